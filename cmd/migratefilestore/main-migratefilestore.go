@@ -0,0 +1,64 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// copies all block files from one filestore backend to another
+// wave must not be running, the source backend is left unchanged
+//
+//	go run cmd/migratefilestore/main-migratefilestore.go -from sqlite -to directory [-dir path] [-datadir path]
+//
+// after migrating, set "filestore:backend" (and "filestore:dir") in settings.json and restart wave
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/wavetermdev/waveterm/pkg/filestore"
+	"github.com/wavetermdev/waveterm/pkg/wavebase"
+)
+
+func main() {
+	dataDir := flag.String("datadir", os.Getenv(wavebase.WaveDataHomeEnvVar), "wave data directory (defaults to $"+wavebase.WaveDataHomeEnvVar+")")
+	from := flag.String("from", filestore.Backend_SQLite, "source backend (sqlite or directory)")
+	to := flag.String("to", filestore.Backend_Directory, "destination backend (sqlite or directory)")
+	dir := flag.String("dir", "", "directory for the directory backend (defaults to db/filestore in the data directory)")
+	flag.Parse()
+	err := migrate(*dataDir, *from, *to, *dir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func migrate(dataDir string, from string, to string, dir string) error {
+	if dataDir == "" {
+		return fmt.Errorf("-datadir is required (or set $%s)", wavebase.WaveDataHomeEnvVar)
+	}
+	wavebase.DataHome_VarCache = dataDir
+	waveLock, err := wavebase.AcquireWaveLock()
+	if err != nil {
+		return fmt.Errorf("cannot acquire wave lock (wave must not be running): %w", err)
+	}
+	defer waveLock.Close()
+	err = wavebase.EnsureWaveDBDir()
+	if err != nil {
+		return err
+	}
+	filestore.SetBackendConfig(filestore.BackendConfig{Type: from, Dir: dir})
+	err = filestore.InitFilestore()
+	if err != nil {
+		return fmt.Errorf("error opening source backend: %w", err)
+	}
+	dst, err := filestore.MakeBackend(filestore.BackendConfig{Type: to, Dir: dir})
+	if err != nil {
+		return fmt.Errorf("error opening destination backend: %w", err)
+	}
+	stats, err := filestore.MigrateBackend(context.Background(), filestore.GetBackend(), dst)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("migrated %d zones, %d files, %d parts from %s to %s\n", stats.NumZones, stats.NumFiles, stats.NumParts, from, to)
+	return nil
+}
@@ -22,6 +22,7 @@ import (
 	"github.com/wavetermdev/waveterm/pkg/remote/conncontroller"
 	"github.com/wavetermdev/waveterm/pkg/service"
 	"github.com/wavetermdev/waveterm/pkg/telemetry"
+	"github.com/wavetermdev/waveterm/pkg/termsearch"
 	"github.com/wavetermdev/waveterm/pkg/util/shellutil"
 	"github.com/wavetermdev/waveterm/pkg/wavebase"
 	"github.com/wavetermdev/waveterm/pkg/waveobj"
@@ -30,6 +31,7 @@ import (
 	"github.com/wavetermdev/waveterm/pkg/wcore"
 	"github.com/wavetermdev/waveterm/pkg/web"
 	"github.com/wavetermdev/waveterm/pkg/wps"
+	"github.com/wavetermdev/waveterm/pkg/wps/wpsstore"
 	"github.com/wavetermdev/waveterm/pkg/wshrpc"
 	"github.com/wavetermdev/waveterm/pkg/wshrpc/wshremote"
 	"github.com/wavetermdev/waveterm/pkg/wshrpc/wshserver"
@@ -58,6 +60,8 @@ func doShutdown(reason string) {
 		sendTelemetryWrapper()
 		// TODO deal with flush in progress
 		clearTempFiles()
+		termsearch.FlushIndex(ctx)
+		wpsstore.FlushEvents(ctx)
 		filestore.WFS.FlushCache(ctx)
 		watcher := wconfig.GetWatcher()
 		if watcher != nil {
@@ -172,6 +176,12 @@ func shutdownActivityUpdate() {
 
 func createMainWshClient() {
 	rpc := wshserver.GetMainRpcClient()
+	wshutil.DefaultRouter.SetTraceName(wshutil.DefaultRoute)
+	wshutil.ScopeBlockTabResolver = func(blockId string) (string, error) {
+		ctx, cancelFn := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancelFn()
+		return wstore.DBFindTabForBlockId(ctx, blockId)
+	}
 	wshutil.DefaultRouter.RegisterRoute(wshutil.DefaultRoute, rpc, true)
 	wps.Broker.SetClient(wshutil.DefaultRouter)
 	localConnWsh := wshutil.MakeWshRpc(nil, nil, wshrpc.RpcContext{Conn: wshrpc.LocalConnName}, &wshremote.ServerImpl{})
@@ -206,6 +216,27 @@ func clearTempFiles() error {
 	return nil
 }
 
+func applyQuotaSettings(fullConfig wconfig.FullConfigType) {
+	settings := fullConfig.Settings
+	filestore.SetQuotaConfig(filestore.MakeQuotaConfig(settings.FileStoreZoneMaxBytes, settings.FileStoreTotalMaxBytes))
+}
+
+func applyDebugSettings(fullConfig wconfig.FullConfigType) {
+	wshutil.DefaultRouter.SetTraceAlwaysOn(fullConfig.Settings.DebugRpcTrace)
+}
+
+// runs at startup (also available on demand with "wsh debug storage --gc")
+func collectOrphanZones() {
+	defer panichandler.PanicHandler("collectOrphanZones")
+	// the first run converts the filestore db to incremental vacuum, which rewrites the whole db
+	ctx, cancelFn := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancelFn()
+	_, err := wcore.CollectOrphanZones(ctx)
+	if err != nil {
+		log.Printf("error collecting orphan zones: %v\n", err)
+	}
+}
+
 func main() {
 	log.SetFlags(log.LstdFlags | log.Lmicroseconds)
 	log.SetPrefix("[wavesrv] ")
@@ -258,6 +289,15 @@ func main() {
 	log.Printf("wave version: %s (%s)\n", WaveVersion, BuildTime)
 	log.Printf("wave data dir: %s\n", wavebase.GetWaveDataDir())
 	log.Printf("wave config dir: %s\n", wavebase.GetWaveConfigDir())
+	fullConfig := wconfig.ReadFullConfig()
+	settings := fullConfig.Settings
+	filestore.SetBackendConfig(filestore.BackendConfig{Type: settings.FileStoreBackend, Dir: settings.FileStoreDir})
+	applyQuotaSettings(fullConfig)
+	applyDebugSettings(fullConfig)
+	if watcher := wconfig.GetWatcher(); watcher != nil {
+		watcher.RegisterUpdateHandler(applyQuotaSettings)
+		watcher.RegisterUpdateHandler(applyDebugSettings)
+	}
 	err = filestore.InitFilestore()
 	if err != nil {
 		log.Printf("error initializing filestore: %v\n", err)
@@ -268,6 +308,16 @@ func main() {
 		log.Printf("error initializing wstore: %v\n", err)
 		return
 	}
+	err = termsearch.InitTermSearch()
+	if err != nil {
+		log.Printf("error initializing terminal search: %v\n", err)
+		return
+	}
+	err = wpsstore.InitEventStore()
+	if err != nil {
+		// event history is kept in memory only
+		log.Printf("error initializing event store: %v\n", err)
+	}
 	panichandler.PanicTelemetryHandler = panicTelemetryHandler
 	go func() {
 		defer panichandler.PanicHandler("InitCustomShellStartupFiles")
@@ -286,7 +336,9 @@ func main() {
 		log.Printf("error clearing temp files: %v\n", err)
 		return
 	}
+	go collectOrphanZones()
 
+	conncontroller.RegisterReconnectHandler(blockcontroller.ResyncConnBlocks)
 	createMainWshClient()
 	installShutdownSignalHandlers()
 	startupActivityUpdate()
@@ -16,7 +16,7 @@ import (
 var connCmd = &cobra.Command{
 	Use:   "conn",
 	Short: "manage Wave Terminal connections",
-	Long:  "Commands to manage Wave Terminal SSH and WSL connections",
+	Long:  "Commands to manage Wave Terminal connections (SSH, WSL, docker://container, podman://container, and k8s://namespace/pod[/container])",
 }
 
 var connStatusCmd = &cobra.Command{
@@ -67,6 +67,43 @@ var connEnsureCmd = &cobra.Command{
 	PreRunE: preRunSetupRpcClient,
 }
 
+var connForwardCmd = &cobra.Command{
+	Use:   "forward",
+	Short: "manage ssh port forwards for a connection",
+}
+
+var connForwardListCmd = &cobra.Command{
+	Use:     "list [CONNECTION]",
+	Short:   "list port forwards (for all connections if none is given)",
+	Args:    cobra.MaximumNArgs(1),
+	RunE:    connForwardListRun,
+	PreRunE: preRunSetupRpcClient,
+}
+
+var connForwardAddCmd = &cobra.Command{
+	Use:     "add CONNECTION (-L|-R|-D) SPEC",
+	Short:   "add a port forward to a connected connection",
+	Long:    "Add a port forward to a connected connection. SPEC uses the same format as ssh -L/-R/-D.",
+	Example: "  wsh conn forward add user@host -L 5432:localhost:5432\n  wsh conn forward add user@host -R 8080:localhost:3000\n  wsh conn forward add user@host -D 1080",
+	Args:    cobra.ExactArgs(1),
+	RunE:    connForwardAddRun,
+	PreRunE: preRunSetupRpcClient,
+}
+
+var connForwardRemoveCmd = &cobra.Command{
+	Use:     "remove CONNECTION FORWARDID",
+	Short:   "remove a port forward (FORWARDID can be a unique prefix)",
+	Args:    cobra.ExactArgs(2),
+	RunE:    connForwardRemoveRun,
+	PreRunE: preRunSetupRpcClient,
+}
+
+var (
+	connForwardLocal   string
+	connForwardRemote  string
+	connForwardDynamic string
+)
+
 func init() {
 	rootCmd.AddCommand(connCmd)
 	connCmd.AddCommand(connStatusCmd)
@@ -75,14 +112,31 @@ func init() {
 	connCmd.AddCommand(connDisconnectAllCmd)
 	connCmd.AddCommand(connConnectCmd)
 	connCmd.AddCommand(connEnsureCmd)
+	connCmd.AddCommand(connForwardCmd)
+	connForwardCmd.AddCommand(connForwardListCmd)
+	connForwardCmd.AddCommand(connForwardAddCmd)
+	connForwardCmd.AddCommand(connForwardRemoveCmd)
+	connForwardAddCmd.Flags().StringVarP(&connForwardLocal, "local", "L", "", "local forward ([bind_address:]port:host:hostport)")
+	connForwardAddCmd.Flags().StringVarP(&connForwardRemote, "remote", "R", "", "remote forward ([bind_address:]port:host:hostport)")
+	connForwardAddCmd.Flags().StringVarP(&connForwardDynamic, "dynamic", "D", "", "dynamic (socks5) forward ([bind_address:]port)")
+	connForwardAddCmd.MarkFlagsOneRequired("local", "remote", "dynamic")
+	connForwardAddCmd.MarkFlagsMutuallyExclusive("local", "remote", "dynamic")
 }
 
 func validateConnectionName(name string) error {
-	if !strings.HasPrefix(name, "wsl://") {
-		_, err := remote.ParseOpts(name)
+	if strings.HasPrefix(name, "wsl://") {
+		return nil
+	}
+	if strings.Contains(name, "://") {
+		_, err := remote.ParseExecConnName(name)
 		if err != nil {
-			return fmt.Errorf("cannot parse connection name: %w", err)
+			return fmt.Errorf("cannot parse connection name: %w (supported schemes: wsl, %s)", err, strings.Join(remote.GetConnProviderSchemes(), ", "))
 		}
+		return nil
+	}
+	_, err := remote.ParseOpts(name)
+	if err != nil {
+		return fmt.Errorf("cannot parse connection name: %w", err)
 	}
 	return nil
 }
@@ -187,3 +241,112 @@ func connEnsureRun(cmd *cobra.Command, args []string) error {
 	WriteStdout("wsh ensured on connection %q\n", connName)
 	return nil
 }
+
+func printConnForwards(connName string, forwards []wshrpc.ConnForward) {
+	for _, fwd := range forwards {
+		target := fwd.TargetAddr
+		if fwd.Type == wshrpc.ConnForwardType_Dynamic {
+			target = "(socks5)"
+		}
+		str := fmt.Sprintf("%-30s %-8s %-8s %-22s %-22s %-7s %d", connName, fwd.ForwardId[:8], fwd.Type, fwd.BindAddr, target, fwd.Status, fwd.NumConns)
+		if fwd.Error != "" {
+			str += fmt.Sprintf(" (%s)", fwd.Error)
+		}
+		WriteStdout("%s\n", str)
+	}
+}
+
+func connForwardListRun(cmd *cobra.Command, args []string) error {
+	forwardMap := make(map[string][]wshrpc.ConnForward)
+	var connNames []string
+	if len(args) > 0 {
+		connName := args[0]
+		if err := validateConnectionName(connName); err != nil {
+			return err
+		}
+		forwards, err := wshclient.ConnForwardListCommand(RpcClient, connName, nil)
+		if err != nil {
+			return fmt.Errorf("listing forwards: %w", err)
+		}
+		forwardMap[connName] = forwards
+		connNames = append(connNames, connName)
+	} else {
+		resp, err := wshclient.ConnStatusCommand(RpcClient, nil)
+		if err != nil {
+			return fmt.Errorf("getting connection status: %w", err)
+		}
+		for _, conn := range resp {
+			if len(conn.Forwards) == 0 {
+				continue
+			}
+			forwardMap[conn.Connection] = conn.Forwards
+			connNames = append(connNames, conn.Connection)
+		}
+	}
+	numForwards := 0
+	for _, forwards := range forwardMap {
+		numForwards += len(forwards)
+	}
+	if numForwards == 0 {
+		WriteStdout("no port forwards\n")
+		return nil
+	}
+	WriteStdout("%-30s %-8s %-8s %-22s %-22s %-7s %s\n", "connection", "id", "type", "bind", "target", "status", "conns")
+	for _, connName := range connNames {
+		printConnForwards(connName, forwardMap[connName])
+	}
+	return nil
+}
+
+func connForwardAddRun(cmd *cobra.Command, args []string) error {
+	connName := args[0]
+	if err := validateConnectionName(connName); err != nil {
+		return err
+	}
+	data := wshrpc.CommandConnForwardAddData{ConnName: connName}
+	if connForwardLocal != "" {
+		data.Type = wshrpc.ConnForwardType_Local
+		data.Spec = connForwardLocal
+	} else if connForwardRemote != "" {
+		data.Type = wshrpc.ConnForwardType_Remote
+		data.Spec = connForwardRemote
+	} else {
+		data.Type = wshrpc.ConnForwardType_Dynamic
+		data.Spec = connForwardDynamic
+	}
+	fwd, err := wshclient.ConnForwardAddCommand(RpcClient, data, &wshrpc.RpcOpts{Timeout: 10000})
+	if err != nil {
+		return fmt.Errorf("adding forward: %w", err)
+	}
+	WriteStdout("added %s forward %s on %q (id %s)\n", fwd.Type, fwd.BindAddr, connName, fwd.ForwardId[:8])
+	return nil
+}
+
+func connForwardRemoveRun(cmd *cobra.Command, args []string) error {
+	connName := args[0]
+	if err := validateConnectionName(connName); err != nil {
+		return err
+	}
+	forwards, err := wshclient.ConnForwardListCommand(RpcClient, connName, nil)
+	if err != nil {
+		return fmt.Errorf("listing forwards: %w", err)
+	}
+	var matches []string
+	for _, fwd := range forwards {
+		if strings.HasPrefix(fwd.ForwardId, args[1]) {
+			matches = append(matches, fwd.ForwardId)
+		}
+	}
+	if len(matches) == 0 {
+		return fmt.Errorf("forward %q not found on %q", args[1], connName)
+	}
+	if len(matches) > 1 {
+		return fmt.Errorf("forward id %q is ambiguous", args[1])
+	}
+	err = wshclient.ConnForwardRemoveCommand(RpcClient, wshrpc.CommandConnForwardRemoveData{ConnName: connName, ForwardId: matches[0]}, &wshrpc.RpcOpts{Timeout: 10000})
+	if err != nil {
+		return fmt.Errorf("removing forward: %w", err)
+	}
+	WriteStdout("removed forward %s from %q\n", matches[0][:8], connName)
+	return nil
+}
@@ -53,9 +53,10 @@ func MakeRemoteUnixListener() (net.Listener, error) {
 func handleNewListenerConn(conn net.Conn, router *wshutil.WshRouter) {
 	var routeIdContainer atomic.Pointer[string]
 	proxy := wshutil.MakeRpcProxy()
+	binFrames := wshutil.MakeStreamBinFrames(false)
 	go func() {
 		defer panichandler.PanicHandler("handleNewListenerConn:AdaptOutputChToStream")
-		writeErr := wshutil.AdaptOutputChToStream(proxy.ToRemoteCh, conn)
+		writeErr := wshutil.AdaptOutputChToStream(proxy.ToRemoteCh, conn, binFrames)
 		if writeErr != nil {
 			log.Printf("error writing to domain socket: %v\n", writeErr)
 		}
@@ -80,7 +81,7 @@ func handleNewListenerConn(conn net.Conn, router *wshutil.WshRouter) {
 				router.InjectMessage(disposeBytes, *routeIdPtr)
 			}
 		}()
-		wshutil.AdaptStreamToMsgCh(conn, proxy.FromRemoteCh)
+		wshutil.AdaptStreamToMsgCh(conn, proxy.FromRemoteCh, binFrames)
 	}()
 	routeId, err := proxy.HandleClientProxyAuth(router)
 	if err != nil {
@@ -120,13 +121,14 @@ func setupConnServerRpcClientWithRouter(router *wshutil.WshRouter) (*wshutil.Wsh
 	if err != nil {
 		return nil, fmt.Errorf("error extracting rpc context from %s: %v", wshutil.WaveJwtTokenVarName, err)
 	}
+	router.SetTraceName("connserver:" + rpcCtx.Conn)
 	authRtn, err := router.HandleProxyAuth(jwtToken)
 	if err != nil {
 		return nil, fmt.Errorf("error handling proxy auth: %v", err)
 	}
 	inputCh := make(chan []byte, wshutil.DefaultInputChSize)
 	outputCh := make(chan []byte, wshutil.DefaultOutputChSize)
-	connServerClient := wshutil.MakeWshRpc(inputCh, outputCh, *rpcCtx, &wshremote.ServerImpl{LogWriter: os.Stdout})
+	connServerClient := wshutil.MakeWshRpc(inputCh, outputCh, *rpcCtx, &wshremote.ServerImpl{LogWriter: os.Stdout, Router: router})
 	connServerClient.SetAuthToken(authRtn.AuthToken)
 	router.RegisterRoute(authRtn.RouteId, connServerClient, false)
 	wshclient.RouteAnnounceCommand(connServerClient, nil)
@@ -155,7 +157,7 @@ func serverRunRouter() error {
 	go func() {
 		for msg := range termProxy.FromRemoteCh {
 			// send this to the router
-			router.InjectMessage(msg, wshutil.UpstreamRoute)
+			router.InjectMessage(wshutil.RebaseRemoteDeadline(msg), wshutil.UpstreamRoute)
 		}
 	}()
 	router.SetUpstreamClient(termProxy)
@@ -0,0 +1,128 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc/wshclient"
+	"github.com/wavetermdev/waveterm/pkg/wshutil"
+)
+
+var debugRpcTraceCmd = &cobra.Command{
+	Use:   "rpctrace",
+	Short: "show rpc messages as they pass through the wavesrv and connserver routers",
+	Long: `Show rpc messages as they pass through the wavesrv router (and the connserver routers for --conn, which defaults to the current connection).
+Responses show the time since their request passed through the same router, so comparing the routers shows the latency of each hop.
+Messages are only recorded while a trace is running, unless the "debug:rpctrace" setting is on (then --history shows the recent messages).`,
+	Args: cobra.NoArgs,
+	RunE: debugRpcTraceRun,
+}
+
+var (
+	debugRpcTraceCommand string
+	debugRpcTraceRoute   string
+	debugRpcTraceConns   []string
+	debugRpcTraceHistory bool
+	debugRpcTraceJson    bool
+)
+
+func init() {
+	debugRpcTraceCmd.Flags().StringVar(&debugRpcTraceCommand, "command", "", "only show messages for this command (including its responses)")
+	debugRpcTraceCmd.Flags().StringVar(&debugRpcTraceRoute, "route", "", "only show messages to or from this route")
+	debugRpcTraceCmd.Flags().StringArrayVarP(&debugRpcTraceConns, "conn", "c", nil, "also trace the connserver router for this connection (can be repeated)")
+	debugRpcTraceCmd.Flags().BoolVar(&debugRpcTraceHistory, "history", false, "show the buffered messages first")
+	debugRpcTraceCmd.Flags().BoolVar(&debugRpcTraceJson, "json", false, "output as newline-delimited json")
+	debugCmd.AddCommand(debugRpcTraceCmd)
+}
+
+func formatRpcTraceEntry(entry wshrpc.RpcTraceEntry) string {
+	id := entry.ReqId
+	kind := "req"
+	if entry.ResId != "" {
+		id = entry.ResId
+		kind = "res"
+	} else if entry.Command == "" {
+		kind = "cont"
+	}
+	if len(id) > 8 {
+		id = id[:8]
+	}
+	rtn := fmt.Sprintf("%s %-24s %-4s %-20s %-8s %s -> %s (from %s) %db",
+		time.UnixMilli(entry.Ts).Format("15:04:05.000"), entry.Router, kind, entry.Command, id, entry.Source, entry.Route, entry.FromRoute, entry.Size)
+	if entry.LatencyUs > 0 {
+		rtn += fmt.Sprintf(" %s", time.Duration(entry.LatencyUs)*time.Microsecond)
+	}
+	if entry.Cont {
+		rtn += " [cont]"
+	}
+	if entry.Error != "" {
+		rtn += fmt.Sprintf(" error=%q", entry.Error)
+	}
+	if entry.Dropped > 0 {
+		rtn += fmt.Sprintf(" (%d dropped)", entry.Dropped)
+	}
+	return rtn
+}
+
+func debugRpcTraceRun(cmd *cobra.Command, args []string) error {
+	conns := debugRpcTraceConns
+	if len(conns) == 0 && RpcContext.Conn != "" && RpcContext.Conn != wshrpc.LocalConnName {
+		conns = []string{RpcContext.Conn}
+	}
+	routes := []string{wshutil.DefaultRoute}
+	for _, conn := range conns {
+		routes = append(routes, wshutil.MakeConnectionRouteId(conn))
+	}
+	traceData := wshrpc.CommandRpcTraceData{Command: debugRpcTraceCommand, Route: debugRpcTraceRoute, History: debugRpcTraceHistory}
+	type traceResp struct {
+		Route string
+		Resp  wshrpc.RespOrErrorUnion[wshrpc.RpcTraceEntry]
+	}
+	respCh := make(chan traceResp)
+	doneCh := make(chan string)
+	var allOpts []*wshrpc.RpcOpts
+	for _, route := range routes {
+		opts := &wshrpc.RpcOpts{Timeout: FileFollowTimeout, Route: route}
+		allOpts = append(allOpts, opts)
+		rtnCh := wshclient.RpcTraceCommand(RpcClient, traceData, opts)
+		go func(route string) {
+			for resp := range rtnCh {
+				respCh <- traceResp{Route: route, Resp: resp}
+			}
+			doneCh <- route
+		}(route)
+	}
+	sigCh, stopFn := notifyInterrupt()
+	defer stopFn()
+	numActive := len(routes)
+	for numActive > 0 {
+		select {
+		case <-sigCh:
+			cancelStreams(allOpts...)
+			return nil
+		case <-doneCh:
+			numActive--
+		case resp := <-respCh:
+			if resp.Resp.Error != nil {
+				WriteStderr("[rpctrace] %s: %v\n", resp.Route, resp.Resp.Error)
+				continue
+			}
+			if debugRpcTraceJson {
+				barr, err := json.Marshal(resp.Resp.Response)
+				if err != nil {
+					return fmt.Errorf("marshaling json: %w", err)
+				}
+				WriteStdout("%s\n", string(barr))
+				continue
+			}
+			WriteStdout("%s\n", formatRpcTraceEntry(resp.Resp.Response))
+		}
+	}
+	return nil
+}
@@ -5,8 +5,11 @@ package cmd
 
 import (
 	"encoding/json"
+	"fmt"
+	"time"
 
 	"github.com/spf13/cobra"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
 	"github.com/wavetermdev/waveterm/pkg/wshrpc/wshclient"
 )
 
@@ -24,8 +27,29 @@ var debugBlockIdsCmd = &cobra.Command{
 	Hidden: true,
 }
 
+var debugStorageCmd = &cobra.Command{
+	Use:   "storage",
+	Short: "show filestore usage (per zone and file) and orphan zones",
+	Long: `Show filestore usage per zone (largest first) and zones that are not owned by any block, tab, or workspace.
+Use --gc to delete orphan zones and vacuum the filestore db before reporting (this also runs at startup).`,
+	Args: cobra.NoArgs,
+	RunE: debugStorageRun,
+}
+
+var (
+	debugStorageGC    bool
+	debugStorageFiles bool
+	debugStorageLimit int
+	debugStorageJson  bool
+)
+
 func init() {
 	debugCmd.AddCommand(debugBlockIdsCmd)
+	debugStorageCmd.Flags().BoolVar(&debugStorageGC, "gc", false, "delete orphan zones and vacuum before reporting")
+	debugStorageCmd.Flags().BoolVar(&debugStorageFiles, "files", false, "show the files in each zone")
+	debugStorageCmd.Flags().IntVarP(&debugStorageLimit, "limit", "n", 20, "maximum number of zones to show (0 for all)")
+	debugStorageCmd.Flags().BoolVar(&debugStorageJson, "json", false, "output as json")
+	debugCmd.AddCommand(debugStorageCmd)
 	rootCmd.AddCommand(debugCmd)
 }
 
@@ -45,3 +69,48 @@ func debugBlockIdsRun(cmd *cobra.Command, args []string) error {
 	WriteStdout("%s\n", string(barr))
 	return nil
 }
+
+func debugStorageRun(cmd *cobra.Command, args []string) error {
+	report, err := wshclient.StorageReportCommand(RpcClient, wshrpc.CommandStorageReportData{GC: debugStorageGC}, &wshrpc.RpcOpts{Timeout: 300000})
+	if err != nil {
+		return fmt.Errorf("getting storage report: %w", err)
+	}
+	if debugStorageJson {
+		barr, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return fmt.Errorf("marshaling json: %w", err)
+		}
+		WriteStdout("%s\n", string(barr))
+		return nil
+	}
+	WriteStdout("backend:     %s\n", report.Backend)
+	WriteStdout("db:          %d bytes (%d free)\n", report.DBFileSize, report.DBFreeBytes)
+	WriteStdout("zones:       %d (size %d, disksize %d)\n", len(report.Zones), report.Size, report.DiskSize)
+	WriteStdout("orphans:     %d (disksize %d)\n", report.NumOrphans, report.OrphanDiskSize)
+	if report.LastGC != nil {
+		gc := report.LastGC
+		WriteStdout("last gc:     %s, deleted %d of %d zones (%d files), reclaimed %d bytes, vacuum %d bytes\n",
+			time.UnixMilli(gc.Ts).Format(time.DateTime), gc.NumOrphans, gc.NumZones, gc.NumFiles, gc.ReclaimedBytes, gc.VacuumBytes)
+	}
+	if len(report.Zones) == 0 {
+		return nil
+	}
+	WriteStdout("\n%-36s %-9s %5s %12s %12s\n", "zone", "type", "files", "size", "disksize")
+	for idx, zone := range report.Zones {
+		if debugStorageLimit > 0 && idx >= debugStorageLimit {
+			WriteStdout("(%d more zones)\n", len(report.Zones)-idx)
+			break
+		}
+		otype := zone.OType
+		if zone.Orphan {
+			otype = "orphan"
+		}
+		WriteStdout("%-36s %-9s %5d %12d %12d\n", zone.ZoneId, otype, len(zone.Files), zone.Size, zone.DiskSize)
+		if debugStorageFiles {
+			for _, file := range zone.Files {
+				WriteStdout("  %-44s %12d %12d\n", file.Name, file.Size, file.DiskSize)
+			}
+		}
+	}
+	return nil
+}
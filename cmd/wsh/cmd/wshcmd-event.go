@@ -0,0 +1,217 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/wavetermdev/waveterm/pkg/wps"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc/wshclient"
+)
+
+var eventScopes []string
+var eventPersist int
+var eventFilter string
+var eventInterval time.Duration
+var eventCount int
+var eventHistoryCount int
+var eventSince string
+var eventUntil string
+
+var eventCmd = &cobra.Command{
+	Use:   "event",
+	Short: "publish, subscribe to, and read the history of wave events",
+	Long: `Commands for wave events (e.g. controllerstatus, connchange, blockclose, or your own event names).
+Events are printed as newline-delimited json. Scopes are used as-is (star matches like "block:*" are allowed for subscriptions), except "this" which is the current block.`,
+}
+
+var eventPubCmd = &cobra.Command{
+	Use:     "pub name [json]",
+	Short:   "publish an event",
+	Example: "  wsh event pub build:done '{\"status\": \"ok\"}'\n  wsh event pub build:done --scope this --persist 10 '{\"status\": \"ok\"}'\n  echo '{\"status\": \"ok\"}' | wsh event pub build:done -",
+	Args:    cobra.RangeArgs(1, 2),
+	RunE:    activityWrap("event", eventPubRun),
+	PreRunE: preRunSetupRpcClient,
+}
+
+var eventSubCmd = &cobra.Command{
+	Use:     "sub name",
+	Short:   "print events as they are published (until killed)",
+	Example: "  wsh event sub controllerstatus\n  wsh event sub controllerstatus --scope this --filter '$.shellprocstatus == \"done\"' -n 1\n  wsh event sub sysinfo --scope local --interval 10s",
+	Args:    cobra.ExactArgs(1),
+	RunE:    activityWrap("event", eventSubRun),
+	PreRunE: preRunSetupRpcClient,
+}
+
+var eventHistoryCmd = &cobra.Command{
+	Use:     "history name",
+	Short:   "print the stored history of an event (for events published with persist)",
+	Example: "  wsh event history connchange\n  wsh event history controllerstatus --scope this --since 1h",
+	Args:    cobra.ExactArgs(1),
+	RunE:    activityWrap("event", eventHistoryRun),
+	PreRunE: preRunSetupRpcClient,
+}
+
+func init() {
+	eventPubCmd.Flags().StringArrayVarP(&eventScopes, "scope", "s", nil, "scope of the event (can be repeated)")
+	eventPubCmd.Flags().IntVar(&eventPersist, "persist", 0, "number of events to keep in the event history (the history is also saved to disk)")
+	eventSubCmd.Flags().StringArrayVarP(&eventScopes, "scope", "s", nil, "only receive events with this scope (can be repeated, default is all scopes)")
+	eventSubCmd.Flags().StringVar(&eventFilter, "filter", "", "only receive events whose data matches this expression (e.g. '$.exitcode != 0')")
+	eventSubCmd.Flags().DurationVar(&eventInterval, "interval", 0, "receive at most one event per interval (other events are dropped)")
+	eventSubCmd.Flags().IntVarP(&eventCount, "count", "n", 0, "exit after receiving this many events")
+	eventHistoryCmd.Flags().StringArrayVarP(&eventScopes, "scope", "s", nil, "only show events with this scope")
+	eventHistoryCmd.Flags().IntVarP(&eventHistoryCount, "count", "n", 20, "maximum number of events to show (most recent)")
+	eventHistoryCmd.Flags().StringVar(&eventSince, "since", "", "only show events after this time (RFC3339, or a duration ago like 1h)")
+	eventHistoryCmd.Flags().StringVar(&eventUntil, "until", "", "only show events before this time (RFC3339, or a duration ago like 1h)")
+
+	eventCmd.AddCommand(eventPubCmd)
+	eventCmd.AddCommand(eventSubCmd)
+	eventCmd.AddCommand(eventHistoryCmd)
+	rootCmd.AddCommand(eventCmd)
+}
+
+func resolveEventScopes(scopes []string) ([]string, error) {
+	var rtn []string
+	for _, scope := range scopes {
+		if scope == "this" {
+			oref, err := resolveSimpleId(scope)
+			if err != nil {
+				return nil, err
+			}
+			scope = oref.String()
+		}
+		rtn = append(rtn, scope)
+	}
+	return rtn, nil
+}
+
+func printEvent(event *wps.WaveEvent) error {
+	barr, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("marshaling event: %w", err)
+	}
+	WriteStdout("%s\n", string(barr))
+	return nil
+}
+
+func eventPubRun(cmd *cobra.Command, args []string) error {
+	scopes, err := resolveEventScopes(eventScopes)
+	if err != nil {
+		return err
+	}
+	// user events are low frequency, so their history is also saved to disk
+	event := wps.WaveEvent{Event: args[0], Scopes: scopes, Persist: eventPersist, Durable: eventPersist > 0}
+	if len(args) > 1 {
+		dataStr := args[1]
+		if dataStr == "-" {
+			barr, err := io.ReadAll(WrappedStdin)
+			if err != nil {
+				return fmt.Errorf("reading stdin: %w", err)
+			}
+			dataStr = string(barr)
+		}
+		err = json.Unmarshal([]byte(dataStr), &event.Data)
+		if err != nil {
+			return fmt.Errorf("event data is not valid json: %w", err)
+		}
+	}
+	err = wshclient.EventPublishCommand(RpcClient, event, &wshrpc.RpcOpts{Timeout: 2000})
+	if err != nil {
+		return fmt.Errorf("publishing event: %w", err)
+	}
+	return nil
+}
+
+func eventSubRun(cmd *cobra.Command, args []string) error {
+	scopes, err := resolveEventScopes(eventScopes)
+	if err != nil {
+		return err
+	}
+	eventName := args[0]
+	// buffered so the rpc client is never blocked by a slow stdout
+	eventCh := make(chan *wps.WaveEvent, 100)
+	RpcClient.EventListener.On(eventName, func(event *wps.WaveEvent) {
+		select {
+		case eventCh <- event:
+		default:
+			WriteStderr("[event] output is falling behind, dropping %s event\n", event.Event)
+		}
+	})
+	subReq := wps.SubscriptionRequest{
+		Event:         eventName,
+		Scopes:        scopes,
+		AllScopes:     len(scopes) == 0,
+		Filter:        eventFilter,
+		MinIntervalMs: eventInterval.Milliseconds(),
+	}
+	err = wshclient.EventSubCommand(RpcClient, subReq, &wshrpc.RpcOpts{Timeout: 2000})
+	if err != nil {
+		return fmt.Errorf("subscribing to %s: %w", eventName, err)
+	}
+	defer wshclient.EventUnsubCommand(RpcClient, eventName, &wshrpc.RpcOpts{Timeout: 1000})
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sigCh)
+	numEvents := 0
+	for {
+		select {
+		case <-sigCh:
+			return nil
+		case event := <-eventCh:
+			err = printEvent(event)
+			if err != nil {
+				return err
+			}
+			numEvents++
+			if eventCount > 0 && numEvents >= eventCount {
+				return nil
+			}
+		}
+	}
+}
+
+func eventHistoryRun(cmd *cobra.Command, args []string) error {
+	scopes, err := resolveEventScopes(eventScopes)
+	if err != nil {
+		return err
+	}
+	if len(scopes) > 1 {
+		return fmt.Errorf("only one --scope can be given for history")
+	}
+	historyData := wshrpc.CommandEventReadHistoryData{Event: args[0], MaxItems: eventHistoryCount}
+	if len(scopes) == 1 {
+		historyData.Scope = scopes[0]
+	}
+	if eventSince != "" {
+		historyData.StartTs, err = parseIJsonTime(eventSince)
+		if err != nil {
+			return err
+		}
+	}
+	if eventUntil != "" {
+		historyData.EndTs, err = parseIJsonTime(eventUntil)
+		if err != nil {
+			return err
+		}
+	}
+	events, err := wshclient.EventReadHistoryCommand(RpcClient, historyData, &wshrpc.RpcOpts{Timeout: 5000})
+	if err != nil {
+		return fmt.Errorf("reading event history: %w", err)
+	}
+	for _, event := range events {
+		err = printEvent(event)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
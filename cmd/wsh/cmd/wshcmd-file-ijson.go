@@ -0,0 +1,174 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"strconv"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/wavetermdev/waveterm/pkg/ijson"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc/wshclient"
+)
+
+var fileIJsonCmd = &cobra.Command{
+	Use:   "ijson",
+	Short: "inspect and undo changes to ijson files",
+	Long: `Commands for ijson (incremental json) files, which store a document as a log of commands (used by VDom apps).
+Commands are numbered, and the most recent ones are kept when the file is compacted so the document can be read as of an earlier command or rolled back.`,
+}
+
+var fileIJsonLogCmd = &cobra.Command{
+	Use:     "log wavefile://zone/file",
+	Short:   "list the commands stored in an ijson file",
+	Example: "  wsh file ijson log wavefile://block/vdom",
+	Args:    cobra.ExactArgs(1),
+	RunE:    activityWrap("file", fileIJsonLogRun),
+	PreRunE: preRunSetupRpcClient,
+}
+
+var fileIJsonAtCmd = &cobra.Command{
+	Use:     "at wavefile://zone/file [idx]",
+	Short:   "print an ijson document as of a command index or time",
+	Example: "  wsh file ijson at wavefile://block/vdom 42\n  wsh file ijson at wavefile://block/vdom --time 10m\n  wsh file ijson at wavefile://block/vdom --time 2024-12-01T15:04:05Z",
+	Args:    cobra.RangeArgs(1, 2),
+	RunE:    activityWrap("file", fileIJsonAtRun),
+	PreRunE: preRunSetupRpcClient,
+}
+
+var fileIJsonUndoCmd = &cobra.Command{
+	Use:     "undo wavefile://zone/file",
+	Short:   "remove the most recent commands from an ijson file",
+	Example: "  wsh file ijson undo wavefile://block/vdom\n  wsh file ijson undo -n 3 wavefile://block/vdom",
+	Args:    cobra.ExactArgs(1),
+	RunE:    activityWrap("file", fileIJsonUndoRun),
+	PreRunE: preRunSetupRpcClient,
+}
+
+func init() {
+	fileIJsonLogCmd.Flags().Bool("json", false, "output the commands as json")
+	fileIJsonAtCmd.Flags().String("time", "", "read the document as of this time (RFC3339, or a duration ago like 10m)")
+	fileIJsonUndoCmd.Flags().IntP("count", "n", 1, "number of commands to undo")
+
+	fileIJsonCmd.AddCommand(fileIJsonLogCmd)
+	fileIJsonCmd.AddCommand(fileIJsonAtCmd)
+	fileIJsonCmd.AddCommand(fileIJsonUndoCmd)
+	fileCmd.AddCommand(fileIJsonCmd)
+}
+
+func resolveIJsonFileArg(fileArg string) (*wshrpc.CommandFileData, error) {
+	ref, err := parseWaveFileURL(fileArg)
+	if err != nil {
+		return nil, err
+	}
+	fullORef, err := resolveWaveFile(ref)
+	if err != nil {
+		return nil, err
+	}
+	return &wshrpc.CommandFileData{ZoneId: fullORef.OID, FileName: ref.fileName}, nil
+}
+
+func convertIJsonErr(fileArg string, err error) error {
+	err = convertNotFoundErr(err)
+	if err == fs.ErrNotExist {
+		return fmt.Errorf("%s: no such file", fileArg)
+	}
+	return err
+}
+
+func fileIJsonLogRun(cmd *cobra.Command, args []string) error {
+	fileData, err := resolveIJsonFileArg(args[0])
+	if err != nil {
+		return err
+	}
+	commands, err := wshclient.FileIJsonLogCommand(RpcClient, *fileData, &wshrpc.RpcOpts{Timeout: fileTimeout})
+	if err != nil {
+		return convertIJsonErr(args[0], err)
+	}
+	if jsonOut, _ := cmd.Flags().GetBool("json"); jsonOut {
+		barr, err := json.MarshalIndent(commands, "", "  ")
+		if err != nil {
+			return fmt.Errorf("marshaling json: %w", err)
+		}
+		WriteStdout("%s\n", string(barr))
+		return nil
+	}
+	for _, command := range commands {
+		tsStr := "-"
+		if ts := ijson.GetCommandTs(command); ts > 0 {
+			tsStr = time.UnixMilli(ts).Format(time.DateTime)
+		}
+		path, _ := command["path"].([]any)
+		dataSize := 0
+		if data, ok := command["data"]; ok {
+			barr, _ := json.Marshal(data)
+			dataSize = len(barr)
+		}
+		WriteStdout("%6d  %s  %-6v  %s (%d bytes)\n", ijson.GetCommandIdx(command), tsStr, command["type"], ijson.FormatPath(path), dataSize)
+	}
+	return nil
+}
+
+// accepts RFC3339 times or durations (which are relative to now)
+func parseIJsonTime(timeStr string) (int64, error) {
+	if dur, err := time.ParseDuration(timeStr); err == nil {
+		return time.Now().Add(-dur).UnixMilli(), nil
+	}
+	t, err := time.Parse(time.RFC3339, timeStr)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q (use RFC3339 or a duration like 10m)", timeStr)
+	}
+	return t.UnixMilli(), nil
+}
+
+func fileIJsonAtRun(cmd *cobra.Command, args []string) error {
+	fileData, err := resolveIJsonFileArg(args[0])
+	if err != nil {
+		return err
+	}
+	atData := wshrpc.CommandFileIJsonAtData{ZoneId: fileData.ZoneId, FileName: fileData.FileName}
+	timeStr, _ := cmd.Flags().GetString("time")
+	if len(args) > 1 {
+		atData.Idx, err = strconv.Atoi(args[1])
+		if err != nil || atData.Idx <= 0 {
+			return fmt.Errorf("invalid command index %q", args[1])
+		}
+	} else if timeStr != "" {
+		atData.Ts, err = parseIJsonTime(timeStr)
+		if err != nil {
+			return err
+		}
+	} else {
+		return fmt.Errorf("a command index or --time is required")
+	}
+	rtn, err := wshclient.FileIJsonAtCommand(RpcClient, atData, &wshrpc.RpcOpts{Timeout: fileTimeout})
+	if err != nil {
+		return convertIJsonErr(args[0], err)
+	}
+	barr, err := json.MarshalIndent(rtn.Data, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshaling json: %w", err)
+	}
+	WriteStdout("%s\n", string(barr))
+	return nil
+}
+
+func fileIJsonUndoRun(cmd *cobra.Command, args []string) error {
+	fileData, err := resolveIJsonFileArg(args[0])
+	if err != nil {
+		return err
+	}
+	count, _ := cmd.Flags().GetInt("count")
+	undoData := wshrpc.CommandFileIJsonUndoData{ZoneId: fileData.ZoneId, FileName: fileData.FileName, Count: count}
+	lastIdx, err := wshclient.FileIJsonUndoCommand(RpcClient, undoData, &wshrpc.RpcOpts{Timeout: fileTimeout})
+	if err != nil {
+		return convertIJsonErr(args[0], err)
+	}
+	WriteStdout("undid %d command(s), last command is now %d\n", count, lastIdx)
+	return nil
+}
@@ -5,11 +5,14 @@ package cmd
 
 import (
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"io"
 	"io/fs"
+	"os"
 	"strings"
 
+	"github.com/wavetermdev/waveterm/pkg/filestore"
 	"github.com/wavetermdev/waveterm/pkg/wshrpc"
 	"github.com/wavetermdev/waveterm/pkg/wshrpc/wshclient"
 )
@@ -83,13 +86,63 @@ func streamWriteToWaveFile(fileData wshrpc.CommandFileData, reader io.Reader) er
 
 		err = wshclient.FileAppendCommand(RpcClient, appendData, &wshrpc.RpcOpts{Timeout: fileTimeout})
 		if err != nil {
-			return fmt.Errorf("appending chunk to file: %w", err)
+			return fileAppendError(err)
 		}
 	}
 
 	return nil
 }
 
+func fileAppendError(err error) error {
+	if errors.Is(err, filestore.ErrQuotaExceeded) {
+		return fmt.Errorf("storage quota exceeded (see filestore:zonemaxbytes and filestore:totalmaxbytes): %w", err)
+	}
+	return fmt.Errorf("appending to file: %w", err)
+}
+
+// streams the file with FileStreamCommand, when following this runs until the file is deleted or wsh is interrupted
+func streamFromWaveFile(streamData wshrpc.CommandFileStreamData, writer io.Writer) error {
+	timeout := fileTimeout
+	if streamData.Follow {
+		timeout = FileFollowTimeout
+	}
+	sigCh, stopFn := notifyInterrupt()
+	defer stopFn()
+	opts := &wshrpc.RpcOpts{Timeout: timeout}
+	rtnCh := wshclient.FileStreamCommand(RpcClient, streamData, opts)
+	for {
+		select {
+		case <-sigCh:
+			cancelStreams(opts)
+			return nil
+		case resp, ok := <-rtnCh:
+			if !ok {
+				return nil
+			}
+			if resp.Error != nil {
+				return resp.Error
+			}
+			chunk := resp.Response
+			if chunk.Truncated {
+				fmt.Fprintf(os.Stderr, "wsh: file truncated\n")
+				continue
+			}
+			if chunk.SkipSize > 0 {
+				fmt.Fprintf(os.Stderr, "wsh: skipped %d bytes (overwritten before they could be read)\n", chunk.SkipSize)
+				continue
+			}
+			data, err := base64.StdEncoding.DecodeString(chunk.Data64)
+			if err != nil {
+				return fmt.Errorf("decoding data: %w", err)
+			}
+			_, err = writer.Write(data)
+			if err != nil {
+				return fmt.Errorf("writing data: %w", err)
+			}
+		}
+	}
+}
+
 func streamReadFromWaveFile(fileData wshrpc.CommandFileData, size int64, writer io.Writer) error {
 	const chunkSize = 32 * 1024 // 32KB chunks
 	for offset := int64(0); offset < size; offset += chunkSize {
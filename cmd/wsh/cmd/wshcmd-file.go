@@ -10,6 +10,7 @@ import (
 	"fmt"
 	"io"
 	"io/fs"
+	"math"
 	"net/url"
 	"os"
 	"path"
@@ -32,6 +33,7 @@ const (
 	WaveFilePrefix = "wavefile://"
 
 	DefaultFileTimeout = 5000
+	FileFollowTimeout  = math.MaxInt32 // follow streams run until they are canceled
 )
 
 var fileCmd = &cobra.Command{
@@ -52,6 +54,9 @@ func init() {
 	fileListCmd.Flags().BoolP("one", "1", false, "list one file per line")
 	fileListCmd.Flags().BoolP("files", "f", false, "list files only")
 
+	fileCatCmd.Flags().BoolP("follow", "f", false, "output appended data as the file grows")
+	fileCatCmd.Flags().Int64P("bytes", "c", 0, "output the last N bytes")
+
 	fileCmd.AddCommand(fileListCmd)
 	fileCmd.AddCommand(fileCatCmd)
 	fileCmd.AddCommand(fileWriteCmd)
@@ -111,7 +116,7 @@ var fileListCmd = &cobra.Command{
 var fileCatCmd = &cobra.Command{
 	Use:     "cat wavefile://zone/file",
 	Short:   "display contents of a wave file",
-	Example: "  wsh file cat wavefile://block/config.txt\n  wsh file cat wavefile://client/settings.json",
+	Example: "  wsh file cat wavefile://block/config.txt\n  wsh file cat wavefile://client/settings.json\n  wsh file cat -f -c 4096 wavefile://block/term",
 	Args:    cobra.ExactArgs(1),
 	RunE:    activityWrap("file", fileCatRun),
 	PreRunE: preRunSetupRpcClient,
@@ -176,6 +181,26 @@ func fileCatRun(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
+	follow, _ := cmd.Flags().GetBool("follow")
+	tailBytes, _ := cmd.Flags().GetInt64("bytes")
+	if follow || tailBytes > 0 {
+		streamData := wshrpc.CommandFileStreamData{
+			ZoneId:   fullORef.OID,
+			FileName: ref.fileName,
+			FromEnd:  tailBytes,
+			Follow:   follow,
+		}
+		err = streamFromWaveFile(streamData, os.Stdout)
+		err = convertNotFoundErr(err)
+		if err == fs.ErrNotExist {
+			return fmt.Errorf("%s: no such file", args[0])
+		}
+		if err != nil {
+			return fmt.Errorf("reading file: %w", err)
+		}
+		return nil
+	}
+
 	fileData := wshrpc.CommandFileData{
 		ZoneId:   fullORef.OID,
 		FileName: ref.fileName,
@@ -226,6 +251,15 @@ func fileInfoRun(cmd *cobra.Command, args []string) error {
 
 	WriteStdout("filename: %s\n", info.Name)
 	WriteStdout("size:     %d\n", info.Size)
+	logicalSize := info.Size
+	if info.Opts.Circular && logicalSize > info.Opts.MaxSize {
+		logicalSize = info.Opts.MaxSize
+	}
+	compression := info.Opts.Compression
+	if compression == "" {
+		compression = "none"
+	}
+	WriteStdout("disksize: %d (logical %d, compression %s)\n", info.DiskSize, logicalSize, compression)
 	WriteStdout("ctime:    %s\n", time.Unix(info.CreatedTs/1000, 0).Format(time.DateTime))
 	WriteStdout("mtime:    %s\n", time.Unix(info.ModTs/1000, 0).Format(time.DateTime))
 	if len(info.Meta) > 0 {
@@ -346,7 +380,7 @@ func fileAppendRun(cmd *cobra.Command, args []string) error {
 			fileData.Data64 = base64.StdEncoding.EncodeToString(buf.Bytes())
 			err = wshclient.FileAppendCommand(RpcClient, fileData, &wshrpc.RpcOpts{Timeout: fileTimeout})
 			if err != nil {
-				return fmt.Errorf("appending to file: %w", err)
+				return fileAppendError(err)
 			}
 			remainingSpace -= int64(buf.Len())
 			buf.Reset()
@@ -357,7 +391,7 @@ func fileAppendRun(cmd *cobra.Command, args []string) error {
 		fileData.Data64 = base64.StdEncoding.EncodeToString(buf.Bytes())
 		err = wshclient.FileAppendCommand(RpcClient, fileData, &wshrpc.RpcOpts{Timeout: fileTimeout})
 		if err != nil {
-			return fmt.Errorf("appending to file: %w", err)
+			return fileAppendError(err)
 		}
 	}
 
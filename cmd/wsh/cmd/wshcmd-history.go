@@ -0,0 +1,135 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc/wshclient"
+)
+
+var historyCmd = &cobra.Command{
+	Use:   "history [query]",
+	Short: "search shell command history",
+	Long: `Search the history of commands run in Wave shell blocks (most recent first).
+Commands are tracked with shell integration, so they are only recorded for shells started by Wave.
+Use -b to only show commands from a specific block.`,
+	Example: "  wsh history\n  wsh history make --failed\n  wsh history --conn user@host --json\n  wsh history -b this --since 24h",
+	Args:    cobra.MaximumNArgs(1),
+	RunE:    activityWrap("history", historyRun),
+	PreRunE: preRunSetupRpcClient,
+}
+
+var historyClearCmd = &cobra.Command{
+	Use:     "clear",
+	Short:   "clear shell command history (for all blocks, or for the block given with -b)",
+	Args:    cobra.NoArgs,
+	RunE:    activityWrap("history", historyClearRun),
+	PreRunE: preRunSetupRpcClient,
+}
+
+var (
+	historyConn    string
+	historyFailed  bool
+	historySuccess bool
+	historySince   time.Duration
+	historyLimit   int
+	historyJson    bool
+)
+
+func init() {
+	rootCmd.AddCommand(historyCmd)
+	historyCmd.Flags().StringVarP(&historyConn, "conn", "c", "", "only show commands run on this connection (use \"local\" for local shells)")
+	historyCmd.Flags().BoolVar(&historyFailed, "failed", false, "only show commands that exited with a non-zero exit code")
+	historyCmd.Flags().BoolVar(&historySuccess, "success", false, "only show commands that exited with a zero exit code")
+	historyCmd.Flags().DurationVar(&historySince, "since", 0, "only show commands run within this duration (e.g. 1h, 30m)")
+	historyCmd.Flags().IntVarP(&historyLimit, "limit", "n", 50, "maximum number of commands to show")
+	historyCmd.Flags().BoolVar(&historyJson, "json", false, "output as json")
+	historyCmd.AddCommand(historyClearCmd)
+}
+
+func historyRun(cmd *cobra.Command, args []string) error {
+	if historyFailed && historySuccess {
+		return fmt.Errorf("cannot specify both --failed and --success")
+	}
+	searchData := wshrpc.CommandHistorySearchData{
+		Connection: historyConn,
+		Limit:      historyLimit,
+	}
+	if len(args) > 0 {
+		searchData.Query = args[0]
+	}
+	if historyFailed {
+		searchData.ExitStatus = wshrpc.HistoryExitStatus_Failed
+	}
+	if historySuccess {
+		searchData.ExitStatus = wshrpc.HistoryExitStatus_Success
+	}
+	if historySince > 0 {
+		searchData.Since = time.Now().Add(-historySince).UnixMilli()
+	}
+	if blockArg != "" {
+		fullORef, err := resolveBlockArg()
+		if err != nil {
+			return err
+		}
+		searchData.BlockId = fullORef.OID
+	}
+	items, err := wshclient.HistorySearchCommand(RpcClient, searchData, &wshrpc.RpcOpts{Timeout: 5000})
+	if err != nil {
+		return fmt.Errorf("searching history: %w", err)
+	}
+	if historyJson {
+		if items == nil {
+			items = []*wshrpc.HistoryItem{}
+		}
+		barr, err := json.MarshalIndent(items, "", "  ")
+		if err != nil {
+			return fmt.Errorf("marshaling json: %w", err)
+		}
+		WriteStdout("%s\n", string(barr))
+		return nil
+	}
+	if len(items) == 0 {
+		WriteStdout("no commands found\n")
+		return nil
+	}
+	WriteStdout("%-19s %-5s %-9s %-20s %s\n", "time", "exit", "duration", "connection", "command")
+	for _, item := range items {
+		exitStr := "-"
+		if item.ExitCode != nil {
+			exitStr = fmt.Sprintf("%d", *item.ExitCode)
+		}
+		durationStr := (time.Duration(item.DurationMs) * time.Millisecond).Round(time.Millisecond).String()
+		cmdStr := strings.ReplaceAll(item.CmdStr, "\n", " ")
+		WriteStdout("%-19s %-5s %-9s %-20s %s\n", time.UnixMilli(item.Ts).Format(time.DateTime), exitStr, durationStr, item.Connection, cmdStr)
+	}
+	return nil
+}
+
+func historyClearRun(cmd *cobra.Command, args []string) error {
+	var clearData wshrpc.CommandHistoryClearData
+	if blockArg != "" {
+		fullORef, err := resolveBlockArg()
+		if err != nil {
+			return err
+		}
+		clearData.BlockId = fullORef.OID
+	}
+	err := wshclient.HistoryClearCommand(RpcClient, clearData, &wshrpc.RpcOpts{Timeout: 5000})
+	if err != nil {
+		return fmt.Errorf("clearing history: %w", err)
+	}
+	if clearData.BlockId != "" {
+		WriteStdout("history cleared for block %s\n", clearData.BlockId)
+	} else {
+		WriteStdout("history cleared\n")
+	}
+	return nil
+}
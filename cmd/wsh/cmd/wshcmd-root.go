@@ -7,7 +7,10 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"os/signal"
 	"runtime/debug"
+	"syscall"
+	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/wavetermdev/waveterm/pkg/waveobj"
@@ -154,6 +157,29 @@ func setupRpcClient(serverImpl wshutil.ServerImpl) error {
 	return nil
 }
 
+const streamCancelTimeout = 500 * time.Millisecond
+
+// returns a channel that receives SIGINT and SIGTERM, call the stop func when done (for streaming commands that cancel their streams before exiting)
+func notifyInterrupt() (chan os.Signal, func()) {
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+	return sigCh, func() { signal.Stop(sigCh) }
+}
+
+// cancels the streams on the server and waits for the cancels to be sent (wsh exits right after)
+func cancelStreams(allOpts ...*wshrpc.RpcOpts) {
+	var canceled bool
+	for _, opts := range allOpts {
+		if opts.StreamCancelFn != nil {
+			opts.StreamCancelFn()
+			canceled = true
+		}
+	}
+	if canceled {
+		RpcClient.WaitForOutputDrain(streamCancelTimeout)
+	}
+}
+
 func isFullORef(orefStr string) bool {
 	_, err := waveobj.ParseORef(orefStr)
 	return err == nil
@@ -0,0 +1,150 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/spf13/cobra"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc/wshclient"
+	"github.com/wavetermdev/waveterm/pkg/wshutil"
+)
+
+var rpcListJson bool
+var rpcCallRoute string
+var rpcCallTimeout int
+
+var rpcCmd = &cobra.Command{
+	Use:   "rpc",
+	Short: "list and call wave rpc commands",
+	Long:  `List and call the rpc commands that wsh uses (for scripting things that don't have a wsh command).`,
+}
+
+var rpcListCmd = &cobra.Command{
+	Use:     "list [command]",
+	Short:   "list rpc commands (or show the json schema for one command)",
+	Example: "  wsh rpc list\n  wsh rpc list getmeta",
+	Args:    cobra.MaximumNArgs(1),
+	RunE:    activityWrap("rpc", rpcListRun),
+	PreRunE: preRunSetupRpcClient,
+}
+
+var rpcCallCmd = &cobra.Command{
+	Use:   "call command [json]",
+	Short: "call an rpc command",
+	Long: `Call an rpc command with json data (use "-" to read the data from stdin).
+Responses are printed as json, response streams print one line per response (until the stream ends or wsh is killed).`,
+	Example: "  wsh rpc call getmeta '{\"oref\": \"block:<blockid>\"}'\n  wsh rpc call waveinfo\n  wsh rpc call remotefileinfo '\"~/.bashrc\"' --route conn:user@host",
+	Args:    cobra.RangeArgs(1, 2),
+	RunE:    activityWrap("rpc", rpcCallRun),
+	PreRunE: preRunSetupRpcClient,
+}
+
+func init() {
+	rpcListCmd.Flags().BoolVar(&rpcListJson, "json", false, "output the full command info (with schemas) as json")
+	rpcCallCmd.Flags().StringVar(&rpcCallRoute, "route", "", "route to send the command to (default is wavesrv)")
+	rpcCallCmd.Flags().IntVarP(&rpcCallTimeout, "timeout", "t", 5000, "timeout in milliseconds (for calls, streams run until they finish)")
+	rpcCmd.AddCommand(rpcListCmd)
+	rpcCmd.AddCommand(rpcCallCmd)
+	rootCmd.AddCommand(rpcCmd)
+}
+
+func writeIndentedJson(val any) error {
+	barr, err := json.MarshalIndent(val, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshaling json: %w", err)
+	}
+	WriteStdout("%s\n", string(barr))
+	return nil
+}
+
+func rpcListRun(cmd *cobra.Command, args []string) error {
+	infos, err := wshclient.WshRpcListCommandsCommand(RpcClient, &wshrpc.RpcOpts{Timeout: 5000})
+	if err != nil {
+		return fmt.Errorf("listing rpc commands: %w", err)
+	}
+	if len(args) == 1 {
+		for _, info := range infos {
+			if info.Command == args[0] {
+				return writeIndentedJson(info)
+			}
+		}
+		return fmt.Errorf("rpc command %q not found", args[0])
+	}
+	if rpcListJson {
+		return writeIndentedJson(infos)
+	}
+	for _, info := range infos {
+		dataType := info.DataType
+		if dataType == "" {
+			dataType = "-"
+		}
+		respType := info.ResponseType
+		if respType == "" {
+			respType = "-"
+		}
+		WriteStdout("%-24s %-16s %s => %s\n", info.Command, info.CommandType, dataType, respType)
+	}
+	return nil
+}
+
+func rpcCallRun(cmd *cobra.Command, args []string) error {
+	command := args[0]
+	decl := wshutil.WshCommandDeclMap[command]
+	if decl == nil {
+		return fmt.Errorf("unknown rpc command %q (see wsh rpc list)", command)
+	}
+	var data any
+	if len(args) > 1 {
+		dataStr := args[1]
+		if dataStr == "-" {
+			barr, err := io.ReadAll(WrappedStdin)
+			if err != nil {
+				return fmt.Errorf("reading stdin: %w", err)
+			}
+			dataStr = string(barr)
+		}
+		err := json.Unmarshal([]byte(dataStr), &data)
+		if err != nil {
+			return fmt.Errorf("data is not valid json: %w", err)
+		}
+	}
+	opts := &wshrpc.RpcOpts{Timeout: rpcCallTimeout, Route: rpcCallRoute}
+	if decl.CommandType != wshrpc.RpcType_ResponseStream {
+		resp, err := wshclient.SendRpcRequestCall(RpcClient, command, data, opts)
+		if err != nil {
+			return fmt.Errorf("calling %s: %w", command, err)
+		}
+		if resp == nil {
+			return nil
+		}
+		return writeIndentedJson(resp)
+	}
+	opts.Timeout = FileFollowTimeout
+	respCh := wshclient.SendRpcRequestResponseStream(RpcClient, command, data, opts)
+	sigCh, stopFn := notifyInterrupt()
+	defer stopFn()
+	for {
+		select {
+		case <-sigCh:
+			cancelStreams(opts)
+			return nil
+		case resp, ok := <-respCh:
+			if !ok {
+				return nil
+			}
+			if resp.Error != nil {
+				return fmt.Errorf("%s: %w", command, resp.Error)
+			}
+			barr, err := json.Marshal(resp.Response)
+			if err != nil {
+				return fmt.Errorf("marshaling json: %w", err)
+			}
+			WriteStdout("%s\n", string(barr))
+		}
+	}
+}
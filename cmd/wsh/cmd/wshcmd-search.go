@@ -0,0 +1,126 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc/wshclient"
+)
+
+var searchCmd = &cobra.Command{
+	Use:   "search [query]",
+	Short: "search terminal output",
+	Long: `Search the output of terminal blocks (most recent first).
+Every word in the query must match (words are matched as whole tokens, or as prefixes when they end with *).
+Use -b, --tab, or --workspace to limit the search to specific blocks, and --jump to focus the block of the most recent match.`,
+	Example: "  wsh search error\n  wsh search \"connection refused\" --conn user@host\n  wsh search panic --tab -C 5\n  wsh search build failed --since 1h --jump",
+	Args:    cobra.MinimumNArgs(1),
+	RunE:    activityWrap("search", searchRun),
+	PreRunE: preRunSetupRpcClient,
+}
+
+var (
+	searchTab          bool
+	searchWorkspace    bool
+	searchConn         string
+	searchSince        time.Duration
+	searchLimit        int
+	searchContextLines int
+	searchJump         bool
+	searchJson         bool
+)
+
+func init() {
+	rootCmd.AddCommand(searchCmd)
+	searchCmd.Flags().BoolVar(&searchTab, "tab", false, "only search blocks in the current tab")
+	searchCmd.Flags().BoolVar(&searchWorkspace, "workspace", false, "only search blocks in the current workspace")
+	searchCmd.Flags().StringVarP(&searchConn, "conn", "c", "", "only search output from this connection")
+	searchCmd.Flags().DurationVar(&searchSince, "since", 0, "only search output within this duration (e.g. 1h, 30m)")
+	searchCmd.Flags().IntVarP(&searchLimit, "limit", "n", 20, "maximum number of matches to show")
+	searchCmd.Flags().IntVarP(&searchContextLines, "context", "C", 2, "number of lines to show before and after each match")
+	searchCmd.Flags().BoolVar(&searchJump, "jump", false, "focus the block of the most recent match")
+	searchCmd.Flags().BoolVar(&searchJson, "json", false, "output as json")
+}
+
+func searchRun(cmd *cobra.Command, args []string) error {
+	searchData := wshrpc.CommandSearchBlockFilesData{
+		Query:        strings.Join(args, " "),
+		Connection:   searchConn,
+		ContextLines: searchContextLines,
+		Limit:        searchLimit,
+	}
+	if searchSince > 0 {
+		searchData.Since = time.Now().Add(-searchSince).UnixMilli()
+	}
+	if blockArg != "" {
+		fullORef, err := resolveBlockArg()
+		if err != nil {
+			return err
+		}
+		searchData.BlockIds = []string{fullORef.OID}
+	}
+	if searchTab {
+		tabORef, err := resolveSimpleId("tab")
+		if err != nil {
+			return fmt.Errorf("resolving tab: %w", err)
+		}
+		searchData.TabId = tabORef.OID
+	}
+	if searchWorkspace {
+		wsORef, err := resolveSimpleId("workspace")
+		if err != nil {
+			return fmt.Errorf("resolving workspace: %w", err)
+		}
+		searchData.WorkspaceId = wsORef.OID
+	}
+	matches, err := wshclient.SearchBlockFilesCommand(RpcClient, searchData, &wshrpc.RpcOpts{Timeout: 10000})
+	if err != nil {
+		return fmt.Errorf("searching: %w", err)
+	}
+	if searchJump && len(matches) > 0 {
+		err = wshclient.FocusBlockCommand(RpcClient, matches[0].BlockId, &wshrpc.RpcOpts{Timeout: 5000})
+		if err != nil {
+			return fmt.Errorf("focusing block: %w", err)
+		}
+	}
+	if searchJson {
+		if matches == nil {
+			matches = []*wshrpc.BlockFileSearchMatch{}
+		}
+		barr, err := json.MarshalIndent(matches, "", "  ")
+		if err != nil {
+			return fmt.Errorf("marshaling json: %w", err)
+		}
+		WriteStdout("%s\n", string(barr))
+		return nil
+	}
+	if len(matches) == 0 {
+		WriteStdout("no matches found\n")
+		return nil
+	}
+	for idx, match := range matches {
+		if idx > 0 {
+			WriteStdout("--\n")
+		}
+		header := fmt.Sprintf("%s block:%s", time.UnixMilli(match.Ts).Format(time.DateTime), match.BlockId)
+		if match.Connection != "" {
+			header += fmt.Sprintf(" (%s)", match.Connection)
+		}
+		WriteStdout("%s\n", header)
+		for _, line := range match.Before {
+			WriteStdout("  %s\n", line)
+		}
+		WriteStdout("> %s\n", match.Line)
+		for _, line := range match.After {
+			WriteStdout("  %s\n", line)
+		}
+	}
+	return nil
+}
@@ -0,0 +1 @@
+ALTER TABLE db_file_data DROP COLUMN codec;
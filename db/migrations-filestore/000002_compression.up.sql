@@ -0,0 +1,2 @@
+-- parts written before this migration are stored raw (codec = '')
+ALTER TABLE db_file_data ADD COLUMN codec varchar(20) NOT NULL DEFAULT '';
@@ -0,0 +1,15 @@
+CREATE TABLE history (
+    historyid varchar(36) PRIMARY KEY,
+    ts bigint NOT NULL,
+    blockid varchar(36) NOT NULL,
+    tabid varchar(36) NOT NULL,
+    connection varchar(200) NOT NULL,
+    cwd text NOT NULL,
+    cmdstr text NOT NULL,
+    exitcode int NULL DEFAULT NULL,
+    durationms int NOT NULL,
+    startoffset bigint NOT NULL,
+    endoffset bigint NOT NULL
+);
+
+CREATE INDEX history_ts_idx ON history (ts);
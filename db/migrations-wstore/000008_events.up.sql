@@ -0,0 +1,9 @@
+CREATE TABLE event_history (
+    event varchar(100) NOT NULL,
+    scope varchar(300) NOT NULL,
+    seq bigint NOT NULL,
+    ts bigint NOT NULL,
+    eventjson json NOT NULL
+);
+
+CREATE INDEX event_history_idx ON event_history (event, scope, seq);
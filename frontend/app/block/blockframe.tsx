@@ -348,7 +348,11 @@ const ConnStatusOverlay = React.memo(
         React.useEffect(() => {
             if (width) {
                 const hasError = !util.isBlank(connStatus.error);
-                const showError = hasError && width >= 250 && connStatus.status != "connecting";
+                const showError =
+                    hasError &&
+                    width >= 250 &&
+                    connStatus.status != "connecting" &&
+                    connStatus.status != "reconnecting";
                 setShowError(showError);
             }
         }, [width, connStatus, setShowError]);
@@ -389,6 +393,9 @@ const ConnStatusOverlay = React.memo(
             statusText = `Connecting to "${connName}"...`;
             showReconnect = false;
         }
+        if (connStatus.status == "reconnecting") {
+            statusText = `Connection to "${connName}" lost, reconnecting...`;
+        }
         if (connStatus.status == "connected") {
             showReconnect = false;
         }
@@ -401,7 +408,7 @@ const ConnStatusOverlay = React.memo(
             reconDisplay = "Reconnect";
             reconClassName = clsx(reconClassName, "font-size-11 vertical-padding-3 horizontal-padding-7");
         }
-        const showIcon = connStatus.status != "connecting";
+        const showIcon = connStatus.status != "connecting" && connStatus.status != "reconnecting";
 
         const wshConfigEnabled = fullConfig?.connections?.[connName]?.["conn:wshenabled"] ?? true;
         React.useEffect(() => {
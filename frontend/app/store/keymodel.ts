@@ -173,8 +173,9 @@ async function handleCmdN() {
         const blockAtom = WOS.getWaveObjectAtom<Block>(WOS.makeORef("block", focusedNode.data?.blockId));
         const blockData = globalStore.get(blockAtom);
         if (blockData?.meta?.view == "term") {
-            if (blockData?.meta?.["cmd:cwd"] != null) {
-                termBlockDef.meta["cmd:cwd"] = blockData.meta["cmd:cwd"];
+            const cwd = blockData?.meta?.["shell:cwd"] ?? blockData?.meta?.["cmd:cwd"];
+            if (cwd != null) {
+                termBlockDef.meta["cmd:cwd"] = cwd;
             }
         }
         if (blockData?.meta?.connection != null) {
@@ -2,6 +2,7 @@
 // SPDX-License-Identifier: Apache-2.0
 
 import { type WebSocket, newWebSocket } from "@/util/wsutil";
+import base64 from "base64-js";
 import debug from "debug";
 import { sprintf } from "sprintf-js";
 
@@ -13,11 +14,28 @@ const WarnWebSocketSendSize = 1024 * 1024; // 1MB
 const MaxWebSocketSendSize = 5 * 1024 * 1024; // 5MB
 const reconnectHandlers: (() => void)[] = [];
 const StableConnTime = 2000;
+const BinFrameRefPrefix = "#bin:";
 
 function addWSReconnectHandler(handler: () => void) {
     reconnectHandlers.push(handler);
 }
 
+// large "data64" values can arrive as binary frames (sent right before the message), this puts them back as base64
+function inlineBinFrames(obj: any, frames: Uint8Array[]) {
+    if (obj == null || typeof obj != "object") {
+        return;
+    }
+    for (const key of Object.keys(obj)) {
+        const val = obj[key];
+        if (key == "data64" && typeof val == "string" && val.startsWith(BinFrameRefPrefix)) {
+            const frame = frames[parseInt(val.substring(BinFrameRefPrefix.length))];
+            obj[key] = frame == null ? "" : base64.fromByteArray(frame);
+            continue;
+        }
+        inlineBinFrames(val, frames);
+    }
+}
+
 function removeWSReconnectHandler(handler: () => void) {
     const index = this.reconnectHandlers.indexOf(handler);
     if (index > -1) {
@@ -47,6 +65,7 @@ class WSControl {
     eoOpts: ElectronOverrideOpts;
     noReconnect: boolean = false;
     onOpenTimeoutId: NodeJS.Timeout = null;
+    pendingFrames: Uint8Array[] = [];
 
     constructor(
         baseHostPort: string,
@@ -75,13 +94,15 @@ class WSControl {
         dlog("try reconnect:", desc);
         this.opening = true;
         this.wsConn = newWebSocket(
-            this.baseHostPort + "/ws?tabid=" + this.tabId,
+            this.baseHostPort + "/ws?tabid=" + this.tabId + "&binframes=1",
             this.eoOpts
                 ? {
                       [AuthKeyHeader]: this.eoOpts.authKey,
                   }
                 : null
         );
+        this.wsConn.binaryType = "arraybuffer";
+        this.pendingFrames = [];
         this.wsConn.onopen = (e: Event) => {
             this.onopen(e);
         };
@@ -172,10 +193,18 @@ class WSControl {
     }
 
     onmessage(event: MessageEvent) {
+        if (event.data instanceof ArrayBuffer) {
+            this.pendingFrames.push(new Uint8Array(event.data));
+            return;
+        }
         let eventData = null;
         if (event.data != null) {
             eventData = JSON.parse(event.data);
         }
+        if (this.pendingFrames.length > 0) {
+            inlineBinFrames(eventData, this.pendingFrames);
+            this.pendingFrames = [];
+        }
         if (eventData == null) {
             return;
         }
@@ -58,6 +58,7 @@ class WshClient {
         }
         if (opts?.timeout) {
             msg.timeout = opts.timeout;
+            msg.deadline = Date.now() + opts.timeout;
         }
         if (opts?.route) {
             msg.route = opts.route;
@@ -84,6 +85,7 @@ class WshClient {
         };
         if (opts?.timeout) {
             msg.timeout = opts.timeout;
+            msg.deadline = Date.now() + opts.timeout;
         }
         if (opts?.route) {
             msg.route = opts.route;
@@ -127,6 +129,10 @@ class WshClient {
     }
 
     recvRpcMessage(msg: RpcMessage) {
+        if (msg.cancel) {
+            // frontend handlers can't be canceled (and cancels don't get a response)
+            return;
+        }
         const isRequest = msg.command != null || msg.reqid != null;
         if (isRequest) {
             this.handleIncomingCommand(msg);
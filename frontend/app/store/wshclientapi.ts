@@ -42,6 +42,21 @@ class RpcApiType {
         return client.wshRpcCall("connensure", data, opts);
     }
 
+    // command "connforwardadd" [call]
+    ConnForwardAddCommand(client: WshClient, data: CommandConnForwardAddData, opts?: RpcOpts): Promise<ConnForward> {
+        return client.wshRpcCall("connforwardadd", data, opts);
+    }
+
+    // command "connforwardlist" [call]
+    ConnForwardListCommand(client: WshClient, data: string, opts?: RpcOpts): Promise<ConnForward[]> {
+        return client.wshRpcCall("connforwardlist", data, opts);
+    }
+
+    // command "connforwardremove" [call]
+    ConnForwardRemoveCommand(client: WshClient, data: CommandConnForwardRemoveData, opts?: RpcOpts): Promise<void> {
+        return client.wshRpcCall("connforwardremove", data, opts);
+    }
+
     // command "connlist" [call]
     ConnListCommand(client: WshClient, opts?: RpcOpts): Promise<string[]> {
         return client.wshRpcCall("connlist", null, opts);
@@ -152,6 +167,21 @@ class RpcApiType {
         return client.wshRpcCall("filedelete", data, opts);
     }
 
+    // command "fileijsonat" [call]
+    FileIJsonAtCommand(client: WshClient, data: CommandFileIJsonAtData, opts?: RpcOpts): Promise<FileIJsonAtRtnData> {
+        return client.wshRpcCall("fileijsonat", data, opts);
+    }
+
+    // command "fileijsonlog" [call]
+    FileIJsonLogCommand(client: WshClient, data: CommandFileData, opts?: RpcOpts): Promise<{[key: string]: any}[]> {
+        return client.wshRpcCall("fileijsonlog", data, opts);
+    }
+
+    // command "fileijsonundo" [call]
+    FileIJsonUndoCommand(client: WshClient, data: CommandFileIJsonUndoData, opts?: RpcOpts): Promise<number> {
+        return client.wshRpcCall("fileijsonundo", data, opts);
+    }
+
     // command "fileinfo" [call]
     FileInfoCommand(client: WshClient, data: CommandFileData, opts?: RpcOpts): Promise<WaveFileInfo> {
         return client.wshRpcCall("fileinfo", data, opts);
@@ -167,11 +197,21 @@ class RpcApiType {
         return client.wshRpcCall("fileread", data, opts);
     }
 
+    // command "filestream" [responsestream]
+	FileStreamCommand(client: WshClient, data: CommandFileStreamData, opts?: RpcOpts): AsyncGenerator<FileStreamRtnData, void, boolean> {
+        return client.wshRpcStream("filestream", data, opts);
+    }
+
     // command "filewrite" [call]
     FileWriteCommand(client: WshClient, data: CommandFileData, opts?: RpcOpts): Promise<void> {
         return client.wshRpcCall("filewrite", data, opts);
     }
 
+    // command "focusblock" [call]
+    FocusBlockCommand(client: WshClient, data: string, opts?: RpcOpts): Promise<void> {
+        return client.wshRpcCall("focusblock", data, opts);
+    }
+
     // command "focuswindow" [call]
     FocusWindowCommand(client: WshClient, data: string, opts?: RpcOpts): Promise<void> {
         return client.wshRpcCall("focuswindow", data, opts);
@@ -192,6 +232,16 @@ class RpcApiType {
         return client.wshRpcCall("getvar", data, opts);
     }
 
+    // command "historyclear" [call]
+    HistoryClearCommand(client: WshClient, data: CommandHistoryClearData, opts?: RpcOpts): Promise<void> {
+        return client.wshRpcCall("historyclear", data, opts);
+    }
+
+    // command "historysearch" [call]
+    HistorySearchCommand(client: WshClient, data: CommandHistorySearchData, opts?: RpcOpts): Promise<HistoryItem[]> {
+        return client.wshRpcCall("historysearch", data, opts);
+    }
+
     // command "message" [call]
     MessageCommand(client: WshClient, data: CommandMessageData, opts?: RpcOpts): Promise<void> {
         return client.wshRpcCall("message", data, opts);
@@ -267,6 +317,16 @@ class RpcApiType {
         return client.wshRpcCall("routeunannounce", null, opts);
     }
 
+    // command "rpctrace" [responsestream]
+	RpcTraceCommand(client: WshClient, data: CommandRpcTraceData, opts?: RpcOpts): AsyncGenerator<RpcTraceEntry, void, boolean> {
+        return client.wshRpcStream("rpctrace", data, opts);
+    }
+
+    // command "searchblockfiles" [call]
+    SearchBlockFilesCommand(client: WshClient, data: CommandSearchBlockFilesData, opts?: RpcOpts): Promise<BlockFileSearchMatch[]> {
+        return client.wshRpcCall("searchblockfiles", data, opts);
+    }
+
     // command "setconfig" [call]
     SetConfigCommand(client: WshClient, data: SettingsType, opts?: RpcOpts): Promise<void> {
         return client.wshRpcCall("setconfig", data, opts);
@@ -292,6 +352,11 @@ class RpcApiType {
         return client.wshRpcCall("setview", data, opts);
     }
 
+    // command "storagereport" [call]
+    StorageReportCommand(client: WshClient, data: CommandStorageReportData, opts?: RpcOpts): Promise<StorageReportData> {
+        return client.wshRpcCall("storagereport", data, opts);
+    }
+
     // command "streamcpudata" [responsestream]
 	StreamCpuDataCommand(client: WshClient, data: CpuDataRequest, opts?: RpcOpts): AsyncGenerator<TimeSeriesData, void, boolean> {
         return client.wshRpcStream("streamcpudata", data, opts);
@@ -357,6 +422,11 @@ class RpcApiType {
         return client.wshRpcCall("wshactivity", data, opts);
     }
 
+    // command "wshrpclistcommands" [call]
+    WshRpcListCommandsCommand(client: WshClient, opts?: RpcOpts): Promise<WshRpcCommandInfo[]> {
+        return client.wshRpcCall("wshrpclistcommands", null, opts);
+    }
+
     // command "wsldefaultdistro" [call]
     WslDefaultDistroCommand(client: WshClient, opts?: RpcOpts): Promise<string> {
         return client.wshRpcCall("wsldefaultdistro", null, opts);
@@ -109,6 +109,11 @@ export class TermWrap {
             if (data == null || data.length == 0) {
                 return false;
             }
+            const blockData = globalStore.get(WOS.getWaveObjectAtom<Block>(WOS.makeORef("block", this.blockId)));
+            if (blockData?.meta?.controller == "shell") {
+                // shell blocks have their cwd tracked by the backend (shell:cwd)
+                return true;
+            }
             if (data.startsWith("file://")) {
                 data = data.substring(7);
                 const nextSlashIdx = data.indexOf("/");
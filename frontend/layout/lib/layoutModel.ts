@@ -468,6 +468,24 @@ export class LayoutModel {
                             );
                             break;
                         }
+                        case LayoutTreeActionType.FocusNode: {
+                            const leaf = this?.getNodeByBlockId(action.blockid);
+                            if (leaf) {
+                                this.treeReducer(
+                                    {
+                                        type: LayoutTreeActionType.FocusNode,
+                                        nodeId: leaf.id,
+                                    } as LayoutTreeFocusNodeAction,
+                                    false
+                                );
+                            } else {
+                                console.error(
+                                    "Cannot apply eventbus layout action FocusNode, could not find leaf node with blockId",
+                                    action.blockid
+                                );
+                            }
+                            break;
+                        }
                         default:
                             console.warn("unsupported layout action", action);
                             break;
@@ -68,6 +68,18 @@ declare global {
         meta?: MetaType;
     };
 
+    // wshrpc.BlockFileSearchMatch
+    type BlockFileSearchMatch = {
+        blockid: string;
+        filename: string;
+        offset: number;
+        ts: number;
+        connection?: string;
+        line: string;
+        before?: string[];
+        after?: string[];
+    };
+
     // wshrpc.BlockInfoData
     type BlockInfoData = {
         blockid: string;
@@ -125,6 +137,19 @@ declare global {
         view: string;
     };
 
+    // wshrpc.CommandConnForwardAddData
+    type CommandConnForwardAddData = {
+        connname: string;
+        type: string;
+        spec: string;
+    };
+
+    // wshrpc.CommandConnForwardRemoveData
+    type CommandConnForwardRemoveData = {
+        connname: string;
+        forwardid: string;
+    };
+
     // wshrpc.CommandControllerResyncData
     type CommandControllerResyncData = {
         forcerestart?: boolean;
@@ -163,6 +188,8 @@ declare global {
         event: string;
         scope: string;
         maxitems: number;
+        startts?: number;
+        endts?: number;
     };
 
     // wshrpc.CommandFileCreateData
@@ -187,6 +214,21 @@ declare global {
         size?: number;
     };
 
+    // wshrpc.CommandFileIJsonAtData
+    type CommandFileIJsonAtData = {
+        zoneid: string;
+        filename: string;
+        idx?: number;
+        ts?: number;
+    };
+
+    // wshrpc.CommandFileIJsonUndoData
+    type CommandFileIJsonUndoData = {
+        zoneid: string;
+        filename: string;
+        count: number;
+    };
+
     // wshrpc.CommandFileListData
     type CommandFileListData = {
         zoneid: string;
@@ -196,11 +238,35 @@ declare global {
         limit?: number;
     };
 
+    // wshrpc.CommandFileStreamData
+    type CommandFileStreamData = {
+        zoneid: string;
+        filename: string;
+        offset?: number;
+        fromend?: number;
+        follow?: boolean;
+    };
+
     // wshrpc.CommandGetMetaData
     type CommandGetMetaData = {
         oref: ORef;
     };
 
+    // wshrpc.CommandHistoryClearData
+    type CommandHistoryClearData = {
+        blockid?: string;
+    };
+
+    // wshrpc.CommandHistorySearchData
+    type CommandHistorySearchData = {
+        query?: string;
+        connection?: string;
+        blockid?: string;
+        exitstatus?: string;
+        since?: number;
+        limit?: number;
+    };
+
     // wshrpc.CommandMessageData
     type CommandMessageData = {
         oref: ORef;
@@ -237,12 +303,36 @@ declare global {
         resolvedids: {[key: string]: ORef};
     };
 
+    // wshrpc.CommandRpcTraceData
+    type CommandRpcTraceData = {
+        command?: string;
+        route?: string;
+        history?: boolean;
+    };
+
+    // wshrpc.CommandSearchBlockFilesData
+    type CommandSearchBlockFilesData = {
+        query: string;
+        blockids?: string[];
+        tabid?: string;
+        workspaceid?: string;
+        connection?: string;
+        since?: number;
+        contextlines?: number;
+        limit?: number;
+    };
+
     // wshrpc.CommandSetMetaData
     type CommandSetMetaData = {
         oref: ORef;
         meta: MetaType;
     };
 
+    // wshrpc.CommandStorageReportData
+    type CommandStorageReportData = {
+        gc?: boolean;
+    };
+
     // wshrpc.CommandVarData
     type CommandVarData = {
         key: string;
@@ -286,10 +376,24 @@ declare global {
         metamaptype: MetaType;
     };
 
+    // wshrpc.ConnForward
+    type ConnForward = {
+        forwardid: string;
+        type: string;
+        spec: string;
+        bindaddr: string;
+        targetaddr?: string;
+        fromconfig?: boolean;
+        status: string;
+        error?: string;
+        numconns: number;
+    };
+
     // wshrpc.ConnKeywords
     type ConnKeywords = {
         "conn:wshenabled"?: boolean;
         "conn:askbeforewshinstall"?: boolean;
+        "conn:autoreconnect"?: boolean;
         "display:hidden"?: boolean;
         "display:order"?: number;
         "term:*"?: boolean;
@@ -300,6 +404,7 @@ declare global {
         "ssh:hostname"?: string;
         "ssh:port"?: string;
         "ssh:identityfile"?: string[];
+        "ssh:certificatefile"?: string[];
         "ssh:batchmode"?: boolean;
         "ssh:pubkeyauthentication"?: boolean;
         "ssh:passwordauthentication"?: boolean;
@@ -307,9 +412,16 @@ declare global {
         "ssh:preferredauthentications"?: string[];
         "ssh:addkeystoagent"?: boolean;
         "ssh:identityagent"?: string;
+        "ssh:forwardagent"?: boolean;
         "ssh:proxyjump"?: string[];
+        "ssh:proxycommand"?: string;
         "ssh:userknownhostsfile"?: string[];
         "ssh:globalknownhostsfile"?: string[];
+        "ssh:localforward"?: string[];
+        "ssh:remoteforward"?: string[];
+        "ssh:dynamicforward"?: string[];
+        "ssh:serveraliveinterval"?: number;
+        "ssh:serveralivecountmax"?: number;
     };
 
     // wshrpc.ConnRequest
@@ -328,6 +440,7 @@ declare global {
         activeconnnum: number;
         error?: string;
         wsherror?: string;
+        forwards?: ConnForward[];
     };
 
     // wshrpc.CpuDataRequest
@@ -352,6 +465,13 @@ declare global {
         meta?: {[key: string]: any};
     };
 
+    // wshrpc.FileIJsonAtRtnData
+    type FileIJsonAtRtnData = {
+        idx: number;
+        ts: number;
+        data: any;
+    };
+
     // wshrpc.FileInfo
     type FileInfo = {
         path: string;
@@ -373,6 +493,16 @@ declare global {
         circular?: boolean;
         ijson?: boolean;
         ijsonbudget?: number;
+        ijsonhistory?: number;
+        compression?: string;
+    };
+
+    // wshrpc.FileStreamRtnData
+    type FileStreamRtnData = {
+        offset: number;
+        data64?: string;
+        skipsize?: number;
+        truncated?: boolean;
     };
 
     // wconfig.FullConfigType
@@ -393,6 +523,21 @@ declare global {
         data64: string;
     };
 
+    // wshrpc.HistoryItem
+    type HistoryItem = {
+        historyid: string;
+        ts: number;
+        blockid: string;
+        tabid: string;
+        connection: string;
+        cwd: string;
+        cmdstr: string;
+        exitcode?: number;
+        durationms: number;
+        startoffset: number;
+        endoffset: number;
+    };
+
     // waveobj.LayoutActionData
     type LayoutActionData = {
         actiontype: string;
@@ -454,8 +599,11 @@ declare global {
         "cmd:env"?: {[key: string]: string};
         "cmd:cwd"?: string;
         "cmd:nowsh"?: boolean;
+        "cmd:wshscope"?: string;
         "cmd:args"?: string[];
         "cmd:shell"?: boolean;
+        "shell:*"?: boolean;
+        "shell:cwd"?: string;
         "ai:*"?: boolean;
         "ai:preset"?: string;
         "ai:apitype"?: string;
@@ -492,6 +640,8 @@ declare global {
         "term:vdomblockid"?: string;
         "term:vdomtoolbarblockid"?: string;
         "term:transparency"?: number;
+        "term:archive"?: boolean;
+        "term:archivemaxbytes"?: number;
         "web:zoom"?: number;
         "markdown:fontsize"?: number;
         "markdown:fixedfontsize"?: number;
@@ -585,6 +735,7 @@ declare global {
         reqid?: string;
         resid?: string;
         timeout?: number;
+        deadline?: number;
         route?: string;
         authtoken?: string;
         source?: string;
@@ -602,6 +753,23 @@ declare global {
         route?: string;
     };
 
+    // wshrpc.RpcTraceEntry
+    type RpcTraceEntry = {
+        ts: number;
+        router: string;
+        command?: string;
+        reqid?: string;
+        resid?: string;
+        source?: string;
+        route?: string;
+        fromroute?: string;
+        size: number;
+        latencyus?: number;
+        cont?: boolean;
+        error?: string;
+        dropped?: number;
+    };
+
     // waveobj.RuntimeOpts
     type RuntimeOpts = {
         termsize?: TermSize;
@@ -643,6 +811,9 @@ declare global {
         "term:scrollback"?: number;
         "term:copyonselect"?: boolean;
         "term:transparency"?: number;
+        "term:archive"?: boolean;
+        "term:archivemaxbytes"?: number;
+        "term:archivetotalmaxbytes"?: number;
         "editor:minimapenabled"?: boolean;
         "editor:stickyscrollenabled"?: boolean;
         "editor:wordwrap"?: boolean;
@@ -686,6 +857,14 @@ declare global {
         "conn:*"?: boolean;
         "conn:askbeforewshinstall"?: boolean;
         "conn:wshenabled"?: boolean;
+        "conn:autoreconnect"?: boolean;
+        "filestore:*"?: boolean;
+        "filestore:backend"?: string;
+        "filestore:dir"?: string;
+        "filestore:zonemaxbytes"?: number;
+        "filestore:totalmaxbytes"?: number;
+        "debug:*"?: boolean;
+        "debug:rpctrace"?: boolean;
     };
 
     // waveobj.StickerClickOptsType
@@ -709,11 +888,53 @@ declare global {
         display: StickerDisplayOptsType;
     };
 
+    // wshrpc.StorageFileUsage
+    type StorageFileUsage = {
+        name: string;
+        size: number;
+        disksize: number;
+    };
+
+    // wshrpc.StorageGCResult
+    type StorageGCResult = {
+        ts: number;
+        numzones: number;
+        numorphans: number;
+        numfiles: number;
+        reclaimedbytes: number;
+        vacuumbytes: number;
+    };
+
+    // wshrpc.StorageReportData
+    type StorageReportData = {
+        backend: string;
+        dbfilesize: number;
+        dbfreebytes: number;
+        size: number;
+        disksize: number;
+        numorphans: number;
+        orphandisksize: number;
+        zones: StorageZoneUsage[];
+        lastgc?: StorageGCResult;
+    };
+
+    // wshrpc.StorageZoneUsage
+    type StorageZoneUsage = {
+        zoneid: string;
+        otype?: string;
+        orphan?: boolean;
+        size: number;
+        disksize: number;
+        files: StorageFileUsage[];
+    };
+
     // wps.SubscriptionRequest
     type SubscriptionRequest = {
         event: string;
         scopes?: string[];
         allscopes?: boolean;
+        filter?: string;
+        minintervalms?: number;
     };
 
     // waveobj.Tab
@@ -1005,6 +1226,14 @@ declare global {
         data64: string;
     };
 
+    // wps.WSQuotaEventData
+    type WSQuotaEventData = {
+        zoneid?: string;
+        usage: number;
+        limit: number;
+        exceeded?: boolean;
+    };
+
     // webcmd.WSRpcCommand
     type WSRpcCommand = {
         wscommand: "rpc";
@@ -1022,6 +1251,9 @@ declare global {
         scopes?: string[];
         sender?: string;
         persist?: number;
+        durable?: boolean;
+        ts?: number;
+        seq?: number;
         data?: any;
     };
 
@@ -1042,6 +1274,7 @@ declare global {
         name: string;
         opts?: FileOptsType;
         size?: number;
+        disksize?: number;
         createdts?: number;
         modts?: number;
         meta?: {[key: string]: any};
@@ -1184,6 +1417,16 @@ declare global {
         windowid: string;
     };
 
+    // wshrpc.WshRpcCommandInfo
+    type WshRpcCommandInfo = {
+        command: string;
+        commandtype: string;
+        datatype?: string;
+        dataschema?: {[key: string]: any};
+        responsetype?: string;
+        responseschema?: {[key: string]: any};
+    };
+
     // wshrpc.WshServerCommandMeta
     type WshServerCommandMeta = {
         commandtype: string;
@@ -7,6 +7,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"io"
 	"io/fs"
@@ -21,6 +22,7 @@ import (
 	"github.com/wavetermdev/waveterm/pkg/remote"
 	"github.com/wavetermdev/waveterm/pkg/remote/conncontroller"
 	"github.com/wavetermdev/waveterm/pkg/shellexec"
+	"github.com/wavetermdev/waveterm/pkg/termsearch"
 	"github.com/wavetermdev/waveterm/pkg/util/envutil"
 	"github.com/wavetermdev/waveterm/pkg/util/utilfn"
 	"github.com/wavetermdev/waveterm/pkg/wavebase"
@@ -32,6 +34,7 @@ import (
 	"github.com/wavetermdev/waveterm/pkg/wshutil"
 	"github.com/wavetermdev/waveterm/pkg/wsl"
 	"github.com/wavetermdev/waveterm/pkg/wstore"
+	"golang.org/x/crypto/ssh"
 )
 
 const (
@@ -52,8 +55,13 @@ const (
 )
 
 const (
-	DefaultTermMaxFileSize = 256 * 1024
+	DefaultTermMaxFileSize = 2560 * 1024 // term files are compressed on disk
 	DefaultHtmlMaxFileSize = 256 * 1024
+	DefaultIJsonHistory    = 50 // ijson commands kept through compaction (for undo)
+
+	// used when term:archive is set (term:archivemaxbytes and term:archivetotalmaxbytes override)
+	DefaultTermArchiveMaxBytes      = 64 * 1024 * 1024
+	DefaultTermArchiveTotalMaxBytes = 1024 * 1024 * 1024
 )
 
 const DefaultTimeout = 2 * time.Second
@@ -78,6 +86,7 @@ type BlockController struct {
 	ShellInputCh      chan *BlockInputUnion
 	ShellProcStatus   string
 	ShellProcExitCode int
+	ShellProcConnLost bool // the shell exited because its connection dropped (restarted on reconnect)
 	RunLock           *atomic.Bool
 	StatusVersion     int
 }
@@ -135,7 +144,8 @@ func (bc *BlockController) UpdateControllerAndSendUpdate(updateFn func() bool) {
 				waveobj.MakeORef(waveobj.OType_Tab, bc.TabId).String(),
 				waveobj.MakeORef(waveobj.OType_Block, bc.BlockId).String(),
 			},
-			Data: rtStatus,
+			Data:    rtStatus,
+			Persist: wps.ControllerStatusPersist,
 		})
 	}
 }
@@ -177,6 +187,12 @@ func HandleAppendBlockFile(blockId string, blockFile string, data []byte) error
 	if err != nil {
 		return fmt.Errorf("error appending to blockfile: %w", err)
 	}
+	if blockFile == BlockFile_Term && termsearch.IsEnabled() {
+		file, err := filestore.WFS.Stat(ctx, blockId, blockFile)
+		if err == nil {
+			termsearch.IndexAppend(blockId, blockFile, file.Size-int64(len(data)), data)
+		}
+	}
 	wps.Broker.Publish(wps.WaveEvent{
 		Event: wps.Event_BlockFile,
 		Scopes: []string{
@@ -192,6 +208,29 @@ func HandleAppendBlockFile(blockId string, blockFile string, data []byte) error
 	return nil
 }
 
+// term:archive spills output that scrolls out of the circular term file into archive segments
+// the budget is stored in the file meta (removed when archiving is off), so it is checked on every append
+func updateTermArchive(ctx context.Context, blockId string, blockMeta waveobj.MetaMapType) error {
+	settings := wconfig.GetWatcher().GetFullConfig().Settings
+	totalMaxBytes := settings.TermArchiveTotalMaxBytes
+	if totalMaxBytes <= 0 {
+		totalMaxBytes = DefaultTermArchiveTotalMaxBytes
+	}
+	filestore.SetArchiveTotalMaxBytes(totalMaxBytes)
+	var maxBytes any // nil removes the key
+	if blockMeta.GetBool(waveobj.MetaKey_TermArchive, settings.TermArchive) {
+		blockMaxBytes := int64(DefaultTermArchiveMaxBytes)
+		if settings.TermArchiveMaxBytes > 0 {
+			blockMaxBytes = settings.TermArchiveMaxBytes
+		}
+		if blockMeta.GetInt(waveobj.MetaKey_TermArchiveMaxBytes, 0) > 0 {
+			blockMaxBytes = int64(blockMeta.GetInt(waveobj.MetaKey_TermArchiveMaxBytes, 0))
+		}
+		maxBytes = blockMaxBytes
+	}
+	return filestore.WFS.WriteMeta(ctx, blockId, BlockFile_Term, filestore.FileMeta{filestore.ArchiveMaxBytesMetaKey: maxBytes}, true)
+}
+
 func (bc *BlockController) resetTerminalState() {
 	ctx, cancelFn := context.WithTimeout(context.Background(), DefaultTimeout)
 	defer cancelFn()
@@ -213,7 +252,7 @@ func (bc *BlockController) resetTerminalState() {
 }
 
 // for "cmd" type blocks
-func createCmdStrAndOpts(blockId string, blockMeta waveobj.MetaMapType) (string, *shellexec.CommandOptsType, error) {
+func createCmdStrAndOpts(blockId string, blockMeta waveobj.MetaMapType, connName string) (string, *shellexec.CommandOptsType, error) {
 	var cmdStr string
 	var cmdOpts shellexec.CommandOptsType
 	cmdOpts.Env = make(map[string]string)
@@ -222,7 +261,7 @@ func createCmdStrAndOpts(blockId string, blockMeta waveobj.MetaMapType) (string,
 		return "", nil, fmt.Errorf("missing cmd in block meta")
 	}
 	cmdOpts.Cwd = blockMeta.GetString(waveobj.MetaKey_CmdCwd, "")
-	if cmdOpts.Cwd != "" {
+	if cmdOpts.Cwd != "" && connName == "" {
 		cwdPath, err := wavebase.ExpandHomeDir(cmdOpts.Cwd)
 		if err != nil {
 			return "", nil, err
@@ -276,7 +315,7 @@ func (bc *BlockController) DoRunShellCommand(rc *RunShellOpts, blockMeta waveobj
 	// create a circular blockfile for the output
 	ctx, cancelFn := context.WithTimeout(context.Background(), 2*time.Second)
 	defer cancelFn()
-	err := filestore.WFS.MakeFile(ctx, bc.BlockId, BlockFile_Term, nil, filestore.FileOptsType{MaxSize: DefaultTermMaxFileSize, Circular: true})
+	err := filestore.WFS.MakeFile(ctx, bc.BlockId, BlockFile_Term, nil, filestore.FileOptsType{MaxSize: DefaultTermMaxFileSize, Circular: true, Compression: filestore.Compression_Zstd})
 	if err != nil && err != fs.ErrExist {
 		err = fs.ErrExist
 		return fmt.Errorf("error creating blockfile: %w", err)
@@ -284,22 +323,36 @@ func (bc *BlockController) DoRunShellCommand(rc *RunShellOpts, blockMeta waveobj
 	if err == fs.ErrExist {
 		// reset the terminal state
 		bc.resetTerminalState()
+		// term files from before compression are converted as their parts are rewritten
+		err = filestore.WFS.SetCompression(ctx, bc.BlockId, BlockFile_Term, filestore.Compression_Zstd)
+		if err != nil {
+			log.Printf("error setting term file compression (continuing): %v\n", err)
+		}
+	}
+	err = updateTermArchive(ctx, bc.BlockId, blockMeta)
+	if err != nil {
+		log.Printf("error updating term archive settings (continuing): %v\n", err)
 	}
-	err = nil
 	bcInitStatus := bc.GetRuntimeStatus()
 	if bcInitStatus.ShellProcStatus == Status_Running {
 		return nil
 	}
 	// TODO better sync here (don't let two starts happen at the same times)
 	remoteName := blockMeta.GetString(waveobj.MetaKey_Connection, "")
+	termsearch.SetZoneConnection(bc.BlockId, remoteName)
 	var cmdStr string
 	var cmdOpts shellexec.CommandOptsType
 	if bc.ControllerType == BlockController_Shell {
 		cmdOpts.Env = make(map[string]string)
 		cmdOpts.Interactive = true
 		cmdOpts.Login = true
-		cmdOpts.Cwd = blockMeta.GetString(waveobj.MetaKey_CmdCwd, "")
-		if cmdOpts.Cwd != "" {
+		// start in the last cwd reported by the shell (falls back to cmd:cwd)
+		cmdOpts.Cwd = blockMeta.GetString(waveobj.MetaKey_ShellCwd, "")
+		if cmdOpts.Cwd == "" {
+			cmdOpts.Cwd = blockMeta.GetString(waveobj.MetaKey_CmdCwd, "")
+		}
+		// remote cwds are expanded by the remote shell
+		if cmdOpts.Cwd != "" && remoteName == "" {
 			cwdPath, err := wavebase.ExpandHomeDir(cmdOpts.Cwd)
 			if err != nil {
 				return err
@@ -308,7 +361,7 @@ func (bc *BlockController) DoRunShellCommand(rc *RunShellOpts, blockMeta waveobj
 		}
 	} else if bc.ControllerType == BlockController_Cmd {
 		var cmdOptsPtr *shellexec.CommandOptsType
-		cmdStr, cmdOptsPtr, err = createCmdStrAndOpts(bc.BlockId, blockMeta)
+		cmdStr, cmdOptsPtr, err = createCmdStrAndOpts(bc.BlockId, blockMeta, remoteName)
 		if err != nil {
 			return err
 		}
@@ -316,6 +369,10 @@ func (bc *BlockController) DoRunShellCommand(rc *RunShellOpts, blockMeta waveobj
 	} else {
 		return fmt.Errorf("unknown controller type %q", bc.ControllerType)
 	}
+	wshScope, err := wshrpc.ParseWshScope(blockMeta.GetString(waveobj.MetaKey_CmdWshScope, ""))
+	if err != nil {
+		return fmt.Errorf("invalid cmd:wshscope: %w", err)
+	}
 	var shellProc *shellexec.ShellProc
 	if strings.HasPrefix(remoteName, "wsl://") {
 		wslName := strings.TrimPrefix(remoteName, "wsl://")
@@ -330,7 +387,7 @@ func (bc *BlockController) DoRunShellCommand(rc *RunShellOpts, blockMeta waveobj
 
 		// create jwt
 		if !blockMeta.GetBool(waveobj.MetaKey_CmdNoWsh, false) {
-			jwtStr, err := wshutil.MakeClientJWTToken(wshrpc.RpcContext{TabId: bc.TabId, BlockId: bc.BlockId, Conn: wslConn.GetName()}, wslConn.GetDomainSocketName())
+			jwtStr, err := wshutil.MakeClientJWTToken(wshrpc.RpcContext{TabId: bc.TabId, BlockId: bc.BlockId, Conn: wslConn.GetName(), Scope: wshScope}, wslConn.GetDomainSocketName())
 			if err != nil {
 				return fmt.Errorf("error making jwt token: %w", err)
 			}
@@ -340,6 +397,29 @@ func (bc *BlockController) DoRunShellCommand(rc *RunShellOpts, blockMeta waveobj
 		if err != nil {
 			return err
 		}
+	} else if remote.IsExecConnName(remoteName) {
+		credentialCtx, cancelFunc := context.WithTimeout(context.Background(), 60*time.Second)
+		defer cancelFunc()
+
+		conn, err := conncontroller.GetExecConn(credentialCtx, remoteName, false)
+		if err != nil {
+			return err
+		}
+		connStatus := conn.DeriveConnStatus()
+		if connStatus.Status != conncontroller.Status_Connected {
+			return fmt.Errorf("not connected, cannot start shellproc")
+		}
+		if !blockMeta.GetBool(waveobj.MetaKey_CmdNoWsh, false) && conn.WshEnabled.Load() {
+			jwtStr, err := wshutil.MakeClientJWTToken(wshrpc.RpcContext{TabId: bc.TabId, BlockId: bc.BlockId, Conn: conn.GetName(), Scope: wshScope}, conn.GetDomainSocketName())
+			if err != nil {
+				return fmt.Errorf("error making jwt token: %w", err)
+			}
+			cmdOpts.Env[wshutil.WaveJwtTokenVarName] = jwtStr
+		}
+		shellProc, err = shellexec.StartExecShellProc(rc.TermSize, cmdStr, cmdOpts, conn)
+		if err != nil {
+			return err
+		}
 	} else if remoteName != "" {
 		credentialCtx, cancelFunc := context.WithTimeout(context.Background(), 60*time.Second)
 		defer cancelFunc()
@@ -354,7 +434,7 @@ func (bc *BlockController) DoRunShellCommand(rc *RunShellOpts, blockMeta waveobj
 			return fmt.Errorf("not connected, cannot start shellproc")
 		}
 		if !blockMeta.GetBool(waveobj.MetaKey_CmdNoWsh, false) {
-			jwtStr, err := wshutil.MakeClientJWTToken(wshrpc.RpcContext{TabId: bc.TabId, BlockId: bc.BlockId, Conn: conn.Opts.String()}, conn.GetDomainSocketName())
+			jwtStr, err := wshutil.MakeClientJWTToken(wshrpc.RpcContext{TabId: bc.TabId, BlockId: bc.BlockId, Conn: conn.Opts.String(), Scope: wshScope}, conn.GetDomainSocketName())
 			if err != nil {
 				return fmt.Errorf("error making jwt token: %w", err)
 			}
@@ -386,7 +466,7 @@ func (bc *BlockController) DoRunShellCommand(rc *RunShellOpts, blockMeta waveobj
 	} else {
 		// local terminal
 		if !blockMeta.GetBool(waveobj.MetaKey_CmdNoWsh, false) {
-			jwtStr, err := wshutil.MakeClientJWTToken(wshrpc.RpcContext{TabId: bc.TabId, BlockId: bc.BlockId}, wavebase.GetDomainSocketName())
+			jwtStr, err := wshutil.MakeClientJWTToken(wshrpc.RpcContext{TabId: bc.TabId, BlockId: bc.BlockId, Scope: wshScope}, wavebase.GetDomainSocketName())
 			if err != nil {
 				return fmt.Errorf("error making jwt token: %w", err)
 			}
@@ -421,9 +501,33 @@ func (bc *BlockController) DoRunShellCommand(rc *RunShellOpts, blockMeta waveobj
 	// make esc sequence wshclient wshProxy
 	// we don't need to authenticate this wshProxy since it is coming direct
 	wshProxy := wshutil.MakeRpcProxy()
-	wshProxy.SetRpcContext(&wshrpc.RpcContext{TabId: bc.TabId, BlockId: bc.BlockId})
+	wshProxy.SetRpcContext(&wshrpc.RpcContext{TabId: bc.TabId, BlockId: bc.BlockId, Scope: wshScope})
 	wshutil.DefaultRouter.RegisterRoute(wshutil.MakeControllerRouteId(bc.BlockId), wshProxy, true)
-	ptyBuffer := wshutil.MakePtyBuffer(wshutil.WaveOSCPrefix, shellProc.Cmd, wshProxy.FromRemoteCh)
+	var ptyBuffer *wshutil.PtyBuffer
+	if bc.ControllerType == BlockController_Shell {
+		// track commands using the shell integration markers (starting at the current end of the term file)
+		var baseOffset int64
+		termFile, statErr := filestore.WFS.Stat(ctx, bc.BlockId, BlockFile_Term)
+		if statErr == nil {
+			baseOffset = termFile.Size
+		}
+		connName := remoteName
+		if connName == "" {
+			connName = wshrpc.LocalConnName
+		}
+		tracker := &shellTracker{
+			BlockId:    bc.BlockId,
+			TabId:      bc.TabId,
+			Connection: connName,
+			Cwd:        cmdOpts.Cwd,
+			BaseOffset: baseOffset,
+		}
+		shellCh := make(chan wshutil.ShellIntegrationMarker, wshutil.DefaultShellChSize)
+		go tracker.runLoop(shellCh)
+		ptyBuffer = wshutil.MakeShellPtyBuffer(wshutil.WaveOSCPrefix, shellProc.Cmd, wshProxy.FromRemoteCh, shellCh)
+	} else {
+		ptyBuffer = wshutil.MakePtyBuffer(wshutil.WaveOSCPrefix, shellProc.Cmd, wshProxy.FromRemoteCh)
+	}
 	go func() {
 		// handles regular output from the pty (goes to the blockfile and xterm)
 		defer panichandler.PanicHandler("blockcontroller:shellproc-pty-read-loop")
@@ -495,6 +599,7 @@ func (bc *BlockController) DoRunShellCommand(rc *RunShellOpts, blockMeta waveobj
 		defer panichandler.PanicHandler("blockcontroller:shellproc-wait-loop")
 		// wait for the shell to finish
 		var exitCode int
+		var connLost bool
 		defer func() {
 			wshutil.DefaultRouter.UnregisterRoute(wshutil.MakeControllerRouteId(bc.BlockId))
 			bc.UpdateControllerAndSendUpdate(func() bool {
@@ -502,18 +607,32 @@ func (bc *BlockController) DoRunShellCommand(rc *RunShellOpts, blockMeta waveobj
 					bc.ShellProcStatus = Status_Done
 				}
 				bc.ShellProcExitCode = exitCode
+				bc.ShellProcConnLost = connLost
 				return true
 			})
 			log.Printf("[shellproc] shell process wait loop done\n")
 		}()
 		waitErr := shellProc.Cmd.Wait()
 		exitCode = shellProc.Cmd.ExitCode()
+		connLost = isConnLostWaitErr(bc.BlockId, shellProc.ConnName, waitErr)
 		shellProc.SetWaitErrorAndSignalDone(waitErr)
 		go checkCloseOnExit(bc.BlockId, exitCode)
 	}()
 	return nil
 }
 
+// remote sessions that end without an exit status (or end while the connection is down) lost their connection
+func isConnLostWaitErr(blockId string, connName string, waitErr error) bool {
+	if connName == "" || waitErr == nil {
+		return false
+	}
+	var exitMissingErr *ssh.ExitMissingError
+	if errors.As(waitErr, &exitMissingErr) {
+		return true
+	}
+	return CheckConnStatus(blockId) != nil
+}
+
 func checkCloseOnExit(blockId string, exitCode int) {
 	ctx, cancelFn := context.WithTimeout(context.Background(), DefaultTimeout)
 	defer cancelFn()
@@ -677,6 +796,17 @@ func CheckConnStatus(blockId string) error {
 		}
 		return nil
 	}
+	if remote.IsExecConnName(connName) {
+		conn, err := conncontroller.GetExecConn(context.Background(), connName, false)
+		if err != nil {
+			return err
+		}
+		connStatus := conn.DeriveConnStatus()
+		if connStatus.Status != conncontroller.Status_Connected {
+			return fmt.Errorf("not connected: %s", connStatus.Status)
+		}
+		return nil
+	}
 	opts, err := remote.ParseOpts(connName)
 	if err != nil {
 		return fmt.Errorf("error parsing connection name: %w", err)
@@ -755,6 +885,10 @@ func ResyncController(ctx context.Context, tabId string, blockId string, rtOpts
 	// check if conn is different, if so, stop the current controller, and set status back to init
 	if curBc != nil {
 		bcStatus := curBc.GetRuntimeStatus()
+		if curBc.getShellProc() != nil && bcStatus.ShellProcConnName != connName {
+			// the shell cwd is only valid for the connection it was reported on
+			clearShellCwd(ctx, blockId)
+		}
 		if bcStatus.ShellProcStatus == Status_Running && bcStatus.ShellProcConnName != connName {
 			log.Printf("stopping blockcontroller %s due to conn change\n", blockId)
 			StopBlockControllerAndSetStatus(blockId, Status_Init)
@@ -843,6 +977,45 @@ func StopAllBlockControllers() {
 	}
 }
 
+// restarts the cmd:runonstart blocks on connName whose shell procs were killed (called after an automatic reconnect)
+// blocks that exited cleanly (exit code 0) are left alone
+func ResyncConnBlocks(connName string) {
+	for _, bc := range getControllerList() {
+		// only restart shells that are still running (on a dead session) or that exited because the connection dropped
+		// (not shells the user exited)
+		bcStatus := bc.GetRuntimeStatus()
+		var connLost bool
+		bc.WithLock(func() {
+			connLost = bc.ShellProcConnLost
+		})
+		if bcStatus.ShellProcStatus != Status_Running && !(bcStatus.ShellProcStatus == Status_Done && connLost) {
+			continue
+		}
+		ctx, cancelFn := context.WithTimeout(context.Background(), DefaultTimeout)
+		blockData, err := wstore.DBGet[*waveobj.Block](ctx, bc.BlockId)
+		cancelFn()
+		if err != nil || blockData == nil {
+			continue
+		}
+		if blockData.Meta.GetString(waveobj.MetaKey_Connection, "") != connName {
+			continue
+		}
+		if !getBoolFromMeta(blockData.Meta, waveobj.MetaKey_CmdRunOnStart, true) {
+			continue
+		}
+		log.Printf("resyncing block %s after reconnect to %q\n", bc.BlockId, connName)
+		go func(tabId string, blockId string) {
+			defer panichandler.PanicHandler("blockcontroller:resync-conn-blocks")
+			ctx, cancelFn := context.WithTimeout(context.Background(), DefaultTimeout)
+			defer cancelFn()
+			err := ResyncController(ctx, tabId, blockId, nil, true)
+			if err != nil {
+				log.Printf("error resyncing block %s after reconnect: %v\n", blockId, err)
+			}
+		}(bc.TabId, bc.BlockId)
+	}
+}
+
 func GetBlockController(blockId string) *BlockController {
 	globalLock.Lock()
 	defer globalLock.Unlock()
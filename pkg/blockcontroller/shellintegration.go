@@ -0,0 +1,162 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package blockcontroller
+
+import (
+	"context"
+	"log"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/wavetermdev/waveterm/pkg/cmdhistory"
+	"github.com/wavetermdev/waveterm/pkg/panichandler"
+	"github.com/wavetermdev/waveterm/pkg/waveobj"
+	"github.com/wavetermdev/waveterm/pkg/wps"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"github.com/wavetermdev/waveterm/pkg/wshutil"
+	"github.com/wavetermdev/waveterm/pkg/wstore"
+)
+
+// FinalTerm (OSC 133) marker types
+const (
+	FinalTerm_PromptStart  = "A"
+	FinalTerm_CommandStart = "B"
+	FinalTerm_OutputStart  = "C"
+	FinalTerm_CommandDone  = "D"
+)
+
+// tracks the commands run in a shell block (using the shell integration markers from the pty output)
+// only accessed from the shell integration loop goroutine
+type shellTracker struct {
+	BlockId    string
+	TabId      string
+	Connection string
+	Cwd        string
+	BaseOffset int64 // offset in the term file where the pty output starts
+	CurCmd     *wshrpc.HistoryItem
+}
+
+func (st *shellTracker) runLoop(shellCh chan wshutil.ShellIntegrationMarker) {
+	defer panichandler.PanicHandler("blockcontroller:shell-integration-loop")
+	for marker := range shellCh {
+		st.processMarker(marker)
+	}
+}
+
+func (st *shellTracker) processMarker(marker wshutil.ShellIntegrationMarker) {
+	if marker.OSCNum == wshutil.ShellOSC_Cwd {
+		st.updateCwd(parseOsc7Cwd(marker.Data))
+		return
+	}
+	if marker.OSCNum != wshutil.ShellOSC_FinalTerm {
+		return
+	}
+	fields := strings.Split(marker.Data, ";")
+	switch fields[0] {
+	case FinalTerm_PromptStart:
+		// if we never got a "D" marker, the command is finished without an exit code
+		st.finishCmd(marker, nil)
+	case FinalTerm_OutputStart:
+		st.finishCmd(marker, nil)
+		st.CurCmd = &wshrpc.HistoryItem{
+			Ts:          marker.Ts,
+			BlockId:     st.BlockId,
+			TabId:       st.TabId,
+			Connection:  st.Connection,
+			Cwd:         st.Cwd,
+			CmdStr:      parseFinalTermCmdLine(fields[1:]),
+			StartOffset: st.BaseOffset + marker.Pos,
+		}
+	case FinalTerm_CommandDone:
+		var exitCode *int
+		if len(fields) > 1 {
+			exitCodeVal, err := strconv.Atoi(fields[1])
+			if err == nil {
+				exitCode = &exitCodeVal
+			}
+		}
+		st.finishCmd(marker, exitCode)
+	}
+}
+
+// parses the OSC 7 data (file://host/path, or a plain path), returns "" if invalid
+func parseOsc7Cwd(data string) string {
+	if !strings.HasPrefix(data, "file://") {
+		return data
+	}
+	u, err := url.Parse(data)
+	if err != nil || u.Path == "" {
+		return ""
+	}
+	cwd := u.Path
+	// windows paths come through as /C:/path
+	if len(cwd) >= 3 && cwd[0] == '/' && cwd[2] == ':' {
+		cwd = cwd[1:]
+	}
+	return cwd
+}
+
+// persists the new cwd into the block meta (shell:cwd) and sends a waveobj:update event
+func (st *shellTracker) updateCwd(cwd string) {
+	if cwd == "" || cwd == st.Cwd {
+		return
+	}
+	st.Cwd = cwd
+	ctx, cancelFn := context.WithTimeout(context.Background(), DefaultTimeout)
+	defer cancelFn()
+	ctx = waveobj.ContextWithUpdates(ctx)
+	metaUpdate := waveobj.MetaMapType{waveobj.MetaKey_ShellCwd: cwd}
+	err := wstore.UpdateObjectMeta(ctx, waveobj.MakeORef(waveobj.OType_Block, st.BlockId), metaUpdate, false)
+	if err != nil {
+		log.Printf("error updating shell cwd for block %s: %v\n", st.BlockId, err)
+		return
+	}
+	wps.Broker.SendUpdateEvents(waveobj.ContextGetUpdatesRtn(ctx))
+}
+
+func clearShellCwd(ctx context.Context, blockId string) {
+	ctx = waveobj.ContextWithUpdates(ctx)
+	metaUpdate := waveobj.MetaMapType{waveobj.MetaKey_ShellCwd: nil}
+	err := wstore.UpdateObjectMeta(ctx, waveobj.MakeORef(waveobj.OType_Block, blockId), metaUpdate, false)
+	if err != nil {
+		log.Printf("error clearing shell cwd for block %s: %v\n", blockId, err)
+		return
+	}
+	wps.Broker.SendUpdateEvents(waveobj.ContextGetUpdatesRtn(ctx))
+}
+
+// parses the cmdline from the "C" marker params (cmdline_url=[url-encoded-cmd] or cmdline=[cmd])
+func parseFinalTermCmdLine(params []string) string {
+	for _, param := range params {
+		if strings.HasPrefix(param, "cmdline_url=") {
+			cmdLine, err := url.PathUnescape(strings.TrimPrefix(param, "cmdline_url="))
+			if err != nil {
+				return ""
+			}
+			return cmdLine
+		}
+		if strings.HasPrefix(param, "cmdline=") {
+			return strings.TrimPrefix(param, "cmdline=")
+		}
+	}
+	return ""
+}
+
+func (st *shellTracker) finishCmd(marker wshutil.ShellIntegrationMarker, exitCode *int) {
+	curCmd := st.CurCmd
+	st.CurCmd = nil
+	if curCmd == nil || strings.TrimSpace(curCmd.CmdStr) == "" {
+		return
+	}
+	curCmd.ExitCode = exitCode
+	curCmd.DurationMs = marker.Ts - curCmd.Ts
+	curCmd.EndOffset = st.BaseOffset + marker.Pos
+	ctx, cancelFn := context.WithTimeout(context.Background(), DefaultTimeout)
+	defer cancelFn()
+	err := cmdhistory.InsertHistoryItem(ctx, curCmd)
+	if err != nil {
+		log.Printf("error inserting cmd history item for block %s: %v\n", st.BlockId, err)
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// persistent history of shell commands (tracked with shell integration markers)
+package cmdhistory
+
+import (
+	"context"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"github.com/wavetermdev/waveterm/pkg/wstore"
+)
+
+const DefaultSearchLimit = 100
+const MaxSearchLimit = 10000
+
+func InsertHistoryItem(ctx context.Context, item *wshrpc.HistoryItem) error {
+	if item.HistoryId == "" {
+		item.HistoryId = uuid.NewString()
+	}
+	return wstore.WithTx(ctx, func(tx *wstore.TxWrap) error {
+		query := `INSERT INTO history (historyid, ts, blockid, tabid, connection, cwd, cmdstr, exitcode, durationms, startoffset, endoffset)
+		                       VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+		tx.Exec(query, item.HistoryId, item.Ts, item.BlockId, item.TabId, item.Connection, item.Cwd, item.CmdStr, item.ExitCode, item.DurationMs, item.StartOffset, item.EndOffset)
+		return nil
+	})
+}
+
+func escapeLikeStr(str string) string {
+	str = strings.ReplaceAll(str, `\`, `\\`)
+	str = strings.ReplaceAll(str, `%`, `\%`)
+	str = strings.ReplaceAll(str, `_`, `\_`)
+	return str
+}
+
+// returns the most recent matching items first
+func SearchHistory(ctx context.Context, opts wshrpc.CommandHistorySearchData) ([]*wshrpc.HistoryItem, error) {
+	var whereParts []string
+	var args []any
+	if opts.Query != "" {
+		whereParts = append(whereParts, `cmdstr LIKE ? ESCAPE '\'`)
+		args = append(args, "%"+escapeLikeStr(opts.Query)+"%")
+	}
+	if opts.Connection != "" {
+		whereParts = append(whereParts, `connection = ?`)
+		args = append(args, opts.Connection)
+	}
+	if opts.BlockId != "" {
+		whereParts = append(whereParts, `blockid = ?`)
+		args = append(args, opts.BlockId)
+	}
+	if opts.Since > 0 {
+		whereParts = append(whereParts, `ts >= ?`)
+		args = append(args, opts.Since)
+	}
+	switch opts.ExitStatus {
+	case wshrpc.HistoryExitStatus_Success:
+		whereParts = append(whereParts, `exitcode = 0`)
+	case wshrpc.HistoryExitStatus_Failed:
+		whereParts = append(whereParts, `exitcode <> 0`)
+	}
+	limit := opts.Limit
+	if limit <= 0 {
+		limit = DefaultSearchLimit
+	}
+	if limit > MaxSearchLimit {
+		limit = MaxSearchLimit
+	}
+	query := `SELECT * FROM history`
+	if len(whereParts) > 0 {
+		query += ` WHERE ` + strings.Join(whereParts, " AND ")
+	}
+	query += ` ORDER BY ts DESC LIMIT ?`
+	args = append(args, limit)
+	return wstore.WithTxRtn(ctx, func(tx *wstore.TxWrap) ([]*wshrpc.HistoryItem, error) {
+		var rtn []*wshrpc.HistoryItem
+		tx.Select(&rtn, query, args...)
+		return rtn, nil
+	})
+}
+
+// if blockId is empty, clears all history
+func ClearHistory(ctx context.Context, blockId string) error {
+	return wstore.WithTx(ctx, func(tx *wstore.TxWrap) error {
+		if blockId == "" {
+			tx.Exec(`DELETE FROM history`)
+			return nil
+		}
+		tx.Exec(`DELETE FROM history WHERE blockid = ?`, blockId)
+		return nil
+	})
+}
@@ -9,9 +9,11 @@ package filestore
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"io/fs"
 	"log"
+	"maps"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -24,6 +26,7 @@ const (
 	// ijson meta keys
 	IJsonNumCommands      = "ijson:numcmds"
 	IJsonIncrementalBytes = "ijson:incbytes"
+	IJsonLastIdx          = "ijson:lastidx" // idx of the last command (commands are numbered from 1, numbers are kept across compactions)
 )
 
 const (
@@ -35,6 +38,7 @@ const (
 
 const DefaultPartDataSize = 64 * 1024
 const DefaultFlushTime = 5 * time.Second
+const MaxCacheEntryDataSize = 256 * 1024 // dirty (raw) data per file is flushed early past this (independent of the file's MaxSize)
 const NoPartIdx = -1
 
 // for unit tests
@@ -54,6 +58,10 @@ type FileOptsType struct {
 	Circular    bool  `json:"circular,omitempty"`
 	IJson       bool  `json:"ijson,omitempty"`
 	IJsonBudget int   `json:"ijsonbudget,omitempty"`
+	// number of recent ijson commands kept (uncompacted) when the file is compacted, for point-in-time reads and undo
+	IJsonHistory int `json:"ijsonhistory,omitempty"`
+	// codec for parts stored on disk ("", "zstd", or "gzip"), the cache always holds raw data
+	Compression string `json:"compression,omitempty"`
 }
 
 type FileMeta = map[string]any
@@ -140,6 +148,16 @@ func (s *FileStore) MakeFile(ctx context.Context, zoneId string, name string, me
 	if opts.IJsonBudget < 0 {
 		return fmt.Errorf("ijson budget must be non-negative")
 	}
+	if opts.IJsonHistory > 0 && !opts.IJson {
+		return fmt.Errorf("ijson history requires ijson")
+	}
+	if opts.IJsonHistory < 0 {
+		return fmt.Errorf("ijson history must be non-negative")
+	}
+	err := validateCompression(opts.Compression)
+	if err != nil {
+		return err
+	}
 	return withLock(s, zoneId, name, func(entry *CacheEntry) error {
 		if entry.File != nil {
 			return fs.ErrExist
@@ -154,32 +172,59 @@ func (s *FileStore) MakeFile(ctx context.Context, zoneId string, name string, me
 			Opts:      opts,
 			Meta:      meta,
 		}
-		return dbInsertFile(ctx, file)
+		return globalBackend.InsertFile(ctx, file)
 	})
 }
 
 func (s *FileStore) DeleteFile(ctx context.Context, zoneId string, name string) error {
 	return withLock(s, zoneId, name, func(entry *CacheEntry) error {
-		err := dbDeleteFile(ctx, zoneId, name)
+		err := globalBackend.DeleteFile(ctx, zoneId, name)
 		if err != nil {
 			return fmt.Errorf("error deleting file: %v", err)
 		}
 		entry.clear()
-		return nil
+		removeQuotaUsage(zoneId, name)
+		notifyFileWatchers(zoneId, name, false)
+		if IsArchiveSegmentName(name) {
+			return nil
+		}
+		return s.deleteArchiveSegments(ctx, zoneId, name)
 	})
 }
 
 func (s *FileStore) DeleteZone(ctx context.Context, zoneId string) error {
-	fileNames, err := dbGetZoneFileNames(ctx, zoneId)
+	fileNames, err := globalBackend.GetZoneFileNames(ctx, zoneId)
 	if err != nil {
 		return fmt.Errorf("error getting zone files: %v", err)
 	}
 	for _, name := range fileNames {
 		s.DeleteFile(ctx, zoneId, name)
 	}
+	runZoneDeleteHandlers(ctx, zoneId)
 	return nil
 }
 
+var zoneDeleteHandlerLock = &sync.Mutex{}
+var zoneDeleteHandlers []func(ctx context.Context, zoneId string)
+
+// registers a handler that is called (synchronously) after DeleteZone removes a zone's files
+// used to clean up data that is derived from the zone (e.g. search indexes)
+func RegisterZoneDeleteHandler(handler func(ctx context.Context, zoneId string)) {
+	zoneDeleteHandlerLock.Lock()
+	defer zoneDeleteHandlerLock.Unlock()
+	zoneDeleteHandlers = append(zoneDeleteHandlers, handler)
+}
+
+func runZoneDeleteHandlers(ctx context.Context, zoneId string) {
+	zoneDeleteHandlerLock.Lock()
+	handlers := make([]func(context.Context, string), len(zoneDeleteHandlers))
+	copy(handlers, zoneDeleteHandlers)
+	zoneDeleteHandlerLock.Unlock()
+	for _, handler := range handlers {
+		handler(ctx, zoneId)
+	}
+}
+
 // if file doesn't exsit, returns fs.ErrNotExist
 func (s *FileStore) Stat(ctx context.Context, zoneId string, name string) (*WaveFile, error) {
 	return withLockRtn(s, zoneId, name, func(entry *CacheEntry) (*WaveFile, error) {
@@ -194,8 +239,38 @@ func (s *FileStore) Stat(ctx context.Context, zoneId string, name string) (*Wave
 	})
 }
 
+// changes the codec for parts written from now on (existing parts keep their codec until they are rewritten)
+func (s *FileStore) SetCompression(ctx context.Context, zoneId string, name string, codec string) error {
+	err := validateCompression(codec)
+	if err != nil {
+		return err
+	}
+	return withLock(s, zoneId, name, func(entry *CacheEntry) error {
+		file, err := entry.loadFileForRead(ctx)
+		if err != nil {
+			return err
+		}
+		if file.Opts.Compression == codec {
+			return nil
+		}
+		err = entry.loadFileIntoCache(ctx)
+		if err != nil {
+			return err
+		}
+		entry.File.Opts.Compression = codec
+		return nil
+	})
+}
+
+// returns the bytes stored on disk for the file's data (compressed size, does not include unflushed writes)
+func (s *FileStore) DiskSize(ctx context.Context, zoneId string, name string) (int64, error) {
+	return withLockRtn(s, zoneId, name, func(entry *CacheEntry) (int64, error) {
+		return globalBackend.GetFileDiskSize(ctx, zoneId, name)
+	})
+}
+
 func (s *FileStore) ListFiles(ctx context.Context, zoneId string) ([]*WaveFile, error) {
-	files, err := dbGetZoneFiles(ctx, zoneId)
+	files, err := globalBackend.GetZoneFiles(ctx, zoneId)
 	if err != nil {
 		return nil, fmt.Errorf("error getting zone files: %v", err)
 	}
@@ -217,6 +292,9 @@ func (s *FileStore) WriteMeta(ctx context.Context, zoneId string, name string, m
 			return err
 		}
 		if merge {
+			if entry.File.Meta == nil {
+				entry.File.Meta = make(FileMeta)
+			}
 			for k, v := range meta {
 				if v == nil {
 					delete(entry.File.Meta, k)
@@ -238,9 +316,22 @@ func (s *FileStore) WriteFile(ctx context.Context, zoneId string, name string, d
 		if err != nil {
 			return err
 		}
+		err = checkQuota(ctx, entry.File, int64(len(data)))
+		if err != nil {
+			return err
+		}
 		entry.writeAt(0, data, true)
+		notifyFileWatchers(zoneId, name, true)
 		// since WriteFile can *truncate* the file, we need to flush the file to the DB immediately
-		return entry.flushToDB(ctx, true)
+		err = entry.flushToDB(ctx, true)
+		if err != nil {
+			return err
+		}
+		if entry.File == nil || entry.File.Opts.Circular {
+			// offsets restart at 0, so the archive no longer lines up with the file
+			return s.deleteArchiveSegments(ctx, zoneId, name)
+		}
+		return nil
 	})
 }
 
@@ -263,7 +354,13 @@ func (s *FileStore) WriteAt(ctx context.Context, zoneId string, name string, off
 		if err != nil {
 			return err
 		}
+		err = checkQuota(ctx, file, max(file.Size, offset+int64(len(data))))
+		if err != nil {
+			return err
+		}
 		entry.writeAt(offset, data, false)
+		notifyFileWatchers(zoneId, name, false)
+		entry.flushIfOverCacheLimit(ctx)
 		return nil
 	})
 }
@@ -274,6 +371,11 @@ func (s *FileStore) AppendData(ctx context.Context, zoneId string, name string,
 		if err != nil {
 			return err
 		}
+		err = s.archiveEvictedParts(ctx, entry, int64(len(data)))
+		if err != nil {
+			// the append still goes through (the evicted parts are lost)
+			logArchiveError(zoneId, name, err)
+		}
 		partMap := entry.File.computePartMap(entry.File.Size, int64(len(data)))
 		incompleteParts := incompletePartsFromMap(partMap)
 		if len(incompleteParts) > 0 {
@@ -282,20 +384,34 @@ func (s *FileStore) AppendData(ctx context.Context, zoneId string, name string,
 				return err
 			}
 		}
+		err = checkQuota(ctx, entry.File, entry.File.Size+int64(len(data)))
+		if err != nil {
+			return err
+		}
 		entry.writeAt(entry.File.Size, data, false)
+		notifyFileWatchers(zoneId, name, false)
+		entry.flushIfOverCacheLimit(ctx)
 		return nil
 	})
 }
 
+// meta that was loaded from the db has float64 numbers
+func metaGetInt(file *WaveFile, key string) int {
+	switch val := file.Meta[key].(type) {
+	case int:
+		return val
+	case float64:
+		return int(val)
+	default:
+		return 0
+	}
+}
+
 func metaIncrement(file *WaveFile, key string, amount int) int {
 	if file.Meta == nil {
 		file.Meta = make(FileMeta)
 	}
-	val, ok := file.Meta[key].(int)
-	if !ok {
-		val = 0
-	}
-	newVal := val + amount
+	newVal := metaGetInt(file, key) + amount
 	file.Meta[key] = newVal
 	return newVal
 }
@@ -306,11 +422,18 @@ func (s *FileStore) compactIJson(ctx context.Context, entry *CacheEntry) error {
 	if err != nil {
 		return err
 	}
-	newBytes, err := ijson.CompactIJson(fullData, entry.File.Opts.IJsonBudget)
+	newBytes, err := ijson.CompactIJsonWithHistory(fullData, entry.File.Opts.IJsonBudget, entry.File.Opts.IJsonHistory)
 	if err != nil {
 		return err
 	}
+	if entry.File.Meta != nil {
+		delete(entry.File.Meta, IJsonNumCommands)
+		delete(entry.File.Meta, IJsonIncrementalBytes)
+	}
+	// compaction only shrinks the file, so this just records the new size
+	checkQuota(ctx, entry.File, int64(len(newBytes)))
 	entry.writeAt(0, newBytes, true)
+	notifyFileWatchers(entry.ZoneId, entry.Name, true)
 	return nil
 }
 
@@ -328,7 +451,7 @@ func (s *FileStore) CompactIJson(ctx context.Context, zoneId string, name string
 }
 
 func (s *FileStore) AppendIJson(ctx context.Context, zoneId string, name string, command map[string]any) error {
-	data, err := ijson.ValidateAndMarshalCommand(command)
+	_, err := ijson.ValidateAndMarshalCommand(command)
 	if err != nil {
 		return err
 	}
@@ -340,6 +463,14 @@ func (s *FileStore) AppendIJson(ctx context.Context, zoneId string, name string,
 		if !entry.File.Opts.IJson {
 			return fmt.Errorf("file %s:%s is not an ijson file", zoneId, name)
 		}
+		cmdIdx := metaGetInt(entry.File, IJsonLastIdx) + 1
+		stampedCmd := maps.Clone(command)
+		stampedCmd[ijson.IdxKey] = cmdIdx
+		stampedCmd[ijson.TsKey] = time.Now().UnixMilli()
+		data, err := json.Marshal(stampedCmd)
+		if err != nil {
+			return fmt.Errorf("error marshalling ijson command to json: %w", err)
+		}
 		partMap := entry.File.computePartMap(entry.File.Size, int64(len(data)))
 		incompleteParts := incompletePartsFromMap(partMap)
 		if len(incompleteParts) > 0 {
@@ -348,9 +479,15 @@ func (s *FileStore) AppendIJson(ctx context.Context, zoneId string, name string,
 				return err
 			}
 		}
+		err = checkQuota(ctx, entry.File, entry.File.Size+int64(len(data))+1)
+		if err != nil {
+			return err
+		}
 		oldSize := entry.File.Size
 		entry.writeAt(entry.File.Size, data, false)
 		entry.writeAt(entry.File.Size, []byte("\n"), false)
+		metaIncrement(entry.File, IJsonLastIdx, 1)
+		notifyFileWatchers(zoneId, name, false)
 		if oldSize == 0 {
 			return nil
 		}
@@ -369,7 +506,7 @@ func (s *FileStore) AppendIJson(ctx context.Context, zoneId string, name string,
 }
 
 func (s *FileStore) GetAllZoneIds(ctx context.Context) ([]string, error) {
-	return dbGetAllZoneIds(ctx)
+	return globalBackend.GetAllZoneIds(ctx)
 }
 
 // returns (offset, data, error)
@@ -377,6 +514,24 @@ func (s *FileStore) GetAllZoneIds(ctx context.Context) ([]string, error) {
 func (s *FileStore) ReadAt(ctx context.Context, zoneId string, name string, offset int64, size int64) (rtnOffset int64, rtnData []byte, rtnErr error) {
 	withLock(s, zoneId, name, func(entry *CacheEntry) error {
 		rtnOffset, rtnData, rtnErr = entry.readAt(ctx, offset, size, false)
+		if rtnErr != nil || rtnOffset <= offset {
+			return nil
+		}
+		// the start of the range was evicted from the circular file, fill it in from the archive (if any)
+		archiveOffset, archiveData, err := s.readArchive(ctx, zoneId, name, offset, minInt64(size, rtnOffset-offset))
+		if err != nil {
+			rtnErr = err
+			return nil
+		}
+		if len(archiveData) == 0 {
+			return nil
+		}
+		if len(rtnData) > 0 && archiveOffset+int64(len(archiveData)) != rtnOffset {
+			// gap between the archive and the live data
+			return nil
+		}
+		rtnOffset = archiveOffset
+		rtnData = append(archiveData, rtnData...)
 		return nil
 	})
 	return
@@ -0,0 +1,348 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package filestore
+
+// circular files can spill parts that are about to be overwritten into archive segments
+// segments are regular (zstd compressed) files in the same zone named <name>:archive:<idx>
+// each segment records the absolute offset of its first byte, so ReadAt can read across archive and live data
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/wavetermdev/waveterm/pkg/panichandler"
+)
+
+const (
+	ArchiveMaxBytesMetaKey = "archive:maxbytes" // set on a circular file to enable archiving (per-file budget)
+	ArchiveOffsetMetaKey   = "archive:offset"   // absolute offset of a segment's first byte
+	ArchiveSegmentInfix    = ":archive:"
+)
+
+const archiveSegmentParts = 16
+const ArchivePruneMinInterval = 10 * time.Second
+const ArchiveErrorLogInterval = time.Minute
+
+// the total budget is enforced in the background (pruning scans every zone), new segments just queue a run
+var archivePruneCh = make(chan struct{}, 1)
+
+// budget for all archive segments (0 is unlimited), enforced when segments are created
+var archiveTotalMaxBytes = &atomic.Int64{}
+
+// archiving runs on every append that wraps a circular file, so a persistent error is logged at most once per ArchiveErrorLogInterval
+var lastArchiveErrorLogTs = &atomic.Int64{}
+var suppressedArchiveErrors = &atomic.Int64{}
+
+func logArchiveError(zoneId string, name string, err error) {
+	now := time.Now().UnixMilli()
+	lastTs := lastArchiveErrorLogTs.Load()
+	if now-lastTs < ArchiveErrorLogInterval.Milliseconds() || !lastArchiveErrorLogTs.CompareAndSwap(lastTs, now) {
+		suppressedArchiveErrors.Add(1)
+		return
+	}
+	log.Printf("[filestore] error archiving %s/%s: %v (%d errors suppressed since the last log)\n", zoneId, name, err, suppressedArchiveErrors.Swap(0))
+}
+
+func SetArchiveTotalMaxBytes(maxBytes int64) {
+	archiveTotalMaxBytes.Store(maxBytes)
+}
+
+func archiveSegmentName(name string, idx int) string {
+	return fmt.Sprintf("%s%s%06d", name, ArchiveSegmentInfix, idx)
+}
+
+// returns (base file name, segment idx, ok)
+func parseArchiveSegmentName(segName string) (string, int, bool) {
+	infixIdx := strings.LastIndex(segName, ArchiveSegmentInfix)
+	if infixIdx == -1 {
+		return "", 0, false
+	}
+	idx, err := strconv.Atoi(segName[infixIdx+len(ArchiveSegmentInfix):])
+	if err != nil || idx < 0 {
+		return "", 0, false
+	}
+	return segName[:infixIdx], idx, true
+}
+
+func IsArchiveSegmentName(name string) bool {
+	_, _, ok := parseArchiveSegmentName(name)
+	return ok
+}
+
+func metaGetInt64(meta FileMeta, key string) int64 {
+	switch val := meta[key].(type) {
+	case int:
+		return int64(val)
+	case int64:
+		return val
+	case float64:
+		return int64(val)
+	default:
+		return 0
+	}
+}
+
+type archiveSegment struct {
+	Name      string
+	Idx       int
+	Offset    int64
+	Size      int64
+	CreatedTs int64
+}
+
+func (seg *archiveSegment) endOffset() int64 {
+	return seg.Offset + seg.Size
+}
+
+// returns the file's segments sorted by idx
+// must not be called while holding the lock of a segment (the base file lock is ok)
+func (s *FileStore) getArchiveSegments(ctx context.Context, zoneId string, name string) ([]*archiveSegment, error) {
+	fileNames, err := globalBackend.GetZoneFileNames(ctx, zoneId)
+	if err != nil {
+		return nil, fmt.Errorf("error getting zone files: %w", err)
+	}
+	var segments []*archiveSegment
+	for _, fileName := range fileNames {
+		baseName, idx, ok := parseArchiveSegmentName(fileName)
+		if !ok || baseName != name {
+			continue
+		}
+		segFile, err := s.Stat(ctx, zoneId, fileName)
+		if err != nil {
+			// deleted concurrently (by the global budget)
+			continue
+		}
+		segments = append(segments, &archiveSegment{
+			Name:      fileName,
+			Idx:       idx,
+			Offset:    metaGetInt64(segFile.Meta, ArchiveOffsetMetaKey),
+			Size:      segFile.Size,
+			CreatedTs: segFile.CreatedTs,
+		})
+	}
+	sort.Slice(segments, func(i, j int) bool {
+		return segments[i].Idx < segments[j].Idx
+	})
+	return segments, nil
+}
+
+func (s *FileStore) deleteArchiveSegments(ctx context.Context, zoneId string, name string) error {
+	segments, err := s.getArchiveSegments(ctx, zoneId, name)
+	if err != nil {
+		return err
+	}
+	for _, seg := range segments {
+		err = s.DeleteFile(ctx, zoneId, seg.Name)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// called with the entry lock held, before dataLen bytes are appended to the file
+// whole parts are archived when their slot starts being overwritten, so the newest segment can overlap the live data
+func (s *FileStore) archiveEvictedParts(ctx context.Context, entry *CacheEntry, dataLen int64) error {
+	file := entry.File
+	maxBytes := metaGetInt64(file.Meta, ArchiveMaxBytesMetaKey)
+	if !file.Opts.Circular || maxBytes <= 0 {
+		return nil
+	}
+	oldStart := file.DataStartIdx()
+	newStart := file.Size + dataLen - file.Opts.MaxSize
+	if newStart <= 0 {
+		return nil
+	}
+	// parts k where oldStart <= k*partDataSize < newStart
+	firstPart := (oldStart + partDataSize - 1) / partDataSize
+	lastPart := (newStart - 1) / partDataSize
+	if lastPart < firstPart {
+		return nil
+	}
+	spillStart := firstPart * partDataSize
+	spillEnd := minInt64((lastPart+1)*partDataSize, file.Size)
+	if spillEnd <= spillStart {
+		return nil
+	}
+	realOffset, data, err := entry.readAt(ctx, spillStart, spillEnd-spillStart, false)
+	if err != nil {
+		return fmt.Errorf("error reading evicted parts: %w", err)
+	}
+	return s.appendArchive(ctx, file.ZoneId, file.Name, realOffset, data, maxBytes)
+}
+
+func (s *FileStore) appendArchive(ctx context.Context, zoneId string, name string, offset int64, data []byte, maxBytes int64) error {
+	segments, err := s.getArchiveSegments(ctx, zoneId, name)
+	if err != nil {
+		return err
+	}
+	segmentSize := archiveSegmentParts * partDataSize
+	var createdSegment bool
+	for len(data) > 0 {
+		var lastSeg *archiveSegment
+		if len(segments) > 0 {
+			lastSeg = segments[len(segments)-1]
+		}
+		if lastSeg == nil || lastSeg.endOffset() != offset || lastSeg.Size >= segmentSize {
+			idx := 0
+			if lastSeg != nil {
+				idx = lastSeg.Idx + 1
+			}
+			segName := archiveSegmentName(name, idx)
+			err = s.MakeFile(ctx, zoneId, segName, FileMeta{ArchiveOffsetMetaKey: offset}, FileOptsType{Compression: Compression_Zstd})
+			if err != nil {
+				return fmt.Errorf("error creating archive segment %q: %w", segName, err)
+			}
+			lastSeg = &archiveSegment{Name: segName, Idx: idx, Offset: offset}
+			segments = append(segments, lastSeg)
+			createdSegment = true
+		}
+		toWrite := minInt64(int64(len(data)), segmentSize-lastSeg.Size)
+		err = s.AppendData(ctx, zoneId, lastSeg.Name, data[:toWrite])
+		if err != nil {
+			return fmt.Errorf("error writing archive segment %q: %w", lastSeg.Name, err)
+		}
+		lastSeg.Size += toWrite
+		offset += toWrite
+		data = data[toWrite:]
+	}
+	// the budget is enforced in whole segments (oldest first), the newest segment is always kept
+	var totalSize int64
+	for _, seg := range segments {
+		totalSize += seg.Size
+	}
+	for len(segments) > 1 && totalSize > maxBytes {
+		err = s.DeleteFile(ctx, zoneId, segments[0].Name)
+		if err != nil {
+			return err
+		}
+		totalSize -= segments[0].Size
+		segments = segments[1:]
+	}
+	if createdSegment {
+		queueArchivePrune()
+	}
+	return nil
+}
+
+func queueArchivePrune() {
+	select {
+	case archivePruneCh <- struct{}{}:
+	default:
+	}
+}
+
+// runs at most once per ArchivePruneMinInterval, so bursts of new segments are coalesced
+func runArchivePruneLoop() {
+	defer panichandler.PanicHandler("filestore archive prune")
+	for range archivePruneCh {
+		if stopFlush.Load() {
+			return
+		}
+		ctx, cancelFn := context.WithTimeout(context.Background(), time.Minute)
+		err := WFS.pruneArchives(ctx)
+		cancelFn()
+		if err != nil {
+			log.Printf("[filestore] error pruning archives: %v\n", err)
+		}
+		time.Sleep(ArchivePruneMinInterval)
+	}
+}
+
+// enforces the total archive budget across all zones by removing the oldest segments
+// must not be called while holding any entry lock (it locks every segment it stats or deletes)
+func (s *FileStore) pruneArchives(ctx context.Context) error {
+	maxBytes := archiveTotalMaxBytes.Load()
+	if maxBytes <= 0 {
+		return nil
+	}
+	zoneIds, err := globalBackend.GetAllZoneIds(ctx)
+	if err != nil {
+		return err
+	}
+	type zoneSegment struct {
+		ZoneId string
+		Seg    *WaveFile
+	}
+	var segments []zoneSegment
+	var totalSize int64
+	for _, zoneId := range zoneIds {
+		fileNames, err := globalBackend.GetZoneFileNames(ctx, zoneId)
+		if err != nil {
+			return err
+		}
+		for _, fileName := range fileNames {
+			if !IsArchiveSegmentName(fileName) {
+				continue
+			}
+			segFile, err := s.Stat(ctx, zoneId, fileName)
+			if err != nil {
+				continue
+			}
+			segments = append(segments, zoneSegment{ZoneId: zoneId, Seg: segFile})
+			totalSize += segFile.Size
+		}
+	}
+	sort.Slice(segments, func(i, j int) bool {
+		return segments[i].Seg.CreatedTs < segments[j].Seg.CreatedTs
+	})
+	var numDeleted int
+	for len(segments) > 1 && totalSize > maxBytes {
+		err = s.DeleteFile(ctx, segments[0].ZoneId, segments[0].Seg.Name)
+		if err != nil {
+			return err
+		}
+		totalSize -= segments[0].Seg.Size
+		segments = segments[1:]
+		numDeleted++
+	}
+	if numDeleted > 0 {
+		log.Printf("[filestore] archive budget exceeded, removed %d segments\n", numDeleted)
+	}
+	return nil
+}
+
+// returns (offset, data, error) for the archived bytes in [offset, offset+size)
+// the returned data is contiguous (it stops at the first gap between segments)
+func (s *FileStore) readArchive(ctx context.Context, zoneId string, name string, offset int64, size int64) (int64, []byte, error) {
+	segments, err := s.getArchiveSegments(ctx, zoneId, name)
+	if err != nil {
+		return 0, nil, err
+	}
+	endOffset := offset + size
+	rtnOffset := int64(-1)
+	var rtnData []byte
+	for _, seg := range segments {
+		readStart := max(offset, seg.Offset)
+		if rtnOffset != -1 {
+			curEnd := rtnOffset + int64(len(rtnData))
+			if seg.Offset > curEnd {
+				break
+			}
+			readStart = curEnd
+		}
+		readEnd := min(endOffset, seg.endOffset())
+		if readStart >= readEnd {
+			continue
+		}
+		_, segData, err := s.ReadAt(ctx, zoneId, seg.Name, readStart-seg.Offset, readEnd-readStart)
+		if err != nil {
+			return 0, nil, fmt.Errorf("error reading archive segment %q: %w", seg.Name, err)
+		}
+		if rtnOffset == -1 {
+			rtnOffset = readStart
+		}
+		rtnData = append(rtnData, segData...)
+	}
+	if rtnOffset == -1 {
+		return offset, nil, nil
+	}
+	return rtnOffset, rtnData, nil
+}
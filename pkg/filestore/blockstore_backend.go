@@ -0,0 +1,204 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package filestore
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"log"
+	"path/filepath"
+
+	"github.com/wavetermdev/waveterm/pkg/wavebase"
+)
+
+const (
+	Backend_SQLite    = "sqlite"
+	Backend_Directory = "directory"
+)
+
+const DefaultBackendDirName = "filestore"
+
+// storage beneath the write cache (file records and their data parts)
+// all calls for a given file are serialized by the cache entry lock
+type StorageBackend interface {
+	Type() string
+	// returns fs.ErrExist if the file already exists
+	InsertFile(ctx context.Context, file *WaveFile) error
+	DeleteFile(ctx context.Context, zoneId string, name string) error
+	// returns nil (and no error) if the file does not exist
+	GetZoneFile(ctx context.Context, zoneId string, name string) (*WaveFile, error)
+	GetZoneFiles(ctx context.Context, zoneId string) ([]*WaveFile, error)
+	GetZoneFileNames(ctx context.Context, zoneId string) ([]string, error)
+	GetAllZoneIds(ctx context.Context) ([]string, error)
+	// parts that are not stored are not included in the returned map
+	GetFileParts(ctx context.Context, zoneId string, name string, parts []int) (map[int]*DataCacheEntry, error)
+	// bytes used by the file's data parts (after compression)
+	GetFileDiskSize(ctx context.Context, zoneId string, name string) (int64, error)
+	// updates size, modts, and meta, and writes the parts (replace removes all existing parts first)
+	// returns os.ErrNotExist if the file does not exist
+	WriteCacheEntry(ctx context.Context, file *WaveFile, dataEntries map[int]*DataCacheEntry, replace bool) error
+}
+
+type BackendConfig struct {
+	Type string // defaults to Backend_SQLite
+	Dir  string // only for Backend_Directory (defaults to GetDefaultBackendDir())
+}
+
+var backendConfig BackendConfig
+var globalBackend StorageBackend
+
+// must be called before InitFilestore (changing the backend requires a restart)
+func SetBackendConfig(config BackendConfig) {
+	backendConfig = config
+}
+
+func GetBackend() StorageBackend {
+	return globalBackend
+}
+
+func GetDefaultBackendDir() string {
+	return filepath.Join(wavebase.GetWaveDataDir(), wavebase.WaveDBDir, DefaultBackendDirName)
+}
+
+// the sqlite backend uses the filestore db, so it must be initialized first
+func MakeBackend(config BackendConfig) (StorageBackend, error) {
+	switch config.Type {
+	case "", Backend_SQLite:
+		if globalDB == nil {
+			return nil, fmt.Errorf("filestore db is not initialized")
+		}
+		return &sqliteBackend{}, nil
+	case Backend_Directory:
+		dir := config.Dir
+		if dir == "" {
+			dir = GetDefaultBackendDir()
+		}
+		return makeDirBackend(dir)
+	default:
+		return nil, fmt.Errorf("invalid filestore backend %q (must be %q or %q)", config.Type, Backend_SQLite, Backend_Directory)
+	}
+}
+
+type sqliteBackend struct{}
+
+func (b *sqliteBackend) Type() string {
+	return Backend_SQLite
+}
+
+func (b *sqliteBackend) InsertFile(ctx context.Context, file *WaveFile) error {
+	return dbInsertFile(ctx, file)
+}
+
+func (b *sqliteBackend) DeleteFile(ctx context.Context, zoneId string, name string) error {
+	return dbDeleteFile(ctx, zoneId, name)
+}
+
+func (b *sqliteBackend) GetZoneFile(ctx context.Context, zoneId string, name string) (*WaveFile, error) {
+	return dbGetZoneFile(ctx, zoneId, name)
+}
+
+func (b *sqliteBackend) GetZoneFiles(ctx context.Context, zoneId string) ([]*WaveFile, error) {
+	return dbGetZoneFiles(ctx, zoneId)
+}
+
+func (b *sqliteBackend) GetZoneFileNames(ctx context.Context, zoneId string) ([]string, error) {
+	return dbGetZoneFileNames(ctx, zoneId)
+}
+
+func (b *sqliteBackend) GetAllZoneIds(ctx context.Context) ([]string, error) {
+	return dbGetAllZoneIds(ctx)
+}
+
+func (b *sqliteBackend) GetFileParts(ctx context.Context, zoneId string, name string, parts []int) (map[int]*DataCacheEntry, error) {
+	return dbGetFileParts(ctx, zoneId, name, parts)
+}
+
+func (b *sqliteBackend) GetFileDiskSize(ctx context.Context, zoneId string, name string) (int64, error) {
+	return dbGetFileDiskSize(ctx, zoneId, name)
+}
+
+func (b *sqliteBackend) WriteCacheEntry(ctx context.Context, file *WaveFile, dataEntries map[int]*DataCacheEntry, replace bool) error {
+	return dbWriteCacheEntry(ctx, file, dataEntries, replace)
+}
+
+type MigrateStats struct {
+	NumZones int
+	NumFiles int
+	NumParts int
+}
+
+// number of parts copied per write (bounds memory use for large files)
+const migratePartBatchSize = 64
+
+// copies every file from src to dst (src is not modified)
+// dst must be empty, the write cache must be flushed (or not running) before migrating
+func MigrateBackend(ctx context.Context, src StorageBackend, dst StorageBackend) (MigrateStats, error) {
+	var stats MigrateStats
+	if src.Type() == dst.Type() {
+		return stats, fmt.Errorf("cannot migrate from %q to itself", src.Type())
+	}
+	dstZoneIds, err := dst.GetAllZoneIds(ctx)
+	if err != nil {
+		return stats, fmt.Errorf("error reading destination backend: %w", err)
+	}
+	if len(dstZoneIds) > 0 {
+		return stats, fmt.Errorf("destination backend %q is not empty (%d zones)", dst.Type(), len(dstZoneIds))
+	}
+	zoneIds, err := src.GetAllZoneIds(ctx)
+	if err != nil {
+		return stats, fmt.Errorf("error getting zones: %w", err)
+	}
+	for _, zoneId := range zoneIds {
+		files, err := src.GetZoneFiles(ctx, zoneId)
+		if err != nil {
+			return stats, fmt.Errorf("error getting files for zone %s: %w", zoneId, err)
+		}
+		for _, file := range files {
+			numParts, err := migrateFile(ctx, src, dst, file)
+			if err != nil {
+				return stats, fmt.Errorf("error migrating %s/%s: %w", zoneId, file.Name, err)
+			}
+			stats.NumFiles++
+			stats.NumParts += numParts
+		}
+		stats.NumZones++
+	}
+	log.Printf("[filestore] migrated %d zones, %d files, %d parts from %s to %s\n", stats.NumZones, stats.NumFiles, stats.NumParts, src.Type(), dst.Type())
+	return stats, nil
+}
+
+func migrateFile(ctx context.Context, src StorageBackend, dst StorageBackend, file *WaveFile) (int, error) {
+	err := dst.InsertFile(ctx, file)
+	if err == fs.ErrExist {
+		return 0, fmt.Errorf("file already exists in destination")
+	}
+	if err != nil {
+		return 0, err
+	}
+	maxPart := int((file.Size + partDataSize - 1) / partDataSize)
+	if file.Opts.Circular {
+		maxPart = min(maxPart, int(file.Opts.MaxSize/partDataSize))
+	}
+	var numParts int
+	for startPart := 0; startPart < maxPart; startPart += migratePartBatchSize {
+		var parts []int
+		for partIdx := startPart; partIdx < min(startPart+migratePartBatchSize, maxPart); partIdx++ {
+			parts = append(parts, partIdx)
+		}
+		dataEntries, err := src.GetFileParts(ctx, file.ZoneId, file.Name, parts)
+		if err != nil {
+			return numParts, err
+		}
+		if len(dataEntries) == 0 {
+			continue
+		}
+		err = dst.WriteCacheEntry(ctx, file, dataEntries, false)
+		if err != nil {
+			return numParts, err
+		}
+		numParts += len(dataEntries)
+	}
+	return numParts, nil
+}
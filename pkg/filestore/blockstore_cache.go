@@ -8,6 +8,7 @@ import (
 	"context"
 	"fmt"
 	"io/fs"
+	"log"
 	"sync"
 	"time"
 )
@@ -115,7 +116,7 @@ func (entry *CacheEntry) loadFileForRead(ctx context.Context) (*WaveFile, error)
 	if entry.File != nil {
 		return entry.File, nil
 	}
-	file, err := dbGetZoneFile(ctx, entry.ZoneId, entry.Name)
+	file, err := globalBackend.GetZoneFile(ctx, entry.ZoneId, entry.Name)
 	if err != nil {
 		return nil, fmt.Errorf("error getting file: %w", err)
 	}
@@ -231,6 +232,9 @@ func (entry *CacheEntry) readAt(ctx context.Context, offset int64, size int64, r
 			return realDataOffset, nil, nil
 		}
 	}
+	if size <= 0 {
+		return offset, nil, nil
+	}
 	partMap := file.computePartMap(offset, size)
 	dataEntryMap, err := entry.loadDataPartsForRead(ctx, getPartIdxsFromMap(partMap))
 	if err != nil {
@@ -276,7 +280,7 @@ func (entry *CacheEntry) loadDataPartsIntoCache(ctx context.Context, parts []int
 		// parts are already loaded
 		return nil
 	}
-	dbDataParts, err := dbGetFileParts(ctx, entry.ZoneId, entry.Name, parts)
+	dbDataParts, err := globalBackend.GetFileParts(ctx, entry.ZoneId, entry.Name, parts)
 	if err != nil {
 		return fmt.Errorf("error getting data parts: %w", err)
 	}
@@ -294,7 +298,7 @@ func (entry *CacheEntry) loadDataPartsForRead(ctx context.Context, parts []int)
 	var dbDataParts map[int]*DataCacheEntry
 	if len(dbParts) > 0 {
 		var err error
-		dbDataParts, err = dbGetFileParts(ctx, entry.ZoneId, entry.Name, dbParts)
+		dbDataParts, err = globalBackend.GetFileParts(ctx, entry.ZoneId, entry.Name, dbParts)
 		if err != nil {
 			return nil, fmt.Errorf("error getting data parts: %w", err)
 		}
@@ -326,11 +330,22 @@ func makeCacheEntry(zoneId string, name string) *CacheEntry {
 	}
 }
 
+// large (compressed) files would otherwise hold up to MaxSize of raw data in memory between flushes
+func (entry *CacheEntry) flushIfOverCacheLimit(ctx context.Context) {
+	if int64(len(entry.DataEntries))*partDataSize <= MaxCacheEntryDataSize {
+		return
+	}
+	err := entry.flushToDB(ctx, false)
+	if err != nil {
+		log.Printf("[filestore] error flushing %s/%s (over cache limit): %v\n", entry.ZoneId, entry.Name, err)
+	}
+}
+
 func (entry *CacheEntry) flushToDB(ctx context.Context, replace bool) error {
 	if entry.File == nil {
 		return nil
 	}
-	err := dbWriteCacheEntry(ctx, entry.File, entry.DataEntries, replace)
+	err := globalBackend.WriteCacheEntry(ctx, entry.File, entry.DataEntries, replace)
 	if ctx.Err() != nil {
 		// transient error
 		return ctx.Err()
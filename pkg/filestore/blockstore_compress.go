@@ -0,0 +1,110 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package filestore
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	Compression_None = ""
+	Compression_Zstd = "zstd"
+	Compression_Gzip = "gzip"
+)
+
+var zstdOnce = &sync.Once{}
+var zstdEncoder *zstd.Encoder
+var zstdDecoder *zstd.Decoder
+var zstdInitErr error
+
+func initZstd() error {
+	zstdOnce.Do(func() {
+		zstdEncoder, zstdInitErr = zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1))
+		if zstdInitErr != nil {
+			return
+		}
+		zstdDecoder, zstdInitErr = zstd.NewReader(nil, zstd.WithDecoderConcurrency(1))
+	})
+	return zstdInitErr
+}
+
+func validateCompression(codec string) error {
+	switch codec {
+	case Compression_None, Compression_Zstd, Compression_Gzip:
+		return nil
+	default:
+		return fmt.Errorf("invalid compression %q (must be %q or %q)", codec, Compression_Zstd, Compression_Gzip)
+	}
+}
+
+// returns the data to store and the codec it was stored with
+// if compression does not shrink the part it is stored raw (codec "")
+func compressPart(codec string, data []byte) ([]byte, string, error) {
+	var compressed []byte
+	switch codec {
+	case Compression_None:
+		return data, Compression_None, nil
+	case Compression_Zstd:
+		err := initZstd()
+		if err != nil {
+			return nil, "", fmt.Errorf("error initializing zstd: %w", err)
+		}
+		compressed = zstdEncoder.EncodeAll(data, nil)
+	case Compression_Gzip:
+		var buf bytes.Buffer
+		writer := gzip.NewWriter(&buf)
+		_, err := writer.Write(data)
+		if err != nil {
+			return nil, "", fmt.Errorf("error compressing part: %w", err)
+		}
+		err = writer.Close()
+		if err != nil {
+			return nil, "", fmt.Errorf("error compressing part: %w", err)
+		}
+		compressed = buf.Bytes()
+	default:
+		return nil, "", fmt.Errorf("invalid compression %q", codec)
+	}
+	if len(compressed) >= len(data) {
+		return data, Compression_None, nil
+	}
+	return compressed, codec, nil
+}
+
+// the codec comes from the stored part (not the file opts)
+func decompressPart(codec string, data []byte) ([]byte, error) {
+	switch codec {
+	case Compression_None:
+		return data, nil
+	case Compression_Zstd:
+		err := initZstd()
+		if err != nil {
+			return nil, fmt.Errorf("error initializing zstd: %w", err)
+		}
+		rtn, err := zstdDecoder.DecodeAll(data, make([]byte, 0, partDataSize))
+		if err != nil {
+			return nil, fmt.Errorf("error decompressing part: %w", err)
+		}
+		return rtn, nil
+	case Compression_Gzip:
+		reader, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("error decompressing part: %w", err)
+		}
+		defer reader.Close()
+		rtn, err := io.ReadAll(reader)
+		if err != nil {
+			return nil, fmt.Errorf("error decompressing part: %w", err)
+		}
+		return rtn, nil
+	default:
+		return nil, fmt.Errorf("unknown part codec %q", codec)
+	}
+}
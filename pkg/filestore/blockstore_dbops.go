@@ -62,27 +62,45 @@ func dbGetAllZoneIds(ctx context.Context) ([]string, error) {
 	})
 }
 
+type dbFilePart struct {
+	PartIdx int    `db:"partidx"`
+	Data    []byte `db:"data"`
+	Codec   string `db:"codec"`
+}
+
 func dbGetFileParts(ctx context.Context, zoneId string, name string, parts []int) (map[int]*DataCacheEntry, error) {
 	if len(parts) == 0 {
 		return nil, nil
 	}
 	return WithTxRtn(ctx, func(tx *TxWrap) (map[int]*DataCacheEntry, error) {
-		var data []*DataCacheEntry
-		query := "SELECT partidx, data FROM db_file_data WHERE zoneid = ? AND name = ? AND partidx IN (SELECT value FROM json_each(?))"
-		tx.Select(&data, query, zoneId, name, dbutil.QuickJsonArr(parts))
+		var dbParts []*dbFilePart
+		query := "SELECT partidx, data, codec FROM db_file_data WHERE zoneid = ? AND name = ? AND partidx IN (SELECT value FROM json_each(?))"
+		tx.Select(&dbParts, query, zoneId, name, dbutil.QuickJsonArr(parts))
 		rtn := make(map[int]*DataCacheEntry)
-		for _, d := range data {
-			if cap(d.Data) != int(partDataSize) {
-				newData := make([]byte, len(d.Data), partDataSize)
-				copy(newData, d.Data)
-				d.Data = newData
+		for _, p := range dbParts {
+			data, err := decompressPart(p.Codec, p.Data)
+			if err != nil {
+				return nil, fmt.Errorf("error reading part %d of %s/%s: %w", p.PartIdx, zoneId, name, err)
 			}
-			rtn[d.PartIdx] = d
+			if cap(data) != int(partDataSize) {
+				newData := make([]byte, len(data), partDataSize)
+				copy(newData, data)
+				data = newData
+			}
+			rtn[p.PartIdx] = &DataCacheEntry{PartIdx: p.PartIdx, Data: data}
 		}
 		return rtn, nil
 	})
 }
 
+// returns the number of bytes stored for the file's parts (after compression)
+func dbGetFileDiskSize(ctx context.Context, zoneId string, name string) (int64, error) {
+	return WithTxRtn(ctx, func(tx *TxWrap) (int64, error) {
+		query := "SELECT COALESCE(SUM(length(data)), 0) FROM db_file_data WHERE zoneid = ? AND name = ?"
+		return tx.GetInt64(query, zoneId, name), nil
+	})
+}
+
 func dbGetZoneFiles(ctx context.Context, zoneId string) ([]*WaveFile, error) {
 	return WithTxRtn(ctx, func(tx *TxWrap) ([]*WaveFile, error) {
 		query := "SELECT * FROM db_wave_file WHERE zoneid = ?"
@@ -98,19 +116,24 @@ func dbWriteCacheEntry(ctx context.Context, file *WaveFile, dataEntries map[int]
 			// since deletion is synchronous this stops us from writing to a deleted file
 			return os.ErrNotExist
 		}
-		// we don't update CreatedTs or Opts
-		query = `UPDATE db_wave_file SET size = ?, modts = ?, meta = ? WHERE zoneid = ? AND name = ?`
-		tx.Exec(query, file.Size, file.ModTs, dbutil.QuickJson(file.Meta), file.ZoneId, file.Name)
+		// we don't update CreatedTs (opts are updated so a compression change is persisted)
+		query = `UPDATE db_wave_file SET size = ?, modts = ?, meta = ?, opts = ? WHERE zoneid = ? AND name = ?`
+		tx.Exec(query, file.Size, file.ModTs, dbutil.QuickJson(file.Meta), dbutil.QuickJson(file.Opts), file.ZoneId, file.Name)
 		if replace {
 			query = `DELETE FROM db_file_data WHERE zoneid = ? AND name = ?`
 			tx.Exec(query, file.ZoneId, file.Name)
 		}
-		dataPartQuery := `REPLACE INTO db_file_data (zoneid, name, partidx, data) VALUES (?, ?, ?, ?)`
+		dataPartQuery := `REPLACE INTO db_file_data (zoneid, name, partidx, data, codec) VALUES (?, ?, ?, ?, ?)`
 		for partIdx, dataEntry := range dataEntries {
 			if partIdx != dataEntry.PartIdx {
 				panic(fmt.Sprintf("partIdx:%d and dataEntry.PartIdx:%d do not match", partIdx, dataEntry.PartIdx))
 			}
-			tx.Exec(dataPartQuery, file.ZoneId, file.Name, dataEntry.PartIdx, dataEntry.Data)
+			// the compressed data goes into a new buffer, the cached part is never modified
+			data, codec, err := compressPart(file.Opts.Compression, dataEntry.Data)
+			if err != nil {
+				return err
+			}
+			tx.Exec(dataPartQuery, file.ZoneId, file.Name, dataEntry.PartIdx, data, codec)
 		}
 		return nil
 	})
@@ -42,10 +42,16 @@ func InitFilestore() error {
 	if err != nil {
 		return err
 	}
+	globalBackend, err = MakeBackend(backendConfig)
+	if err != nil {
+		return err
+	}
 	if !stopFlush.Load() {
 		go WFS.runFlusher()
+		go runVacuumLoop()
+		go runArchivePruneLoop()
 	}
-	log.Printf("filestore initialized\n")
+	log.Printf("filestore initialized (backend %s)\n", globalBackend.Type())
 	return nil
 }
 
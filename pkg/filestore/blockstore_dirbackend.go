@@ -0,0 +1,359 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package filestore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// stores each file as a directory with a json record and one file per part:
+//
+//	<dir>/<escaped zoneid>/<escaped name>/wavefile.json
+//	<dir>/<escaped zoneid>/<escaped name>/00000000.part[.zst|.gz]
+//
+// escaped names have a prefix, so zone ids and file names like "", "." or ".." cannot escape the directory
+// the extension records the part's codec, so parts can be read with normal tools (e.g. zstdcat)
+type dirBackend struct {
+	Lock *sync.Mutex // guards creating and removing zone directories
+	Dir  string
+}
+
+const dirBackendFileRecord = "wavefile.json"
+const dirBackendPartExt = ".part"
+const dirBackendNamePrefix = "_"
+
+var partCodecExts = map[string]string{
+	Compression_None: "",
+	Compression_Zstd: ".zst",
+	Compression_Gzip: ".gz",
+}
+
+func makeDirBackend(dir string) (*dirBackend, error) {
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create filestore directory %q: %w", dir, err)
+	}
+	return &dirBackend{Lock: &sync.Mutex{}, Dir: dir}, nil
+}
+
+func (b *dirBackend) Type() string {
+	return Backend_Directory
+}
+
+func escapeDirName(name string) string {
+	return dirBackendNamePrefix + url.QueryEscape(name)
+}
+
+// returns ok=false for directories that were not created by escapeDirName
+func unescapeDirName(dirName string) (string, bool) {
+	escaped, found := strings.CutPrefix(dirName, dirBackendNamePrefix)
+	if !found {
+		return "", false
+	}
+	name, err := url.QueryUnescape(escaped)
+	if err != nil {
+		return "", false
+	}
+	return name, true
+}
+
+func (b *dirBackend) zoneDir(zoneId string) string {
+	return filepath.Join(b.Dir, escapeDirName(zoneId))
+}
+
+func (b *dirBackend) fileDir(zoneId string, name string) string {
+	return filepath.Join(b.zoneDir(zoneId), escapeDirName(name))
+}
+
+// a second check before creating or removing directories (a file dir is always two levels under b.Dir)
+func (b *dirBackend) checkFileDir(fileDir string) error {
+	relPath, err := filepath.Rel(b.Dir, fileDir)
+	if err != nil || len(strings.Split(relPath, string(filepath.Separator))) != 2 || strings.HasPrefix(relPath, "..") {
+		return fmt.Errorf("invalid filestore path %q", fileDir)
+	}
+	return nil
+}
+
+func partFileName(partIdx int, codec string) string {
+	return fmt.Sprintf("%08d%s%s", partIdx, dirBackendPartExt, partCodecExts[codec])
+}
+
+// returns (partIdx, codec, ok)
+func parsePartFileName(fileName string) (int, string, bool) {
+	base, ext, found := strings.Cut(fileName, dirBackendPartExt)
+	if !found {
+		return 0, "", false
+	}
+	partIdx, err := strconv.Atoi(base)
+	if err != nil || partIdx < 0 {
+		return 0, "", false
+	}
+	for codec, codecExt := range partCodecExts {
+		if ext == codecExt {
+			return partIdx, codec, true
+		}
+	}
+	return 0, "", false
+}
+
+// writes to a temp file and renames it, so readers never see a partial file
+func writeFileAtomic(fileName string, data []byte) error {
+	tempName := fileName + ".temp"
+	err := os.WriteFile(tempName, data, 0600)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tempName, fileName)
+}
+
+func (b *dirBackend) readFileRecord(fileDir string) (*WaveFile, error) {
+	barr, err := os.ReadFile(filepath.Join(fileDir, dirBackendFileRecord))
+	if err != nil {
+		return nil, err
+	}
+	var file WaveFile
+	err = json.Unmarshal(barr, &file)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing %s: %w", filepath.Join(fileDir, dirBackendFileRecord), err)
+	}
+	return &file, nil
+}
+
+func (b *dirBackend) writeFileRecord(fileDir string, file *WaveFile) error {
+	barr, err := json.Marshal(file)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(fileDir, dirBackendFileRecord), barr)
+}
+
+// returns partIdx -> part file name
+func readPartFileNames(fileDir string) (map[int]string, error) {
+	dirEntries, err := os.ReadDir(fileDir)
+	if err != nil {
+		return nil, err
+	}
+	rtn := make(map[int]string)
+	for _, dirEntry := range dirEntries {
+		partIdx, _, ok := parsePartFileName(dirEntry.Name())
+		if ok {
+			rtn[partIdx] = dirEntry.Name()
+		}
+	}
+	return rtn, nil
+}
+
+func (b *dirBackend) InsertFile(ctx context.Context, file *WaveFile) error {
+	b.Lock.Lock()
+	defer b.Lock.Unlock()
+	fileDir := b.fileDir(file.ZoneId, file.Name)
+	if err := b.checkFileDir(fileDir); err != nil {
+		return err
+	}
+	if _, err := os.Stat(filepath.Join(fileDir, dirBackendFileRecord)); err == nil {
+		return fs.ErrExist
+	}
+	err := os.MkdirAll(fileDir, 0700)
+	if err != nil {
+		return fmt.Errorf("cannot create file directory: %w", err)
+	}
+	return b.writeFileRecord(fileDir, file)
+}
+
+func (b *dirBackend) DeleteFile(ctx context.Context, zoneId string, name string) error {
+	b.Lock.Lock()
+	defer b.Lock.Unlock()
+	fileDir := b.fileDir(zoneId, name)
+	if err := b.checkFileDir(fileDir); err != nil {
+		return err
+	}
+	err := os.RemoveAll(fileDir)
+	if err != nil {
+		return err
+	}
+	// only succeeds if this was the last file in the zone
+	os.Remove(b.zoneDir(zoneId))
+	return nil
+}
+
+func (b *dirBackend) GetZoneFile(ctx context.Context, zoneId string, name string) (*WaveFile, error) {
+	file, err := b.readFileRecord(b.fileDir(zoneId, name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	return file, err
+}
+
+func (b *dirBackend) GetZoneFiles(ctx context.Context, zoneId string) ([]*WaveFile, error) {
+	zoneDir := b.zoneDir(zoneId)
+	dirEntries, err := os.ReadDir(zoneDir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var files []*WaveFile
+	for _, dirEntry := range dirEntries {
+		if !dirEntry.IsDir() {
+			continue
+		}
+		file, err := b.readFileRecord(filepath.Join(zoneDir, dirEntry.Name()))
+		if errors.Is(err, fs.ErrNotExist) {
+			// directory without a record (partially deleted)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+func (b *dirBackend) GetZoneFileNames(ctx context.Context, zoneId string) ([]string, error) {
+	files, err := b.GetZoneFiles(ctx, zoneId)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, file := range files {
+		names = append(names, file.Name)
+	}
+	return names, nil
+}
+
+func (b *dirBackend) GetAllZoneIds(ctx context.Context) ([]string, error) {
+	dirEntries, err := os.ReadDir(b.Dir)
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for _, dirEntry := range dirEntries {
+		if !dirEntry.IsDir() {
+			continue
+		}
+		zoneId, ok := unescapeDirName(dirEntry.Name())
+		if !ok {
+			continue
+		}
+		ids = append(ids, zoneId)
+	}
+	return ids, nil
+}
+
+func (b *dirBackend) GetFileParts(ctx context.Context, zoneId string, name string, parts []int) (map[int]*DataCacheEntry, error) {
+	if len(parts) == 0 {
+		return nil, nil
+	}
+	fileDir := b.fileDir(zoneId, name)
+	partFiles, err := readPartFileNames(fileDir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	rtn := make(map[int]*DataCacheEntry)
+	for _, partIdx := range parts {
+		partFile, ok := partFiles[partIdx]
+		if !ok {
+			continue
+		}
+		_, codec, _ := parsePartFileName(partFile)
+		barr, err := os.ReadFile(filepath.Join(fileDir, partFile))
+		if err != nil {
+			return nil, fmt.Errorf("error reading part %d of %s/%s: %w", partIdx, zoneId, name, err)
+		}
+		data, err := decompressPart(codec, barr)
+		if err != nil {
+			return nil, fmt.Errorf("error reading part %d of %s/%s: %w", partIdx, zoneId, name, err)
+		}
+		if cap(data) != int(partDataSize) {
+			newData := make([]byte, len(data), partDataSize)
+			copy(newData, data)
+			data = newData
+		}
+		rtn[partIdx] = &DataCacheEntry{PartIdx: partIdx, Data: data}
+	}
+	return rtn, nil
+}
+
+func (b *dirBackend) GetFileDiskSize(ctx context.Context, zoneId string, name string) (int64, error) {
+	fileDir := b.fileDir(zoneId, name)
+	partFiles, err := readPartFileNames(fileDir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	var size int64
+	for _, partFile := range partFiles {
+		finfo, err := os.Stat(filepath.Join(fileDir, partFile))
+		if err != nil {
+			return 0, err
+		}
+		size += finfo.Size()
+	}
+	return size, nil
+}
+
+func (b *dirBackend) WriteCacheEntry(ctx context.Context, file *WaveFile, dataEntries map[int]*DataCacheEntry, replace bool) error {
+	fileDir := b.fileDir(file.ZoneId, file.Name)
+	dbFile, err := b.readFileRecord(fileDir)
+	if errors.Is(err, fs.ErrNotExist) {
+		// since deletion is synchronous this stops us from writing to a deleted file
+		return os.ErrNotExist
+	}
+	if err != nil {
+		return err
+	}
+	partFiles, err := readPartFileNames(fileDir)
+	if err != nil {
+		return err
+	}
+	if replace {
+		for partIdx, partFile := range partFiles {
+			err = os.Remove(filepath.Join(fileDir, partFile))
+			if err != nil {
+				return err
+			}
+			delete(partFiles, partIdx)
+		}
+	}
+	for partIdx, dataEntry := range dataEntries {
+		if partIdx != dataEntry.PartIdx {
+			panic(fmt.Sprintf("partIdx:%d and dataEntry.PartIdx:%d do not match", partIdx, dataEntry.PartIdx))
+		}
+		data, codec, err := compressPart(file.Opts.Compression, dataEntry.Data)
+		if err != nil {
+			return err
+		}
+		newPartFile := partFileName(partIdx, codec)
+		err = writeFileAtomic(filepath.Join(fileDir, newPartFile), data)
+		if err != nil {
+			return err
+		}
+		if oldPartFile, ok := partFiles[partIdx]; ok && oldPartFile != newPartFile {
+			os.Remove(filepath.Join(fileDir, oldPartFile))
+		}
+	}
+	// we don't update CreatedTs (opts are updated so a compression change is persisted)
+	dbFile.Size = file.Size
+	dbFile.Opts = file.Opts
+	dbFile.ModTs = file.ModTs
+	dbFile.Meta = file.Meta
+	return b.writeFileRecord(fileDir, dbFile)
+}
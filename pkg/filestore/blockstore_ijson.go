@@ -0,0 +1,139 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package filestore
+
+// point-in-time reads and undo for ijson files
+// every command appended with AppendIJson is stamped with an idx and ts, compaction replaces the
+// older commands with a root set (stamped with the idx of the last command it replaced), so the
+// history that can be read or undone is the commands kept by the IJsonHistory option
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/wavetermdev/waveterm/pkg/ijson"
+)
+
+var ErrIJsonHistoryUnavailable = errors.New("ijson history not available")
+
+// must hold the entry lock
+func readIJsonCommands(ctx context.Context, entry *CacheEntry) (*WaveFile, []ijson.Command, error) {
+	file, err := entry.loadFileForRead(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !file.Opts.IJson {
+		return nil, nil, fmt.Errorf("file %s:%s is not an ijson file", entry.ZoneId, entry.Name)
+	}
+	_, fullData, err := entry.readAt(ctx, 0, 0, true)
+	if err != nil {
+		return nil, nil, err
+	}
+	commands, err := ijson.ParseIJson(fullData)
+	if err != nil {
+		return nil, nil, err
+	}
+	return file, commands, nil
+}
+
+// returns the commands stored in the file (oldest first, the first is usually a compacted root set)
+func (s *FileStore) ReadIJsonLog(ctx context.Context, zoneId string, name string) ([]ijson.Command, error) {
+	return withLockRtn(s, zoneId, name, func(entry *CacheEntry) ([]ijson.Command, error) {
+		_, commands, err := readIJsonCommands(ctx, entry)
+		return commands, err
+	})
+}
+
+// returns the state of the document as of command idx (if idx > 0) or as of the last command written at or before ts
+// also returns the last command that was applied
+func (s *FileStore) ReadIJsonAt(ctx context.Context, zoneId string, name string, idx int, ts int64) (any, ijson.Command, error) {
+	if idx <= 0 && ts <= 0 {
+		return nil, nil, fmt.Errorf("idx or ts must be set")
+	}
+	var file *WaveFile
+	var commands []ijson.Command
+	err := withLock(s, zoneId, name, func(entry *CacheEntry) error {
+		var err error
+		file, commands, err = readIJsonCommands(ctx, entry)
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(commands) == 0 {
+		return nil, nil, fmt.Errorf("%w: file is empty", ErrIJsonHistoryUnavailable)
+	}
+	isBefore := func(cmd ijson.Command) bool {
+		if idx > 0 {
+			return ijson.GetCommandIdx(cmd) <= idx
+		}
+		return ijson.GetCommandTs(cmd) <= ts
+	}
+	if !isBefore(commands[0]) {
+		firstCmd := commands[0]
+		return nil, nil, fmt.Errorf("%w: oldest command is %d (%s)", ErrIJsonHistoryUnavailable, ijson.GetCommandIdx(firstCmd), time.UnixMilli(ijson.GetCommandTs(firstCmd)).Format(time.DateTime))
+	}
+	var data any
+	var lastCmd ijson.Command
+	for _, cmd := range commands {
+		if !isBefore(cmd) {
+			break
+		}
+		data, err = ijson.ApplyCommand(data, cmd, file.Opts.IJsonBudget)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error applying ijson command: %w", err)
+		}
+		lastCmd = cmd
+	}
+	return data, lastCmd, nil
+}
+
+// removes the last count commands, returns the idx of the new last command
+// the oldest command in the file (usually the compacted root set) cannot be undone
+func (s *FileStore) UndoIJson(ctx context.Context, zoneId string, name string, count int) (int, error) {
+	if count <= 0 {
+		return 0, fmt.Errorf("count must be positive")
+	}
+	return withLockRtn(s, zoneId, name, func(entry *CacheEntry) (int, error) {
+		err := entry.loadFileIntoCache(ctx)
+		if err != nil {
+			return 0, err
+		}
+		_, commands, err := readIJsonCommands(ctx, entry)
+		if err != nil {
+			return 0, err
+		}
+		if count >= len(commands) {
+			return 0, fmt.Errorf("%w: can only undo %d commands", ErrIJsonHistoryUnavailable, max(len(commands)-1, 0))
+		}
+		commands = commands[:len(commands)-count]
+		var newBytes []byte
+		for _, cmd := range commands {
+			barr, err := json.Marshal(cmd)
+			if err != nil {
+				return 0, fmt.Errorf("error marshalling ijson command to json: %w", err)
+			}
+			newBytes = append(newBytes, barr...)
+			newBytes = append(newBytes, '\n')
+		}
+		checkQuota(ctx, entry.File, int64(len(newBytes)))
+		entry.writeAt(0, newBytes, true)
+		lastIdx := ijson.GetCommandIdx(commands[len(commands)-1])
+		if entry.File.Meta == nil {
+			entry.File.Meta = make(FileMeta)
+		}
+		entry.File.Meta[IJsonLastIdx] = lastIdx
+		entry.File.Meta[IJsonNumCommands] = max(metaGetInt(entry.File, IJsonNumCommands)-count, 0)
+		notifyFileWatchers(zoneId, name, true)
+		// like WriteFile, the file was truncated so it needs to be flushed immediately
+		err = entry.flushToDB(ctx, true)
+		if err != nil {
+			return 0, err
+		}
+		return lastIdx, nil
+	})
+}
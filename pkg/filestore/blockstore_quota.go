@@ -0,0 +1,248 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package filestore
+
+// quotas limit the (uncompressed) bytes stored per zone and across all zones, they are off unless configured
+// only writes that grow a file are checked, so a zone over its quota can still be truncated or overwritten
+// circular files count as their MaxSize at most (so appends to a full circular file never fail)
+// archive segments are not counted (they have their own budgets, see blockstore_archive.go)
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/wavetermdev/waveterm/pkg/wps"
+)
+
+// the EC- prefix lets the error be matched after it crosses an rpc boundary (see wshrpc.MakeRemoteError)
+var ErrQuotaExceeded = errors.New("EC-QUOTA: storage quota exceeded")
+
+// a warning event is published when usage goes over this fraction of a quota
+const QuotaWarningRatio = 0.9
+
+const (
+	quotaLevelOk = iota
+	quotaLevelWarning
+	quotaLevelExceeded
+)
+
+const quotaLoadTimeout = 30 * time.Second
+
+type QuotaConfig struct {
+	ZoneMaxBytes  int64 // 0 is unlimited
+	TotalMaxBytes int64 // 0 is unlimited
+}
+
+// from the filestore:zonemaxbytes and filestore:totalmaxbytes settings (unset or <= 0 is unlimited)
+func MakeQuotaConfig(zoneMaxBytes int64, totalMaxBytes int64) QuotaConfig {
+	return QuotaConfig{
+		ZoneMaxBytes:  max(zoneMaxBytes, 0),
+		TotalMaxBytes: max(totalMaxBytes, 0),
+	}
+}
+
+func (c QuotaConfig) enabled() bool {
+	return c.ZoneMaxBytes > 0 || c.TotalMaxBytes > 0
+}
+
+// usage is only tracked while quotas are enabled (it is loaded from the backend when they are turned on)
+// writes are not checked until the usage is loaded, and sizes of files written during the load (or with
+// unflushed writes) are slightly stale until the file is written again
+type quotaUsage struct {
+	Lock      *sync.Mutex
+	Config    QuotaConfig
+	Loaded    bool
+	FileSizes map[cacheKey]int64
+	ZoneSizes map[string]int64
+	TotalSize int64
+	Levels    map[string]int // zoneid ("" for the total) -> quotaLevel
+}
+
+var globalQuota = &quotaUsage{Lock: &sync.Mutex{}}
+
+// usage is loaded here (not under an entry lock), so this must not be called while holding an entry lock
+func SetQuotaConfig(config QuotaConfig) {
+	if !globalQuota.setConfig(config) {
+		return
+	}
+	ctx, cancelFn := context.WithTimeout(context.Background(), quotaLoadTimeout)
+	defer cancelFn()
+	err := globalQuota.load(ctx, config)
+	if err != nil {
+		// writes are not checked until the config changes again
+		log.Printf("[filestore] error loading quota usage: %v\n", err)
+	}
+}
+
+// returns true if the usage needs to be loaded
+func (q *quotaUsage) setConfig(config QuotaConfig) bool {
+	q.Lock.Lock()
+	defer q.Lock.Unlock()
+	if config == q.Config {
+		return false
+	}
+	wasEnabled := q.Config.enabled()
+	q.Config = config
+	q.Levels = make(map[string]int)
+	if !config.enabled() || !wasEnabled {
+		q.Loaded = false
+		q.FileSizes = nil
+		q.ZoneSizes = nil
+		q.TotalSize = 0
+	}
+	return config.enabled() && !q.Loaded
+}
+
+func storedSize(file *WaveFile, size int64) int64 {
+	if file.Opts.Circular && file.Opts.MaxSize > 0 {
+		return minInt64(size, file.Opts.MaxSize)
+	}
+	return size
+}
+
+// reads every zone's file sizes without holding q.Lock, the result is discarded if the config changed in the meantime
+func (q *quotaUsage) load(ctx context.Context, config QuotaConfig) error {
+	zoneIds, err := globalBackend.GetAllZoneIds(ctx)
+	if err != nil {
+		return fmt.Errorf("error getting zones: %w", err)
+	}
+	fileSizes := make(map[cacheKey]int64)
+	zoneSizes := make(map[string]int64)
+	var totalSize int64
+	for _, zoneId := range zoneIds {
+		files, err := globalBackend.GetZoneFiles(ctx, zoneId)
+		if err != nil {
+			return fmt.Errorf("error getting zone files: %w", err)
+		}
+		for _, file := range files {
+			if IsArchiveSegmentName(file.Name) {
+				continue
+			}
+			size := storedSize(file, file.Size)
+			fileSizes[cacheKey{ZoneId: zoneId, Name: file.Name}] = size
+			zoneSizes[zoneId] += size
+			totalSize += size
+		}
+	}
+	q.Lock.Lock()
+	defer q.Lock.Unlock()
+	if q.Config != config || q.Loaded {
+		return nil
+	}
+	q.FileSizes = fileSizes
+	q.ZoneSizes = zoneSizes
+	q.TotalSize = totalSize
+	q.Loaded = true
+	return nil
+}
+
+// must hold q.Lock
+func (q *quotaUsage) setFileSize(key cacheKey, size int64) {
+	delta := size - q.FileSizes[key]
+	if size < 0 {
+		delta = -q.FileSizes[key]
+		delete(q.FileSizes, key)
+	} else {
+		q.FileSizes[key] = size
+	}
+	q.ZoneSizes[key.ZoneId] += delta
+	if q.ZoneSizes[key.ZoneId] <= 0 {
+		delete(q.ZoneSizes, key.ZoneId)
+	}
+	q.TotalSize += delta
+}
+
+// must hold q.Lock, returns the event to publish if the level changed
+func (q *quotaUsage) updateLevel(zoneId string, usage int64, limit int64) *wps.WSQuotaEventData {
+	level := quotaLevelOk
+	if limit > 0 && usage > limit {
+		level = quotaLevelExceeded
+	} else if limit > 0 && float64(usage) >= float64(limit)*QuotaWarningRatio {
+		level = quotaLevelWarning
+	}
+	if level == q.Levels[zoneId] {
+		return nil
+	}
+	q.Levels[zoneId] = level
+	if level == quotaLevelOk {
+		return nil
+	}
+	return &wps.WSQuotaEventData{ZoneId: zoneId, Usage: usage, Limit: limit, Exceeded: level == quotaLevelExceeded}
+}
+
+// called with the entry lock held, before a write that changes the file size to newSize
+// returns ErrQuotaExceeded (and does not record the new size) if the write grows the file past a quota
+func checkQuota(ctx context.Context, file *WaveFile, newSize int64) error {
+	if IsArchiveSegmentName(file.Name) {
+		return nil
+	}
+	q := globalQuota
+	var events []*wps.WSQuotaEventData
+	err := func() error {
+		q.Lock.Lock()
+		defer q.Lock.Unlock()
+		if !q.Config.enabled() || !q.Loaded {
+			return nil
+		}
+		key := cacheKey{ZoneId: file.ZoneId, Name: file.Name}
+		newStored := storedSize(file, newSize)
+		delta := newStored - q.FileSizes[key]
+		zoneUsage := q.ZoneSizes[file.ZoneId] + delta
+		totalUsage := q.TotalSize + delta
+		if delta > 0 && q.Config.ZoneMaxBytes > 0 && zoneUsage > q.Config.ZoneMaxBytes {
+			if event := q.updateLevel(file.ZoneId, zoneUsage, q.Config.ZoneMaxBytes); event != nil {
+				events = append(events, event)
+			}
+			return fmt.Errorf("%w: zone %s would use %d bytes (limit %d)", ErrQuotaExceeded, file.ZoneId, zoneUsage, q.Config.ZoneMaxBytes)
+		}
+		if delta > 0 && q.Config.TotalMaxBytes > 0 && totalUsage > q.Config.TotalMaxBytes {
+			if event := q.updateLevel("", totalUsage, q.Config.TotalMaxBytes); event != nil {
+				events = append(events, event)
+			}
+			return fmt.Errorf("%w: all zones would use %d bytes (limit %d)", ErrQuotaExceeded, totalUsage, q.Config.TotalMaxBytes)
+		}
+		q.setFileSize(key, newStored)
+		if event := q.updateLevel(file.ZoneId, zoneUsage, q.Config.ZoneMaxBytes); event != nil {
+			events = append(events, event)
+		}
+		if event := q.updateLevel("", totalUsage, q.Config.TotalMaxBytes); event != nil {
+			events = append(events, event)
+		}
+		return nil
+	}()
+	for _, event := range events {
+		publishQuotaEvent(event)
+	}
+	return err
+}
+
+// called when a file is deleted
+func removeQuotaUsage(zoneId string, name string) {
+	q := globalQuota
+	q.Lock.Lock()
+	defer q.Lock.Unlock()
+	if !q.Loaded {
+		return
+	}
+	q.setFileSize(cacheKey{ZoneId: zoneId, Name: name}, -1)
+	if q.ZoneSizes[zoneId] == 0 {
+		delete(q.Levels, zoneId)
+	}
+}
+
+func publishQuotaEvent(event *wps.WSQuotaEventData) {
+	if event.ZoneId == "" {
+		log.Printf("[filestore] total storage usage %d bytes (limit %d, exceeded:%v)\n", event.Usage, event.Limit, event.Exceeded)
+	} else {
+		log.Printf("[filestore] zone %s storage usage %d bytes (limit %d, exceeded:%v)\n", event.ZoneId, event.Usage, event.Limit, event.Exceeded)
+	}
+	wps.Broker.Publish(wps.WaveEvent{
+		Event: wps.Event_FileStoreQuota,
+		Data:  event,
+	})
+}
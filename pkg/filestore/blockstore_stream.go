@@ -0,0 +1,150 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package filestore
+
+// StreamFile replays a file from an offset and then (optionally) follows it
+// followers are woken by file watchers (notified on every write) and read the new data with ReadAt
+// so they never hold an entry lock while waiting
+// like tail -f, in-place overwrites (WriteAt) before the current offset are not replayed
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"sync"
+	"sync/atomic"
+)
+
+const DefaultStreamChunkSize = 64 * 1024
+
+type fileWatch struct {
+	ChangeCh  chan struct{} // buffered, notifications are coalesced
+	Truncated *atomic.Bool  // set when the file is rewritten (data before the current size may have changed)
+}
+
+var fileWatchLock = &sync.Mutex{}
+var fileWatches = make(map[cacheKey][]*fileWatch)
+
+func watchFile(zoneId string, name string) (*fileWatch, func()) {
+	key := cacheKey{ZoneId: zoneId, Name: name}
+	watch := &fileWatch{ChangeCh: make(chan struct{}, 1), Truncated: &atomic.Bool{}}
+	fileWatchLock.Lock()
+	defer fileWatchLock.Unlock()
+	fileWatches[key] = append(fileWatches[key], watch)
+	return watch, func() {
+		fileWatchLock.Lock()
+		defer fileWatchLock.Unlock()
+		watches := fileWatches[key]
+		for idx, w := range watches {
+			if w == watch {
+				watches = append(watches[:idx], watches[idx+1:]...)
+				break
+			}
+		}
+		if len(watches) == 0 {
+			delete(fileWatches, key)
+		} else {
+			fileWatches[key] = watches
+		}
+	}
+}
+
+// called after a file's data changes (or the file is deleted), never blocks
+func notifyFileWatchers(zoneId string, name string, truncated bool) {
+	fileWatchLock.Lock()
+	defer fileWatchLock.Unlock()
+	for _, watch := range fileWatches[cacheKey{ZoneId: zoneId, Name: name}] {
+		if truncated {
+			watch.Truncated.Store(true)
+		}
+		select {
+		case watch.ChangeCh <- struct{}{}:
+		default:
+		}
+	}
+}
+
+type StreamOpts struct {
+	Offset    int64
+	FromEnd   int64 // if > 0, start this many bytes before the end of the file (Offset is ignored)
+	Follow    bool  // wait for new data after the replay (until ctx is done or the file is deleted)
+	ChunkSize int64
+}
+
+// exactly one of Data, SkipSize, or Truncated is set
+type StreamChunk struct {
+	Offset    int64
+	Data      []byte
+	SkipSize  int64 // bytes at Offset that were evicted from a circular file before they could be read
+	Truncated bool  // the file was truncated or rewritten, the stream restarts at Offset (0)
+}
+
+// returns nil when the replay is done (or, when following, when the file is deleted)
+// errors returned by fn stop the stream and are returned
+func (s *FileStore) StreamFile(ctx context.Context, zoneId string, name string, opts StreamOpts, fn func(StreamChunk) error) error {
+	watch, unwatch := watchFile(zoneId, name)
+	defer unwatch()
+	file, err := s.Stat(ctx, zoneId, name)
+	if err != nil {
+		return err
+	}
+	chunkSize := opts.ChunkSize
+	if chunkSize <= 0 {
+		chunkSize = DefaultStreamChunkSize
+	}
+	offset := max(opts.Offset, 0)
+	if opts.FromEnd > 0 {
+		offset = max(file.Size-opts.FromEnd, 0)
+	}
+	offset = min(offset, file.Size)
+	for {
+		if watch.Truncated.Swap(false) || file.Size < offset {
+			offset = 0
+			err = fn(StreamChunk{Truncated: true})
+			if err != nil {
+				return err
+			}
+		}
+		for offset < file.Size {
+			readOffset, data, err := s.ReadAt(ctx, zoneId, name, offset, min(chunkSize, file.Size-offset))
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if readOffset > offset {
+				err = fn(StreamChunk{Offset: offset, SkipSize: readOffset - offset})
+				if err != nil {
+					return err
+				}
+				offset = readOffset
+			}
+			if len(data) == 0 {
+				// the file shrank since the stat, re-check it below
+				break
+			}
+			err = fn(StreamChunk{Offset: offset, Data: data})
+			if err != nil {
+				return err
+			}
+			offset += int64(len(data))
+		}
+		if !opts.Follow {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-watch.ChangeCh:
+		}
+		file, err = s.Stat(ctx, zoneId, name)
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -10,7 +10,10 @@ import (
 	"fmt"
 	"io/fs"
 	"log"
+	"os"
+	"path/filepath"
 	"reflect"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"testing"
@@ -20,9 +23,28 @@ import (
 	"github.com/wavetermdev/waveterm/pkg/ijson"
 )
 
+// set to "directory" to run the suite against the directory backend (defaults to sqlite, "task test:go" runs both)
+const TestBackendEnvVar = "WAVETERM_TEST_FILESTORE_BACKEND"
+
+var testBackendType string
+
+func TestMain(m *testing.M) {
+	testBackendType = os.Getenv(TestBackendEnvVar)
+	if testBackendType == "" {
+		testBackendType = Backend_SQLite
+	}
+	if testBackendType != Backend_SQLite && testBackendType != Backend_Directory {
+		log.Printf("invalid %s: %q\n", TestBackendEnvVar, testBackendType)
+		os.Exit(2)
+	}
+	log.Printf("running tests with %s backend\n", testBackendType)
+	os.Exit(m.Run())
+}
+
 func initDb(t *testing.T) {
-	t.Logf("initializing db for %q", t.Name())
+	t.Logf("initializing db for %q (%s backend)", t.Name(), testBackendType)
 	useTestingDb = true
+	SetBackendConfig(BackendConfig{Type: testBackendType, Dir: t.TempDir()})
 	partDataSize = 50
 	warningCount = &atomic.Int32{}
 	stopFlush.Store(true)
@@ -38,8 +60,10 @@ func cleanupDb(t *testing.T) {
 		globalDB.Close()
 		globalDB = nil
 	}
+	globalBackend = nil
 	useTestingDb = false
 	partDataSize = DefaultPartDataSize
+	SetQuotaConfig(QuotaConfig{})
 	WFS.clearCache()
 	if warningCount.Load() > 0 {
 		t.Errorf("warning count: %d", warningCount.Load())
@@ -583,6 +607,411 @@ func TestSimpleDBFlush(t *testing.T) {
 	checkFileByteCount(t, ctx, zoneId, fileName, 'l', 3)
 }
 
+func TestVacuum(t *testing.T) {
+	initDb(t)
+	defer cleanupDb(t)
+
+	ctx, cancelFn := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelFn()
+	_, err := Vacuum(ctx)
+	if err != nil {
+		t.Fatalf("error converting db: %v", err)
+	}
+	stats, err := GetDBStats(ctx)
+	if err != nil {
+		t.Fatalf("error getting db stats: %v", err)
+	}
+	if stats.AutoVacuum != autoVacuumIncremental {
+		t.Errorf("expected incremental auto_vacuum, got %d", stats.AutoVacuum)
+	}
+	zoneId := uuid.NewString()
+	err = WFS.MakeFile(ctx, zoneId, "big", nil, FileOptsType{})
+	if err != nil {
+		t.Fatalf("error creating file: %v", err)
+	}
+	err = WFS.WriteFile(ctx, zoneId, "big", bytes.Repeat([]byte("0123456789"), 10000))
+	if err != nil {
+		t.Fatalf("error writing data: %v", err)
+	}
+	_, err = WFS.FlushCache(ctx)
+	if err != nil {
+		t.Fatalf("error flushing cache: %v", err)
+	}
+	err = WFS.DeleteZone(ctx, zoneId)
+	if err != nil {
+		t.Fatalf("error deleting zone: %v", err)
+	}
+	if testBackendType == Backend_SQLite {
+		stats, _ = GetDBStats(ctx)
+		if stats.FreeBytes == 0 {
+			t.Errorf("expected free pages after deleting zone")
+		}
+	}
+	reclaimed, err := Vacuum(ctx)
+	if err != nil {
+		t.Fatalf("error vacuuming: %v", err)
+	}
+	stats, _ = GetDBStats(ctx)
+	if stats.FreeBytes != 0 {
+		t.Errorf("expected no free pages after vacuum, got %d bytes", stats.FreeBytes)
+	}
+	if testBackendType == Backend_SQLite && reclaimed == 0 {
+		t.Errorf("expected vacuum to reclaim space")
+	}
+}
+
+func TestCompression(t *testing.T) {
+	initDb(t)
+	defer cleanupDb(t)
+
+	ctx, cancelFn := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelFn()
+	zoneId := uuid.NewString()
+	err := WFS.MakeFile(ctx, zoneId, "bad", nil, FileOptsType{Compression: "lz4"})
+	if err == nil {
+		t.Fatalf("expected error for invalid compression")
+	}
+	for _, codec := range []string{Compression_Zstd, Compression_Gzip} {
+		fileName := "c-" + codec
+		err = WFS.MakeFile(ctx, zoneId, fileName, nil, FileOptsType{Circular: true, MaxSize: 200, Compression: codec})
+		if err != nil {
+			t.Fatalf("error creating file: %v", err)
+		}
+		data := strings.Repeat("a", 150) + makeText(50)
+		err = WFS.WriteFile(ctx, zoneId, fileName, []byte(data))
+		if err != nil {
+			t.Fatalf("error writing data: %v", err)
+		}
+		_, err = WFS.FlushCache(ctx)
+		if err != nil {
+			t.Fatalf("error flushing cache: %v", err)
+		}
+		checkFileData(t, ctx, zoneId, fileName, data)
+		diskSize, err := WFS.DiskSize(ctx, zoneId, fileName)
+		if err != nil {
+			t.Fatalf("error getting disk size: %v", err)
+		}
+		// parts that do not shrink are stored raw (gzip's overhead is too large for these small test parts)
+		if diskSize <= 0 || diskSize > 200 || (codec == Compression_Zstd && diskSize >= 200) {
+			t.Errorf("%s: unexpected disk size %d", codec, diskSize)
+		}
+		err = WFS.AppendData(ctx, zoneId, fileName, []byte("hello"))
+		if err != nil {
+			t.Fatalf("error appending data: %v", err)
+		}
+		err = WFS.WriteAt(ctx, zoneId, fileName, 60, []byte("bb"))
+		if err != nil {
+			t.Fatalf("error writing data: %v", err)
+		}
+		_, err = WFS.FlushCache(ctx)
+		if err != nil {
+			t.Fatalf("error flushing cache: %v", err)
+		}
+		expected := strings.Repeat("a", 55) + "bb" + strings.Repeat("a", 88) + makeText(50) + "hello"
+		checkFileData(t, ctx, zoneId, fileName, expected)
+		checkFileDataAt(t, ctx, zoneId, fileName, 190, makeText(50)[40:]+"hello")
+	}
+}
+
+func TestSetCompression(t *testing.T) {
+	initDb(t)
+	defer cleanupDb(t)
+
+	ctx, cancelFn := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelFn()
+	zoneId := uuid.NewString()
+	err := WFS.MakeFile(ctx, zoneId, "raw", nil, FileOptsType{Circular: true, MaxSize: 200})
+	if err != nil {
+		t.Fatalf("error creating file: %v", err)
+	}
+	data := strings.Repeat("a", 200)
+	err = WFS.WriteFile(ctx, zoneId, "raw", []byte(data))
+	if err != nil {
+		t.Fatalf("error writing data: %v", err)
+	}
+	err = WFS.SetCompression(ctx, zoneId, "raw", Compression_Zstd)
+	if err != nil {
+		t.Fatalf("error setting compression: %v", err)
+	}
+	_, err = WFS.FlushCache(ctx)
+	if err != nil {
+		t.Fatalf("error flushing cache: %v", err)
+	}
+	// existing parts stay raw
+	diskSize, _ := WFS.DiskSize(ctx, zoneId, "raw")
+	if diskSize != 200 {
+		t.Errorf("expected raw disk size 200, got %d", diskSize)
+	}
+	file, _ := WFS.Stat(ctx, zoneId, "raw")
+	if file.Opts.Compression != Compression_Zstd {
+		t.Errorf("expected compression to be saved, got %q", file.Opts.Compression)
+	}
+	// rewritten parts are compressed
+	err = WFS.AppendData(ctx, zoneId, "raw", []byte(data))
+	if err != nil {
+		t.Fatalf("error appending data: %v", err)
+	}
+	_, err = WFS.FlushCache(ctx)
+	if err != nil {
+		t.Fatalf("error flushing cache: %v", err)
+	}
+	diskSize, _ = WFS.DiskSize(ctx, zoneId, "raw")
+	if diskSize >= 200 {
+		t.Errorf("expected rewritten parts to be compressed, got disk size %d", diskSize)
+	}
+	checkFileDataAt(t, ctx, zoneId, "raw", 200, data)
+}
+
+func TestCacheLimit(t *testing.T) {
+	initDb(t)
+	defer cleanupDb(t)
+
+	ctx, cancelFn := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelFn()
+	zoneId := uuid.NewString()
+	err := WFS.MakeFile(ctx, zoneId, "big", nil, FileOptsType{Circular: true, MaxSize: 4 * MaxCacheEntryDataSize, Compression: Compression_Zstd})
+	if err != nil {
+		t.Fatalf("error creating file: %v", err)
+	}
+	err = WFS.AppendData(ctx, zoneId, "big", []byte(strings.Repeat("x", 100)))
+	if err != nil {
+		t.Fatalf("error appending data: %v", err)
+	}
+	if len(WFS.getDirtyCacheKeys()) != 1 {
+		t.Errorf("expected small appends to stay in the cache")
+	}
+	err = WFS.AppendData(ctx, zoneId, "big", []byte(strings.Repeat("x", MaxCacheEntryDataSize)))
+	if err != nil {
+		t.Fatalf("error appending data: %v", err)
+	}
+	if len(WFS.getDirtyCacheKeys()) != 0 {
+		t.Errorf("expected the entry to be flushed once it went over the cache limit")
+	}
+	checkFileSize(t, ctx, zoneId, "big", MaxCacheEntryDataSize+100)
+}
+
+func TestMigrateBackend(t *testing.T) {
+	initDb(t)
+	defer cleanupDb(t)
+
+	ctx, cancelFn := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelFn()
+	zoneId := uuid.NewString()
+	err := WFS.MakeFile(ctx, zoneId, "dir/m1", FileMeta{"a": "b"}, FileOptsType{Compression: Compression_Zstd})
+	if err != nil {
+		t.Fatalf("error creating file: %v", err)
+	}
+	err = WFS.MakeFile(ctx, zoneId, "m2", nil, FileOptsType{Circular: true, MaxSize: 100})
+	if err != nil {
+		t.Fatalf("error creating file: %v", err)
+	}
+	m1Data := makeText(120)
+	m2Data := makeText(30) + strings.Repeat("x", 130)
+	WFS.WriteFile(ctx, zoneId, "dir/m1", []byte(m1Data))
+	WFS.AppendData(ctx, zoneId, "m2", []byte(m2Data))
+	_, err = WFS.FlushCache(ctx)
+	if err != nil {
+		t.Fatalf("error flushing cache: %v", err)
+	}
+	dstConfig := BackendConfig{Type: Backend_Directory, Dir: t.TempDir()}
+	if testBackendType == Backend_Directory {
+		dstConfig = BackendConfig{Type: Backend_SQLite}
+	}
+	dst, err := MakeBackend(dstConfig)
+	if err != nil {
+		t.Fatalf("error making backend: %v", err)
+	}
+	stats, err := MigrateBackend(ctx, globalBackend, dst)
+	if err != nil {
+		t.Fatalf("error migrating: %v", err)
+	}
+	if stats.NumZones != 1 || stats.NumFiles != 2 || stats.NumParts != 5 {
+		t.Errorf("unexpected migrate stats: %+v", stats)
+	}
+	// point the filestore at the destination and read everything back through the cache
+	globalBackend = dst
+	checkFileData(t, ctx, zoneId, "dir/m1", m1Data)
+	checkFileData(t, ctx, zoneId, "m2", m2Data[60:])
+	file, err := WFS.Stat(ctx, zoneId, "dir/m1")
+	if err != nil {
+		t.Fatalf("error stating file: %v", err)
+	}
+	if file.Meta["a"] != "b" || file.Opts.Compression != Compression_Zstd {
+		t.Errorf("file record not migrated: %+v", file)
+	}
+	_, err = MigrateBackend(ctx, dst, dst)
+	if err == nil {
+		t.Errorf("expected error migrating a backend to itself")
+	}
+}
+
+// zone ids and file names like ".." must stay inside the filestore directory
+func TestDirBackendPaths(t *testing.T) {
+	ctx, cancelFn := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelFn()
+	parentDir := t.TempDir()
+	backend, err := makeDirBackend(filepath.Join(parentDir, "filestore"))
+	if err != nil {
+		t.Fatalf("error making backend: %v", err)
+	}
+	err = os.WriteFile(filepath.Join(parentDir, "other.txt"), []byte("x"), 0600)
+	if err != nil {
+		t.Fatalf("error writing file: %v", err)
+	}
+	err = backend.InsertFile(ctx, &WaveFile{ZoneId: "zone-a", Name: "f1"})
+	if err != nil {
+		t.Fatalf("error inserting file: %v", err)
+	}
+	for _, name := range []string{"", ".", "..", "../..", "a/../.."} {
+		for _, zoneId := range []string{"zone-b", "", ".", ".."} {
+			err = backend.InsertFile(ctx, &WaveFile{ZoneId: zoneId, Name: name})
+			if err != nil {
+				t.Fatalf("error inserting %q/%q: %v", zoneId, name, err)
+			}
+			err = backend.DeleteFile(ctx, zoneId, name)
+			if err != nil {
+				t.Fatalf("error deleting %q/%q: %v", zoneId, name, err)
+			}
+		}
+	}
+	file, err := backend.GetZoneFile(ctx, "zone-a", "f1")
+	if err != nil || file == nil {
+		t.Fatalf("expected zone-a/f1 to survive deletes, got %v %v", file, err)
+	}
+	if _, err := os.Stat(filepath.Join(parentDir, "other.txt")); err != nil {
+		t.Errorf("expected files outside the filestore directory to survive: %v", err)
+	}
+	zoneIds, _ := backend.GetAllZoneIds(ctx)
+	if !reflect.DeepEqual(zoneIds, []string{"zone-a"}) {
+		t.Errorf("unexpected zones %v", zoneIds)
+	}
+	if err := backend.checkFileDir(filepath.Join(backend.Dir, "..", "x")); err == nil {
+		t.Errorf("expected a path outside the directory to be rejected")
+	}
+}
+
+func TestArchive(t *testing.T) {
+	initDb(t)
+	defer cleanupDb(t)
+
+	ctx, cancelFn := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelFn()
+	zoneId := uuid.NewString()
+	var fullData bytes.Buffer
+	for i := 0; fullData.Len() < 3000; i++ {
+		fmt.Fprintf(&fullData, "line %d\n", i)
+	}
+	appendAll := func(fileName string) {
+		data := fullData.Bytes()
+		for len(data) > 0 {
+			chunk := data[:min(len(data), 30)]
+			err := WFS.AppendData(ctx, zoneId, fileName, chunk)
+			if err != nil {
+				t.Fatalf("error appending data: %v", err)
+			}
+			data = data[len(chunk):]
+		}
+	}
+	archiveOpts := FileOptsType{Circular: true, MaxSize: 100}
+	err := WFS.MakeFile(ctx, zoneId, "a1", FileMeta{ArchiveMaxBytesMetaKey: 100000}, archiveOpts)
+	if err != nil {
+		t.Fatalf("error creating file: %v", err)
+	}
+	appendAll("a1")
+	fileSize := int64(fullData.Len())
+	checkFileSize(t, ctx, zoneId, "a1", fileSize)
+	checkFileData(t, ctx, zoneId, "a1", string(fullData.Bytes()[fileSize-100:]))
+	checkFileDataAt(t, ctx, zoneId, "a1", 0, fullData.String())
+	checkFileDataAt(t, ctx, zoneId, "a1", 1234, string(fullData.Bytes()[1234:2345]))
+	segments, err := WFS.getArchiveSegments(ctx, zoneId, "a1")
+	if err != nil {
+		t.Fatalf("error getting segments: %v", err)
+	}
+	if len(segments) < 2 || segments[0].Offset != 0 {
+		t.Errorf("unexpected archive segments: %d", len(segments))
+	}
+
+	// per-file budget (segments are 800 bytes with the test part size)
+	err = WFS.MakeFile(ctx, zoneId, "a2", FileMeta{ArchiveMaxBytesMetaKey: 1000}, archiveOpts)
+	if err != nil {
+		t.Fatalf("error creating file: %v", err)
+	}
+	appendAll("a2")
+	offset, data, err := WFS.ReadAt(ctx, zoneId, "a2", 0, fileSize)
+	if err != nil {
+		t.Fatalf("error reading data: %v", err)
+	}
+	if offset == 0 || fileSize-offset > 1000+100 {
+		t.Errorf("archive budget not enforced, data starts at %d", offset)
+	}
+	if string(data) != string(fullData.Bytes()[offset:]) {
+		t.Errorf("data mismatch reading across archive and live data at offset %d", offset)
+	}
+
+	// without the meta key nothing is archived
+	err = WFS.MakeFile(ctx, zoneId, "a3", nil, archiveOpts)
+	if err != nil {
+		t.Fatalf("error creating file: %v", err)
+	}
+	appendAll("a3")
+	offset, _, _ = WFS.ReadAt(ctx, zoneId, "a3", 0, fileSize)
+	if offset != fileSize-100 {
+		t.Errorf("expected only live data, got offset %d", offset)
+	}
+
+	// truncating or deleting the file removes its archive
+	err = WFS.WriteFile(ctx, zoneId, "a1", []byte("hello"))
+	if err != nil {
+		t.Fatalf("error writing data: %v", err)
+	}
+	checkFileDataAt(t, ctx, zoneId, "a1", 0, "hello")
+	err = WFS.DeleteFile(ctx, zoneId, "a2")
+	if err != nil {
+		t.Fatalf("error deleting file: %v", err)
+	}
+	fileNames, _ := WFS.ListFiles(ctx, zoneId)
+	if len(fileNames) != 2 {
+		t.Errorf("expected archive segments to be deleted, got %d files", len(fileNames))
+	}
+}
+
+func TestPruneArchives(t *testing.T) {
+	initDb(t)
+	defer cleanupDb(t)
+	defer SetArchiveTotalMaxBytes(0)
+
+	ctx, cancelFn := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelFn()
+	zoneIds := []string{uuid.NewString(), uuid.NewString()}
+	for idx, zoneId := range zoneIds {
+		for segIdx := 0; segIdx < 3; segIdx++ {
+			segName := archiveSegmentName("f", segIdx)
+			err := WFS.MakeFile(ctx, zoneId, segName, FileMeta{ArchiveOffsetMetaKey: segIdx * 100}, FileOptsType{})
+			if err != nil {
+				t.Fatalf("error creating segment: %v", err)
+			}
+			err = WFS.AppendData(ctx, zoneId, segName, bytes.Repeat([]byte{byte('a' + idx)}, 100))
+			if err != nil {
+				t.Fatalf("error writing segment: %v", err)
+			}
+			time.Sleep(2 * time.Millisecond) // segments are pruned by CreatedTs
+		}
+	}
+	SetArchiveTotalMaxBytes(250)
+	err := WFS.pruneArchives(ctx)
+	if err != nil {
+		t.Fatalf("error pruning archives: %v", err)
+	}
+	fileNames, _ := WFS.ListFiles(ctx, zoneIds[0])
+	if len(fileNames) != 0 {
+		t.Errorf("expected oldest zone's segments to be pruned, got %v", fileNames)
+	}
+	fileNames, _ = WFS.ListFiles(ctx, zoneIds[1])
+	if len(fileNames) != 2 {
+		t.Errorf("expected 2 segments to be kept, got %v", fileNames)
+	}
+}
+
 func TestConcurrentAppend(t *testing.T) {
 	initDb(t)
 	defer cleanupDb(t)
@@ -748,3 +1177,199 @@ func TestIJson(t *testing.T) {
 		t.Errorf("data mismatch: expected %v, got %v", rootSet["data"], outData)
 	}
 }
+
+func TestQuota(t *testing.T) {
+	initDb(t)
+	defer cleanupDb(t)
+
+	ctx, cancelFn := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelFn()
+	SetQuotaConfig(QuotaConfig{ZoneMaxBytes: 100})
+	zoneId := uuid.NewString()
+	err := WFS.MakeFile(ctx, zoneId, "f1", nil, FileOptsType{})
+	if err != nil {
+		t.Fatalf("error creating file: %v", err)
+	}
+	err = WFS.MakeFile(ctx, zoneId, "circ", nil, FileOptsType{Circular: true, MaxSize: 50})
+	if err != nil {
+		t.Fatalf("error creating file: %v", err)
+	}
+	err = WFS.WriteFile(ctx, zoneId, "f1", bytes.Repeat([]byte("a"), 40))
+	if err != nil {
+		t.Fatalf("error writing data: %v", err)
+	}
+	for i := 0; i < 5; i++ {
+		// circular files never count for more than MaxSize
+		err = WFS.AppendData(ctx, zoneId, "circ", bytes.Repeat([]byte("b"), 20))
+		if err != nil {
+			t.Fatalf("error appending to circular file: %v", err)
+		}
+	}
+	err = WFS.AppendData(ctx, zoneId, "f1", bytes.Repeat([]byte("c"), 20))
+	if !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("expected quota error, got %v", err)
+	}
+	// archive segments have their own budget
+	segName := archiveSegmentName("f1", 0)
+	err = WFS.MakeFile(ctx, zoneId, segName, nil, FileOptsType{})
+	if err != nil {
+		t.Fatalf("error creating segment: %v", err)
+	}
+	err = WFS.AppendData(ctx, zoneId, segName, bytes.Repeat([]byte("d"), 200))
+	if err != nil {
+		t.Fatalf("expected archive segments not to count towards the quota, got %v", err)
+	}
+	checkFileSize(t, ctx, zoneId, "f1", 40)
+	err = WFS.WriteAt(ctx, zoneId, "f1", 10, []byte("overwrite"))
+	if err != nil {
+		t.Fatalf("error overwriting data: %v", err)
+	}
+	err = WFS.DeleteFile(ctx, zoneId, "circ")
+	if err != nil {
+		t.Fatalf("error deleting file: %v", err)
+	}
+	err = WFS.AppendData(ctx, zoneId, "f1", bytes.Repeat([]byte("c"), 20))
+	if err != nil {
+		t.Fatalf("error appending after delete: %v", err)
+	}
+}
+
+func TestStreamFile(t *testing.T) {
+	initDb(t)
+	defer cleanupDb(t)
+
+	ctx, cancelFn := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelFn()
+	zoneId := uuid.NewString()
+	err := WFS.MakeFile(ctx, zoneId, "circ", nil, FileOptsType{Circular: true, MaxSize: 100})
+	if err != nil {
+		t.Fatalf("error creating file: %v", err)
+	}
+	err = WFS.AppendData(ctx, zoneId, "circ", bytes.Repeat([]byte("a"), 130))
+	if err != nil {
+		t.Fatalf("error appending data: %v", err)
+	}
+	var chunks []StreamChunk
+	err = WFS.StreamFile(ctx, zoneId, "circ", StreamOpts{ChunkSize: 40}, func(chunk StreamChunk) error {
+		chunks = append(chunks, chunk)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("error streaming file: %v", err)
+	}
+	if len(chunks) != 5 || chunks[0].Offset != 0 || chunks[0].SkipSize != 30 || chunks[1].Offset != 30 || len(chunks[1].Data) != 10 || chunks[4].Offset != 120 {
+		t.Fatalf("unexpected chunks %+v", chunks)
+	}
+
+	err = WFS.MakeFile(ctx, zoneId, "log", nil, FileOptsType{})
+	if err != nil {
+		t.Fatalf("error creating file: %v", err)
+	}
+	err = WFS.AppendData(ctx, zoneId, "log", []byte("hello world\n"))
+	if err != nil {
+		t.Fatalf("error appending data: %v", err)
+	}
+	chunkCh := make(chan StreamChunk, 10)
+	doneCh := make(chan error, 1)
+	go func() {
+		doneCh <- WFS.StreamFile(ctx, zoneId, "log", StreamOpts{FromEnd: 6, Follow: true}, func(chunk StreamChunk) error {
+			chunkCh <- chunk
+			return nil
+		})
+	}()
+	if chunk := <-chunkCh; chunk.Offset != 6 || string(chunk.Data) != "world\n" {
+		t.Fatalf("unexpected first chunk %+v", chunk)
+	}
+	err = WFS.AppendData(ctx, zoneId, "log", []byte("more\n"))
+	if err != nil {
+		t.Fatalf("error appending data: %v", err)
+	}
+	if chunk := <-chunkCh; chunk.Offset != 12 || string(chunk.Data) != "more\n" {
+		t.Fatalf("unexpected appended chunk %+v", chunk)
+	}
+	err = WFS.WriteFile(ctx, zoneId, "log", []byte("new"))
+	if err != nil {
+		t.Fatalf("error writing file: %v", err)
+	}
+	if chunk := <-chunkCh; !chunk.Truncated {
+		t.Fatalf("expected truncated chunk, got %+v", chunk)
+	}
+	if chunk := <-chunkCh; chunk.Offset != 0 || string(chunk.Data) != "new" {
+		t.Fatalf("unexpected chunk after truncate %+v", chunk)
+	}
+	err = WFS.DeleteFile(ctx, zoneId, "log")
+	if err != nil {
+		t.Fatalf("error deleting file: %v", err)
+	}
+	if err := <-doneCh; err != nil {
+		t.Fatalf("expected stream to end after delete, got %v", err)
+	}
+}
+
+func TestIJsonHistory(t *testing.T) {
+	initDb(t)
+	defer cleanupDb(t)
+
+	ctx, cancelFn := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelFn()
+	zoneId := uuid.NewString()
+	fileName := "ij1"
+	err := WFS.MakeFile(ctx, zoneId, fileName, nil, FileOptsType{IJson: true, IJsonHistory: 2})
+	if err != nil {
+		t.Fatalf("error creating file: %v", err)
+	}
+	err = WFS.AppendIJson(ctx, zoneId, fileName, ijson.MakeSetCommand(nil, ijson.M{"count": 0}))
+	if err != nil {
+		t.Fatalf("error appending ijson: %v", err)
+	}
+	for i := 1; i <= 4; i++ {
+		err = WFS.AppendIJson(ctx, zoneId, fileName, ijson.MakeSetCommand(ijson.Path{"count"}, i))
+		if err != nil {
+			t.Fatalf("error appending ijson: %v", err)
+		}
+	}
+	data, lastCmd, err := WFS.ReadIJsonAt(ctx, zoneId, fileName, 3, 0)
+	if err != nil {
+		t.Fatalf("error reading ijson at 3: %v", err)
+	}
+	if ijson.GetCommandIdx(lastCmd) != 3 || !jsonDeepEqual(ijson.M{"count": float64(2)}, data) {
+		t.Errorf("unexpected state at 3: %v (last command %v)", data, lastCmd)
+	}
+	err = WFS.CompactIJson(ctx, zoneId, fileName)
+	if err != nil {
+		t.Fatalf("error compacting ijson: %v", err)
+	}
+	commands, err := WFS.ReadIJsonLog(ctx, zoneId, fileName)
+	if err != nil {
+		t.Fatalf("error reading ijson log: %v", err)
+	}
+	if len(commands) != 3 || ijson.GetCommandIdx(commands[0]) != 3 || ijson.GetCommandIdx(commands[2]) != 5 {
+		t.Fatalf("unexpected commands after compaction: %v", commands)
+	}
+	_, _, err = WFS.ReadIJsonAt(ctx, zoneId, fileName, 2, 0)
+	if !errors.Is(err, ErrIJsonHistoryUnavailable) {
+		t.Errorf("expected history unavailable error, got %v", err)
+	}
+	lastIdx, err := WFS.UndoIJson(ctx, zoneId, fileName, 2)
+	if err != nil {
+		t.Fatalf("error undoing ijson: %v", err)
+	}
+	if lastIdx != 3 {
+		t.Errorf("expected last idx 3 after undo, got %d", lastIdx)
+	}
+	_, err = WFS.UndoIJson(ctx, zoneId, fileName, 1)
+	if !errors.Is(err, ErrIJsonHistoryUnavailable) {
+		t.Errorf("expected history unavailable error undoing the root, got %v", err)
+	}
+	err = WFS.AppendIJson(ctx, zoneId, fileName, ijson.MakeSetCommand(ijson.Path{"count"}, 10))
+	if err != nil {
+		t.Fatalf("error appending ijson: %v", err)
+	}
+	data, lastCmd, err = WFS.ReadIJsonAt(ctx, zoneId, fileName, 0, time.Now().UnixMilli())
+	if err != nil {
+		t.Fatalf("error reading current ijson: %v", err)
+	}
+	if ijson.GetCommandIdx(lastCmd) != 4 || !jsonDeepEqual(ijson.M{"count": float64(10)}, data) {
+		t.Errorf("unexpected state after undo and append: %v (last command %v)", data, lastCmd)
+	}
+}
@@ -0,0 +1,100 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package filestore
+
+// sqlite only returns space to the OS on VACUUM
+// the filestore db is switched to incremental auto_vacuum (which requires one full VACUUM), after that
+// free pages are released with incremental_vacuum on a schedule (and after zones are garbage collected)
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/wavetermdev/waveterm/pkg/panichandler"
+)
+
+const DefaultVacuumInterval = time.Hour
+const VacuumMinFreeBytes = 4 * 1024 * 1024 // the scheduled incremental vacuum is skipped below this
+
+const autoVacuumIncremental = 2
+
+type DBStats struct {
+	FileSize   int64 `json:"filesize"`
+	FreeBytes  int64 `json:"freebytes"`
+	AutoVacuum int   `json:"autovacuum"` // 0 (none), 1 (full), 2 (incremental)
+}
+
+func GetDBStats(ctx context.Context) (*DBStats, error) {
+	return WithTxRtn(ctx, func(tx *TxWrap) (*DBStats, error) {
+		pageSize := tx.GetInt64(`PRAGMA page_size`)
+		return &DBStats{
+			FileSize:   tx.GetInt64(`PRAGMA page_count`) * pageSize,
+			FreeBytes:  tx.GetInt64(`PRAGMA freelist_count`) * pageSize,
+			AutoVacuum: tx.GetInt(`PRAGMA auto_vacuum`),
+		}, nil
+	})
+}
+
+// releases free pages to the OS, returns the number of bytes reclaimed
+// if the db does not use incremental auto_vacuum yet it is converted (with a full VACUUM, which rewrites the whole db)
+func Vacuum(ctx context.Context) (int64, error) {
+	before, err := GetDBStats(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("error getting db stats: %w", err)
+	}
+	if before.AutoVacuum != autoVacuumIncremental {
+		// VACUUM cannot run in a transaction
+		_, err = globalDB.ExecContext(ctx, `PRAGMA auto_vacuum = INCREMENTAL`)
+		if err == nil {
+			_, err = globalDB.ExecContext(ctx, `VACUUM`)
+		}
+	} else {
+		err = incrementalVacuum(ctx)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("error vacuuming filestore db: %w", err)
+	}
+	after, err := GetDBStats(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("error getting db stats: %w", err)
+	}
+	reclaimed := before.FileSize - after.FileSize
+	if reclaimed > 0 {
+		log.Printf("[filestore] vacuum reclaimed %d bytes\n", reclaimed)
+	}
+	return max(reclaimed, 0), nil
+}
+
+// incremental_vacuum frees one page per step, so the rows must be read (Exec only runs the first step)
+func incrementalVacuum(ctx context.Context) error {
+	rows, err := globalDB.QueryContext(ctx, `PRAGMA incremental_vacuum`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+	}
+	return rows.Err()
+}
+
+func runVacuumLoop() {
+	defer panichandler.PanicHandler("filestore vacuum")
+	for {
+		time.Sleep(DefaultVacuumInterval)
+		if stopFlush.Load() {
+			return
+		}
+		ctx, cancelFn := context.WithTimeout(context.Background(), time.Minute)
+		stats, err := GetDBStats(ctx)
+		if err == nil && stats.AutoVacuum == autoVacuumIncremental && stats.FreeBytes >= VacuumMinFreeBytes {
+			_, err = Vacuum(ctx)
+		}
+		if err != nil {
+			log.Printf("[filestore] scheduled vacuum error: %v\n", err)
+		}
+		cancelFn()
+	}
+}
@@ -33,6 +33,12 @@ type A = []any
 // set: type, path, value
 // del: type, path
 // arrayappend: type, path, value
+// commands stored in wave files also have idx (sequence number) and ts (unixmilli) fields, which are ignored when applying them
+
+const (
+	IdxKey = "idx"
+	TsKey  = "ts"
+)
 
 func MakeSetCommand(path Path, value any) Command {
 	return Command{
@@ -159,6 +165,11 @@ func FormatPath(path Path) string {
 			buf.WriteByte('[')
 			buf.WriteString(strconv.Itoa(elem))
 			buf.WriteByte(']')
+		case float64:
+			// paths that were unmarshalled from json
+			buf.WriteByte('[')
+			buf.WriteString(strconv.Itoa(int(elem)))
+			buf.WriteByte(']')
 		default:
 			// a placeholder for a bad value
 			buf.WriteString(".*")
@@ -626,29 +637,66 @@ func ApplyCommands(data any, commands []Command, budget int) (any, error) {
 }
 
 func CompactIJson(fullData []byte, budget int) ([]byte, error) {
-	var newData any
-	for len(fullData) > 0 {
-		nlIdx := bytes.IndexByte(fullData, '\n')
-		var cmdData []byte
-		if nlIdx == -1 {
-			cmdData = fullData
-			fullData = nil
-		} else {
-			cmdData = fullData[:nlIdx]
-			fullData = fullData[nlIdx+1:]
+	return CompactIJsonWithHistory(fullData, budget, 0)
+}
+
+// compacts all but the last keepCommands commands into a single root set command
+// the root set takes the idx and ts of the last command it replaces (it is the state as of that command)
+func CompactIJsonWithHistory(fullData []byte, budget int, keepCommands int) ([]byte, error) {
+	commands, err := ParseIJson(fullData)
+	if err != nil {
+		return nil, err
+	}
+	numCompact := len(commands) - max(keepCommands, 0)
+	if numCompact <= 0 {
+		numCompact = min(1, len(commands))
+	}
+	newData, err := ApplyCommands(nil, commands[:numCompact], budget)
+	if err != nil {
+		return nil, fmt.Errorf("error applying ijson command: %w", err)
+	}
+	newRootCmd := MakeSetCommand(nil, newData)
+	if numCompact > 0 {
+		lastCmd := commands[numCompact-1]
+		if idx := GetCommandIdx(lastCmd); idx > 0 {
+			newRootCmd[IdxKey] = idx
 		}
-		var cmdMap Command
-		err := json.Unmarshal(cmdData, &cmdMap)
-		if err != nil {
-			return nil, fmt.Errorf("error unmarshalling ijson command: %w", err)
+		if ts := GetCommandTs(lastCmd); ts > 0 {
+			newRootCmd[TsKey] = ts
 		}
-		newData, err = ApplyCommand(newData, cmdMap, budget)
+	}
+	var buf bytes.Buffer
+	for _, cmd := range append([]Command{newRootCmd}, commands[numCompact:]...) {
+		barr, err := json.Marshal(cmd)
 		if err != nil {
-			return nil, fmt.Errorf("error applying ijson command: %w", err)
+			return nil, fmt.Errorf("error marshalling ijson command to json: %w", err)
 		}
+		buf.Write(barr)
+		buf.WriteByte('\n')
 	}
-	newRootCmd := MakeSetCommand(nil, newData)
-	return json.Marshal(newRootCmd)
+	return buf.Bytes(), nil
+}
+
+func getCommandNum(command Command, key string) int64 {
+	switch val := command[key].(type) {
+	case float64:
+		return int64(val)
+	case int:
+		return int64(val)
+	case int64:
+		return val
+	default:
+		return 0
+	}
+}
+
+// returns 0 if the command has no idx (it was written before commands were numbered)
+func GetCommandIdx(command Command) int {
+	return int(getCommandNum(command, IdxKey))
+}
+
+func GetCommandTs(command Command) int64 {
+	return getCommandNum(command, TsKey)
 }
 
 // returns a list of commands
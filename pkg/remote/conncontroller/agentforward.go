@@ -0,0 +1,125 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package conncontroller
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"time"
+
+	"github.com/wavetermdev/waveterm/pkg/userinput"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+const AgentForwardConfirmTimeout = 60 * time.Second
+
+func (conn *SSHConn) GetKeywords() *wshrpc.ConnKeywords {
+	conn.Lock.Lock()
+	defer conn.Lock.Unlock()
+	return conn.Keywords
+}
+
+// asks the user (once per connection) whether the local agent may be forwarded
+// the answer (allow or deny) is remembered until wave restarts
+func (conn *SSHConn) confirmAgentForwarding(ctx context.Context) (bool, error) {
+	conn.AgentForwardConfirmLock.Lock()
+	defer conn.AgentForwardConfirmLock.Unlock()
+	var allowed *bool
+	conn.WithLock(func() {
+		allowed = conn.AgentForwardAllowed
+	})
+	if allowed != nil {
+		return *allowed, nil
+	}
+	request := &userinput.UserInputRequest{
+		ResponseType: "confirm",
+		QueryText: fmt.Sprintf("`%s` is configured to forward your SSH agent.  \n\n"+
+			"Anyone with root access on the remote host will be able to use your local keys "+
+			"while shells on this connection are open.  \n\n"+
+			"Allow agent forwarding for this connection?", conn.GetName()),
+		Title:       "SSH Agent Forwarding",
+		Markdown:    true,
+		OkLabel:     "Allow",
+		CancelLabel: "Don't Forward",
+	}
+	ctx, cancelFn := context.WithTimeout(ctx, AgentForwardConfirmTimeout)
+	defer cancelFn()
+	response, err := userinput.GetUserInput(ctx, request)
+	if err != nil {
+		// not remembered, so we will ask again next time
+		return false, err
+	}
+	confirmed := response.Confirm
+	conn.WithLock(func() {
+		conn.AgentForwardAllowed = &confirmed
+	})
+	return confirmed, nil
+}
+
+// serves "auth-agent@openssh.com" channels on the client from the local agent socket (once per client)
+func (conn *SSHConn) ensureAgentForwarder(client *ssh.Client, agentSock string) error {
+	conn.Lock.Lock()
+	defer conn.Lock.Unlock()
+	if conn.AgentForwardClient == client {
+		return nil
+	}
+	if agentSock == "" {
+		return fmt.Errorf("no agent socket found (SSH_AUTH_SOCK is not set)")
+	}
+	agentConn, err := net.Dial("unix", agentSock)
+	if err != nil {
+		return fmt.Errorf("cannot connect to agent socket %q: %w", agentSock, err)
+	}
+	err = agent.ForwardToAgent(client, agent.NewClient(agentConn))
+	if err != nil {
+		agentConn.Close()
+		return fmt.Errorf("cannot forward agent: %w", err)
+	}
+	conn.closeAgentForward_nolock()
+	conn.AgentConn = agentConn
+	conn.AgentForwardClient = client
+	return nil
+}
+
+func (conn *SSHConn) closeAgentForward_nolock() {
+	if conn.AgentConn != nil {
+		conn.AgentConn.Close()
+		conn.AgentConn = nil
+	}
+	conn.AgentForwardClient = nil
+}
+
+// requests agent forwarding on a new session when ssh:forwardagent is set (and the user allows it)
+// errors are logged, the session is still usable without forwarding
+func (conn *SSHConn) MaybeForwardAgent(ctx context.Context, session *ssh.Session) {
+	keywords := conn.GetKeywords()
+	if keywords == nil || keywords.SshForwardAgent == nil || !*keywords.SshForwardAgent {
+		return
+	}
+	allowed, err := conn.confirmAgentForwarding(ctx)
+	if err != nil {
+		log.Printf("[conncontroller:%s] agent forwarding not confirmed: %v\n", conn.GetName(), err)
+		return
+	}
+	if !allowed {
+		return
+	}
+	client := conn.GetClient()
+	if client == nil {
+		return
+	}
+	err = conn.ensureAgentForwarder(client, keywords.SshIdentityAgent)
+	if err != nil {
+		log.Printf("[conncontroller:%s] %v\n", conn.GetName(), err)
+		return
+	}
+	err = agent.RequestAgentForwarding(session)
+	if err != nil {
+		log.Printf("[conncontroller:%s] agent forwarding request failed: %v\n", conn.GetName(), err)
+	}
+}
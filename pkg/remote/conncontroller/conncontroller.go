@@ -39,6 +39,7 @@ const (
 	Status_Init         = "init"
 	Status_Connecting   = "connecting"
 	Status_Connected    = "connected"
+	Status_Reconnecting = "reconnecting"
 	Status_Disconnected = "disconnected"
 	Status_Error        = "error"
 )
@@ -63,6 +64,15 @@ type SSHConn struct {
 	HasWaiter          *atomic.Bool
 	LastConnectTime    int64
 	ActiveConnNum      int
+	Forwards           []*portForward
+	ReconnectCancelFn  context.CancelFunc
+	Keywords           *wshrpc.ConnKeywords // resolved keywords from the last successful connect
+	ConnFlags          *wshrpc.ConnKeywords // flags passed to the last successful connect (reused when reconnecting)
+
+	AgentForwardConfirmLock *sync.Mutex
+	AgentForwardAllowed     *bool
+	AgentForwardClient      *ssh.Client
+	AgentConn               net.Conn
 }
 
 func GetAllConnStatus() []wshrpc.ConnStatus {
@@ -73,6 +83,9 @@ func GetAllConnStatus() []wshrpc.ConnStatus {
 	for _, conn := range clientControllerMap {
 		connStatuses = append(connStatuses, conn.DeriveConnStatus())
 	}
+	for _, conn := range execConnMap {
+		connStatuses = append(connStatuses, conn.DeriveConnStatus())
+	}
 	return connStatuses
 }
 
@@ -101,6 +114,7 @@ func (conn *SSHConn) DeriveConnStatus() wshrpc.ConnStatus {
 		ActiveConnNum: conn.ActiveConnNum,
 		Error:         conn.Error,
 		WshError:      conn.WshError,
+		Forwards:      conn.listForwards_nolock(),
 	}
 }
 
@@ -111,7 +125,8 @@ func (conn *SSHConn) FireConnChangeEvent() {
 		Scopes: []string{
 			fmt.Sprintf("connection:%s", conn.GetName()),
 		},
-		Data: status,
+		Data:    status,
+		Persist: wps.ConnChangePersist,
 	}
 	log.Printf("sending event: %+#v", event)
 	wps.Broker.Publish(event)
@@ -120,10 +135,11 @@ func (conn *SSHConn) FireConnChangeEvent() {
 func (conn *SSHConn) Close() error {
 	defer conn.FireConnChangeEvent()
 	conn.WithLock(func() {
-		if conn.Status == Status_Connected || conn.Status == Status_Connecting {
+		if conn.Status == Status_Connected || conn.Status == Status_Connecting || conn.Status == Status_Reconnecting {
 			// if status is init, disconnected, or error don't change it
 			conn.Status = Status_Disconnected
 		}
+		conn.cancelReconnect_nolock()
 		conn.close_nolock()
 	})
 	// we must wait for the waiter to complete
@@ -139,6 +155,8 @@ func (conn *SSHConn) Close() error {
 
 func (conn *SSHConn) close_nolock() {
 	// does not set status (that should happen at another level)
+	conn.closeForwards_nolock()
+	conn.closeAgentForward_nolock()
 	if conn.DomainSockListener != nil {
 		conn.DomainSockListener.Close()
 		conn.DomainSockListener = nil
@@ -153,6 +171,11 @@ func (conn *SSHConn) close_nolock() {
 	}
 }
 
+// true while a connection (or an automatic reconnect) is being established
+func (conn *SSHConn) isConnecting_nolock() bool {
+	return conn.Status == Status_Connecting || conn.Status == Status_Reconnecting
+}
+
 func (conn *SSHConn) GetDomainSocketName() string {
 	conn.Lock.Lock()
 	defer conn.Lock.Unlock()
@@ -173,11 +196,7 @@ func (conn *SSHConn) GetName() string {
 func (conn *SSHConn) OpenDomainSocketListener() error {
 	var allowed bool
 	conn.WithLock(func() {
-		if conn.Status != Status_Connecting {
-			allowed = false
-		} else {
-			allowed = true
-		}
+		allowed = conn.isConnecting_nolock()
 	})
 	if !allowed {
 		return fmt.Errorf("cannot open domain socket for %q when status is %q", conn.GetName(), conn.GetStatus())
@@ -211,11 +230,7 @@ func (conn *SSHConn) OpenDomainSocketListener() error {
 func (conn *SSHConn) StartConnServer() error {
 	var allowed bool
 	conn.WithLock(func() {
-		if conn.Status != Status_Connecting {
-			allowed = false
-		} else {
-			allowed = true
-		}
+		allowed = conn.isConnecting_nolock()
 	})
 	if !allowed {
 		return fmt.Errorf("cannot start conn server for %q when status is %q", conn.GetName(), conn.GetStatus())
@@ -300,26 +315,16 @@ func (wise *WshInstallSkipError) Error() string {
 	return "skipping wsh installation"
 }
 
-func (conn *SSHConn) CheckAndInstallWsh(ctx context.Context, clientDisplayName string, opts *WshInstallOpts) error {
-	if opts == nil {
-		opts = &WshInstallOpts{}
-	}
-	client := conn.GetClient()
-	if client == nil {
-		return fmt.Errorf("client is nil")
-	}
-	// check that correct wsh extensions are installed
-	expectedVersion := fmt.Sprintf("wsh v%s", wavebase.WaveVersion)
-	clientVersion, err := remote.GetWshVersion(client)
-	if err == nil && clientVersion == expectedVersion && !opts.Force {
-		return nil
-	}
+// asks the user before installing wsh (unless opts.NoUserPrompt is set)
+// versionErr is the error from checking the installed wsh version (nil if an older version is installed)
+// returns a WshInstallSkipError if the user declines
+func confirmWshInstall(ctx context.Context, connName string, clientDisplayName string, opts *WshInstallOpts, versionErr error) error {
 	var queryText string
 	var title string
 	if opts.Force {
 		queryText = fmt.Sprintf("ReInstalling Wave Shell Extensions (%s) on `%s`\n", wavebase.WaveVersion, clientDisplayName)
 		title = "Install Wave Shell Extensions"
-	} else if err != nil {
+	} else if versionErr != nil {
 		queryText = fmt.Sprintf("Wave requires Wave Shell Extensions to be  \n"+
 			"installed on `%s`  \n"+
 			"to ensure a seamless experience.  \n\n"+
@@ -346,7 +351,7 @@ func (conn *SSHConn) CheckAndInstallWsh(ctx context.Context, clientDisplayName s
 		if !response.Confirm {
 			meta := make(map[string]any)
 			meta["conn:wshenabled"] = false
-			err = wconfig.SetConnectionsConfigValue(conn.GetName(), meta)
+			err = wconfig.SetConnectionsConfigValue(connName, meta)
 			if err != nil {
 				log.Printf("warning: error writing to connections file: %v", err)
 			}
@@ -362,6 +367,27 @@ func (conn *SSHConn) CheckAndInstallWsh(ctx context.Context, clientDisplayName s
 			}
 		}
 	}
+	return nil
+}
+
+func (conn *SSHConn) CheckAndInstallWsh(ctx context.Context, clientDisplayName string, opts *WshInstallOpts) error {
+	if opts == nil {
+		opts = &WshInstallOpts{}
+	}
+	client := conn.GetClient()
+	if client == nil {
+		return fmt.Errorf("client is nil")
+	}
+	// check that correct wsh extensions are installed
+	expectedVersion := fmt.Sprintf("wsh v%s", wavebase.WaveVersion)
+	clientVersion, err := remote.GetWshVersion(client)
+	if err == nil && clientVersion == expectedVersion && !opts.Force {
+		return nil
+	}
+	err = confirmWshInstall(ctx, conn.GetName(), clientDisplayName, opts, err)
+	if err != nil {
+		return err
+	}
 	log.Printf("attempting to install wsh to `%s`", clientDisplayName)
 	clientOs, err := remote.GetClientOs(client)
 	if err != nil {
@@ -401,7 +427,7 @@ func (conn *SSHConn) WaitForConnect(ctx context.Context) error {
 		if status.Status == Status_Connected {
 			return nil
 		}
-		if status.Status == Status_Connecting {
+		if status.Status == Status_Connecting || status.Status == Status_Reconnecting {
 			select {
 			case <-ctx.Done():
 				return fmt.Errorf("context timeout")
@@ -426,6 +452,8 @@ func (conn *SSHConn) Connect(ctx context.Context, connFlags *wshrpc.ConnKeywords
 		if conn.Status == Status_Connecting || conn.Status == Status_Connected {
 			connectAllowed = false
 		} else {
+			// a manual connect takes over from an automatic reconnect
+			conn.cancelReconnect_nolock()
 			conn.Status = Status_Connecting
 			conn.Error = ""
 			connectAllowed = true
@@ -447,6 +475,7 @@ func (conn *SSHConn) Connect(ctx context.Context, connFlags *wshrpc.ConnKeywords
 			}, "ssh-connconnect")
 		} else {
 			conn.Status = Status_Connected
+			conn.ConnFlags = connFlags
 			conn.LastConnectTime = time.Now().UnixMilli()
 			if conn.ActiveConnNum == 0 {
 				conn.ActiveConnNum = int(activeConnCounter.Add(1))
@@ -498,21 +527,12 @@ func (conn *SSHConn) WithLock(fn func()) {
 	fn()
 }
 
-func (conn *SSHConn) connectInternal(ctx context.Context, connFlags *wshrpc.ConnKeywords) error {
-	client, _, err := remote.ConnectToClient(ctx, conn.Opts, nil, 0, connFlags)
-	if err != nil {
-		log.Printf("error: failed to connect to client %s: %s\n", conn.GetName(), err)
-		return err
-	}
-	fmtAddr := knownhosts.Normalize(fmt.Sprintf("%s@%s", client.User(), client.RemoteAddr().String()))
-	clientDisplayName := fmt.Sprintf("%s (%s)", conn.GetName(), fmtAddr)
-	conn.WithLock(func() {
-		conn.Client = client
-	})
+// returns (conn:wshenabled, conn:askbeforewshinstall), connections.json overrides the global settings
+func getWshSettings(connName string) (bool, bool) {
 	config := wconfig.ReadFullConfig()
 	enableWsh := config.Settings.ConnWshEnabled
 	askBeforeInstall := config.Settings.ConnAskBeforeWshInstall
-	connSettings, ok := config.Connections[conn.GetName()]
+	connSettings, ok := config.Connections[connName]
 	if ok {
 		if connSettings.ConnWshEnabled != nil {
 			enableWsh = *connSettings.ConnWshEnabled
@@ -521,6 +541,22 @@ func (conn *SSHConn) connectInternal(ctx context.Context, connFlags *wshrpc.Conn
 			askBeforeInstall = *connSettings.ConnAskBeforeWshInstall
 		}
 	}
+	return enableWsh, askBeforeInstall
+}
+
+func (conn *SSHConn) connectInternal(ctx context.Context, connFlags *wshrpc.ConnKeywords) error {
+	client, _, sshKeywords, err := remote.ConnectToClient(ctx, conn.Opts, nil, 0, connFlags)
+	if err != nil {
+		log.Printf("error: failed to connect to client %s: %s\n", conn.GetName(), err)
+		return err
+	}
+	fmtAddr := knownhosts.Normalize(fmt.Sprintf("%s@%s", client.User(), client.RemoteAddr().String()))
+	clientDisplayName := fmt.Sprintf("%s (%s)", conn.GetName(), fmtAddr)
+	conn.WithLock(func() {
+		conn.Client = client
+		conn.Keywords = sshKeywords
+	})
+	enableWsh, askBeforeInstall := getWshSettings(conn.GetName())
 	if enableWsh {
 		installErr := conn.CheckAndInstallWsh(ctx, clientDisplayName, &WshInstallOpts{NoUserPrompt: !askBeforeInstall})
 		if errors.Is(installErr, &WshInstallSkipError{}) {
@@ -561,6 +597,8 @@ func (conn *SSHConn) connectInternal(ctx context.Context, connFlags *wshrpc.Conn
 	} else {
 		conn.WshEnabled.Store(false)
 	}
+	conn.startConfigForwards(client, sshKeywords)
+	conn.startKeepAlive(client, sshKeywords)
 	conn.HasWaiter.Store(true)
 	go conn.waitForDisconnect()
 	return nil
@@ -574,6 +612,8 @@ func (conn *SSHConn) waitForDisconnect() {
 		return
 	}
 	err := client.Wait()
+	autoReconnect := isAutoReconnectEnabled(conn.GetName())
+	var shouldReconnect bool
 	conn.WithLock(func() {
 		// disconnects happen for a variety of reasons (like network, etc. and are typically transient)
 		// so we just set the status to "disconnected" here (not error)
@@ -581,11 +621,19 @@ func (conn *SSHConn) waitForDisconnect() {
 		if err != nil && conn.Error == "" {
 			conn.Error = err.Error()
 		}
-		if conn.Status != Status_Error {
+		if conn.Status == Status_Connected && autoReconnect {
+			// unexpected disconnect (Close sets the status before closing the client)
+			conn.Status = Status_Reconnecting
+			shouldReconnect = true
+		} else if conn.Status != Status_Error {
 			conn.Status = Status_Disconnected
 		}
 		conn.close_nolock()
 	})
+	if shouldReconnect {
+		log.Printf("[conncontroller:%s] connection lost, attempting to reconnect\n", conn.GetName())
+		conn.startReconnectLoop()
+	}
 }
 
 func getConnInternal(opts *remote.SSHOpts) *SSHConn {
@@ -593,7 +641,7 @@ func getConnInternal(opts *remote.SSHOpts) *SSHConn {
 	defer globalLock.Unlock()
 	rtn := clientControllerMap[*opts]
 	if rtn == nil {
-		rtn = &SSHConn{Lock: &sync.Mutex{}, Status: Status_Init, WshEnabled: &atomic.Bool{}, Opts: opts, HasWaiter: &atomic.Bool{}}
+		rtn = &SSHConn{Lock: &sync.Mutex{}, Status: Status_Init, WshEnabled: &atomic.Bool{}, Opts: opts, HasWaiter: &atomic.Bool{}, AgentForwardConfirmLock: &sync.Mutex{}}
 		clientControllerMap[*opts] = rtn
 	}
 	return rtn
@@ -624,7 +672,7 @@ func EnsureConnection(ctx context.Context, connName string) error {
 	switch connStatus.Status {
 	case Status_Connected:
 		return nil
-	case Status_Connecting:
+	case Status_Connecting, Status_Reconnecting:
 		return conn.WaitForConnect(ctx)
 	case Status_Init, Status_Disconnected:
 		return conn.Connect(ctx, &wshrpc.ConnKeywords{})
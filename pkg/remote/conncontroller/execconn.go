@@ -0,0 +1,384 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package conncontroller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os/exec"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/wavetermdev/waveterm/pkg/panichandler"
+	"github.com/wavetermdev/waveterm/pkg/remote"
+	"github.com/wavetermdev/waveterm/pkg/telemetry"
+	"github.com/wavetermdev/waveterm/pkg/util/shellutil"
+	"github.com/wavetermdev/waveterm/pkg/wavebase"
+	"github.com/wavetermdev/waveterm/pkg/wps"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"github.com/wavetermdev/waveterm/pkg/wshutil"
+)
+
+const ExecConnWshPath = "~/.waveterm/bin/wsh"
+
+// the connserver runs in router mode and listens on this socket inside the target (like wsl)
+const ExecConnSockName = "~/.waveterm/" + wavebase.RemoteDomainSocketBaseName
+
+// guarded by globalLock (shared with the ssh connections)
+var execConnMap = make(map[string]*ExecConn)
+
+// a connection provided by a remote.ConnProvider (docker://, podman://, k8s://)
+type ExecConn struct {
+	Lock            *sync.Mutex
+	Status          string
+	Target          *remote.ExecTarget
+	WshEnabled      *atomic.Bool
+	ConnController  *exec.Cmd
+	Error           string
+	WshError        string
+	HasWaiter       *atomic.Bool
+	LastConnectTime int64
+	ActiveConnNum   int
+	CancelFn        context.CancelFunc // cancels the commands started for the current connection
+}
+
+func (conn *ExecConn) GetName() string {
+	// no lock required because target is immutable
+	return conn.Target.ConnName()
+}
+
+func (conn *ExecConn) WithLock(fn func()) {
+	conn.Lock.Lock()
+	defer conn.Lock.Unlock()
+	fn()
+}
+
+func (conn *ExecConn) GetStatus() string {
+	conn.Lock.Lock()
+	defer conn.Lock.Unlock()
+	return conn.Status
+}
+
+func (conn *ExecConn) GetDomainSocketName() string {
+	return ExecConnSockName
+}
+
+func (conn *ExecConn) DeriveConnStatus() wshrpc.ConnStatus {
+	conn.Lock.Lock()
+	defer conn.Lock.Unlock()
+	return wshrpc.ConnStatus{
+		Status:        conn.Status,
+		Connected:     conn.Status == Status_Connected,
+		WshEnabled:    conn.WshEnabled.Load(),
+		Connection:    conn.GetName(),
+		HasConnected:  (conn.LastConnectTime > 0),
+		ActiveConnNum: conn.ActiveConnNum,
+		Error:         conn.Error,
+		WshError:      conn.WshError,
+	}
+}
+
+func (conn *ExecConn) FireConnChangeEvent() {
+	status := conn.DeriveConnStatus()
+	event := wps.WaveEvent{
+		Event: wps.Event_ConnChange,
+		Scopes: []string{
+			fmt.Sprintf("connection:%s", conn.GetName()),
+		},
+		Data:    status,
+		Persist: wps.ConnChangePersist,
+	}
+	log.Printf("sending event: %+#v", event)
+	wps.Broker.Publish(event)
+}
+
+func (conn *ExecConn) Close() error {
+	defer conn.FireConnChangeEvent()
+	conn.WithLock(func() {
+		if conn.Status == Status_Connected || conn.Status == Status_Connecting {
+			// if status is init, disconnected, or error don't change it
+			conn.Status = Status_Disconnected
+		}
+		conn.close_nolock()
+	})
+	// we must wait for the waiter to complete
+	startTime := time.Now()
+	for conn.HasWaiter.Load() {
+		time.Sleep(10 * time.Millisecond)
+		if time.Since(startTime) > 2*time.Second {
+			return fmt.Errorf("timeout waiting for waiter to complete")
+		}
+	}
+	return nil
+}
+
+func (conn *ExecConn) close_nolock() {
+	// does not set status (that should happen at another level)
+	if conn.CancelFn != nil {
+		// kills the connserver
+		conn.CancelFn()
+		conn.CancelFn = nil
+	}
+	conn.ConnController = nil
+}
+
+func (conn *ExecConn) WaitForConnect(ctx context.Context) error {
+	for {
+		status := conn.DeriveConnStatus()
+		if status.Status == Status_Connected {
+			return nil
+		}
+		if status.Status == Status_Connecting {
+			select {
+			case <-ctx.Done():
+				return fmt.Errorf("context timeout")
+			case <-time.After(100 * time.Millisecond):
+				continue
+			}
+		}
+		if status.Status == Status_Init || status.Status == Status_Disconnected {
+			return fmt.Errorf("disconnected")
+		}
+		if status.Status == Status_Error {
+			return fmt.Errorf("error: %v", status.Error)
+		}
+		return fmt.Errorf("unknown status: %q", status.Status)
+	}
+}
+
+// the error is also stored inside of ExecConn
+func (conn *ExecConn) Connect(ctx context.Context) error {
+	var connectAllowed bool
+	conn.WithLock(func() {
+		if conn.Status == Status_Connecting || conn.Status == Status_Connected {
+			connectAllowed = false
+		} else {
+			conn.Status = Status_Connecting
+			conn.Error = ""
+			conn.WshError = ""
+			connectAllowed = true
+		}
+	})
+	log.Printf("Connect %s\n", conn.GetName())
+	if !connectAllowed {
+		return fmt.Errorf("cannot connect to %q when status is %q", conn.GetName(), conn.GetStatus())
+	}
+	conn.FireConnChangeEvent()
+	err := conn.connectInternal(ctx)
+	scheme := conn.Target.Provider.Scheme()
+	conn.WithLock(func() {
+		if err != nil {
+			conn.Status = Status_Error
+			conn.Error = err.Error()
+			conn.close_nolock()
+			telemetry.GoUpdateActivityWrap(wshrpc.ActivityUpdate{
+				Conn: map[string]int{scheme + ":connecterror": 1},
+			}, "exec-connconnect")
+		} else {
+			conn.Status = Status_Connected
+			conn.LastConnectTime = time.Now().UnixMilli()
+			if conn.ActiveConnNum == 0 {
+				conn.ActiveConnNum = int(activeConnCounter.Add(1))
+			}
+			telemetry.GoUpdateActivityWrap(wshrpc.ActivityUpdate{
+				Conn: map[string]int{scheme + ":connect": 1},
+			}, "exec-connconnect")
+		}
+	})
+	conn.FireConnChangeEvent()
+	return err
+}
+
+func (conn *ExecConn) connectInternal(ctx context.Context) error {
+	// make sure the target exists and is running (surfaces the cli's error, e.g. "No such container")
+	_, err := conn.Target.Output(ctx, "true")
+	if err != nil {
+		return fmt.Errorf("cannot run commands in %s: %w", conn.GetName(), err)
+	}
+	connCtx, cancelFn := context.WithCancel(context.Background())
+	conn.WithLock(func() {
+		conn.CancelFn = cancelFn
+	})
+	enableWsh, askBeforeInstall := getWshSettings(conn.GetName())
+	if !enableWsh {
+		conn.WshEnabled.Store(false)
+		return nil
+	}
+	installErr := conn.CheckAndInstallWsh(ctx, conn.GetName(), &WshInstallOpts{NoUserPrompt: !askBeforeInstall})
+	if errors.Is(installErr, &WshInstallSkipError{}) {
+		// skips are not true errors
+		conn.WshEnabled.Store(false)
+		return nil
+	}
+	if installErr == nil {
+		installErr = conn.StartConnServer(connCtx)
+		if installErr != nil {
+			// stop the connserver (clearing ConnController first so its waiter doesn't change the status)
+			conn.WithLock(func() {
+				conn.ConnController = nil
+			})
+			cancelFn()
+		}
+	}
+	if installErr != nil {
+		log.Printf("error: unable to start wsh for %s: %v\n", conn.GetName(), installErr)
+		log.Print("attempting to run with nowsh instead")
+		conn.WithLock(func() {
+			conn.WshError = installErr.Error()
+		})
+		conn.WshEnabled.Store(false)
+		return nil
+	}
+	conn.WshEnabled.Store(true)
+	return nil
+}
+
+func (conn *ExecConn) CheckAndInstallWsh(ctx context.Context, clientDisplayName string, opts *WshInstallOpts) error {
+	if opts == nil {
+		opts = &WshInstallOpts{}
+	}
+	// check that correct wsh extensions are installed
+	expectedVersion := fmt.Sprintf("wsh v%s", wavebase.WaveVersion)
+	clientVersion, err := conn.Target.GetWshVersion(ctx, ExecConnWshPath)
+	if err == nil && clientVersion == expectedVersion && !opts.Force {
+		return nil
+	}
+	err = confirmWshInstall(ctx, conn.GetName(), clientDisplayName, opts, err)
+	if err != nil {
+		return err
+	}
+	log.Printf("attempting to install wsh to `%s`", clientDisplayName)
+	clientOs, clientArch, err := conn.Target.GetClientPlatform(ctx)
+	if err != nil {
+		return err
+	}
+	wshLocalPath := shellutil.GetWshBinaryPath(wavebase.WaveVersion, clientOs, clientArch)
+	err = conn.Target.CopyFile(ctx, wshLocalPath, ExecConnWshPath)
+	if err != nil {
+		return err
+	}
+	log.Printf("successfully installed wsh on %s\n", conn.GetName())
+	return nil
+}
+
+// runs "wsh connserver --router" in the target, its stdio is the rpc channel back to the main router
+func (conn *ExecConn) StartConnServer(connCtx context.Context) error {
+	rpcCtx := wshrpc.RpcContext{
+		ClientType: wshrpc.ClientType_ConnServer,
+		Conn:       conn.GetName(),
+	}
+	jwtToken, err := wshutil.MakeClientJWTToken(rpcCtx, conn.GetDomainSocketName())
+	if err != nil {
+		return fmt.Errorf("unable to create jwt token for conn controller: %w", err)
+	}
+	cmdStr := fmt.Sprintf("%s=\"%s\" %s connserver --router", wshutil.WaveJwtTokenVarName, jwtToken, ExecConnWshPath)
+	log.Printf("starting conn controller for %s\n", conn.GetName())
+	ecmd, err := conn.Target.MakeCmd(connCtx, cmdStr, false)
+	if err != nil {
+		return err
+	}
+	pipeRead, pipeWrite := io.Pipe()
+	inputPipeRead, inputPipeWrite := io.Pipe()
+	ecmd.Stdout = pipeWrite
+	ecmd.Stderr = pipeWrite
+	ecmd.Stdin = inputPipeRead
+	err = ecmd.Start()
+	if err != nil {
+		return fmt.Errorf("unable to start conn controller: %w", err)
+	}
+	conn.WithLock(func() {
+		conn.ConnController = ecmd
+	})
+	conn.HasWaiter.Store(true)
+	go conn.waitForDisconnect(ecmd, pipeWrite, inputPipeRead)
+	go func() {
+		defer panichandler.PanicHandler("conncontroller:exec-connserver-stdio")
+		logName := fmt.Sprintf("conncontroller:%s", conn.GetName())
+		wshutil.HandleStdIOClient(logName, pipeRead, inputPipeWrite)
+	}()
+	regCtx, cancelFn := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelFn()
+	err = wshutil.DefaultRouter.WaitForRegister(regCtx, wshutil.MakeConnectionRouteId(rpcCtx.Conn))
+	if err != nil {
+		return fmt.Errorf("timeout waiting for connserver to register")
+	}
+	time.Sleep(300 * time.Millisecond) // TODO remove this sleep (but we need to wait until connserver is "ready")
+	return nil
+}
+
+// the connection lasts as long as the connserver (e.g. it ends when the container is stopped)
+func (conn *ExecConn) waitForDisconnect(ecmd *exec.Cmd, outputWriter *io.PipeWriter, inputReader *io.PipeReader) {
+	defer panichandler.PanicHandler("conncontroller:exec-waitForDisconnect")
+	defer conn.FireConnChangeEvent()
+	defer conn.HasWaiter.Store(false)
+	err := ecmd.Wait()
+	log.Printf("conn controller (%q) terminated: %v", conn.GetName(), err)
+	// unblock the stdio client
+	outputWriter.Close()
+	inputReader.Close()
+	conn.WithLock(func() {
+		if conn.ConnController != ecmd {
+			// a newer connection owns the status
+			return
+		}
+		// don't overwrite any existing error (or error status)
+		if err != nil && conn.Error == "" {
+			conn.Error = err.Error()
+		}
+		if conn.Status != Status_Error {
+			conn.Status = Status_Disconnected
+		}
+		conn.close_nolock()
+	})
+}
+
+func getExecConnInternal(target *remote.ExecTarget) *ExecConn {
+	globalLock.Lock()
+	defer globalLock.Unlock()
+	connName := target.ConnName()
+	rtn := execConnMap[connName]
+	if rtn == nil {
+		rtn = &ExecConn{Lock: &sync.Mutex{}, Status: Status_Init, Target: target, WshEnabled: &atomic.Bool{}, HasWaiter: &atomic.Bool{}}
+		execConnMap[connName] = rtn
+	}
+	return rtn
+}
+
+// connName must be an exec connection name (see remote.IsExecConnName)
+func GetExecConn(ctx context.Context, connName string, shouldConnect bool) (*ExecConn, error) {
+	target, err := remote.ParseExecConnName(connName)
+	if err != nil {
+		return nil, err
+	}
+	conn := getExecConnInternal(target)
+	if shouldConnect && conn.GetStatus() != Status_Connected {
+		conn.Connect(ctx)
+	}
+	return conn, nil
+}
+
+// Convenience function for ensuring an exec connection is established
+func EnsureExecConnection(ctx context.Context, connName string) error {
+	conn, err := GetExecConn(ctx, connName, false)
+	if err != nil {
+		return err
+	}
+	connStatus := conn.DeriveConnStatus()
+	switch connStatus.Status {
+	case Status_Connected:
+		return nil
+	case Status_Connecting:
+		return conn.WaitForConnect(ctx)
+	case Status_Init, Status_Disconnected:
+		return conn.Connect(ctx)
+	case Status_Error:
+		return fmt.Errorf("connection error: %s", connStatus.Error)
+	default:
+		return fmt.Errorf("unknown connection status %q", connStatus.Status)
+	}
+}
@@ -0,0 +1,346 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package conncontroller
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/wavetermdev/waveterm/pkg/panichandler"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"golang.org/x/crypto/ssh"
+)
+
+const DefaultForwardBindHost = "localhost"
+
+// a single local/remote/dynamic port forward running over an SSHConn
+type portForward struct {
+	Lock       *sync.Mutex
+	ForwardId  string
+	Type       string
+	Spec       string
+	BindAddr   string
+	TargetAddr string
+	FromConfig bool
+	Error      string
+	Listener   net.Listener
+	Conns      map[net.Conn]bool
+}
+
+func (pf *portForward) toConnForward() wshrpc.ConnForward {
+	pf.Lock.Lock()
+	defer pf.Lock.Unlock()
+	status := wshrpc.ConnForwardStatus_Active
+	if pf.Error != "" {
+		status = wshrpc.ConnForwardStatus_Error
+	}
+	return wshrpc.ConnForward{
+		ForwardId:  pf.ForwardId,
+		Type:       pf.Type,
+		Spec:       pf.Spec,
+		BindAddr:   pf.BindAddr,
+		TargetAddr: pf.TargetAddr,
+		FromConfig: pf.FromConfig,
+		Status:     status,
+		Error:      pf.Error,
+		NumConns:   len(pf.Conns),
+	}
+}
+
+func (pf *portForward) addConn(c net.Conn) bool {
+	pf.Lock.Lock()
+	defer pf.Lock.Unlock()
+	if pf.Listener == nil {
+		// already closed
+		return false
+	}
+	pf.Conns[c] = true
+	return true
+}
+
+func (pf *portForward) removeConn(c net.Conn) {
+	pf.Lock.Lock()
+	defer pf.Lock.Unlock()
+	delete(pf.Conns, c)
+}
+
+func (pf *portForward) close() {
+	pf.Lock.Lock()
+	defer pf.Lock.Unlock()
+	if pf.Listener != nil {
+		pf.Listener.Close()
+		pf.Listener = nil
+	}
+	for c := range pf.Conns {
+		c.Close()
+	}
+	pf.Conns = make(map[net.Conn]bool)
+}
+
+// splits a forward spec on ':' and whitespace (ipv6 addresses can be wrapped in [])
+func splitForwardSpec(spec string) []string {
+	var parts []string
+	var cur strings.Builder
+	inBracket := false
+	hasCur := false
+	for _, ch := range spec {
+		switch {
+		case ch == '[' && !inBracket:
+			inBracket = true
+			hasCur = true
+		case ch == ']' && inBracket:
+			inBracket = false
+		case !inBracket && (ch == ':' || ch == ' ' || ch == '\t'):
+			if ch != ':' && !hasCur {
+				// collapse repeated whitespace
+				continue
+			}
+			parts = append(parts, cur.String())
+			cur.Reset()
+			hasCur = false
+		default:
+			cur.WriteRune(ch)
+			hasCur = true
+		}
+	}
+	if hasCur {
+		parts = append(parts, cur.String())
+	}
+	return parts
+}
+
+func makeForwardAddr(host string, port string) (string, error) {
+	portNum, err := strconv.Atoi(port)
+	if err != nil || portNum < 0 || portNum > 65535 {
+		return "", fmt.Errorf("invalid port %q", port)
+	}
+	if host == "" {
+		host = DefaultForwardBindHost
+	}
+	if host == "*" {
+		host = "0.0.0.0"
+	}
+	return net.JoinHostPort(host, port), nil
+}
+
+// parses a forward spec in ssh -L/-R/-D format (ssh_config format, with a space, is also accepted)
+// local/remote: [bind_address:]port:host:hostport, dynamic: [bind_address:]port
+// returns the bind address and the target address (empty for dynamic forwards)
+func ParseForwardSpec(fwdType string, spec string) (string, string, error) {
+	parts := splitForwardSpec(strings.TrimSpace(spec))
+	switch fwdType {
+	case wshrpc.ConnForwardType_Local, wshrpc.ConnForwardType_Remote:
+		var bindHost string
+		if len(parts) == 4 {
+			bindHost = parts[0]
+			parts = parts[1:]
+		}
+		if len(parts) != 3 {
+			return "", "", fmt.Errorf("invalid %s forward %q (expected [bind_address:]port:host:hostport)", fwdType, spec)
+		}
+		bindAddr, err := makeForwardAddr(bindHost, parts[0])
+		if err != nil {
+			return "", "", fmt.Errorf("invalid %s forward %q: %w", fwdType, spec, err)
+		}
+		if parts[1] == "" {
+			return "", "", fmt.Errorf("invalid %s forward %q: empty host", fwdType, spec)
+		}
+		targetAddr, err := makeForwardAddr(parts[1], parts[2])
+		if err != nil {
+			return "", "", fmt.Errorf("invalid %s forward %q: %w", fwdType, spec, err)
+		}
+		return bindAddr, targetAddr, nil
+	case wshrpc.ConnForwardType_Dynamic:
+		var bindHost string
+		if len(parts) == 2 {
+			bindHost = parts[0]
+			parts = parts[1:]
+		}
+		if len(parts) != 1 {
+			return "", "", fmt.Errorf("invalid dynamic forward %q (expected [bind_address:]port)", spec)
+		}
+		bindAddr, err := makeForwardAddr(bindHost, parts[0])
+		if err != nil {
+			return "", "", fmt.Errorf("invalid dynamic forward %q: %w", spec, err)
+		}
+		return bindAddr, "", nil
+	default:
+		return "", "", fmt.Errorf("invalid forward type %q", fwdType)
+	}
+}
+
+// copies data in both directions, closes both conns when either side finishes
+func proxyConns(c1 net.Conn, c2 net.Conn) {
+	var wg sync.WaitGroup
+	wg.Add(2)
+	copyFn := func(dst net.Conn, src net.Conn) {
+		defer wg.Done()
+		defer panichandler.PanicHandler("conncontroller:forward-copy")
+		io.Copy(dst, src)
+		dst.Close()
+		src.Close()
+	}
+	go copyFn(c1, c2)
+	go copyFn(c2, c1)
+	wg.Wait()
+}
+
+func (conn *SSHConn) startForward(client *ssh.Client, fwdType string, spec string, fromConfig bool) (*portForward, error) {
+	bindAddr, targetAddr, err := ParseForwardSpec(fwdType, spec)
+	if err != nil {
+		return nil, err
+	}
+	pf := &portForward{
+		Lock:       &sync.Mutex{},
+		ForwardId:  uuid.NewString(),
+		Type:       fwdType,
+		Spec:       spec,
+		BindAddr:   bindAddr,
+		TargetAddr: targetAddr,
+		FromConfig: fromConfig,
+		Conns:      make(map[net.Conn]bool),
+	}
+	var listener net.Listener
+	if fwdType == wshrpc.ConnForwardType_Remote {
+		listener, err = client.Listen("tcp", bindAddr)
+	} else {
+		listener, err = net.Listen("tcp", bindAddr)
+	}
+	if err != nil {
+		pf.Error = fmt.Sprintf("cannot listen on %s: %v", bindAddr, err)
+		return pf, fmt.Errorf("cannot start %s forward %q: %w", fwdType, spec, err)
+	}
+	pf.Listener = listener
+	go conn.runForwardAcceptLoop(client, pf, listener)
+	return pf, nil
+}
+
+func (conn *SSHConn) runForwardAcceptLoop(client *ssh.Client, pf *portForward, listener net.Listener) {
+	defer panichandler.PanicHandler("conncontroller:forward-accept-loop")
+	for {
+		c, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		if !pf.addConn(c) {
+			c.Close()
+			return
+		}
+		go func() {
+			defer panichandler.PanicHandler("conncontroller:forward-conn")
+			defer pf.removeConn(c)
+			conn.handleForwardConn(client, pf, c)
+		}()
+	}
+}
+
+func (conn *SSHConn) handleForwardConn(client *ssh.Client, pf *portForward, c net.Conn) {
+	var targetConn net.Conn
+	var err error
+	switch pf.Type {
+	case wshrpc.ConnForwardType_Local:
+		targetConn, err = client.Dial("tcp", pf.TargetAddr)
+	case wshrpc.ConnForwardType_Remote:
+		targetConn, err = net.Dial("tcp", pf.TargetAddr)
+	case wshrpc.ConnForwardType_Dynamic:
+		targetConn, err = socks5Handshake(c, func(addr string) (net.Conn, error) {
+			return client.Dial("tcp", addr)
+		})
+	}
+	if err != nil {
+		log.Printf("[conncontroller:%s] %s forward %q connection error: %v\n", conn.GetName(), pf.Type, pf.Spec, err)
+		c.Close()
+		return
+	}
+	proxyConns(c, targetConn)
+}
+
+// starts the forwards from the resolved connection keywords (failures are recorded in the forward status)
+func (conn *SSHConn) startConfigForwards(client *ssh.Client, keywords *wshrpc.ConnKeywords) {
+	if keywords == nil {
+		return
+	}
+	specMap := map[string][]string{
+		wshrpc.ConnForwardType_Local:   keywords.SshLocalForward,
+		wshrpc.ConnForwardType_Remote:  keywords.SshRemoteForward,
+		wshrpc.ConnForwardType_Dynamic: keywords.SshDynamicForward,
+	}
+	for _, fwdType := range []string{wshrpc.ConnForwardType_Local, wshrpc.ConnForwardType_Remote, wshrpc.ConnForwardType_Dynamic} {
+		for _, spec := range specMap[fwdType] {
+			pf, err := conn.startForward(client, fwdType, spec, true)
+			if err != nil {
+				log.Printf("[conncontroller:%s] %v\n", conn.GetName(), err)
+			}
+			if pf == nil {
+				continue
+			}
+			conn.WithLock(func() {
+				conn.Forwards = append(conn.Forwards, pf)
+			})
+		}
+	}
+}
+
+func (conn *SSHConn) AddForward(fwdType string, spec string) (*wshrpc.ConnForward, error) {
+	client := conn.GetClient()
+	if client == nil || conn.GetStatus() != Status_Connected {
+		return nil, fmt.Errorf("connection %q is not connected", conn.GetName())
+	}
+	pf, err := conn.startForward(client, fwdType, spec, false)
+	if err != nil {
+		return nil, err
+	}
+	conn.WithLock(func() {
+		conn.Forwards = append(conn.Forwards, pf)
+	})
+	conn.FireConnChangeEvent()
+	rtn := pf.toConnForward()
+	return &rtn, nil
+}
+
+func (conn *SSHConn) RemoveForward(forwardId string) error {
+	var found *portForward
+	conn.WithLock(func() {
+		for idx, pf := range conn.Forwards {
+			if pf.ForwardId == forwardId {
+				found = pf
+				conn.Forwards = append(conn.Forwards[:idx], conn.Forwards[idx+1:]...)
+				break
+			}
+		}
+	})
+	if found == nil {
+		return fmt.Errorf("forward %q not found on connection %q", forwardId, conn.GetName())
+	}
+	found.close()
+	conn.FireConnChangeEvent()
+	return nil
+}
+
+func (conn *SSHConn) ListForwards() []wshrpc.ConnForward {
+	conn.Lock.Lock()
+	defer conn.Lock.Unlock()
+	return conn.listForwards_nolock()
+}
+
+func (conn *SSHConn) listForwards_nolock() []wshrpc.ConnForward {
+	var rtn []wshrpc.ConnForward
+	for _, pf := range conn.Forwards {
+		rtn = append(rtn, pf.toConnForward())
+	}
+	return rtn
+}
+
+func (conn *SSHConn) closeForwards_nolock() {
+	for _, pf := range conn.Forwards {
+		pf.close()
+	}
+	conn.Forwards = nil
+}
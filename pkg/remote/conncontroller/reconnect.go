@@ -0,0 +1,215 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package conncontroller
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/wavetermdev/waveterm/pkg/panichandler"
+	"github.com/wavetermdev/waveterm/pkg/telemetry"
+	"github.com/wavetermdev/waveterm/pkg/wconfig"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	KeepAliveRequestName    = "keepalive@openssh.com"
+	DefaultServerAliveCount = 3
+	ReconnectInitialBackoff = 1 * time.Second
+	ReconnectMaxBackoff     = 60 * time.Second
+	ReconnectMaxAttempts    = 10
+)
+
+var reconnectHandlerLock = &sync.Mutex{}
+var reconnectHandlers []func(connName string)
+
+// registers a handler that is called (in its own goroutine) after a connection is automatically re-established
+func RegisterReconnectHandler(handler func(connName string)) {
+	reconnectHandlerLock.Lock()
+	defer reconnectHandlerLock.Unlock()
+	reconnectHandlers = append(reconnectHandlers, handler)
+}
+
+func runReconnectHandlers(connName string) {
+	reconnectHandlerLock.Lock()
+	handlers := make([]func(string), len(reconnectHandlers))
+	copy(handlers, reconnectHandlers)
+	reconnectHandlerLock.Unlock()
+	for _, handler := range handlers {
+		go func(handler func(string)) {
+			defer panichandler.PanicHandler("conncontroller:reconnect-handler")
+			handler(connName)
+		}(handler)
+	}
+}
+
+// connections.json takes precedence over the global setting (defaults to false)
+func isAutoReconnectEnabled(connName string) bool {
+	config := wconfig.ReadFullConfig()
+	autoReconnect := config.Settings.ConnAutoReconnect
+	connSettings, ok := config.Connections[connName]
+	if ok && connSettings.ConnAutoReconnect != nil {
+		autoReconnect = *connSettings.ConnAutoReconnect
+	}
+	return autoReconnect
+}
+
+// starts the keepalive loop if ssh:serveraliveinterval is set
+func (conn *SSHConn) startKeepAlive(client *ssh.Client, keywords *wshrpc.ConnKeywords) {
+	if keywords == nil || keywords.SshServerAliveInterval == nil || *keywords.SshServerAliveInterval <= 0 {
+		return
+	}
+	interval := time.Duration(*keywords.SshServerAliveInterval) * time.Second
+	countMax := DefaultServerAliveCount
+	if keywords.SshServerAliveCountMax != nil && *keywords.SshServerAliveCountMax > 0 {
+		countMax = *keywords.SshServerAliveCountMax
+	}
+	go conn.runKeepAlive(client, interval, countMax)
+}
+
+// sends a keepalive request every interval, closes the client after countMax consecutive unanswered requests
+// (closing the client wakes up waitForDisconnect)
+func (conn *SSHConn) runKeepAlive(client *ssh.Client, interval time.Duration, countMax int) {
+	defer panichandler.PanicHandler("conncontroller:keepalive")
+	doneCh := make(chan struct{})
+	go func() {
+		defer panichandler.PanicHandler("conncontroller:keepalive-wait")
+		client.Wait()
+		close(doneCh)
+	}()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	numMissed := 0
+	for {
+		select {
+		case <-doneCh:
+			return
+		case <-ticker.C:
+		}
+		if sendKeepAlive(client, interval) {
+			numMissed = 0
+			continue
+		}
+		numMissed++
+		log.Printf("[conncontroller:%s] keepalive missed (%d/%d)\n", conn.GetName(), numMissed, countMax)
+		if numMissed >= countMax {
+			log.Printf("[conncontroller:%s] no keepalive response from server, closing connection\n", conn.GetName())
+			conn.WithLock(func() {
+				if conn.Client == client && conn.Error == "" {
+					conn.Error = fmt.Sprintf("timeout, server not responding (%d keepalives missed)", numMissed)
+				}
+			})
+			client.Close()
+			return
+		}
+	}
+}
+
+// returns true if the server replied (any reply counts, servers typically reject the unknown request)
+func sendKeepAlive(client *ssh.Client, timeout time.Duration) bool {
+	respCh := make(chan error, 1)
+	go func() {
+		defer panichandler.PanicHandler("conncontroller:send-keepalive")
+		_, _, err := client.SendRequest(KeepAliveRequestName, true, nil)
+		respCh <- err
+	}()
+	select {
+	case err := <-respCh:
+		return err == nil
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+func (conn *SSHConn) cancelReconnect_nolock() {
+	if conn.ReconnectCancelFn != nil {
+		conn.ReconnectCancelFn()
+		conn.ReconnectCancelFn = nil
+	}
+}
+
+// status must already be set to Status_Reconnecting
+func (conn *SSHConn) startReconnectLoop() {
+	ctx, cancelFn := context.WithCancel(context.Background())
+	conn.WithLock(func() {
+		conn.cancelReconnect_nolock()
+		conn.ReconnectCancelFn = cancelFn
+	})
+	go conn.runReconnectLoop(ctx)
+}
+
+func (conn *SSHConn) runReconnectLoop(ctx context.Context) {
+	defer panichandler.PanicHandler("conncontroller:reconnect-loop")
+	backoff := ReconnectInitialBackoff
+	for attempt := 1; attempt <= ReconnectMaxAttempts; attempt++ {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		if conn.GetStatus() != Status_Reconnecting {
+			return
+		}
+		log.Printf("[conncontroller:%s] reconnect attempt %d/%d\n", conn.GetName(), attempt, ReconnectMaxAttempts)
+		connFlags := &wshrpc.ConnKeywords{}
+		conn.WithLock(func() {
+			if conn.ConnFlags != nil {
+				flagsCopy := *conn.ConnFlags
+				connFlags = &flagsCopy
+			}
+		})
+		connectCtx, connectCancelFn := context.WithTimeout(ctx, DefaultConnectionTimeout)
+		err := conn.connectInternal(connectCtx, connFlags)
+		connectCancelFn()
+		var connected bool
+		var stillReconnecting bool
+		conn.WithLock(func() {
+			if conn.Status != Status_Reconnecting {
+				// closed while we were connecting (a manual connect cancels the loop and owns the client)
+				if err == nil && (conn.Status == Status_Disconnected || conn.Status == Status_Error) {
+					conn.close_nolock()
+				}
+				return
+			}
+			if err != nil {
+				conn.Error = err.Error()
+				conn.close_nolock()
+				stillReconnecting = true
+				return
+			}
+			conn.Status = Status_Connected
+			conn.Error = ""
+			conn.LastConnectTime = time.Now().UnixMilli()
+			conn.ReconnectCancelFn = nil
+			connected = true
+		})
+		if connected {
+			log.Printf("[conncontroller:%s] reconnected\n", conn.GetName())
+			conn.FireConnChangeEvent()
+			telemetry.GoUpdateActivityWrap(wshrpc.ActivityUpdate{
+				Conn: map[string]int{"ssh:reconnect": 1},
+			}, "ssh-reconnect")
+			runReconnectHandlers(conn.GetName())
+			return
+		}
+		if !stillReconnecting {
+			return
+		}
+		log.Printf("[conncontroller:%s] reconnect attempt %d failed: %v\n", conn.GetName(), attempt, err)
+		conn.FireConnChangeEvent()
+		backoff = min(backoff*2, ReconnectMaxBackoff)
+	}
+	conn.WithLock(func() {
+		if conn.Status == Status_Reconnecting {
+			conn.Status = Status_Error
+			conn.Error = fmt.Sprintf("unable to reconnect after %d attempts: %s", ReconnectMaxAttempts, conn.Error)
+		}
+		conn.ReconnectCancelFn = nil
+	})
+	conn.FireConnChangeEvent()
+}
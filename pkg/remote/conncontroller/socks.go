@@ -0,0 +1,130 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package conncontroller
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+// minimal SOCKS5 server (RFC 1928) for dynamic forwards, supports no-auth + CONNECT only
+
+const (
+	socks5Version       = 0x05
+	socks5AuthNone      = 0x00
+	socks5AuthNoAccept  = 0xff
+	socks5CmdConnect    = 0x01
+	socks5AddrIPv4      = 0x01
+	socks5AddrDomain    = 0x03
+	socks5AddrIPv6      = 0x04
+	socks5RepSuccess    = 0x00
+	socks5RepFailure    = 0x01
+	socks5RepCmdNotSupp = 0x07
+	socks5RepAddrNotSup = 0x08
+)
+
+const socks5HandshakeTimeout = 30 * time.Second
+
+func socks5Reply(c net.Conn, rep byte) error {
+	// bind address is always reported as 0.0.0.0:0
+	_, err := c.Write([]byte{socks5Version, rep, 0x00, socks5AddrIPv4, 0, 0, 0, 0, 0, 0})
+	return err
+}
+
+func readSocks5Addr(c net.Conn, addrType byte) (string, error) {
+	var host string
+	switch addrType {
+	case socks5AddrIPv4:
+		buf := make([]byte, 4)
+		if _, err := io.ReadFull(c, buf); err != nil {
+			return "", err
+		}
+		host = net.IP(buf).String()
+	case socks5AddrIPv6:
+		buf := make([]byte, 16)
+		if _, err := io.ReadFull(c, buf); err != nil {
+			return "", err
+		}
+		host = net.IP(buf).String()
+	case socks5AddrDomain:
+		lenBuf := make([]byte, 1)
+		if _, err := io.ReadFull(c, lenBuf); err != nil {
+			return "", err
+		}
+		buf := make([]byte, int(lenBuf[0]))
+		if _, err := io.ReadFull(c, buf); err != nil {
+			return "", err
+		}
+		host = string(buf)
+	default:
+		socks5Reply(c, socks5RepAddrNotSup)
+		return "", fmt.Errorf("unsupported socks5 address type %d", addrType)
+	}
+	portBuf := make([]byte, 2)
+	if _, err := io.ReadFull(c, portBuf); err != nil {
+		return "", err
+	}
+	port := binary.BigEndian.Uint16(portBuf)
+	return net.JoinHostPort(host, strconv.Itoa(int(port))), nil
+}
+
+// runs the SOCKS5 handshake on c, dials the requested address, and returns the connection to it
+func socks5Handshake(c net.Conn, dialFn func(addr string) (net.Conn, error)) (net.Conn, error) {
+	c.SetDeadline(time.Now().Add(socks5HandshakeTimeout))
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(c, header); err != nil {
+		return nil, fmt.Errorf("reading socks5 header: %w", err)
+	}
+	if header[0] != socks5Version {
+		return nil, fmt.Errorf("unsupported socks version %d", header[0])
+	}
+	methods := make([]byte, int(header[1]))
+	if _, err := io.ReadFull(c, methods); err != nil {
+		return nil, fmt.Errorf("reading socks5 auth methods: %w", err)
+	}
+	hasNoAuth := false
+	for _, method := range methods {
+		if method == socks5AuthNone {
+			hasNoAuth = true
+			break
+		}
+	}
+	if !hasNoAuth {
+		c.Write([]byte{socks5Version, socks5AuthNoAccept})
+		return nil, fmt.Errorf("socks5 client does not support no-auth")
+	}
+	if _, err := c.Write([]byte{socks5Version, socks5AuthNone}); err != nil {
+		return nil, err
+	}
+	req := make([]byte, 4)
+	if _, err := io.ReadFull(c, req); err != nil {
+		return nil, fmt.Errorf("reading socks5 request: %w", err)
+	}
+	if req[0] != socks5Version {
+		return nil, fmt.Errorf("unsupported socks version %d", req[0])
+	}
+	addr, err := readSocks5Addr(c, req[3])
+	if err != nil {
+		return nil, fmt.Errorf("reading socks5 address: %w", err)
+	}
+	if req[1] != socks5CmdConnect {
+		socks5Reply(c, socks5RepCmdNotSupp)
+		return nil, fmt.Errorf("unsupported socks5 command %d", req[1])
+	}
+	targetConn, err := dialFn(addr)
+	if err != nil {
+		socks5Reply(c, socks5RepFailure)
+		return nil, fmt.Errorf("dialing %s: %w", addr, err)
+	}
+	if err := socks5Reply(c, socks5RepSuccess); err != nil {
+		targetConn.Close()
+		return nil, err
+	}
+	c.SetDeadline(time.Time{})
+	return targetConn, nil
+}
@@ -0,0 +1,303 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package remote
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/wavetermdev/waveterm/pkg/util/utilfn"
+)
+
+// a provider for exec-based connections (e.g. docker://container)
+// all interaction with the target goes through commands run by the provider
+type ConnProvider interface {
+	// the uri scheme handled by the provider (without "://")
+	Scheme() string
+	// validates the target (the part of the connection name after "://")
+	ValidateTarget(target string) error
+	// returns a command that runs cmdStr with /bin/sh inside of the target
+	// stdin is always attached, tty allocates a terminal in the target (the command must then be run under a local pty)
+	MakeCmd(ctx context.Context, target string, cmdStr string, tty bool) (*exec.Cmd, error)
+	// copies a local file into the target (remotePath may start with "~/")
+	CopyFile(ctx context.Context, target string, localPath string, remotePath string) error
+}
+
+var providerLock = &sync.Mutex{}
+var connProviders = make(map[string]ConnProvider)
+
+func init() {
+	RegisterConnProvider(&CliProvider{ProviderScheme: "docker", CliName: "docker", MakeArgs: makeContainerExecArgs})
+	RegisterConnProvider(&CliProvider{ProviderScheme: "podman", CliName: "podman", MakeArgs: makeContainerExecArgs})
+	RegisterConnProvider(&CliProvider{ProviderScheme: "k8s", CliName: "kubectl", MakeArgs: makeKubectlExecArgs})
+}
+
+// registers (or replaces) the provider for its scheme
+func RegisterConnProvider(provider ConnProvider) {
+	providerLock.Lock()
+	defer providerLock.Unlock()
+	connProviders[provider.Scheme()] = provider
+}
+
+func GetConnProviderSchemes() []string {
+	providerLock.Lock()
+	defer providerLock.Unlock()
+	var schemes []string
+	for scheme := range connProviders {
+		schemes = append(schemes, scheme)
+	}
+	sort.Strings(schemes)
+	return schemes
+}
+
+func splitConnScheme(connName string) (string, string, bool) {
+	scheme, target, found := strings.Cut(connName, "://")
+	if !found || scheme == "" {
+		return "", "", false
+	}
+	return scheme, target, true
+}
+
+// true if the connection name uses the scheme of a registered provider
+func IsExecConnName(connName string) bool {
+	scheme, _, ok := splitConnScheme(connName)
+	if !ok {
+		return false
+	}
+	providerLock.Lock()
+	defer providerLock.Unlock()
+	_, found := connProviders[scheme]
+	return found
+}
+
+// parses a connection name like "docker://container" into its provider and target
+func ParseExecConnName(connName string) (*ExecTarget, error) {
+	scheme, target, ok := splitConnScheme(connName)
+	if !ok {
+		return nil, fmt.Errorf("invalid connection name %q (expected scheme://target)", connName)
+	}
+	providerLock.Lock()
+	provider := connProviders[scheme]
+	providerLock.Unlock()
+	if provider == nil {
+		return nil, fmt.Errorf("no connection provider for %q", scheme+"://")
+	}
+	err := provider.ValidateTarget(target)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s connection %q: %w", scheme, connName, err)
+	}
+	return &ExecTarget{Provider: provider, Target: target}, nil
+}
+
+// a provider that shells out to a cli (docker, podman, kubectl)
+type CliProvider struct {
+	ProviderScheme string
+	CliName        string // looked up in PATH
+	CliPath        string // optional, overrides CliName
+	// returns the cli args that run argv inside of the target
+	MakeArgs func(target string, tty bool, argv []string) ([]string, error)
+}
+
+func (p *CliProvider) Scheme() string {
+	return p.ProviderScheme
+}
+
+func (p *CliProvider) ValidateTarget(target string) error {
+	_, err := p.MakeArgs(target, false, nil)
+	return err
+}
+
+func (p *CliProvider) MakeCmd(ctx context.Context, target string, cmdStr string, tty bool) (*exec.Cmd, error) {
+	cliPath := p.CliPath
+	if cliPath == "" {
+		var err error
+		cliPath, err = exec.LookPath(p.CliName)
+		if err != nil {
+			return nil, fmt.Errorf("cannot find %q (required for %s:// connections): %w", p.CliName, p.ProviderScheme, err)
+		}
+	}
+	args, err := p.MakeArgs(target, tty, []string{"/bin/sh", "-c", cmdStr})
+	if err != nil {
+		return nil, err
+	}
+	ecmd := exec.CommandContext(ctx, cliPath, args...)
+	ecmd.Env = os.Environ()
+	return ecmd, nil
+}
+
+func (p *CliProvider) CopyFile(ctx context.Context, target string, localPath string, remotePath string) error {
+	return catCopyFile(ctx, p, target, localPath, remotePath)
+}
+
+var containerNameRe = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+var kubeNameRe = regexp.MustCompile(`^[a-z0-9]([a-z0-9.-]*[a-z0-9])?$`)
+
+// docker://container and podman://container (name or id)
+func makeContainerExecArgs(target string, tty bool, argv []string) ([]string, error) {
+	if !containerNameRe.MatchString(target) {
+		return nil, fmt.Errorf("invalid container name %q", target)
+	}
+	args := []string{"exec", "-i"}
+	if tty {
+		args = append(args, "-t")
+	}
+	args = append(args, target)
+	return append(args, argv...), nil
+}
+
+// k8s://namespace/pod or k8s://namespace/pod/container
+func makeKubectlExecArgs(target string, tty bool, argv []string) ([]string, error) {
+	parts := strings.Split(target, "/")
+	if len(parts) < 2 || len(parts) > 3 {
+		return nil, fmt.Errorf("target must be namespace/pod or namespace/pod/container")
+	}
+	for _, part := range parts {
+		if !kubeNameRe.MatchString(part) {
+			return nil, fmt.Errorf("invalid name %q", part)
+		}
+	}
+	args := []string{"exec", "-i"}
+	if tty {
+		args = append(args, "-t")
+	}
+	args = append(args, "-n", parts[0], parts[1])
+	if len(parts) == 3 {
+		args = append(args, "-c", parts[2])
+	}
+	args = append(args, "--")
+	return append(args, argv...), nil
+}
+
+// quotes a remote path for /bin/sh, leaving a leading "~/" unquoted so it is expanded
+func quoteRemotePath(remotePath string) string {
+	if remotePath == "~" {
+		return remotePath
+	}
+	if strings.HasPrefix(remotePath, "~/") {
+		return "~/" + utilfn.ShellQuote(remotePath[2:], false, -1)
+	}
+	return utilfn.ShellQuote(remotePath, false, -1)
+}
+
+// copies a file by streaming it to "cat" over the command's stdin (works with any provider that attaches stdin)
+func catCopyFile(ctx context.Context, provider ConnProvider, target string, localPath string, remotePath string) error {
+	input, err := os.Open(localPath)
+	if err != nil {
+		return fmt.Errorf("cannot open local file %s to send to target: %w", localPath, err)
+	}
+	defer input.Close()
+	quotedDir := quoteRemotePath(path.Dir(remotePath))
+	quotedTemp := quoteRemotePath(remotePath + ".temp")
+	quotedDest := quoteRemotePath(remotePath)
+	cmdStr := fmt.Sprintf("mkdir -p %s && cat > %s && mv %s %s && chmod a+x %s", quotedDir, quotedTemp, quotedTemp, quotedDest, quotedDest)
+	ecmd, err := provider.MakeCmd(ctx, target, cmdStr, false)
+	if err != nil {
+		return err
+	}
+	ecmd.Stdin = input
+	var stderrBuf bytes.Buffer
+	ecmd.Stderr = &stderrBuf
+	err = ecmd.Run()
+	if err != nil {
+		return fmt.Errorf("error copying file to %s://%s: %w", provider.Scheme(), target, withStderr(err, stderrBuf.String()))
+	}
+	return nil
+}
+
+func withStderr(err error, stderr string) error {
+	stderr = strings.TrimSpace(stderr)
+	if stderr == "" {
+		return err
+	}
+	return fmt.Errorf("%w (%s)", err, stderr)
+}
+
+// a target (e.g. a container) reached through a ConnProvider
+type ExecTarget struct {
+	Provider ConnProvider
+	Target   string
+}
+
+func (et *ExecTarget) ConnName() string {
+	return et.Provider.Scheme() + "://" + et.Target
+}
+
+func (et *ExecTarget) MakeCmd(ctx context.Context, cmdStr string, tty bool) (*exec.Cmd, error) {
+	return et.Provider.MakeCmd(ctx, et.Target, cmdStr, tty)
+}
+
+// runs cmdStr in the target and returns its stdout (stderr is included in the error)
+func (et *ExecTarget) Output(ctx context.Context, cmdStr string) ([]byte, error) {
+	ecmd, err := et.MakeCmd(ctx, cmdStr, false)
+	if err != nil {
+		return nil, err
+	}
+	ecmd.Stdin = bytes.NewReader(nil)
+	out, err := ecmd.Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return nil, withStderr(err, string(exitErr.Stderr))
+		}
+		return nil, err
+	}
+	return out, nil
+}
+
+func (et *ExecTarget) CopyFile(ctx context.Context, localPath string, remotePath string) error {
+	return et.Provider.CopyFile(ctx, et.Target, localPath, remotePath)
+}
+
+func (et *ExecTarget) GetWshVersion(ctx context.Context, wshPath string) (string, error) {
+	out, err := et.Output(ctx, quoteRemotePath(wshPath)+" version")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// returns the user's shell in the target (using wsh if it is installed)
+// many containers do not have bash, so this falls back to the first of bash or sh in the PATH
+func (et *ExecTarget) DetectShell(ctx context.Context, wshPath string) string {
+	if wshPath != "" {
+		out, err := et.Output(ctx, quoteRemotePath(wshPath)+" shell")
+		if err == nil && strings.TrimSpace(string(out)) != "" {
+			return strings.TrimSpace(string(out))
+		}
+	}
+	out, err := et.Output(ctx, "command -v bash || command -v sh")
+	if err == nil {
+		lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+		if lines[0] != "" {
+			return lines[0]
+		}
+	}
+	return "/bin/sh"
+}
+
+// returns the os and arch (as used in the wsh binary names)
+func (et *ExecTarget) GetClientPlatform(ctx context.Context) (string, string, error) {
+	out, err := et.Output(ctx, "uname -s; uname -m")
+	if err != nil {
+		return "", "", fmt.Errorf("unable to determine os/arch: %w", err)
+	}
+	fields := strings.Fields(strings.ToLower(string(out)))
+	if len(fields) != 2 {
+		return "", "", fmt.Errorf("unable to determine os/arch, unexpected output %q", strings.TrimSpace(string(out)))
+	}
+	clientOs, clientArch := fields[0], fields[1]
+	if clientArch == "x86_64" {
+		clientArch = "x64"
+	}
+	return clientOs, clientArch, nil
+}
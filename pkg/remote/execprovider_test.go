@@ -0,0 +1,158 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package remote
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// a fake docker cli that runs the command locally (only the "running" container exists)
+const fakeDockerScript = `#!/bin/sh
+echo "$@" >> "$FAKE_DOCKER_LOG"
+[ "$1" = "exec" ] || { echo "unsupported command $1" >&2; exit 1; }
+shift
+while [ "${1#-}" != "$1" ]; do shift; done
+if [ "$1" != "running" ]; then
+	echo "Error response from daemon: No such container: $1" >&2
+	exit 1
+fi
+shift
+exec "$@"
+`
+
+func makeFakeDockerTarget(t *testing.T, container string) (*ExecTarget, string) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake cli requires /bin/sh")
+	}
+	tmpDir := t.TempDir()
+	scriptPath := filepath.Join(tmpDir, "docker")
+	err := os.WriteFile(scriptPath, []byte(fakeDockerScript), 0755)
+	if err != nil {
+		t.Fatalf("error writing fake cli: %v", err)
+	}
+	homeDir := filepath.Join(tmpDir, "home")
+	os.Mkdir(homeDir, 0755)
+	logPath := filepath.Join(tmpDir, "docker.log")
+	t.Setenv("HOME", homeDir)
+	t.Setenv("FAKE_DOCKER_LOG", logPath)
+	provider := &CliProvider{ProviderScheme: "docker", CliName: "docker", CliPath: scriptPath, MakeArgs: makeContainerExecArgs}
+	return &ExecTarget{Provider: provider, Target: container}, homeDir
+}
+
+func TestParseExecConnName(t *testing.T) {
+	validNames := []string{"docker://web", "docker://3f2a9c1b", "podman://db_1", "k8s://default/api-7d9f", "k8s://prod/api-7d9f/sidecar"}
+	for _, name := range validNames {
+		target, err := ParseExecConnName(name)
+		if err != nil {
+			t.Errorf("expected %q to parse: %v", name, err)
+			continue
+		}
+		if target.ConnName() != name {
+			t.Errorf("expected conn name %q, got %q", name, target.ConnName())
+		}
+		if !IsExecConnName(name) {
+			t.Errorf("expected %q to be an exec connection name", name)
+		}
+	}
+	invalidNames := []string{"docker://", "docker://-rm", "docker://a b", "k8s://pod", "k8s://a/b/c/d", "k8s://Default/pod", "ftp://host", "user@host"}
+	for _, name := range invalidNames {
+		_, err := ParseExecConnName(name)
+		if err == nil {
+			t.Errorf("expected %q not to parse", name)
+		}
+	}
+	if IsExecConnName("wsl://Ubuntu") || IsExecConnName("user@host") {
+		t.Errorf("wsl and ssh names are not exec connection names")
+	}
+}
+
+func TestKubectlExecArgs(t *testing.T) {
+	args, err := makeKubectlExecArgs("prod/api-7d9f/sidecar", true, []string{"/bin/sh", "-c", "ls"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []string{"exec", "-i", "-t", "-n", "prod", "api-7d9f", "-c", "sidecar", "--", "/bin/sh", "-c", "ls"}
+	if !reflect.DeepEqual(args, expected) {
+		t.Errorf("expected %v, got %v", expected, args)
+	}
+	args, _ = makeKubectlExecArgs("default/api", false, []string{"true"})
+	expected = []string{"exec", "-i", "-n", "default", "api", "--", "true"}
+	if !reflect.DeepEqual(args, expected) {
+		t.Errorf("expected %v, got %v", expected, args)
+	}
+}
+
+func TestExecTargetCommands(t *testing.T) {
+	target, _ := makeFakeDockerTarget(t, "running")
+	ctx := context.Background()
+	out, err := target.Output(ctx, "echo hello; echo ignored >&2")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(out) != "hello\n" {
+		t.Errorf("expected output %q, got %q", "hello\n", string(out))
+	}
+	clientOs, clientArch, err := target.GetClientPlatform(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if clientOs != runtime.GOOS {
+		t.Errorf("expected os %q, got %q", runtime.GOOS, clientOs)
+	}
+	if clientArch == "" || clientArch == "x86_64" {
+		t.Errorf("unexpected arch %q", clientArch)
+	}
+	shellPath := target.DetectShell(ctx, "~/.waveterm/bin/wsh")
+	if filepath.Base(shellPath) != "bash" && filepath.Base(shellPath) != "sh" {
+		t.Errorf("expected bash or sh without wsh, got %q", shellPath)
+	}
+}
+
+func TestExecTargetMissing(t *testing.T) {
+	target, _ := makeFakeDockerTarget(t, "stopped")
+	_, err := target.Output(context.Background(), "true")
+	if err == nil {
+		t.Fatalf("expected an error for a missing container")
+	}
+	if !strings.Contains(err.Error(), "No such container: stopped") {
+		t.Errorf("expected the cli's stderr in the error, got %v", err)
+	}
+}
+
+func TestExecTargetCopyFile(t *testing.T) {
+	target, homeDir := makeFakeDockerTarget(t, "running")
+	srcPath := filepath.Join(t.TempDir(), "wsh-src")
+	err := os.WriteFile(srcPath, []byte("#!/bin/sh\necho 'wsh v0.0.0-test'\n"), 0644)
+	if err != nil {
+		t.Fatalf("error writing source file: %v", err)
+	}
+	err = target.CopyFile(context.Background(), srcPath, "~/.waveterm/bin/wsh")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	destPath := filepath.Join(homeDir, ".waveterm", "bin", "wsh")
+	finfo, err := os.Stat(destPath)
+	if err != nil {
+		t.Fatalf("expected file to be copied: %v", err)
+	}
+	if finfo.Mode()&0111 == 0 {
+		t.Errorf("expected copied file to be executable, mode %v", finfo.Mode())
+	}
+	if _, err := os.Stat(destPath + ".temp"); err == nil {
+		t.Errorf("expected temp file to be renamed")
+	}
+	version, err := target.GetWshVersion(context.Background(), "~/.waveterm/bin/wsh")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if version != "wsh v0.0.0-test" {
+		t.Errorf("expected version %q, got %q", "wsh v0.0.0-test", version)
+	}
+}
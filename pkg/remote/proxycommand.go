@@ -0,0 +1,185 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package remote
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wavetermdev/waveterm/pkg/util/shellutil"
+)
+
+const ProxyCommandMaxStderrSize = 8 * 1024
+
+// expands the ssh_config tokens used in ProxyCommand (%h, %p, %r, %n, %%)
+func expandProxyCommandTokens(proxyCommand string, opts *SSHOpts, host string, port string, user string) string {
+	var buf strings.Builder
+	for i := 0; i < len(proxyCommand); i++ {
+		ch := proxyCommand[i]
+		if ch != '%' || i == len(proxyCommand)-1 {
+			buf.WriteByte(ch)
+			continue
+		}
+		i++
+		switch proxyCommand[i] {
+		case '%':
+			buf.WriteByte('%')
+		case 'h':
+			buf.WriteString(host)
+		case 'p':
+			buf.WriteString(port)
+		case 'r':
+			buf.WriteString(user)
+		case 'n':
+			buf.WriteString(opts.SSHHost)
+		default:
+			// unknown tokens are passed through
+			buf.WriteByte('%')
+			buf.WriteByte(proxyCommand[i])
+		}
+	}
+	return buf.String()
+}
+
+// keeps the last ProxyCommandMaxStderrSize bytes written
+type proxyStderrBuffer struct {
+	Lock *sync.Mutex
+	Buf  []byte
+}
+
+func (b *proxyStderrBuffer) Write(p []byte) (int, error) {
+	b.Lock.Lock()
+	defer b.Lock.Unlock()
+	b.Buf = append(b.Buf, p...)
+	if len(b.Buf) > ProxyCommandMaxStderrSize {
+		b.Buf = b.Buf[len(b.Buf)-ProxyCommandMaxStderrSize:]
+	}
+	return len(p), nil
+}
+
+func (b *proxyStderrBuffer) String() string {
+	b.Lock.Lock()
+	defer b.Lock.Unlock()
+	return strings.TrimSpace(string(b.Buf))
+}
+
+type proxyCommandAddr struct {
+	Command string
+}
+
+func (a proxyCommandAddr) Network() string {
+	return "proxycommand"
+}
+
+func (a proxyCommandAddr) String() string {
+	return a.Command
+}
+
+// a net.Conn over the stdin/stdout of a locally spawned ProxyCommand
+type ProxyCommandConn struct {
+	Cmd       *exec.Cmd
+	Stdin     io.WriteCloser
+	Stdout    io.ReadCloser
+	Stderr    *proxyStderrBuffer
+	CancelFn  context.CancelFunc // kills the command
+	CloseOnce *sync.Once
+	WaitErr   error
+}
+
+// the command outlives ctx (it carries the connection), ctx is only checked before starting
+// callers must Close the conn if the ssh handshake fails (see newClientConnContext)
+func StartProxyCommand(ctx context.Context, command string) (*ProxyCommandConn, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	procCtx, cancelFn := context.WithCancel(context.Background())
+	var ecmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		ecmd = exec.CommandContext(procCtx, "cmd.exe", "/C", command)
+	} else {
+		ecmd = exec.CommandContext(procCtx, shellutil.DetectLocalShellPath(), "-c", command)
+	}
+	ecmd.Env = os.Environ()
+	// don't block on the stderr copy if a child process keeps the pipe open
+	ecmd.WaitDelay = time.Second
+	stderrBuf := &proxyStderrBuffer{Lock: &sync.Mutex{}}
+	ecmd.Stderr = stderrBuf
+	stdin, err := ecmd.StdinPipe()
+	if err != nil {
+		cancelFn()
+		return nil, fmt.Errorf("cannot create stdin pipe for ProxyCommand: %w", err)
+	}
+	stdout, err := ecmd.StdoutPipe()
+	if err != nil {
+		cancelFn()
+		return nil, fmt.Errorf("cannot create stdout pipe for ProxyCommand: %w", err)
+	}
+	err = ecmd.Start()
+	if err != nil {
+		cancelFn()
+		return nil, fmt.Errorf("cannot start ProxyCommand %q: %w", command, err)
+	}
+	return &ProxyCommandConn{Cmd: ecmd, Stdin: stdin, Stdout: stdout, Stderr: stderrBuf, CancelFn: cancelFn, CloseOnce: &sync.Once{}}, nil
+}
+
+func (pc *ProxyCommandConn) Read(p []byte) (int, error) {
+	return pc.Stdout.Read(p)
+}
+
+func (pc *ProxyCommandConn) Write(p []byte) (int, error) {
+	return pc.Stdin.Write(p)
+}
+
+func (pc *ProxyCommandConn) Close() error {
+	pc.CloseOnce.Do(func() {
+		pc.Stdin.Close()
+		// give the command a moment to exit on its own (so we capture all of its stderr)
+		waitCh := make(chan error, 1)
+		go func() {
+			waitCh <- pc.Cmd.Wait()
+		}()
+		select {
+		case pc.WaitErr = <-waitCh:
+		case <-time.After(500 * time.Millisecond):
+			pc.CancelFn()
+			pc.WaitErr = <-waitCh
+		}
+		pc.CancelFn()
+	})
+	return nil
+}
+
+// returns the captured stderr output of the command
+func (pc *ProxyCommandConn) StderrOutput() string {
+	return pc.Stderr.String()
+}
+
+func (pc *ProxyCommandConn) LocalAddr() net.Addr {
+	return proxyCommandAddr{Command: "local"}
+}
+
+func (pc *ProxyCommandConn) RemoteAddr() net.Addr {
+	return proxyCommandAddr{Command: pc.Cmd.String()}
+}
+
+// deadlines are not supported over pipes
+func (pc *ProxyCommandConn) SetDeadline(t time.Time) error {
+	return nil
+}
+
+func (pc *ProxyCommandConn) SetReadDeadline(t time.Time) error {
+	return nil
+}
+
+func (pc *ProxyCommandConn) SetWriteDeadline(t time.Time) error {
+	return nil
+}
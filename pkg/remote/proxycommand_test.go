@@ -0,0 +1,39 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package remote
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestProxyCommandHandshakeTimeout(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sleep")
+	}
+	ctx, cancelFn := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancelFn()
+	proxyConn, err := StartProxyCommand(ctx, "sleep 30")
+	if err != nil {
+		t.Fatalf("error starting proxy command: %v", err)
+	}
+	startTs := time.Now()
+	clientConfig := &ssh.ClientConfig{User: "test", HostKeyCallback: ssh.InsecureIgnoreHostKey()}
+	_, err = newClientConnContext(ctx, proxyConn, "test:22", clientConfig)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+	proxyConn.Close()
+	if time.Since(startTs) > 5*time.Second {
+		t.Errorf("handshake did not stop with the context")
+	}
+	if proxyConn.Cmd.ProcessState == nil {
+		t.Errorf("expected the proxy command to be waited on")
+	}
+}
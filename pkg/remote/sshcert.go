@@ -0,0 +1,248 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package remote
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/skeema/knownhosts"
+	"github.com/wavetermdev/waveterm/pkg/wavebase"
+	"golang.org/x/crypto/ssh"
+	xknownhosts "golang.org/x/crypto/ssh/knownhosts"
+)
+
+// openssh looks for a certificate next to each identity file (e.g. ~/.ssh/id_ed25519-cert.pub)
+const IdentityCertSuffix = "-cert.pub"
+
+func readCertificateFile(certFile string) (*ssh.Certificate, error) {
+	filePath, err := wavebase.ExpandHomeDir(certFile)
+	if err != nil {
+		return nil, err
+	}
+	certBytes, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	pubKey, _, _, _, err := ssh.ParseAuthorizedKey(certBytes)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse certificate file %q: %w", certFile, err)
+	}
+	cert, ok := pubKey.(*ssh.Certificate)
+	if !ok {
+		return nil, fmt.Errorf("%q is not an ssh certificate", certFile)
+	}
+	if cert.CertType != ssh.UserCert {
+		return nil, fmt.Errorf("%q is not an ssh user certificate", certFile)
+	}
+	return cert, nil
+}
+
+// true if the certificate is within its validity period (expired certs would just be rejected by the server)
+func isCertCurrentlyValid(cert *ssh.Certificate) bool {
+	now := uint64(time.Now().Unix())
+	if cert.ValidAfter != 0 && now < cert.ValidAfter {
+		return false
+	}
+	if cert.ValidBefore != ssh.CertTimeInfinity && now >= cert.ValidBefore {
+		return false
+	}
+	return true
+}
+
+// loads the certificates from ssh:certificatefile (unreadable, invalid, or expired certificates are skipped)
+func loadCertificateFiles(certFiles []string) []*ssh.Certificate {
+	var rtn []*ssh.Certificate
+	for _, certFile := range certFiles {
+		cert, err := readCertificateFile(certFile)
+		if err != nil {
+			log.Printf("skipping ssh certificate: %v\n", err)
+			continue
+		}
+		if !isCertCurrentlyValid(cert) {
+			log.Printf("skipping ssh certificate %q: not currently valid\n", certFile)
+			continue
+		}
+		rtn = append(rtn, cert)
+	}
+	return rtn
+}
+
+// returns the signer with any matching certificates (certificates first so cert auth is preferred)
+// identityFile is optional, if set its "-cert.pub" companion is also checked
+func withCertSigners(signer ssh.Signer, certs []*ssh.Certificate, identityFile string) []ssh.Signer {
+	if _, ok := signer.PublicKey().(*ssh.Certificate); ok {
+		// already a certificate (e.g. from the agent)
+		return []ssh.Signer{signer}
+	}
+	candidates := certs
+	if identityFile != "" {
+		companionCert, err := readCertificateFile(identityFile + IdentityCertSuffix)
+		if err == nil && isCertCurrentlyValid(companionCert) {
+			candidates = append([]*ssh.Certificate{companionCert}, candidates...)
+		}
+	}
+	var rtn []ssh.Signer
+	signerKey := signer.PublicKey().Marshal()
+	for _, cert := range candidates {
+		if !bytes.Equal(cert.Key.Marshal(), signerKey) {
+			continue
+		}
+		certSigner, err := ssh.NewCertSigner(cert, signer)
+		if err != nil {
+			log.Printf("cannot create certificate signer: %v\n", err)
+			continue
+		}
+		rtn = append(rtn, certSigner)
+	}
+	return append(rtn, signer)
+}
+
+// moves the agent's certificates ahead of its plain keys (keeping the relative order)
+func sortAgentSignersCertsFirst(signers []ssh.Signer) []ssh.Signer {
+	var certSigners []ssh.Signer
+	var keySigners []ssh.Signer
+	for _, signer := range signers {
+		if _, ok := signer.PublicKey().(*ssh.Certificate); ok {
+			certSigners = append(certSigners, signer)
+		} else {
+			keySigners = append(keySigners, signer)
+		}
+	}
+	return append(certSigners, keySigners...)
+}
+
+// true if a @cert-authority line in known_hosts applies to the host
+func hasHostCertAuthority(keyDb *knownhosts.HostKeyDB, hostname string) bool {
+	if keyDb == nil {
+		return false
+	}
+	for _, knownKey := range keyDb.HostKeys(hostname) {
+		if knownKey.Cert {
+			return true
+		}
+	}
+	return false
+}
+
+// removes the @cert-authority keys for the host from a KeyError's Want list (CA keys are not host keys)
+func filterCertAuthorityKeys(want []xknownhosts.KnownKey, keyDb *knownhosts.HostKeyDB, hostname string) []xknownhosts.KnownKey {
+	if keyDb == nil {
+		return want
+	}
+	var caKeys [][]byte
+	for _, knownKey := range keyDb.HostKeys(hostname) {
+		if knownKey.Cert {
+			caKeys = append(caKeys, knownKey.Marshal())
+		}
+	}
+	var rtn []xknownhosts.KnownKey
+	for _, wantKey := range want {
+		isCA := false
+		for _, caKey := range caKeys {
+			if bytes.Equal(wantKey.Key.Marshal(), caKey) {
+				isCA = true
+				break
+			}
+		}
+		if !isCA {
+			rtn = append(rtn, wantKey)
+		}
+	}
+	return rtn
+}
+
+// checks known_hosts for a plain (non-marker) entry for hostname with exactly this key
+// (x/crypto only checks the first known key of each type, so a @cert-authority line can shadow a plain entry)
+// wildcard patterns are not checked here
+func isKnownPlainHostKey(knownHostsFiles []string, hostname string, key ssh.PublicKey) bool {
+	normalized := xknownhosts.Normalize(hostname)
+	keyBytes := key.Marshal()
+	for _, filename := range knownHostsFiles {
+		data, err := os.ReadFile(filename)
+		if err != nil {
+			continue
+		}
+		for len(data) > 0 {
+			marker, hosts, pubKey, _, rest, err := ssh.ParseKnownHosts(data)
+			if err != nil {
+				break
+			}
+			data = rest
+			if marker != "" || !bytes.Equal(pubKey.Marshal(), keyBytes) {
+				continue
+			}
+			for _, host := range hosts {
+				if host == normalized || matchHashedHost(host, normalized) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// matches a hashed known_hosts entry (|1|salt|hash, HMAC-SHA1 of the hostname)
+func matchHashedHost(entry string, hostname string) bool {
+	parts := strings.Split(entry, "|")
+	if len(parts) != 4 || parts[0] != "" || parts[1] != "1" {
+		return false
+	}
+	salt, err := base64.StdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return false
+	}
+	hash, err := base64.StdEncoding.DecodeString(parts[3])
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha1.New, salt)
+	mac.Write([]byte(hostname))
+	return hmac.Equal(mac.Sum(nil), hash)
+}
+
+// maps a certificate algorithm to its plain key algorithm (ssh-ed25519-cert-v01@openssh.com -> ssh-ed25519)
+func certAlgoToKeyAlgo(algo string) string {
+	if !strings.HasSuffix(algo, "-cert-v01@openssh.com") {
+		return ""
+	}
+	keyAlgo := strings.TrimSuffix(algo, "-cert-v01@openssh.com")
+	if strings.HasPrefix(keyAlgo, "sk-") {
+		keyAlgo += "@openssh.com"
+	}
+	return keyAlgo
+}
+
+// for hosts with a @cert-authority line, the db only returns certificate algorithms for that key type.
+// the plain algorithms are appended (certificates stay preferred) so a host without a certificate
+// can still be verified against its plain known_hosts entries
+func makeCertAwareHostKeyAlgorithms(keyDb *knownhosts.HostKeyDB) HostKeyAlgorithms {
+	return func(hostWithPort string) []string {
+		algos := keyDb.HostKeyAlgorithms(hostWithPort)
+		if !hasHostCertAuthority(keyDb, hostWithPort) {
+			return algos
+		}
+		rtn := append([]string{}, algos...)
+		seen := make(map[string]bool)
+		for _, algo := range algos {
+			seen[algo] = true
+		}
+		for _, algo := range algos {
+			keyAlgo := certAlgoToKeyAlgo(algo)
+			if keyAlgo == "" || seen[keyAlgo] {
+				continue
+			}
+			seen[keyAlgo] = true
+			rtn = append(rtn, keyAlgo)
+		}
+		return rtn
+	}
+}
@@ -0,0 +1,123 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package remote
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+	xknownhosts "golang.org/x/crypto/ssh/knownhosts"
+)
+
+func TestCertAlgoToKeyAlgo(t *testing.T) {
+	tests := []struct {
+		CertAlgo string
+		KeyAlgo  string
+	}{
+		{ssh.CertAlgoED25519v01, ssh.KeyAlgoED25519},
+		{ssh.CertAlgoRSAv01, ssh.KeyAlgoRSA},
+		{ssh.CertAlgoRSASHA256v01, ssh.KeyAlgoRSASHA256},
+		{ssh.CertAlgoRSASHA512v01, ssh.KeyAlgoRSASHA512},
+		{ssh.CertAlgoECDSA256v01, ssh.KeyAlgoECDSA256},
+		{ssh.CertAlgoECDSA384v01, ssh.KeyAlgoECDSA384},
+		{ssh.CertAlgoECDSA521v01, ssh.KeyAlgoECDSA521},
+		{ssh.CertAlgoSKED25519v01, ssh.KeyAlgoSKED25519},
+		{ssh.CertAlgoSKECDSA256v01, ssh.KeyAlgoSKECDSA256},
+		{ssh.KeyAlgoED25519, ""},
+		{"", ""},
+	}
+	for _, test := range tests {
+		if keyAlgo := certAlgoToKeyAlgo(test.CertAlgo); keyAlgo != test.KeyAlgo {
+			t.Errorf("%q: expected %q, got %q", test.CertAlgo, test.KeyAlgo, keyAlgo)
+		}
+	}
+}
+
+func TestMatchHashedHost(t *testing.T) {
+	hashed := xknownhosts.HashHostname("example.com")
+	hashedPort := xknownhosts.HashHostname(xknownhosts.Normalize("example.com:2222"))
+	tests := []struct {
+		Entry    string
+		Hostname string
+		Match    bool
+	}{
+		{hashed, "example.com", true},
+		{hashed, "other.com", false},
+		{hashedPort, "[example.com]:2222", true},
+		{hashedPort, "example.com", false},
+		{"example.com", "example.com", false}, // plain entries are not hashed
+		{"|1|bad|entry", "example.com", false},
+		{"|2|c2FsdA==|aGFzaA==", "example.com", false},
+	}
+	for _, test := range tests {
+		if match := matchHashedHost(test.Entry, test.Hostname); match != test.Match {
+			t.Errorf("%q %q: expected %v, got %v", test.Entry, test.Hostname, test.Match, match)
+		}
+	}
+}
+
+func makeTestHostKey(t *testing.T) ssh.PublicKey {
+	t.Helper()
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("error generating key: %v", err)
+	}
+	sshPub, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatalf("error converting key: %v", err)
+	}
+	return sshPub
+}
+
+func TestIsKnownPlainHostKey(t *testing.T) {
+	plainKey := makeTestHostKey(t)
+	hashedKey := makeTestHostKey(t)
+	portKey := makeTestHostKey(t)
+	caKey := makeTestHostKey(t)
+	revokedKey := makeTestHostKey(t)
+	unknownKey := makeTestHostKey(t)
+	lines := []string{
+		"# comment",
+		xknownhosts.Line([]string{"example.com"}, plainKey),
+		xknownhosts.Line([]string{xknownhosts.HashHostname("hashed.example.com")}, hashedKey),
+		xknownhosts.Line([]string{"example.com:2222"}, portKey),
+		"@cert-authority " + xknownhosts.Line([]string{"*.example.com"}, caKey),
+		"@revoked " + xknownhosts.Line([]string{"example.com"}, revokedKey),
+	}
+	dir := t.TempDir()
+	knownHostsFile := filepath.Join(dir, "known_hosts")
+	content := ""
+	for _, line := range lines {
+		content += line + "\n"
+	}
+	if err := os.WriteFile(knownHostsFile, []byte(content), 0600); err != nil {
+		t.Fatalf("error writing known_hosts: %v", err)
+	}
+	files := []string{filepath.Join(dir, "missing"), knownHostsFile}
+	tests := []struct {
+		Name     string
+		Hostname string
+		Key      ssh.PublicKey
+		Known    bool
+	}{
+		{"plain", "example.com:22", plainKey, true},
+		{"plain-wrong-host", "other.com:22", plainKey, false},
+		{"hashed", "hashed.example.com:22", hashedKey, true},
+		{"hashed-wrong-host", "example.com:22", hashedKey, false},
+		{"port", "example.com:2222", portKey, true},
+		{"port-default", "example.com:22", portKey, false},
+		{"cert-authority", "host.example.com:22", caKey, false},
+		{"revoked", "example.com:22", revokedKey, false},
+		{"unknown", "example.com:22", unknownKey, false},
+	}
+	for _, test := range tests {
+		if known := isKnownPlainHostKey(files, test.Hostname, test.Key); known != test.Known {
+			t.Errorf("%s: expected %v, got %v", test.Name, test.Known, known)
+		}
+	}
+}
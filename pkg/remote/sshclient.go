@@ -17,6 +17,7 @@ import (
 	"os/exec"
 	"os/user"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -62,6 +63,8 @@ type ConnectionDebugInfo struct {
 	CurrentClient *ssh.Client
 	NextOpts      *SSHOpts
 	JumpNum       int32
+	ProxyCommand  string
+	ProxyStderr   string
 }
 
 type ConnectionError struct {
@@ -70,10 +73,20 @@ type ConnectionError struct {
 }
 
 func (ce ConnectionError) Error() string {
+	var rtn string
 	if ce.CurrentClient == nil {
-		return fmt.Sprintf("Connecting to %+#v, Error: %v", ce.NextOpts, ce.Err)
+		rtn = fmt.Sprintf("Connecting to %+#v, Error: %v", ce.NextOpts, ce.Err)
+	} else {
+		rtn = fmt.Sprintf("Connecting from %v to %+#v (jump number %d), Error: %v", ce.CurrentClient, ce.NextOpts, ce.JumpNum, ce.Err)
+	}
+	if ce.ProxyCommand != "" {
+		rtn += fmt.Sprintf(" (ProxyCommand %q", ce.ProxyCommand)
+		if ce.ProxyStderr != "" {
+			rtn += fmt.Sprintf(", stderr: %s", ce.ProxyStderr)
+		}
+		rtn += ")"
 	}
-	return fmt.Sprintf("Connecting from %v to %+#v (jump number %d), Error: %v", ce.CurrentClient, ce.NextOpts, ce.JumpNum, ce.Err)
+	return rtn
 }
 
 // This exists to trick the ssh library into continuing to try
@@ -125,8 +138,10 @@ func createPublicKeyCallback(connCtx context.Context, sshKeywords *wshrpc.ConnKe
 	// require pointer to modify list in closure
 	identityFilesPtr := &identityFiles
 
+	// certificates are offered ahead of the matching plain key
+	certs := loadCertificateFiles(sshKeywords.SshCertificateFile)
 	var authSockSigners []ssh.Signer
-	authSockSigners = append(authSockSigners, authSockSignersExt...)
+	authSockSigners = append(authSockSigners, sortAgentSignersCertsFirst(authSockSignersExt)...)
 	authSockSignersPtr := &authSockSigners
 
 	return func() ([]ssh.Signer, error) {
@@ -134,7 +149,7 @@ func createPublicKeyCallback(connCtx context.Context, sshKeywords *wshrpc.ConnKe
 		if len(*authSockSignersPtr) != 0 {
 			authSockSigner := (*authSockSignersPtr)[0]
 			*authSockSignersPtr = (*authSockSignersPtr)[1:]
-			return []ssh.Signer{authSockSigner}, nil
+			return withCertSigners(authSockSigner, certs, ""), nil
 		}
 
 		if len(*identityFilesPtr) == 0 {
@@ -158,7 +173,7 @@ func createPublicKeyCallback(connCtx context.Context, sshKeywords *wshrpc.ConnKe
 						PrivateKey: unencryptedPrivateKey,
 					})
 				}
-				return []ssh.Signer{signer}, nil
+				return withCertSigners(signer, certs, identityFile), nil
 			}
 		}
 		if _, ok := err.(*ssh.PassphraseMissingError); !ok {
@@ -201,7 +216,7 @@ func createPublicKeyCallback(connCtx context.Context, sshKeywords *wshrpc.ConnKe
 				PrivateKey: unencryptedPrivateKey,
 			})
 		}
-		return []ssh.Signer{signer}, nil
+		return withCertSigners(signer, certs, identityFile), nil
 	}
 }
 
@@ -422,8 +437,9 @@ func createHostKeyCallback(sshKeywords *wshrpc.ConnKeywords) (ssh.HostKeyCallbac
 	// and we try again
 	var basicCallback ssh.HostKeyCallback
 	var hostKeyAlgorithms HostKeyAlgorithms
+	var keyDb *knownhosts.HostKeyDB
 	for basicCallback == nil && len(knownHostsFiles) > 0 {
-		keyDb, err := knownhosts.NewDB(knownHostsFiles...)
+		keyDb, err = knownhosts.NewDB(knownHostsFiles...)
 		if serr, ok := err.(*os.PathError); ok {
 			badFile := serr.Path
 			unreadableFiles = append(unreadableFiles, badFile)
@@ -442,7 +458,7 @@ func createHostKeyCallback(sshKeywords *wshrpc.ConnKeywords) (ssh.HostKeyCallbac
 			return nil, nil, fmt.Errorf("known_hosts formatting error: %+v", err)
 		} else {
 			basicCallback = keyDb.HostKeyCallback()
-			hostKeyAlgorithms = keyDb.HostKeyAlgorithms
+			hostKeyAlgorithms = makeCertAwareHostKeyAlgorithms(keyDb)
 		}
 	}
 
@@ -462,7 +478,16 @@ func createHostKeyCallback(sshKeywords *wshrpc.ConnKeywords) (ssh.HostKeyCallbac
 		if err == nil {
 			// success
 			return nil
-		} else if _, ok := err.(*xknownhosts.RevokedError); ok {
+		}
+		if cert, ok := key.(*ssh.Certificate); ok && !hasHostCertAuthority(keyDb, hostname) {
+			// no @cert-authority applies to this host, fall back to the plain host key (as openssh does)
+			key = cert.Key
+			err = basicCallback(hostname, remote, key)
+			if err == nil {
+				return nil
+			}
+		}
+		if _, ok := err.(*xknownhosts.RevokedError); ok {
 			// revoked credentials are refused outright
 			return err
 		} else if _, ok := err.(*xknownhosts.KeyError); !ok {
@@ -470,6 +495,13 @@ func createHostKeyCallback(sshKeywords *wshrpc.ConnKeywords) (ssh.HostKeyCallbac
 			return err
 		}
 		serr, _ := err.(*xknownhosts.KeyError)
+		if len(serr.Want) > 0 && hasHostCertAuthority(keyDb, hostname) {
+			// the host presented a plain key, only compare it against the plain known_hosts entries
+			if isKnownPlainHostKey(knownHostsFiles, hostname, key) {
+				return nil
+			}
+			serr.Want = filterCertAuthorityKeys(serr.Want, keyDb, hostname)
+		}
 		if len(serr.Want) == 0 {
 			// the key was not found
 
@@ -546,7 +578,12 @@ func createHostKeyCallback(sshKeywords *wshrpc.ConnKeywords) (ssh.HostKeyCallbac
 			return err
 		}
 		// try one final time
-		return updatedCallback(hostname, remote, key)
+		err = updatedCallback(hostname, remote, key)
+		if err != nil && isKnownPlainHostKey(knownHostsFiles, hostname, key) {
+			// the new entry can be shadowed by a @cert-authority line with the same key type
+			return nil
+		}
+		return err
 	}
 
 	return waveHostKeyCallback, hostKeyAlgorithms, nil
@@ -610,9 +647,23 @@ func createClientConfig(connCtx context.Context, sshKeywords *wshrpc.ConnKeyword
 	}, nil
 }
 
-func connectInternal(ctx context.Context, networkAddr string, clientConfig *ssh.ClientConfig, currentClient *ssh.Client) (*ssh.Client, error) {
+func connectInternal(ctx context.Context, networkAddr string, clientConfig *ssh.ClientConfig, currentClient *ssh.Client, debugInfo *ConnectionDebugInfo) (*ssh.Client, error) {
 	var clientConn net.Conn
 	var err error
+	if debugInfo.ProxyCommand != "" {
+		proxyConn, err := StartProxyCommand(ctx, debugInfo.ProxyCommand)
+		if err != nil {
+			return nil, err
+		}
+		client, err := newClientConnContext(ctx, proxyConn, networkAddr, clientConfig)
+		if err != nil {
+			// kills the command (if it is hanging) and waits for it
+			proxyConn.Close()
+			debugInfo.ProxyStderr = proxyConn.StderrOutput()
+			return nil, err
+		}
+		return client, nil
+	}
 	if currentClient == nil {
 		d := net.Dialer{Timeout: clientConfig.Timeout}
 		clientConn, err = d.DialContext(ctx, "tcp", networkAddr)
@@ -632,19 +683,46 @@ func connectInternal(ctx context.Context, networkAddr string, clientConfig *ssh.
 	return ssh.NewClient(c, chans, reqs), nil
 }
 
-func ConnectToClient(connCtx context.Context, opts *SSHOpts, currentClient *ssh.Client, jumpNum int32, connFlags *wshrpc.ConnKeywords) (*ssh.Client, int32, error) {
+// ssh.NewClientConn does not take a context, so conn is closed to stop the handshake if ctx is done
+func newClientConnContext(ctx context.Context, conn net.Conn, networkAddr string, clientConfig *ssh.ClientConfig) (*ssh.Client, error) {
+	type handshakeResult struct {
+		Conn  ssh.Conn
+		Chans <-chan ssh.NewChannel
+		Reqs  <-chan *ssh.Request
+		Err   error
+	}
+	resultCh := make(chan handshakeResult, 1)
+	go func() {
+		defer panichandler.PanicHandler("newClientConnContext")
+		c, chans, reqs, err := ssh.NewClientConn(conn, networkAddr, clientConfig)
+		resultCh <- handshakeResult{Conn: c, Chans: chans, Reqs: reqs, Err: err}
+	}()
+	select {
+	case <-ctx.Done():
+		conn.Close()
+		return nil, fmt.Errorf("ssh handshake: %w", ctx.Err())
+	case result := <-resultCh:
+		if result.Err != nil {
+			return nil, result.Err
+		}
+		return ssh.NewClient(result.Conn, result.Chans, result.Reqs), nil
+	}
+}
+
+// returns the client, the jump number, and the resolved keywords used to make the connection
+func ConnectToClient(connCtx context.Context, opts *SSHOpts, currentClient *ssh.Client, jumpNum int32, connFlags *wshrpc.ConnKeywords) (*ssh.Client, int32, *wshrpc.ConnKeywords, error) {
 	debugInfo := &ConnectionDebugInfo{
 		CurrentClient: currentClient,
 		NextOpts:      opts,
 		JumpNum:       jumpNum,
 	}
 	if jumpNum > SshProxyJumpMaxDepth {
-		return nil, jumpNum, ConnectionError{ConnectionDebugInfo: debugInfo, Err: fmt.Errorf("ProxyJump %d exceeds Wave's max depth of %d", jumpNum, SshProxyJumpMaxDepth)}
+		return nil, jumpNum, nil, ConnectionError{ConnectionDebugInfo: debugInfo, Err: fmt.Errorf("ProxyJump %d exceeds Wave's max depth of %d", jumpNum, SshProxyJumpMaxDepth)}
 	}
 	// todo print final warning if logging gets turned off
 	sshConfigKeywords, err := findSshConfigKeywords(opts.SSHHost)
 	if err != nil {
-		return nil, debugInfo.JumpNum, ConnectionError{ConnectionDebugInfo: debugInfo, Err: err}
+		return nil, debugInfo.JumpNum, nil, ConnectionError{ConnectionDebugInfo: debugInfo, Err: err}
 	}
 
 	connFlags.SshUser = opts.SSHUser
@@ -659,13 +737,13 @@ func ConnectToClient(connCtx context.Context, opts *SSHOpts, currentClient *ssh.
 
 	sshKeywords, err := combineSshKeywords(connFlags, sshConfigKeywords, &savedKeywords)
 	if err != nil {
-		return nil, debugInfo.JumpNum, ConnectionError{ConnectionDebugInfo: debugInfo, Err: err}
+		return nil, debugInfo.JumpNum, nil, ConnectionError{ConnectionDebugInfo: debugInfo, Err: err}
 	}
 
 	for _, proxyName := range sshKeywords.SshProxyJump {
 		proxyOpts, err := ParseOpts(proxyName)
 		if err != nil {
-			return nil, debugInfo.JumpNum, ConnectionError{ConnectionDebugInfo: debugInfo, Err: err}
+			return nil, debugInfo.JumpNum, nil, ConnectionError{ConnectionDebugInfo: debugInfo, Err: err}
 		}
 
 		// ensure no overflow (this will likely never happen)
@@ -674,23 +752,30 @@ func ConnectToClient(connCtx context.Context, opts *SSHOpts, currentClient *ssh.
 		}
 
 		// do not apply supplied keywords to proxies - ssh config must be used for that
-		debugInfo.CurrentClient, jumpNum, err = ConnectToClient(connCtx, proxyOpts, debugInfo.CurrentClient, jumpNum, &wshrpc.ConnKeywords{})
+		debugInfo.CurrentClient, jumpNum, _, err = ConnectToClient(connCtx, proxyOpts, debugInfo.CurrentClient, jumpNum, &wshrpc.ConnKeywords{})
 		if err != nil {
 			// do not add a context on a recursive call
 			// (this can cause a recursive nested context that's arbitrarily deep)
-			return nil, jumpNum, err
+			return nil, jumpNum, nil, err
 		}
 	}
 	clientConfig, err := createClientConfig(connCtx, sshKeywords, debugInfo)
 	if err != nil {
-		return nil, debugInfo.JumpNum, ConnectionError{ConnectionDebugInfo: debugInfo, Err: err}
+		return nil, debugInfo.JumpNum, nil, ConnectionError{ConnectionDebugInfo: debugInfo, Err: err}
 	}
 	networkAddr := sshKeywords.SshHostName + ":" + sshKeywords.SshPort
-	client, err := connectInternal(connCtx, networkAddr, clientConfig, debugInfo.CurrentClient)
+	if sshKeywords.SshProxyCommand != "" {
+		if len(sshKeywords.SshProxyJump) > 0 {
+			log.Printf("ignoring ProxyCommand for %s since ProxyJump is set\n", opts.String())
+		} else {
+			debugInfo.ProxyCommand = expandProxyCommandTokens(sshKeywords.SshProxyCommand, opts, sshKeywords.SshHostName, sshKeywords.SshPort, sshKeywords.SshUser)
+		}
+	}
+	client, err := connectInternal(connCtx, networkAddr, clientConfig, debugInfo.CurrentClient, debugInfo)
 	if err != nil {
-		return client, debugInfo.JumpNum, ConnectionError{ConnectionDebugInfo: debugInfo, Err: err}
+		return client, debugInfo.JumpNum, nil, ConnectionError{ConnectionDebugInfo: debugInfo, Err: err}
 	}
-	return client, debugInfo.JumpNum, nil
+	return client, debugInfo.JumpNum, sshKeywords, nil
 }
 
 func combineSshKeywords(userProvidedOpts *wshrpc.ConnKeywords, configKeywords *wshrpc.ConnKeywords, savedKeywords *wshrpc.ConnKeywords) (*wshrpc.ConnKeywords, error) {
@@ -732,6 +817,12 @@ func combineSshKeywords(userProvidedOpts *wshrpc.ConnKeywords, configKeywords *w
 	sshKeywords.SshIdentityFile = append(sshKeywords.SshIdentityFile, userProvidedOpts.SshIdentityFile...)
 	sshKeywords.SshIdentityFile = append(sshKeywords.SshIdentityFile, configKeywords.SshIdentityFile...)
 
+	if savedKeywords != nil {
+		sshKeywords.SshCertificateFile = append(sshKeywords.SshCertificateFile, savedKeywords.SshCertificateFile...)
+	}
+	sshKeywords.SshCertificateFile = append(sshKeywords.SshCertificateFile, userProvidedOpts.SshCertificateFile...)
+	sshKeywords.SshCertificateFile = append(sshKeywords.SshCertificateFile, configKeywords.SshCertificateFile...)
+
 	// these are not officially supported in the waveterm frontend but can be configured
 	// in ssh config files
 	sshKeywords.SshBatchMode = configKeywords.SshBatchMode
@@ -741,13 +832,51 @@ func combineSshKeywords(userProvidedOpts *wshrpc.ConnKeywords, configKeywords *w
 	sshKeywords.SshPreferredAuthentications = configKeywords.SshPreferredAuthentications
 	sshKeywords.SshAddKeysToAgent = configKeywords.SshAddKeysToAgent
 	sshKeywords.SshIdentityAgent = configKeywords.SshIdentityAgent
+	if userProvidedOpts.SshForwardAgent != nil {
+		sshKeywords.SshForwardAgent = userProvidedOpts.SshForwardAgent
+	} else if savedKeywords != nil && savedKeywords.SshForwardAgent != nil {
+		sshKeywords.SshForwardAgent = savedKeywords.SshForwardAgent
+	} else {
+		sshKeywords.SshForwardAgent = configKeywords.SshForwardAgent
+	}
 	sshKeywords.SshProxyJump = configKeywords.SshProxyJump
+	if userProvidedOpts.SshProxyCommand != "" {
+		sshKeywords.SshProxyCommand = userProvidedOpts.SshProxyCommand
+	} else if savedKeywords != nil && savedKeywords.SshProxyCommand != "" {
+		sshKeywords.SshProxyCommand = savedKeywords.SshProxyCommand
+	} else {
+		sshKeywords.SshProxyCommand = configKeywords.SshProxyCommand
+	}
 	sshKeywords.SshUserKnownHostsFile = configKeywords.SshUserKnownHostsFile
 	sshKeywords.SshGlobalKnownHostsFile = configKeywords.SshGlobalKnownHostsFile
+	if savedKeywords == nil {
+		savedKeywords = &wshrpc.ConnKeywords{}
+	}
+	sshKeywords.SshServerAliveInterval = firstNonNilInt(userProvidedOpts.SshServerAliveInterval, savedKeywords.SshServerAliveInterval, configKeywords.SshServerAliveInterval)
+	sshKeywords.SshServerAliveCountMax = firstNonNilInt(userProvidedOpts.SshServerAliveCountMax, savedKeywords.SshServerAliveCountMax, configKeywords.SshServerAliveCountMax)
+
+	// forwards are combined from all sources
+	for _, keywords := range []*wshrpc.ConnKeywords{configKeywords, savedKeywords, userProvidedOpts} {
+		if keywords == nil {
+			continue
+		}
+		sshKeywords.SshLocalForward = append(sshKeywords.SshLocalForward, keywords.SshLocalForward...)
+		sshKeywords.SshRemoteForward = append(sshKeywords.SshRemoteForward, keywords.SshRemoteForward...)
+		sshKeywords.SshDynamicForward = append(sshKeywords.SshDynamicForward, keywords.SshDynamicForward...)
+	}
 
 	return sshKeywords, nil
 }
 
+func firstNonNilInt(vals ...*int) *int {
+	for _, val := range vals {
+		if val != nil {
+			return val
+		}
+	}
+	return nil
+}
+
 // note that a `var == "yes"` will default to false
 // but `var != "no"` will default to true
 // when given unexpected strings
@@ -786,6 +915,7 @@ func findSshConfigKeywords(hostPattern string) (connKeywords *wshrpc.ConnKeyword
 		identityFileRaw[i] = trimquotes.TryTrimQuotes(identityFileRaw[i])
 	}
 	sshKeywords.SshIdentityFile = identityFileRaw
+	sshKeywords.SshCertificateFile = getAllTrimmed(hostPattern, "CertificateFile")
 
 	batchModeRaw, err := WaveSshConfigUserSettings().GetStrict(hostPattern, "BatchMode")
 	if err != nil {
@@ -850,6 +980,14 @@ func findSshConfigKeywords(hostPattern string) (connKeywords *wshrpc.ConnKeyword
 		sshKeywords.SshIdentityAgent = agentPath
 	}
 
+	// only yes/no are supported (not the socket path or environment variable forms)
+	forwardAgentRaw, err := WaveSshConfigUserSettings().GetStrict(hostPattern, "ForwardAgent")
+	if err != nil {
+		return nil, err
+	}
+	forwardAgent := (strings.ToLower(trimquotes.TryTrimQuotes(forwardAgentRaw)) == "yes")
+	sshKeywords.SshForwardAgent = &forwardAgent
+
 	proxyJumpRaw, err := WaveSshConfigUserSettings().GetStrict(hostPattern, "ProxyJump")
 	if err != nil {
 		return nil, err
@@ -862,14 +1000,57 @@ func findSshConfigKeywords(hostPattern string) (connKeywords *wshrpc.ConnKeyword
 		}
 		sshKeywords.SshProxyJump = append(sshKeywords.SshProxyJump, proxyJumpName)
 	}
+	proxyCommandRaw, err := WaveSshConfigUserSettings().GetStrict(hostPattern, "ProxyCommand")
+	if err != nil {
+		return nil, err
+	}
+	proxyCommandRaw = strings.TrimSpace(proxyCommandRaw)
+	if strings.ToLower(proxyCommandRaw) != "none" {
+		sshKeywords.SshProxyCommand = proxyCommandRaw
+	}
 	rawUserKnownHostsFile, _ := WaveSshConfigUserSettings().GetStrict(hostPattern, "UserKnownHostsFile")
 	sshKeywords.SshUserKnownHostsFile = strings.Fields(rawUserKnownHostsFile) // TODO - smarter splitting escaped spaces and quotes
 	rawGlobalKnownHostsFile, _ := WaveSshConfigUserSettings().GetStrict(hostPattern, "GlobalKnownHostsFile")
 	sshKeywords.SshGlobalKnownHostsFile = strings.Fields(rawGlobalKnownHostsFile) // TODO - smarter splitting escaped spaces and quotes
+	sshKeywords.SshLocalForward = getAllTrimmed(hostPattern, "LocalForward")
+	sshKeywords.SshRemoteForward = getAllTrimmed(hostPattern, "RemoteForward")
+	sshKeywords.SshDynamicForward = getAllTrimmed(hostPattern, "DynamicForward")
+	sshKeywords.SshServerAliveInterval = getIntStrict(hostPattern, "ServerAliveInterval")
+	sshKeywords.SshServerAliveCountMax = getIntStrict(hostPattern, "ServerAliveCountMax")
 
 	return sshKeywords, nil
 }
 
+func getAllTrimmed(hostPattern string, keyword string) []string {
+	var rtn []string
+	for _, val := range WaveSshConfigUserSettings().GetAll(hostPattern, keyword) {
+		val = strings.TrimSpace(trimquotes.TryTrimQuotes(val))
+		if val == "" {
+			continue
+		}
+		rtn = append(rtn, val)
+	}
+	return rtn
+}
+
+// returns nil if the keyword is unset or is not a valid integer
+func getIntStrict(hostPattern string, keyword string) *int {
+	raw, err := WaveSshConfigUserSettings().GetStrict(hostPattern, keyword)
+	if err != nil {
+		return nil
+	}
+	raw = strings.TrimSpace(trimquotes.TryTrimQuotes(raw))
+	if raw == "" {
+		return nil
+	}
+	val, err := strconv.Atoi(raw)
+	if err != nil {
+		log.Printf("invalid %s value %q for %s\n", keyword, raw, hostPattern)
+		return nil
+	}
+	return &val
+}
+
 type SSHOpts struct {
 	SSHHost string `json:"sshhost"`
 	SSHUser string `json:"sshuser"`
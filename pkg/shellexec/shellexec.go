@@ -12,7 +12,9 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
 	"runtime"
+	"sort"
 	"strings"
 	"sync"
 	"syscall"
@@ -165,7 +167,18 @@ func StartWslShellProc(ctx context.Context, termSize waveobj.TermSize, cmdStr st
 	}
 
 	homeDir := wsl.GetHomeDir(conn.Context, client)
-	shellOpts = append(shellOpts, "~", "-d", client.Name())
+	startDir := "~"
+	if cmdOpts.Cwd != "" {
+		cwd := cmdOpts.Cwd
+		if cwd == "~" || strings.HasPrefix(cwd, "~/") {
+			cwd = homeDir + cwd[1:]
+		}
+		// wsl.exe fails to start if the dir does not exist, so fall back to home
+		if wsl.DirExists(conn.Context, client, cwd) {
+			startDir = cwd
+		}
+	}
+	shellOpts = append(shellOpts, "--cd", startDir, "-d", client.Name())
 
 	var subShellOpts []string
 
@@ -177,7 +190,7 @@ func StartWslShellProc(ctx context.Context, termSize waveobj.TermSize, cmdStr st
 			// cant set -l or -i with --rcfile
 			subShellOpts = append(subShellOpts, "--rcfile", fmt.Sprintf(`%s/.waveterm/%s/.bashrc`, homeDir, shellutil.BashIntegrationDir))
 		} else if isFishShell(shellPath) {
-			carg := fmt.Sprintf(`"set -x PATH \"%s\"/.waveterm/%s $PATH"`, homeDir, shellutil.WaveHomeBinDir)
+			carg := fmt.Sprintf(`"source \"%s\"/.waveterm/%s/wave.fish"`, homeDir, shellutil.FishIntegrationDir)
 			subShellOpts = append(subShellOpts, "-C", carg)
 		} else if wsl.IsPowershell(shellPath) {
 			// powershell is weird about quoted path executables and requires an ampersand first
@@ -237,12 +250,96 @@ func StartWslShellProc(ctx context.Context, termSize waveobj.TermSize, cmdStr st
 	return &ShellProc{Cmd: cmdWrap, ConnName: conn.GetName(), CloseOnce: &sync.Once{}, DoneCh: make(chan any)}, nil
 }
 
+var envVarNameRe = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// starts the shell in an exec-based connection (docker://, podman://, k8s://)
+// the provider's cli runs under a local pty and allocates a terminal in the target
+// the target is assumed to have a posix /bin/sh (the command is built as a single sh script)
+func StartExecShellProc(termSize waveobj.TermSize, cmdStr string, cmdOpts CommandOptsType, conn *conncontroller.ExecConn) (*ShellProc, error) {
+	setupCtx, cancelFn := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancelFn()
+	wshEnabled := conn.WshEnabled.Load()
+	var wshPath string
+	if wshEnabled {
+		wshPath = conncontroller.ExecConnWshPath
+	}
+	shellPath := cmdOpts.ShellPath
+	if shellPath == "" {
+		shellPath = conn.Target.DetectShell(setupCtx, wshPath)
+	}
+	log.Printf("detected shell: %s", shellPath)
+	envVars := make(map[string]string)
+	for envKey, envVal := range cmdOpts.Env {
+		envVars[envKey] = envVal
+	}
+	envVars["TERM"] = shellutil.DefaultTermType
+	var shellOpts []string
+	for _, opt := range cmdOpts.ShellOpts {
+		shellOpts = append(shellOpts, utilfn.ShellQuote(opt, false, -1))
+	}
+	if cmdStr == "" {
+		if wshEnabled {
+			_, err := conn.Target.Output(setupCtx, wshPath+" rcfiles")
+			if err != nil {
+				log.Printf("error installing rc files: %v", err)
+				return nil, err
+			}
+		}
+		if wshEnabled && isBashShell(shellPath) {
+			// cant set -l or -i with --rcfile
+			shellOpts = append(shellOpts, "--rcfile", fmt.Sprintf(`"$HOME"/.waveterm/%s/.bashrc`, shellutil.BashIntegrationDir))
+		} else if wshEnabled && isFishShell(shellPath) {
+			shellOpts = append(shellOpts, "-C", fmt.Sprintf(`"source \"$HOME\"/.waveterm/%s/wave.fish"`, shellutil.FishIntegrationDir))
+		} else {
+			if cmdOpts.Login {
+				shellOpts = append(shellOpts, "-l")
+			} else if cmdOpts.Interactive {
+				shellOpts = append(shellOpts, "-i")
+			}
+		}
+	} else {
+		shellOpts = append(shellOpts, "-c", utilfn.ShellQuote(cmdStr, false, -1))
+	}
+	var exportWords []string
+	for envKey, envVal := range envVars {
+		if !envVarNameRe.MatchString(envKey) {
+			log.Printf("skipping invalid environment variable name %q\n", envKey)
+			continue
+		}
+		exportWords = append(exportWords, envKey+"="+utilfn.ShellQuote(envVal, false, -1))
+	}
+	if wshEnabled && cmdStr == "" && isZshShell(shellPath) {
+		exportWords = append(exportWords, fmt.Sprintf(`ZDOTDIR="$HOME"/.waveterm/%s`, shellutil.ZshIntegrationDir))
+	}
+	sort.Strings(exportWords)
+	cmdCombined := fmt.Sprintf("export %s; exec %s %s", strings.Join(exportWords, " "), utilfn.ShellQuote(shellPath, false, -1), strings.Join(shellOpts, " "))
+	cmdCombined = makeRemoteCdCmd(cmdOpts.Cwd, false) + cmdCombined
+	ecmd, err := conn.Target.MakeCmd(context.Background(), cmdCombined, true)
+	if err != nil {
+		return nil, err
+	}
+	if termSize.Rows == 0 || termSize.Cols == 0 {
+		termSize.Rows = shellutil.DefaultTermRows
+		termSize.Cols = shellutil.DefaultTermCols
+	}
+	if termSize.Rows <= 0 || termSize.Cols <= 0 {
+		return nil, fmt.Errorf("invalid term size: %v", termSize)
+	}
+	cmdPty, err := pty.StartWithSize(ecmd, &pty.Winsize{Rows: uint16(termSize.Rows), Cols: uint16(termSize.Cols)})
+	if err != nil {
+		return nil, err
+	}
+	cmdWrap := MakeCmdWrap(ecmd, cmdPty)
+	return &ShellProc{Cmd: cmdWrap, ConnName: conn.GetName(), CloseOnce: &sync.Once{}, DoneCh: make(chan any)}, nil
+}
+
 func StartRemoteShellProcNoWsh(termSize waveobj.TermSize, cmdStr string, cmdOpts CommandOptsType, conn *conncontroller.SSHConn) (*ShellProc, error) {
 	client := conn.GetClient()
 	session, err := client.NewSession()
 	if err != nil {
 		return nil, err
 	}
+	conn.MaybeForwardAgent(context.Background(), session)
 
 	remoteStdinRead, remoteStdinWriteOurs, err := os.Pipe()
 	if err != nil {
@@ -310,7 +407,7 @@ func StartRemoteShellProc(termSize waveobj.TermSize, cmdStr string, cmdOpts Comm
 			// cant set -l or -i with --rcfile
 			shellOpts = append(shellOpts, "--rcfile", fmt.Sprintf(`"%s"/.waveterm/%s/.bashrc`, homeDir, shellutil.BashIntegrationDir))
 		} else if isFishShell(shellPath) {
-			carg := fmt.Sprintf(`"set -x PATH \"%s\"/.waveterm/%s $PATH"`, homeDir, shellutil.WaveHomeBinDir)
+			carg := fmt.Sprintf(`"source \"%s\"/.waveterm/%s/wave.fish"`, homeDir, shellutil.FishIntegrationDir)
 			shellOpts = append(shellOpts, "-C", carg)
 		} else if remote.IsPowershell(shellPath) {
 			// powershell is weird about quoted path executables and requires an ampersand first
@@ -337,6 +434,7 @@ func StartRemoteShellProc(termSize waveobj.TermSize, cmdStr string, cmdOpts Comm
 	if err != nil {
 		return nil, err
 	}
+	conn.MaybeForwardAgent(context.Background(), session)
 
 	remoteStdinRead, remoteStdinWriteOurs, err := os.Pipe()
 	if err != nil {
@@ -382,6 +480,7 @@ func StartRemoteShellProc(termSize waveobj.TermSize, cmdStr string, cmdOpts Comm
 	} else {
 		cmdCombined = fmt.Sprintf(`%s=%s %s`, wshutil.WaveJwtTokenVarName, jwtToken, cmdCombined)
 	}
+	cmdCombined = makeRemoteCdCmd(cmdOpts.Cwd, remote.IsPowershell(shellPath)) + cmdCombined
 
 	session.RequestPty("xterm-256color", termSize.Rows, termSize.Cols, nil)
 	sessionWrap := MakeSessionWrap(session, cmdCombined, pipePty)
@@ -393,6 +492,24 @@ func StartRemoteShellProc(termSize waveobj.TermSize, cmdStr string, cmdOpts Comm
 	return &ShellProc{Cmd: sessionWrap, ConnName: conn.GetName(), CloseOnce: &sync.Once{}, DoneCh: make(chan any)}, nil
 }
 
+// returns a prefix for the remote command that changes to cwd
+// errors are ignored so the shell still starts (in the home dir) if cwd no longer exists
+func makeRemoteCdCmd(cwd string, isPowershell bool) string {
+	if cwd == "" {
+		return ""
+	}
+	if isPowershell {
+		return fmt.Sprintf(`Set-Location -Path '%s' -ErrorAction SilentlyContinue; `, strings.ReplaceAll(cwd, "'", "''"))
+	}
+	if cwd == "~" {
+		return ""
+	}
+	if strings.HasPrefix(cwd, "~/") {
+		return fmt.Sprintf("cd ~/%s 2>/dev/null; ", utilfn.ShellQuote(cwd[2:], false, -1))
+	}
+	return fmt.Sprintf("cd %s 2>/dev/null; ", utilfn.ShellQuote(cwd, false, -1))
+}
+
 func isZshShell(shellPath string) bool {
 	// get the base path, and then check contains
 	shellBase := filepath.Base(shellPath)
@@ -426,9 +543,8 @@ func StartShellProc(termSize waveobj.TermSize, cmdStr string, cmdOpts CommandOpt
 			// cant set -l or -i with --rcfile
 			shellOpts = append(shellOpts, "--rcfile", shellutil.GetBashRcFileOverride())
 		} else if isFishShell(shellPath) {
-			wshBinDir := filepath.Join(wavebase.GetWaveDataDir(), shellutil.WaveHomeBinDir)
-			quotedWshBinDir := utilfn.ShellQuote(wshBinDir, false, 300)
-			shellOpts = append(shellOpts, "-C", fmt.Sprintf("set -x PATH %s $PATH", quotedWshBinDir))
+			// fish has no rcfile override, so source our init file after the regular config
+			shellOpts = append(shellOpts, "-C", "source "+utilfn.ShellQuote(shellutil.GetFishInitFile(), false, -1))
 		} else if remote.IsPowershell(shellPath) {
 			shellOpts = append(shellOpts, "-ExecutionPolicy", "Bypass", "-NoExit", "-File", shellutil.GetWavePowershellEnv())
 		} else {
@@ -0,0 +1,84 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package termsearch
+
+const (
+	stripStateGround    = iota
+	stripStateEsc       // after ESC (or ESC + intermediate bytes)
+	stripStateCsi       // ESC [ ... (ends with a byte in 0x40-0x7e)
+	stripStateString    // OSC, DCS, SOS, PM, APC (ends with BEL or ESC \)
+	stripStateStringEsc // ESC inside a string
+)
+
+// removes escape sequences and control chars (except newline and tab) from terminal output
+// the state is kept between calls, so sequences can be split across appends
+type ansiStripper struct {
+	State int
+}
+
+// returns true if b is part of the text
+func (st *ansiStripper) next(b byte) bool {
+	switch st.State {
+	case stripStateEsc:
+		switch {
+		case b == '[':
+			st.State = stripStateCsi
+		case b == ']' || b == 'P' || b == 'X' || b == '^' || b == '_':
+			st.State = stripStateString
+		case b >= 0x20 && b <= 0x2f:
+			// intermediate byte (e.g. ESC ( B), wait for the final byte
+		case b == 0x1b:
+			// restart
+		default:
+			st.State = stripStateGround
+		}
+		return false
+	case stripStateCsi:
+		if b == 0x1b {
+			st.State = stripStateEsc
+		} else if b >= 0x40 && b <= 0x7e {
+			st.State = stripStateGround
+		}
+		return false
+	case stripStateString:
+		if b == 0x07 {
+			st.State = stripStateGround
+		} else if b == 0x1b {
+			st.State = stripStateStringEsc
+		}
+		return false
+	case stripStateStringEsc:
+		if b == '\\' {
+			st.State = stripStateGround
+			return false
+		}
+		// ESC cancels the string and starts a new sequence
+		st.State = stripStateEsc
+		return st.next(b)
+	}
+	if b == 0x1b {
+		st.State = stripStateEsc
+		return false
+	}
+	if b == '\n' || b == '\t' {
+		return true
+	}
+	return b >= 0x20 && b != 0x7f
+}
+
+func (st *ansiStripper) strip(data []byte) []byte {
+	rtn := make([]byte, 0, len(data))
+	for _, b := range data {
+		if st.next(b) {
+			rtn = append(rtn, b)
+		}
+	}
+	return rtn
+}
+
+// strips a complete chunk of terminal output
+func StripAnsi(data []byte) string {
+	var st ansiStripper
+	return string(st.strip(data))
+}
@@ -0,0 +1,262 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package termsearch
+
+import (
+	"context"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+const FlushInterval = 5 * time.Second
+
+const flushTextSize = 4 * 1024         // complete lines are indexed once this much text is buffered
+const maxChunkSize = 16 * 1024         // a partial line is indexed once the buffer reaches this size
+const maxPendingSize = 4 * 1024 * 1024 // chunks are dropped if the db writes fall this far behind
+const pruneInterval = MaxFileIndexBytes / 8
+
+type bufferKey struct {
+	ZoneId   string
+	FileName string
+}
+
+// stripped text for one file that has not been indexed yet
+// LineIdx is the index just after the last newline in Text (LineOffset and LineTs are the file offset and time for that position)
+// LineStarts has the file offset of every line in Text after the first (Offset is the first line's offset)
+type zoneBuffer struct {
+	Stripper   ansiStripper
+	Text       []byte
+	Offset     int64
+	Ts         int64
+	LineIdx    int
+	LineOffset int64
+	LineTs     int64
+	LineStarts []int64
+	LastAppend int64
+}
+
+type indexer struct {
+	Lock        *sync.Mutex
+	Buffers     map[bufferKey]*zoneBuffer
+	Connections map[string]string // zoneid -> connection
+	Pending     []*indexChunk
+	PendingSize int
+	Dropping    bool
+	FlushCh     chan struct{}
+	Unpruned    map[bufferKey]int64 // file bytes indexed since the file's old rows were last pruned
+}
+
+var globalIndexer = &indexer{
+	Lock:        &sync.Mutex{},
+	Buffers:     make(map[bufferKey]*zoneBuffer),
+	Connections: make(map[string]string),
+	FlushCh:     make(chan struct{}, 1),
+	Unpruned:    make(map[bufferKey]int64),
+}
+
+// serializes db writes with zone deletes (so chunks of a deleted zone are never written after the delete)
+var writeLock = &sync.Mutex{}
+
+// the connection is recorded with every chunk indexed for the zone after this call
+func SetZoneConnection(zoneId string, connection string) {
+	if !IsEnabled() {
+		return
+	}
+	globalIndexer.Lock.Lock()
+	defer globalIndexer.Lock.Unlock()
+	globalIndexer.Connections[zoneId] = connection
+}
+
+// offset is the file offset of data[0]
+// only buffers the text (the db is written by the flusher), so this is safe to call from output loops
+func IndexAppend(zoneId string, fileName string, offset int64, data []byte) {
+	if !IsEnabled() {
+		return
+	}
+	globalIndexer.appendData(zoneId, fileName, offset, data, time.Now().UnixMilli())
+}
+
+func (ix *indexer) appendData(zoneId string, fileName string, offset int64, data []byte, ts int64) {
+	ix.Lock.Lock()
+	defer ix.Lock.Unlock()
+	key := bufferKey{ZoneId: zoneId, FileName: fileName}
+	buf := ix.Buffers[key]
+	if buf == nil {
+		buf = &zoneBuffer{}
+		ix.Buffers[key] = buf
+	}
+	for idx, b := range data {
+		if !buf.Stripper.next(b) {
+			continue
+		}
+		if len(buf.Text) == 0 {
+			buf.Offset = offset + int64(idx)
+			buf.Ts = ts
+		}
+		buf.Text = append(buf.Text, b)
+		if b == '\n' {
+			buf.LineIdx = len(buf.Text)
+			buf.LineOffset = offset + int64(idx) + 1
+			buf.LineTs = ts
+			buf.LineStarts = append(buf.LineStarts, buf.LineOffset)
+		}
+	}
+	buf.LastAppend = ts
+	var queued bool
+	if len(buf.Text) >= maxChunkSize {
+		queued = ix.queueChunk(key, buf, true)
+	} else if len(buf.Text) >= flushTextSize {
+		queued = ix.queueChunk(key, buf, false)
+	}
+	if queued {
+		select {
+		case ix.FlushCh <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// moves the buffered text (or just the complete lines) to the pending list, must hold ix.Lock
+func (ix *indexer) queueChunk(key bufferKey, buf *zoneBuffer, partialLine bool) bool {
+	size := buf.LineIdx
+	if partialLine {
+		size = len(buf.Text)
+	}
+	if size == 0 {
+		return false
+	}
+	chunk := &indexChunk{
+		ZoneId:      key.ZoneId,
+		FileName:    key.FileName,
+		Offset:      buf.Offset,
+		Ts:          buf.Ts,
+		Connection:  ix.Connections[key.ZoneId],
+		Text:        string(buf.Text[:size]),
+		LineOffsets: append([]int64{buf.Offset}, buf.LineStarts...),
+	}
+	chunk.LineOffsets = chunk.LineOffsets[:len(chunkLines(chunk.Text))]
+	buf.Text = append([]byte(nil), buf.Text[size:]...)
+	buf.Offset = buf.LineOffset
+	buf.Ts = buf.LineTs
+	buf.LineIdx = 0
+	buf.LineStarts = nil
+	if strings.TrimSpace(chunk.Text) == "" {
+		return false
+	}
+	if ix.PendingSize+len(chunk.Text) > maxPendingSize {
+		if !ix.Dropping {
+			log.Printf("[termsearch] indexing is falling behind, dropping terminal output from the index\n")
+			ix.Dropping = true
+		}
+		return false
+	}
+	ix.Dropping = false
+	ix.Pending = append(ix.Pending, chunk)
+	ix.PendingSize += len(chunk.Text)
+	return true
+}
+
+// partial lines are queued if their buffer has not been appended to for partialLineIdle (never if negative)
+func (ix *indexer) takePending(partialLineIdle time.Duration) []*indexChunk {
+	ix.Lock.Lock()
+	defer ix.Lock.Unlock()
+	now := time.Now().UnixMilli()
+	for key, buf := range ix.Buffers {
+		idle := partialLineIdle >= 0 && now-buf.LastAppend >= partialLineIdle.Milliseconds()
+		ix.queueChunk(key, buf, idle)
+	}
+	rtn := ix.Pending
+	ix.Pending = nil
+	ix.PendingSize = 0
+	return rtn
+}
+
+// returns the files (with their latest indexed offset) that have had pruneInterval of text indexed since their last prune
+func (ix *indexer) takePrunes(chunks []*indexChunk) map[bufferKey]int64 {
+	ix.Lock.Lock()
+	defer ix.Lock.Unlock()
+	endOffsets := make(map[bufferKey]int64)
+	for _, chunk := range chunks {
+		key := bufferKey{ZoneId: chunk.ZoneId, FileName: chunk.FileName}
+		ix.Unpruned[key] += int64(len(chunk.Text))
+		endOffsets[key] = max(endOffsets[key], chunk.LineOffsets[len(chunk.LineOffsets)-1])
+	}
+	var rtn map[bufferKey]int64
+	for key, endOffset := range endOffsets {
+		if ix.Unpruned[key] < pruneInterval {
+			continue
+		}
+		ix.Unpruned[key] = 0
+		if rtn == nil {
+			rtn = make(map[bufferKey]int64)
+		}
+		rtn[key] = endOffset
+	}
+	return rtn
+}
+
+func (ix *indexer) dropZone(zoneId string) {
+	ix.Lock.Lock()
+	defer ix.Lock.Unlock()
+	for key := range ix.Buffers {
+		if key.ZoneId == zoneId {
+			delete(ix.Buffers, key)
+		}
+	}
+	delete(ix.Connections, zoneId)
+	for key := range ix.Unpruned {
+		if key.ZoneId == zoneId {
+			delete(ix.Unpruned, key)
+		}
+	}
+	var pending []*indexChunk
+	var pendingSize int
+	for _, chunk := range ix.Pending {
+		if chunk.ZoneId != zoneId {
+			pending = append(pending, chunk)
+			pendingSize += len(chunk.Text)
+		}
+	}
+	ix.Pending = pending
+	ix.PendingSize = pendingSize
+}
+
+func flush(ctx context.Context, partialLineIdle time.Duration) {
+	writeLock.Lock()
+	defer writeLock.Unlock()
+	chunks := globalIndexer.takePending(partialLineIdle)
+	if len(chunks) == 0 {
+		return
+	}
+	err := insertChunks(ctx, chunks, globalIndexer.takePrunes(chunks))
+	if err != nil {
+		log.Printf("[termsearch] error indexing terminal output: %v\n", err)
+	}
+}
+
+func runFlusher() {
+	ticker := time.NewTicker(FlushInterval)
+	defer ticker.Stop()
+	for {
+		partialLineIdle := time.Duration(-1)
+		select {
+		case <-globalIndexer.FlushCh:
+		case <-ticker.C:
+			partialLineIdle = FlushInterval
+		}
+		ctx, cancelFn := context.WithTimeout(context.Background(), 10*time.Second)
+		flush(ctx, partialLineIdle)
+		cancelFn()
+	}
+}
+
+// indexes all buffered text (including partial lines), called on shutdown
+func FlushIndex(ctx context.Context) {
+	if !IsEnabled() {
+		return
+	}
+	flush(ctx, 0)
+}
@@ -0,0 +1,311 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// full text search over terminal output
+// term blockfile appends are stripped of escape sequences and indexed (in chunks of whole lines) with sqlite fts5
+package termsearch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/sawka/txwrap"
+	"github.com/wavetermdev/waveterm/pkg/filestore"
+	"github.com/wavetermdev/waveterm/pkg/panichandler"
+	"github.com/wavetermdev/waveterm/pkg/wavebase"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+const TermSearchDBName = "termsearch.db"
+
+const DefaultSearchLimit = 100
+const MaxSearchLimit = 1000
+const MaxContextLines = 20
+
+// rows more than this far (in file bytes) behind a file's latest indexed output are pruned
+// (circular term files and their archives drop old output too, so the index does not grow forever)
+const MaxFileIndexBytes = 64 * 1024 * 1024
+
+// highlight() markers, control chars are never indexed so they cannot appear in the text
+const matchStartMarker = "\x02"
+const matchEndMarker = "\x03"
+
+// fts5 is a compile time option for go-sqlite3 (build tag sqlite_fts5), so the table is created at runtime
+const createTableSql = `CREATE VIRTUAL TABLE IF NOT EXISTS term_search USING fts5(
+	text,
+	zoneid UNINDEXED,
+	filename UNINDEXED,
+	fileoffset UNINDEXED,
+	ts UNINDEXED,
+	connection UNINDEXED,
+	lineoffsets UNINDEXED
+)`
+
+var ErrSearchDisabled = errors.New("terminal search is not available (sqlite was built without fts5)")
+
+type TxWrap = txwrap.TxWrap
+
+var globalDB *sqlx.DB
+var useTestingDb bool // just for testing (forces MakeDB() to return an in-memory db)
+
+// if fts5 is not available, search is disabled (and appends are not indexed) but no error is returned
+func InitTermSearch() error {
+	ctx, cancelFn := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancelFn()
+	db, err := MakeDB(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = db.ExecContext(ctx, createTableSql)
+	if err != nil {
+		db.Close()
+		log.Printf("terminal search disabled: %v\n", err)
+		return nil
+	}
+	globalDB = db
+	filestore.RegisterZoneDeleteHandler(deleteZone)
+	go func() {
+		defer panichandler.PanicHandler("termsearch:runFlusher")
+		runFlusher()
+	}()
+	log.Printf("terminal search initialized\n")
+	return nil
+}
+
+func GetDBName() string {
+	waveHome := wavebase.GetWaveDataDir()
+	return filepath.Join(waveHome, wavebase.WaveDBDir, TermSearchDBName)
+}
+
+func MakeDB(ctx context.Context) (*sqlx.DB, error) {
+	var rtn *sqlx.DB
+	var err error
+	if useTestingDb {
+		rtn, err = sqlx.Open("sqlite3", ":memory:")
+	} else {
+		dbName := GetDBName()
+		log.Printf("[db] opening db %s\n", dbName)
+		rtn, err = sqlx.Open("sqlite3", fmt.Sprintf("file:%s?mode=rwc&_journal_mode=WAL&_busy_timeout=5000", dbName))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("opening db: %w", err)
+	}
+	rtn.DB.SetMaxOpenConns(1)
+	return rtn, nil
+}
+
+func IsEnabled() bool {
+	return globalDB != nil
+}
+
+func WithTx(ctx context.Context, fn func(tx *TxWrap) error) error {
+	return txwrap.WithTx(ctx, globalDB, fn)
+}
+
+func WithTxRtn[RT any](ctx context.Context, fn func(tx *TxWrap) (RT, error)) (RT, error) {
+	return txwrap.WithTxRtn(ctx, globalDB, fn)
+}
+
+// LineOffsets has the file offset of every line in Text (the first is Offset)
+type indexChunk struct {
+	ZoneId      string
+	FileName    string
+	Offset      int64
+	Ts          int64
+	Connection  string
+	Text        string
+	LineOffsets []int64
+}
+
+func chunkLines(text string) []string {
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
+
+// stored as space separated deltas from the chunk offset
+func encodeLineOffsets(offset int64, lineOffsets []int64) string {
+	parts := make([]string, 0, len(lineOffsets))
+	for _, lineOffset := range lineOffsets {
+		parts = append(parts, strconv.FormatInt(lineOffset-offset, 10))
+	}
+	return strings.Join(parts, " ")
+}
+
+func decodeLineOffsets(offset int64, str string) []int64 {
+	var rtn []int64
+	for _, part := range strings.Fields(str) {
+		delta, err := strconv.ParseInt(part, 10, 64)
+		if err != nil {
+			return nil
+		}
+		rtn = append(rtn, offset+delta)
+	}
+	return rtn
+}
+
+// prunes maps files to their latest indexed offset, rows outside [offset-MaxFileIndexBytes, offset] are removed
+// (rows past the latest offset are from before the file was truncated)
+func insertChunks(ctx context.Context, chunks []*indexChunk, prunes map[bufferKey]int64) error {
+	return WithTx(ctx, func(tx *TxWrap) error {
+		query := `INSERT INTO term_search (text, zoneid, filename, fileoffset, ts, connection, lineoffsets) VALUES (?, ?, ?, ?, ?, ?, ?)`
+		for _, chunk := range chunks {
+			tx.Exec(query, chunk.Text, chunk.ZoneId, chunk.FileName, chunk.Offset, chunk.Ts, chunk.Connection, encodeLineOffsets(chunk.Offset, chunk.LineOffsets))
+		}
+		for key, endOffset := range prunes {
+			query = `DELETE FROM term_search WHERE zoneid = ? AND filename = ? AND (fileoffset < ? OR fileoffset > ?)`
+			tx.Exec(query, key.ZoneId, key.FileName, endOffset-MaxFileIndexBytes, endOffset)
+		}
+		return nil
+	})
+}
+
+// called by filestore.DeleteZone
+func deleteZone(ctx context.Context, zoneId string) {
+	writeLock.Lock()
+	defer writeLock.Unlock()
+	globalIndexer.dropZone(zoneId)
+	err := WithTx(ctx, func(tx *TxWrap) error {
+		tx.Exec(`DELETE FROM term_search WHERE zoneid = ?`, zoneId)
+		return nil
+	})
+	if err != nil {
+		log.Printf("[termsearch] error removing zone %s from index: %v\n", zoneId, err)
+	}
+}
+
+// every whitespace separated word must match (words are quoted, so fts5 syntax is not interpreted)
+// a trailing * makes the word a prefix match
+func makeMatchQuery(query string) string {
+	var terms []string
+	for _, word := range strings.Fields(query) {
+		prefix := ""
+		if len(word) > 1 && strings.HasSuffix(word, "*") {
+			word = strings.TrimSuffix(word, "*")
+			prefix = "*"
+		}
+		terms = append(terms, `"`+strings.ReplaceAll(word, `"`, `""`)+`"`+prefix)
+	}
+	return strings.Join(terms, " ")
+}
+
+type searchRow struct {
+	ZoneId      string `db:"zoneid"`
+	FileName    string `db:"filename"`
+	FileOffset  int64  `db:"fileoffset"`
+	Ts          int64  `db:"ts"`
+	Connection  string `db:"connection"`
+	Text        string `db:"text"`
+	LineOffsets string `db:"lineoffsets"`
+}
+
+// zoneIds restricts the search to the given zones (nil searches all zones)
+// returns the most recent matches first
+func Search(ctx context.Context, opts wshrpc.CommandSearchBlockFilesData, zoneIds []string) ([]*wshrpc.BlockFileSearchMatch, error) {
+	if !IsEnabled() {
+		return nil, ErrSearchDisabled
+	}
+	matchQuery := makeMatchQuery(opts.Query)
+	if matchQuery == "" {
+		return nil, fmt.Errorf("empty search query")
+	}
+	if zoneIds != nil && len(zoneIds) == 0 {
+		return nil, nil
+	}
+	limit := opts.Limit
+	if limit <= 0 {
+		limit = DefaultSearchLimit
+	}
+	if limit > MaxSearchLimit {
+		limit = MaxSearchLimit
+	}
+	contextLines := opts.ContextLines
+	if contextLines < 0 {
+		contextLines = 0
+	}
+	if contextLines > MaxContextLines {
+		contextLines = MaxContextLines
+	}
+	flush(ctx, -1)
+	whereParts := []string{`term_search MATCH ?`}
+	args := []any{matchQuery}
+	if zoneIds != nil {
+		whereParts = append(whereParts, `zoneid IN (`+strings.TrimSuffix(strings.Repeat("?,", len(zoneIds)), ",")+`)`)
+		for _, zoneId := range zoneIds {
+			args = append(args, zoneId)
+		}
+	}
+	if opts.Connection != "" {
+		whereParts = append(whereParts, `connection = ?`)
+		args = append(args, opts.Connection)
+	}
+	if opts.Since > 0 {
+		whereParts = append(whereParts, `ts >= ?`)
+		args = append(args, opts.Since)
+	}
+	query := `SELECT zoneid, filename, fileoffset, ts, connection, lineoffsets, highlight(term_search, 0, ?, ?) AS text
+	          FROM term_search WHERE ` + strings.Join(whereParts, " AND ") + ` ORDER BY ts DESC, fileoffset DESC LIMIT ?`
+	args = append([]any{matchStartMarker, matchEndMarker}, args...)
+	args = append(args, limit)
+	rows, err := WithTxRtn(ctx, func(tx *TxWrap) ([]*searchRow, error) {
+		var rtn []*searchRow
+		tx.Select(&rtn, query, args...)
+		return rtn, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error searching terminal output: %w", err)
+	}
+	var rtn []*wshrpc.BlockFileSearchMatch
+	for _, row := range rows {
+		for _, match := range extractMatches(row, contextLines) {
+			if len(rtn) >= limit {
+				return rtn, nil
+			}
+			rtn = append(rtn, match)
+		}
+	}
+	return rtn, nil
+}
+
+func removeMarkers(str string) string {
+	str = strings.ReplaceAll(str, matchStartMarker, "")
+	return strings.ReplaceAll(str, matchEndMarker, "")
+}
+
+// returns a match for every line in the chunk that contains a highlighted term
+func extractMatches(row *searchRow, contextLines int) []*wshrpc.BlockFileSearchMatch {
+	lines := chunkLines(row.Text)
+	lineOffsets := decodeLineOffsets(row.FileOffset, row.LineOffsets)
+	var rtn []*wshrpc.BlockFileSearchMatch
+	for idx, line := range lines {
+		if !strings.Contains(line, matchStartMarker) {
+			continue
+		}
+		offset := row.FileOffset
+		if idx < len(lineOffsets) {
+			offset = lineOffsets[idx]
+		}
+		match := &wshrpc.BlockFileSearchMatch{
+			BlockId:    row.ZoneId,
+			FileName:   row.FileName,
+			Offset:     offset,
+			Ts:         row.Ts,
+			Connection: row.Connection,
+			Line:       removeMarkers(line),
+		}
+		for _, ctxLine := range lines[max(0, idx-contextLines):idx] {
+			match.Before = append(match.Before, removeMarkers(ctxLine))
+		}
+		for _, ctxLine := range lines[idx+1 : min(len(lines), idx+1+contextLines)] {
+			match.After = append(match.After, removeMarkers(ctxLine))
+		}
+		rtn = append(rtn, match)
+	}
+	return rtn
+}
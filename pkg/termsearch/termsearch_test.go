@@ -0,0 +1,150 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package termsearch
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+func TestStripAnsi(t *testing.T) {
+	input := "\x1b[1;32mgreen\x1b[0m text\r\n\x1b]0;title\x07tab\there\x1b(B\x1b]7;file://host/tmp\x1b\\ done\x08\n"
+	expected := "green text\ntab\there done\n"
+	if rtn := StripAnsi([]byte(input)); rtn != expected {
+		t.Errorf("expected %q, got %q", expected, rtn)
+	}
+	// sequences split across appends
+	var st ansiStripper
+	var rtn []byte
+	for _, part := range []string{"a\x1b", "[3", "1mb\x1b]0;ti", "tle\x1b", "\\c"} {
+		rtn = append(rtn, st.strip([]byte(part))...)
+	}
+	if string(rtn) != "abc" {
+		t.Errorf("expected %q, got %q", "abc", string(rtn))
+	}
+}
+
+func makeTestIndexer() *indexer {
+	return &indexer{
+		Lock:        &sync.Mutex{},
+		Buffers:     make(map[bufferKey]*zoneBuffer),
+		Connections: make(map[string]string),
+		FlushCh:     make(chan struct{}, 1),
+		Unpruned:    make(map[bufferKey]int64),
+	}
+}
+
+// the chunking and match extraction do not need fts5
+func TestIndexChunks(t *testing.T) {
+	ix := makeTestIndexer()
+	ix.appendData("zone1", "term", 0, []byte("$ make\r\ncompiling main.go\r\n\x1b[31merror: undefined symbol\x1b[0m\r\n"), 1000)
+	ix.appendData("zone1", "term", 61, []byte("build failed\r\n$ "), 2000)
+	chunks := ix.takePending(-1)
+	if len(chunks) != 1 {
+		t.Fatalf("expected 1 chunk, got %d", len(chunks))
+	}
+	chunk := chunks[0]
+	expectedOffsets := []int64{0, 8, 27, 61}
+	if chunk.Offset != 0 || chunk.Ts != 1000 || !reflect.DeepEqual(chunk.LineOffsets, expectedOffsets) {
+		t.Errorf("unexpected chunk offset:%d ts:%d lines:%v", chunk.Offset, chunk.Ts, chunk.LineOffsets)
+	}
+	if decoded := decodeLineOffsets(100, encodeLineOffsets(100, []int64{100, 108, 127})); !reflect.DeepEqual(decoded, []int64{100, 108, 127}) {
+		t.Errorf("line offsets did not round trip: %v", decoded)
+	}
+	// the partial line is kept until its buffer is idle
+	chunks = ix.takePending(0)
+	if len(chunks) != 1 || chunks[0].Offset != 75 || chunks[0].Text != "$ " || !reflect.DeepEqual(chunks[0].LineOffsets, []int64{75}) {
+		t.Errorf("unexpected partial line chunk %+v", chunks)
+	}
+
+	text := strings.Replace(chunk.Text, "error", matchStartMarker+"error"+matchEndMarker, 1)
+	row := &searchRow{ZoneId: "zone1", FileName: "term", FileOffset: chunk.Offset, Text: text, LineOffsets: encodeLineOffsets(chunk.Offset, chunk.LineOffsets)}
+	matches := extractMatches(row, 1)
+	if len(matches) != 1 || matches[0].Offset != 27 || matches[0].Line != "error: undefined symbol" {
+		t.Errorf("unexpected matches %+v", matches)
+	}
+
+	// rows are pruned once pruneInterval of text has been indexed for a file
+	big := &indexChunk{ZoneId: "zone1", FileName: "term", Offset: 100, Text: strings.Repeat("x", pruneInterval), LineOffsets: []int64{100}}
+	if prunes := ix.takePrunes([]*indexChunk{chunk}); prunes != nil {
+		t.Errorf("expected no prunes, got %v", prunes)
+	}
+	prunes := ix.takePrunes([]*indexChunk{big})
+	if prunes[bufferKey{ZoneId: "zone1", FileName: "term"}] != 100 || ix.Unpruned[bufferKey{ZoneId: "zone1", FileName: "term"}] != 0 {
+		t.Errorf("unexpected prunes %v", prunes)
+	}
+}
+
+func initTestDb(t *testing.T) {
+	useTestingDb = true
+	db, err := MakeDB(context.Background())
+	if err != nil {
+		t.Fatalf("error opening db: %v", err)
+	}
+	_, err = db.Exec(createTableSql)
+	if err != nil {
+		db.Close()
+		t.Skipf("fts5 not available (build with -tags sqlite_fts5): %v", err)
+	}
+	globalDB = db
+	t.Cleanup(func() {
+		globalDB = nil
+		db.Close()
+	})
+}
+
+func TestSearch(t *testing.T) {
+	initTestDb(t)
+	ctx := context.Background()
+	SetZoneConnection("zone1", "user@host")
+	IndexAppend("zone1", "term", 0, []byte("$ make\r\ncompiling main.go\r\n\x1b[31merror: undefined symbol\x1b[0m\r\n"))
+	IndexAppend("zone1", "term", 61, []byte("build failed\r\n$ "))
+	IndexAppend("zone2", "term", 0, []byte("no errors here\nanother error line\n"))
+	matches, err := Search(ctx, wshrpc.CommandSearchBlockFilesData{Query: "error", ContextLines: 1}, nil)
+	if err != nil {
+		t.Fatalf("error searching: %v", err)
+	}
+	if len(matches) != 2 {
+		t.Fatalf("expected 2 matches, got %d", len(matches))
+	}
+	matches, err = Search(ctx, wshrpc.CommandSearchBlockFilesData{Query: "error", ContextLines: 1, Connection: "user@host"}, nil)
+	if err != nil {
+		t.Fatalf("error searching: %v", err)
+	}
+	if len(matches) != 1 {
+		t.Fatalf("expected 1 match, got %d", len(matches))
+	}
+	match := matches[0]
+	if match.BlockId != "zone1" || match.Line != "error: undefined symbol" || match.Offset != 27 {
+		t.Errorf("unexpected match %+v", match)
+	}
+	if len(match.Before) != 1 || match.Before[0] != "compiling main.go" || len(match.After) != 1 || match.After[0] != "build failed" {
+		t.Errorf("unexpected context before:%q after:%q", match.Before, match.After)
+	}
+	matches, _ = Search(ctx, wshrpc.CommandSearchBlockFilesData{Query: "undef*"}, []string{"zone2"})
+	if len(matches) != 0 {
+		t.Errorf("expected no matches in zone2, got %d", len(matches))
+	}
+	// rows far behind the file's latest output are pruned
+	newOffset := int64(MaxFileIndexBytes + 100)
+	newChunk := &indexChunk{ZoneId: "zone2", FileName: "term", Offset: newOffset, Text: "new error\n", LineOffsets: []int64{newOffset}}
+	err = insertChunks(ctx, []*indexChunk{newChunk}, map[bufferKey]int64{{ZoneId: "zone2", FileName: "term"}: newOffset})
+	if err != nil {
+		t.Fatalf("error inserting chunk: %v", err)
+	}
+	matches, _ = Search(ctx, wshrpc.CommandSearchBlockFilesData{Query: "error"}, []string{"zone2"})
+	if len(matches) != 1 || matches[0].Offset != newOffset {
+		t.Errorf("expected old rows to be pruned, got %+v", matches)
+	}
+	deleteZone(ctx, "zone1")
+	matches, _ = Search(ctx, wshrpc.CommandSearchBlockFilesData{Query: "undef*"}, nil)
+	if len(matches) != 0 {
+		t.Errorf("expected no matches after deleting zone1, got %d", len(matches))
+	}
+}
@@ -35,6 +35,7 @@ var ExtraTypes = []any{
 	waveobj.UIContext{},
 	eventbus.WSEventType{},
 	wps.WSFileEventData{},
+	wps.WSQuotaEventData{},
 	waveobj.LayoutActionData{},
 	filestore.WaveFile{},
 	wconfig.FullConfigType{},
@@ -0,0 +1,225 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package packetparser
+
+// binary side frames for newline delimited json streams (the domain socket transport)
+//
+//	#wshbin:1\n                  hello, the sender can read binary frames
+//	#B<len>\n<len raw bytes>     a binary frame
+//	{..."data64":"#bin:0"...}\n  the message that references the frames that were sent before it
+//
+// large "data64" values (base64) are moved out of the message into frames, and put back (as base64) when the
+// message is read.  frames are only written after the peer has sent a hello, so peers that don't know about
+// frames (older wsh versions) keep getting plain base64.  "#" is not in the base64 alphabet, so a reference
+// can never be confused with real data.
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+const BinFrameHello = "#wshbin:1"
+const BinFrameMinSize = 1024 // data64 values smaller than this stay inline
+const BinFrameMaxSize = 64 * 1024 * 1024
+
+const binFramePrefix = "#B"
+const binFrameRefPrefix = "#bin:"
+
+var data64Key = []byte(`"data64":"`)
+
+// returns the position of the next "data64" value (after the opening quote) and its end (the closing quote)
+// only matches real keys (preceded by '{' or ','), which is always the case for json.Marshal output
+func findData64(msg []byte, pos int) (int, int) {
+	for pos < len(msg) {
+		idx := bytes.Index(msg[pos:], data64Key)
+		if idx < 0 {
+			return -1, -1
+		}
+		keyStart := pos + idx
+		valStart := keyStart + len(data64Key)
+		valLen := bytes.IndexByte(msg[valStart:], '"')
+		if valLen < 0 {
+			return -1, -1
+		}
+		if keyStart > 0 && (msg[keyStart-1] == '{' || msg[keyStart-1] == ',') {
+			return valStart, valStart + valLen
+		}
+		pos = valStart
+	}
+	return -1, -1
+}
+
+// moves large data64 values out of msg, returns the original msg if there is nothing to move
+func ExtractBinFrames(msg []byte) ([]byte, [][]byte) {
+	var rtn []byte
+	var frames [][]byte
+	copyPos := 0
+	pos := 0
+	for {
+		valStart, valEnd := findData64(msg, pos)
+		if valStart < 0 {
+			break
+		}
+		pos = valEnd
+		val := msg[valStart:valEnd]
+		if len(val) < BinFrameMinSize {
+			continue
+		}
+		frame := make([]byte, base64.StdEncoding.DecodedLen(len(val)))
+		n, err := base64.StdEncoding.Decode(frame, val)
+		if err != nil {
+			// not valid base64, leave it inline
+			continue
+		}
+		if rtn == nil {
+			rtn = make([]byte, 0, len(msg)-len(val)+16)
+		}
+		rtn = append(rtn, msg[copyPos:valStart]...)
+		rtn = append(rtn, binFrameRefPrefix...)
+		rtn = strconv.AppendInt(rtn, int64(len(frames)), 10)
+		copyPos = valEnd
+		frames = append(frames, frame[:n])
+	}
+	if len(frames) == 0 {
+		return msg, nil
+	}
+	rtn = append(rtn, msg[copyPos:]...)
+	return rtn, frames
+}
+
+// puts the referenced frames back into msg (as base64)
+func InlineBinFrames(msg []byte, frames [][]byte) ([]byte, error) {
+	var rtn []byte
+	copyPos := 0
+	pos := 0
+	for {
+		valStart, valEnd := findData64(msg, pos)
+		if valStart < 0 {
+			break
+		}
+		pos = valEnd
+		val := msg[valStart:valEnd]
+		if !bytes.HasPrefix(val, []byte(binFrameRefPrefix)) {
+			continue
+		}
+		frameIdx, err := strconv.Atoi(string(val[len(binFrameRefPrefix):]))
+		if err != nil || frameIdx < 0 || frameIdx >= len(frames) {
+			return nil, fmt.Errorf("invalid binary frame reference %q", val)
+		}
+		frame := frames[frameIdx]
+		if rtn == nil {
+			rtn = make([]byte, 0, len(msg)+base64.StdEncoding.EncodedLen(len(frame)))
+		}
+		rtn = append(rtn, msg[copyPos:valStart]...)
+		rtn = base64.StdEncoding.AppendEncode(rtn, frame)
+		copyPos = valEnd
+	}
+	if rtn == nil {
+		return msg, nil
+	}
+	rtn = append(rtn, msg[copyPos:]...)
+	return rtn, nil
+}
+
+func WriteBinFrameHello(output io.Writer) error {
+	_, err := output.Write([]byte(BinFrameHello + "\n"))
+	return err
+}
+
+// writes msg as a line, with its large data64 values as binary frames
+func WriteBinFrameMsg(output io.Writer, msg []byte) error {
+	msg, frames := ExtractBinFrames(msg)
+	for _, frame := range frames {
+		header := fmt.Appendf(nil, "%s%d\n", binFramePrefix, len(frame))
+		if _, err := output.Write(header); err != nil {
+			return err
+		}
+		if _, err := output.Write(frame); err != nil {
+			return err
+		}
+	}
+	fullMsg := make([]byte, 0, len(msg)+1)
+	fullMsg = append(fullMsg, msg...)
+	fullMsg = append(fullMsg, '\n')
+	_, err := output.Write(fullMsg)
+	return err
+}
+
+// returns the line without the trailing newline, lines longer than maxLineLength are read and discarded (nil line)
+func readLimitedLine(bufReader *bufio.Reader, maxLineLength int) ([]byte, error) {
+	var line []byte
+	tooLong := false
+	for {
+		part, err := bufReader.ReadSlice('\n')
+		if !tooLong {
+			if len(line)+len(part) > maxLineLength+1 {
+				line = nil
+				tooLong = true
+			} else {
+				line = append(line, part...)
+			}
+		}
+		if errors.Is(err, bufio.ErrBufferFull) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if tooLong {
+			return nil, nil
+		}
+		return line[:len(line)-1], nil
+	}
+}
+
+// reads a newline delimited stream that can contain binary frames (the lines don't need to be json)
+// helloFn is called when the peer sends a hello, msgFn is called for every other (non-empty) line
+func ReadBinFrameStream(input io.Reader, maxLineLength int, helloFn func(), msgFn func([]byte)) error {
+	bufReader := bufio.NewReaderSize(input, 16*1024)
+	var frames [][]byte
+	for {
+		line, err := readLimitedLine(bufReader, maxLineLength)
+		if err != nil {
+			return err
+		}
+		if line == nil {
+			// line was too long, the frames for it are dropped as well
+			frames = nil
+			continue
+		}
+		if len(line) == 0 {
+			continue
+		}
+		if string(line) == BinFrameHello {
+			helloFn()
+			continue
+		}
+		if bytes.HasPrefix(line, []byte(binFramePrefix)) {
+			frameLen, err := strconv.Atoi(string(line[len(binFramePrefix):]))
+			if err != nil || frameLen < 0 || frameLen > BinFrameMaxSize {
+				return fmt.Errorf("invalid binary frame header %q", line)
+			}
+			frame := make([]byte, frameLen)
+			if _, err := io.ReadFull(bufReader, frame); err != nil {
+				return fmt.Errorf("reading binary frame: %w", err)
+			}
+			frames = append(frames, frame)
+			continue
+		}
+		if len(frames) > 0 {
+			line, err = InlineBinFrames(line, frames)
+			frames = nil
+			if err != nil {
+				// drop the message (the stream is still in sync)
+				continue
+			}
+		}
+		msgFn(line)
+	}
+}
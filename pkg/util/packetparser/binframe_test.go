@@ -0,0 +1,65 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package packetparser
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestBinFrameStream(t *testing.T) {
+	bigData := bytes.Repeat([]byte{0, '\n', 0xff, '"', 'x'}, 1000)
+	type testData struct {
+		Info   map[string]string `json:"info"`
+		Data64 string            `json:"data64"`
+	}
+	msgs := [][]byte{
+		[]byte(`{"command":"message","data":{"message":"hello"}}`),
+		[]byte(`{"data64":"aGVsbG8="}`),
+		[]byte(`{"data":{"data64":"#bin:9"}}`), // not a frame reference (no frames were sent)
+	}
+	bigMsg, _ := json.Marshal(map[string]any{"data": testData{Info: map[string]string{"data64": "x"}, Data64: base64.StdEncoding.EncodeToString(bigData)}})
+	msgs = append(msgs, bigMsg)
+
+	var buf bytes.Buffer
+	WriteBinFrameHello(&buf)
+	for _, msg := range msgs {
+		if err := WriteBinFrameMsg(&buf, msg); err != nil {
+			t.Fatalf("error writing: %v", err)
+		}
+	}
+	if buf.Len() > len(bigMsg) {
+		t.Errorf("expected the stream (%d bytes) to be smaller than the base64 message (%d bytes)", buf.Len(), len(bigMsg))
+	}
+	if strings.Count(buf.String(), binFramePrefix) != 1 {
+		t.Errorf("expected one binary frame")
+	}
+	gotHello := false
+	var rtn [][]byte
+	ReadBinFrameStream(&buf, 128*1024, func() { gotHello = true }, func(line []byte) {
+		rtn = append(rtn, line)
+	})
+	if !gotHello {
+		t.Errorf("expected hello")
+	}
+	if len(rtn) != len(msgs) {
+		t.Fatalf("expected %d messages, got %d", len(msgs), len(rtn))
+	}
+	for idx := 0; idx < 3; idx++ {
+		if !bytes.Equal(rtn[idx], msgs[idx]) {
+			t.Errorf("message %d: expected %s, got %s", idx, msgs[idx], rtn[idx])
+		}
+	}
+	var got map[string]testData
+	if err := json.Unmarshal(rtn[3], &got); err != nil {
+		t.Fatalf("error unmarshaling: %v", err)
+	}
+	gotData, _ := base64.StdEncoding.DecodeString(got["data"].Data64)
+	if !bytes.Equal(gotData, bigData) || got["data"].Info["data64"] != "x" {
+		t.Errorf("big message did not round trip")
+	}
+}
@@ -36,6 +36,7 @@ const (
 	ZshIntegrationDir  = "shell/zsh"
 	BashIntegrationDir = "shell/bash"
 	PwshIntegrationDir = "shell/pwsh"
+	FishIntegrationDir = "shell/fish"
 	WaveHomeBinDir     = "bin"
 
 	ZshStartup_Zprofile = `
@@ -51,6 +52,39 @@ export PATH={{.WSHBINDIR}}:$PATH
 if [[ -n ${_comps+x} ]]; then
   source <(wsh completion zsh)
 fi
+
+# Wave shell integration (OSC 133 command markers, OSC 7 cwd)
+_waveterm_si_urlencode() {
+  local LC_ALL=C str="$1" out="" c i
+  for (( i = 0; i < ${#str}; i++ )); do
+    c="${str:$i:1}"
+    case "$c" in
+      [a-zA-Z0-9./~_-]) out+="$c" ;;
+      *) printf -v c '%%%02X' "'$c"; out+="$c" ;;
+    esac
+  done
+  printf '%s' "$out"
+}
+
+typeset -g _waveterm_si_cmdrunning=""
+
+_waveterm_si_precmd() {
+  local _waveterm_si_status=$?
+  if [[ -n $_waveterm_si_cmdrunning ]]; then
+    printf '\033]133;D;%d\007' $_waveterm_si_status
+  fi
+  _waveterm_si_cmdrunning=""
+  printf '\033]7;file://%s%s\007' "$HOST" "$(_waveterm_si_urlencode "$PWD")"
+  printf '\033]133;A\007'
+}
+
+_waveterm_si_preexec() {
+  _waveterm_si_cmdrunning=1
+  printf '\033]133;C;cmdline_url=%s\007' "$(_waveterm_si_urlencode "$1")"
+}
+
+precmd_functions=(_waveterm_si_precmd $precmd_functions)
+preexec_functions+=(_waveterm_si_preexec)
 `
 
 	ZshStartup_Zlogin = `
@@ -82,12 +116,129 @@ if type _init_completion &>/dev/null; then
   source <(wsh completion bash)
 fi
 
+# Wave shell integration (OSC 133 command markers, OSC 7 cwd)
+_waveterm_si_urlencode() {
+    local LC_ALL=C str="$1" out="" c i
+    for (( i = 0; i < ${#str}; i++ )); do
+        c="${str:$i:1}"
+        case "$c" in
+            [a-zA-Z0-9./~_-]) out+="$c" ;;
+            *) printf -v c '%%%02X' "'$c"; out+="$c" ;;
+        esac
+    done
+    printf '%s' "$out"
+}
+
+_waveterm_si_cmdrunning=""
+_waveterm_si_ready=""
+
+_waveterm_si_precmd() {
+    local _waveterm_si_status=$?
+    if [ -n "$_waveterm_si_cmdrunning" ]; then
+        printf '\033]133;D;%d\007' "$_waveterm_si_status"
+    fi
+    _waveterm_si_cmdrunning=""
+    _waveterm_si_ready=""
+    printf '\033]7;file://%s%s\007' "$HOSTNAME" "$(_waveterm_si_urlencode "$PWD")"
+    printf '\033]133;A\007'
+    return $_waveterm_si_status
+}
+
+# runs (from the DEBUG trap) before each simple command, only the first command after the prompt emits a marker
+_waveterm_si_preexec() {
+    if [ -z "$_waveterm_si_ready" ] || [ -n "$COMP_LINE" ] || [ "$BASH_COMMAND" = "_waveterm_si_precmd" ]; then
+        return
+    fi
+    _waveterm_si_ready=""
+    _waveterm_si_cmdrunning=1
+    local _waveterm_si_cmd
+    _waveterm_si_cmd=$(HISTTIMEFORMAT= builtin history 1)
+    if [[ $_waveterm_si_cmd =~ ^[[:space:]]*[0-9]+[*]?[[:space:]]+(.*)$ ]]; then
+        _waveterm_si_cmd="${BASH_REMATCH[1]}"
+    fi
+    printf '\033]133;C;cmdline_url=%s\007' "$(_waveterm_si_urlencode "$_waveterm_si_cmd")"
+}
+
+if [ -z "$(trap -p DEBUG)" ]; then
+    trap '_waveterm_si_preexec' DEBUG
+    PROMPT_COMMAND=$'_waveterm_si_precmd\n'"${PROMPT_COMMAND}"$'\n_waveterm_si_ready=1'
+fi
+
+`
+	FishStartup_Wavefish = `
+# this file is sourced (with -C) after the regular fish config files
+set -gx PATH {{.WSHBINDIR}} $PATH
+if not set -q WAVETERM_WSHBINDIR
+    set -gx WAVETERM_WSHBINDIR {{.WSHBINDIR}}
+end
+if not set -q TERM
+    set -gx TERM {{.TERMTYPE}}
+end
+set -gx TERM_PROGRAM waveterm
+set -gx WAVETERM_VERSION {{.WAVEVERSION}}
+
+if type -q wsh
+    wsh completion fish | source
+end
+
+# Wave shell integration (OSC 133 command markers, OSC 7 cwd)
+function _waveterm_si_postexec --on-event fish_postexec
+    printf '\e]133;D;%d\a' $status
+end
+
+function _waveterm_si_preexec --on-event fish_preexec
+    printf '\e]133;C;cmdline_url=%s\a' (string escape --style=url -- "$argv")
+end
+
+function _waveterm_si_prompt --on-event fish_prompt
+    printf '\e]7;file://%s%s\a' $hostname (string escape --style=url -- $PWD)
+    printf '\e]133;A\a'
+end
 `
+
 	PwshStartup_wavepwsh = `
 # no need to source regular profiles since we cannot
 # overwrite those with powershell. Instead we will source
 # this file with -NoExit
 $env:PATH = "{{.WSHBINDIR}}" + "{{.PATHSEP}}" + $env:PATH
+
+# Wave shell integration (OSC 133 command markers, OSC 7 cwd)
+$Global:_WaveOrigPrompt = $function:prompt
+$Global:_WaveCmdRunning = $false
+function Global:prompt {
+    $waveSuccess = $?
+    $waveExitCode = $global:LASTEXITCODE
+    $waveOutput = ""
+    if ($Global:_WaveCmdRunning) {
+        if ($waveSuccess) {
+            $waveStatus = 0
+        } elseif ($waveExitCode) {
+            $waveStatus = $waveExitCode
+        } else {
+            $waveStatus = 1
+        }
+        $waveOutput += "$([char]27)]133;D;$waveStatus$([char]7)"
+    }
+    $Global:_WaveCmdRunning = $false
+    if ($PWD.Provider.Name -eq "FileSystem") {
+        $waveOutput += "$([char]27)]7;$(([System.Uri]$PWD.ProviderPath).AbsoluteUri)$([char]7)"
+    }
+    $waveOutput += "$([char]27)]133;A$([char]7)"
+    $global:LASTEXITCODE = $waveExitCode
+    $waveOutput + (& $Global:_WaveOrigPrompt)
+}
+if (Get-Module -Name PSReadLine) {
+    Set-PSReadLineKeyHandler -Chord Enter -ScriptBlock {
+        $waveLine = $null
+        $waveCursor = $null
+        [Microsoft.PowerShell.PSConsoleReadLine]::GetBufferState([ref]$waveLine, [ref]$waveCursor)
+        [Microsoft.PowerShell.PSConsoleReadLine]::AcceptLine()
+        if ($waveLine.Trim().Length -gt 0) {
+            $Global:_WaveCmdRunning = $true
+            [Console]::Write("$([char]27)]133;C;cmdline_url=$([uri]::EscapeDataString($waveLine))$([char]7)")
+        }
+    }
+}
 `
 )
 
@@ -209,6 +360,10 @@ func GetWavePowershellEnv() string {
 	return filepath.Join(wavebase.GetWaveDataDir(), PwshIntegrationDir, "wavepwsh.ps1")
 }
 
+func GetFishInitFile() string {
+	return filepath.Join(wavebase.GetWaveDataDir(), FishIntegrationDir, "wave.fish")
+}
+
 func GetZshZDotDir() string {
 	return filepath.Join(wavebase.GetWaveDataDir(), ZshIntegrationDir)
 }
@@ -248,6 +403,11 @@ func InitRcFiles(waveHome string, wshBinDir string) error {
 	if err != nil {
 		return err
 	}
+	fishDir := filepath.Join(waveHome, FishIntegrationDir)
+	err = wavebase.CacheEnsureDir(fishDir, FishIntegrationDir, 0755, FishIntegrationDir)
+	if err != nil {
+		return err
+	}
 
 	// write files to directory
 	zprofilePath := filepath.Join(zshDir, ".zprofile")
@@ -273,6 +433,15 @@ func InitRcFiles(waveHome string, wshBinDir string) error {
 	if err != nil {
 		return fmt.Errorf("error writing bash-integration .bashrc: %v", err)
 	}
+	fishVars := map[string]string{
+		"WSHBINDIR":   fmt.Sprintf(`"%s"`, wshBinDir),
+		"TERMTYPE":    DefaultTermType,
+		"WAVEVERSION": wavebase.WaveVersion,
+	}
+	err = utilfn.WriteTemplateToFile(filepath.Join(fishDir, "wave.fish"), FishStartup_Wavefish, fishVars)
+	if err != nil {
+		return fmt.Errorf("error writing fish-integration wave.fish: %v", err)
+	}
 	var pathSep string
 	if runtime.GOOS == "windows" {
 		pathSep = ";"
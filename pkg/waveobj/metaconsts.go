@@ -50,9 +50,13 @@ const (
 	MetaKey_CmdEnv                           = "cmd:env"
 	MetaKey_CmdCwd                           = "cmd:cwd"
 	MetaKey_CmdNoWsh                         = "cmd:nowsh"
+	MetaKey_CmdWshScope                      = "cmd:wshscope"
 	MetaKey_CmdArgs                          = "cmd:args"
 	MetaKey_CmdShell                         = "cmd:shell"
 
+	MetaKey_ShellClear                       = "shell:*"
+	MetaKey_ShellCwd                         = "shell:cwd"
+
 	MetaKey_AiClear                          = "ai:*"
 	MetaKey_AiPresetKey                      = "ai:preset"
 	MetaKey_AiApiType                        = "ai:apitype"
@@ -94,6 +98,8 @@ const (
 	MetaKey_TermVDomSubBlockId               = "term:vdomblockid"
 	MetaKey_TermVDomToolbarBlockId           = "term:vdomtoolbarblockid"
 	MetaKey_TermTransparency                 = "term:transparency"
+	MetaKey_TermArchive                      = "term:archive"
+	MetaKey_TermArchiveMaxBytes              = "term:archivemaxbytes"
 
 	MetaKey_WebZoom                          = "web:zoom"
 
@@ -49,8 +49,13 @@ type MetaTSType struct {
 	CmdEnv              map[string]string `json:"cmd:env,omitempty"`
 	CmdCwd              string            `json:"cmd:cwd,omitempty"`
 	CmdNoWsh            bool              `json:"cmd:nowsh,omitempty"`
-	CmdArgs             []string          `json:"cmd:args,omitempty"`  // args for cmd (only if cmd:shell is false)
-	CmdShell            bool              `json:"cmd:shell,omitempty"` // shell expansion for cmd+args (defaults to true)
+	CmdWshScope         string            `json:"cmd:wshscope,omitempty"` // limits what wsh can do in the block (see wshrpc.ParseWshScope)
+	CmdArgs             []string          `json:"cmd:args,omitempty"`     // args for cmd (only if cmd:shell is false)
+	CmdShell            bool              `json:"cmd:shell,omitempty"`    // shell expansion for cmd+args (defaults to true)
+
+	// runtime state for shell blocks (set by the backend)
+	ShellClear bool   `json:"shell:*,omitempty"`
+	ShellCwd   string `json:"shell:cwd,omitempty"` // current cwd reported by the shell (OSC 7), overrides cmd:cwd on restart
 
 	// AI options match settings
 	AiClear      bool    `json:"ai:*,omitempty"`
@@ -94,7 +99,9 @@ type MetaTSType struct {
 	TermScrollback         *int     `json:"term:scrollback,omitempty"`
 	TermVDomSubBlockId     string   `json:"term:vdomblockid,omitempty"`
 	TermVDomToolbarBlockId string   `json:"term:vdomtoolbarblockid,omitempty"`
-	TermTransparency       *float64 `json:"term:transparency,omitempty"` // default 0.5
+	TermTransparency       *float64 `json:"term:transparency,omitempty"`    // default 0.5
+	TermArchive            *bool    `json:"term:archive,omitempty"`         // matches settings
+	TermArchiveMaxBytes    *int64   `json:"term:archivemaxbytes,omitempty"` // matches settings
 
 	WebZoom float64 `json:"web:zoom,omitempty"`
 
@@ -19,10 +19,11 @@ var instance *Watcher
 var once sync.Once
 
 type Watcher struct {
-	initialized bool
-	watcher     *fsnotify.Watcher
-	mutex       sync.Mutex
-	fullConfig  FullConfigType
+	initialized    bool
+	watcher        *fsnotify.Watcher
+	mutex          sync.Mutex
+	fullConfig     FullConfigType
+	updateHandlers []func(FullConfigType)
 }
 
 type WatcherUpdate struct {
@@ -141,8 +142,19 @@ func isValidSubSettingsFileName(fileName string) bool {
 	return validFileRe.MatchString(baseName)
 }
 
+// registers a handler that is called with the new config whenever the config files change
+// handlers run with the watcher lock held, so they must not call GetFullConfig
+func (w *Watcher) RegisterUpdateHandler(handler func(FullConfigType)) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.updateHandlers = append(w.updateHandlers, handler)
+}
+
 func (w *Watcher) handleSettingsFileEvent(_ fsnotify.Event, _ string) {
 	fullConfig := ReadFullConfig()
 	w.fullConfig = fullConfig
 	w.broadcast(WatcherUpdate{FullConfig: w.fullConfig})
+	for _, handler := range w.updateHandlers {
+		handler(fullConfig)
+	}
 }
@@ -34,6 +34,9 @@ const (
 	ConfigKey_TermScrollback                 = "term:scrollback"
 	ConfigKey_TermCopyOnSelect               = "term:copyonselect"
 	ConfigKey_TermTransparency               = "term:transparency"
+	ConfigKey_TermArchive                    = "term:archive"
+	ConfigKey_TermArchiveMaxBytes            = "term:archivemaxbytes"
+	ConfigKey_TermArchiveTotalMaxBytes       = "term:archivetotalmaxbytes"
 
 	ConfigKey_EditorMinimapEnabled           = "editor:minimapenabled"
 	ConfigKey_EditorStickyScrollEnabled      = "editor:stickyscrollenabled"
@@ -88,5 +91,15 @@ const (
 	ConfigKey_ConnClear                      = "conn:*"
 	ConfigKey_ConnAskBeforeWshInstall        = "conn:askbeforewshinstall"
 	ConfigKey_ConnWshEnabled                 = "conn:wshenabled"
+	ConfigKey_ConnAutoReconnect              = "conn:autoreconnect"
+
+	ConfigKey_FileStoreClear                 = "filestore:*"
+	ConfigKey_FileStoreBackend               = "filestore:backend"
+	ConfigKey_FileStoreDir                   = "filestore:dir"
+	ConfigKey_FileStoreZoneMaxBytes          = "filestore:zonemaxbytes"
+	ConfigKey_FileStoreTotalMaxBytes         = "filestore:totalmaxbytes"
+
+	ConfigKey_DebugClear                     = "debug:*"
+	ConfigKey_DebugRpcTrace                  = "debug:rpctrace"
 )
 
@@ -51,16 +51,19 @@ type SettingsType struct {
 	AiFontSize      float64 `json:"ai:fontsize,omitempty"`
 	AiFixedFontSize float64 `json:"ai:fixedfontsize,omitempty"`
 
-	TermClear          bool     `json:"term:*,omitempty"`
-	TermFontSize       float64  `json:"term:fontsize,omitempty"`
-	TermFontFamily     string   `json:"term:fontfamily,omitempty"`
-	TermTheme          string   `json:"term:theme,omitempty"`
-	TermDisableWebGl   bool     `json:"term:disablewebgl,omitempty"`
-	TermLocalShellPath string   `json:"term:localshellpath,omitempty"`
-	TermLocalShellOpts []string `json:"term:localshellopts,omitempty"`
-	TermScrollback     *int64   `json:"term:scrollback,omitempty"`
-	TermCopyOnSelect   *bool    `json:"term:copyonselect,omitempty"`
-	TermTransparency   *float64 `json:"term:transparency,omitempty"`
+	TermClear                bool     `json:"term:*,omitempty"`
+	TermFontSize             float64  `json:"term:fontsize,omitempty"`
+	TermFontFamily           string   `json:"term:fontfamily,omitempty"`
+	TermTheme                string   `json:"term:theme,omitempty"`
+	TermDisableWebGl         bool     `json:"term:disablewebgl,omitempty"`
+	TermLocalShellPath       string   `json:"term:localshellpath,omitempty"`
+	TermLocalShellOpts       []string `json:"term:localshellopts,omitempty"`
+	TermScrollback           *int64   `json:"term:scrollback,omitempty"`
+	TermCopyOnSelect         *bool    `json:"term:copyonselect,omitempty"`
+	TermTransparency         *float64 `json:"term:transparency,omitempty"`
+	TermArchive              bool     `json:"term:archive,omitempty"`
+	TermArchiveMaxBytes      int64    `json:"term:archivemaxbytes,omitempty"`
+	TermArchiveTotalMaxBytes int64    `json:"term:archivetotalmaxbytes,omitempty"`
 
 	EditorMinimapEnabled      bool    `json:"editor:minimapenabled,omitempty"`
 	EditorStickyScrollEnabled bool    `json:"editor:stickyscrollenabled,omitempty"`
@@ -115,6 +118,16 @@ type SettingsType struct {
 	ConnClear               bool `json:"conn:*,omitempty"`
 	ConnAskBeforeWshInstall bool `json:"conn:askbeforewshinstall,omitempty"`
 	ConnWshEnabled          bool `json:"conn:wshenabled,omitempty"`
+	ConnAutoReconnect       bool `json:"conn:autoreconnect,omitempty"`
+
+	FileStoreClear         bool   `json:"filestore:*,omitempty"`
+	FileStoreBackend       string `json:"filestore:backend,omitempty"`
+	FileStoreDir           string `json:"filestore:dir,omitempty"`
+	FileStoreZoneMaxBytes  int64  `json:"filestore:zonemaxbytes,omitempty"`
+	FileStoreTotalMaxBytes int64  `json:"filestore:totalmaxbytes,omitempty"`
+
+	DebugClear    bool `json:"debug:*,omitempty"`
+	DebugRpcTrace bool `json:"debug:rpctrace,omitempty"`
 }
 
 type ConfigError struct {
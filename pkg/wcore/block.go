@@ -18,6 +18,8 @@ import (
 	"github.com/wavetermdev/waveterm/pkg/waveobj"
 	"github.com/wavetermdev/waveterm/pkg/wps"
 	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc/wshclient"
+	"github.com/wavetermdev/waveterm/pkg/wshutil"
 	"github.com/wavetermdev/waveterm/pkg/wstore"
 )
 
@@ -220,3 +222,53 @@ func sendBlockCloseEvent(blockId string) {
 	}
 	wps.Broker.Publish(waveEvent)
 }
+
+// switches the block's workspace to its tab, focuses the block in the layout, and brings its window to the front
+// sub blocks focus their top level block
+func FocusBlock(ctx context.Context, blockId string) error {
+	for iterNum := 0; ; iterNum++ {
+		if iterNum > 5 {
+			return fmt.Errorf("too many iterations looking for top level block")
+		}
+		block, err := wstore.DBMustGet[*waveobj.Block](ctx, blockId)
+		if err != nil {
+			return fmt.Errorf("error getting block: %w", err)
+		}
+		parentORef := waveobj.ParseORefNoErr(block.ParentORef)
+		if parentORef == nil || parentORef.OType != waveobj.OType_Block {
+			break
+		}
+		blockId = parentORef.OID
+	}
+	tabId, err := wstore.DBFindTabForBlockId(ctx, blockId)
+	if err != nil {
+		return fmt.Errorf("error finding tab for block %s: %w", blockId, err)
+	}
+	workspaceId, err := wstore.DBFindWorkspaceForTabId(ctx, tabId)
+	if err != nil {
+		return fmt.Errorf("error finding workspace for tab %s: %w", tabId, err)
+	}
+	if workspaceId == "" {
+		return fmt.Errorf("workspace not found for tab %s", tabId)
+	}
+	err = QueueLayoutActionForTab(ctx, tabId, waveobj.LayoutActionData{
+		ActionType: LayoutActionDataType_Focus,
+		BlockId:    blockId,
+		Focused:    true,
+	})
+	if err != nil {
+		return fmt.Errorf("error queuing layout action: %w", err)
+	}
+	err = SetActiveTab(ctx, workspaceId, tabId)
+	if err != nil {
+		return err
+	}
+	SendActiveTabUpdate(ctx, workspaceId, tabId)
+	windowId, err := wstore.DBFindWindowForWorkspaceId(ctx, workspaceId)
+	if err != nil || windowId == "" {
+		// workspace is not open in a window
+		return nil
+	}
+	client := wshclient.GetBareRpcClient()
+	return wshclient.FocusWindowCommand(client, windowId, &wshrpc.RpcOpts{Route: wshutil.ElectronRoute})
+}
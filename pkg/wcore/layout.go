@@ -18,6 +18,7 @@ const (
 	LayoutActionDataType_InsertAtIndex = "insertatindex"
 	LayoutActionDataType_Remove        = "delete"
 	LayoutActionDataType_ClearTree     = "clear"
+	LayoutActionDataType_Focus         = "focus"
 )
 
 type PortableLayout []struct {
@@ -0,0 +1,163 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wcore
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/wavetermdev/waveterm/pkg/filestore"
+	"github.com/wavetermdev/waveterm/pkg/waveobj"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"github.com/wavetermdev/waveterm/pkg/wstore"
+)
+
+// zones with files written more recently than this are never collected (their object may still be in the middle of being created)
+const OrphanZoneGracePeriod = time.Minute
+
+var lastGCLock = &sync.Mutex{}
+var lastGC *wshrpc.StorageGCResult
+
+// filestore zones are keyed by the oid of the object that owns them (usually a block)
+// returns oid -> otype for every object (and the client's temp zone)
+func getZoneOwners(ctx context.Context) (map[string]string, error) {
+	owners := make(map[string]string)
+	for otype := range waveobj.ValidOTypes {
+		if otype == waveobj.OType_Temp {
+			continue
+		}
+		oids, err := wstore.DBGetAllOIDsByType(ctx, otype)
+		if err != nil {
+			return nil, fmt.Errorf("error getting %s ids: %w", otype, err)
+		}
+		for _, oid := range oids {
+			owners[oid] = otype
+		}
+	}
+	client, err := wstore.DBGetSingleton[*waveobj.Client](ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error getting client: %w", err)
+	}
+	if client.TempOID != "" {
+		owners[client.TempOID] = waveobj.OType_Temp
+	}
+	return owners, nil
+}
+
+// returns the zone's usage (files sorted by name) and the most recent file modts
+func getZoneUsage(ctx context.Context, zoneId string) (*wshrpc.StorageZoneUsage, int64, error) {
+	files, err := filestore.WFS.ListFiles(ctx, zoneId)
+	if err != nil {
+		return nil, 0, err
+	}
+	usage := &wshrpc.StorageZoneUsage{ZoneId: zoneId, Files: []wshrpc.StorageFileUsage{}}
+	var lastModTs int64
+	for _, file := range files {
+		diskSize, err := filestore.WFS.DiskSize(ctx, zoneId, file.Name)
+		if err != nil {
+			// deleted concurrently
+			continue
+		}
+		usage.Files = append(usage.Files, wshrpc.StorageFileUsage{Name: file.Name, Size: file.Size, DiskSize: diskSize})
+		usage.Size += file.Size
+		usage.DiskSize += diskSize
+		lastModTs = max(lastModTs, file.ModTs, file.CreatedTs)
+	}
+	sort.Slice(usage.Files, func(i, j int) bool {
+		return usage.Files[i].Name < usage.Files[j].Name
+	})
+	return usage, lastModTs, nil
+}
+
+// deletes zones that are not owned by any object (e.g. blocks whose cleanup failed) and then vacuums the filestore db
+func CollectOrphanZones(ctx context.Context) (*wshrpc.StorageGCResult, error) {
+	owners, err := getZoneOwners(ctx)
+	if err != nil {
+		return nil, err
+	}
+	zoneIds, err := filestore.WFS.GetAllZoneIds(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error getting zones: %w", err)
+	}
+	result := &wshrpc.StorageGCResult{Ts: time.Now().UnixMilli(), NumZones: len(zoneIds)}
+	graceTs := time.Now().Add(-OrphanZoneGracePeriod).UnixMilli()
+	for _, zoneId := range zoneIds {
+		if owners[zoneId] != "" {
+			continue
+		}
+		usage, lastModTs, err := getZoneUsage(ctx, zoneId)
+		if err != nil {
+			return nil, fmt.Errorf("error getting files for zone %s: %w", zoneId, err)
+		}
+		if lastModTs > graceTs {
+			continue
+		}
+		err = filestore.WFS.DeleteZone(ctx, zoneId)
+		if err != nil {
+			return nil, fmt.Errorf("error deleting zone %s: %w", zoneId, err)
+		}
+		result.NumOrphans++
+		result.NumFiles += len(usage.Files)
+		result.ReclaimedBytes += usage.DiskSize
+	}
+	result.VacuumBytes, err = filestore.Vacuum(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if result.NumOrphans > 0 {
+		log.Printf("[storage] deleted %d orphan zones (%d files, %d bytes)\n", result.NumOrphans, result.NumFiles, result.ReclaimedBytes)
+	}
+	lastGCLock.Lock()
+	lastGC = result
+	lastGCLock.Unlock()
+	return result, nil
+}
+
+// zones are sorted by disk size (largest first)
+func GetStorageReport(ctx context.Context) (*wshrpc.StorageReportData, error) {
+	owners, err := getZoneOwners(ctx)
+	if err != nil {
+		return nil, err
+	}
+	zoneIds, err := filestore.WFS.GetAllZoneIds(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error getting zones: %w", err)
+	}
+	dbStats, err := filestore.GetDBStats(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error getting db stats: %w", err)
+	}
+	report := &wshrpc.StorageReportData{
+		Backend:     filestore.GetBackend().Type(),
+		DBFileSize:  dbStats.FileSize,
+		DBFreeBytes: dbStats.FreeBytes,
+		Zones:       []wshrpc.StorageZoneUsage{},
+	}
+	for _, zoneId := range zoneIds {
+		usage, _, err := getZoneUsage(ctx, zoneId)
+		if err != nil {
+			return nil, fmt.Errorf("error getting files for zone %s: %w", zoneId, err)
+		}
+		usage.OType = owners[zoneId]
+		usage.Orphan = usage.OType == ""
+		if usage.Orphan {
+			report.NumOrphans++
+			report.OrphanDiskSize += usage.DiskSize
+		}
+		report.Size += usage.Size
+		report.DiskSize += usage.DiskSize
+		report.Zones = append(report.Zones, *usage)
+	}
+	sort.Slice(report.Zones, func(i, j int) bool {
+		return report.Zones[i].DiskSize > report.Zones[j].DiskSize
+	})
+	lastGCLock.Lock()
+	report.LastGC = lastGC
+	lastGCLock.Unlock()
+	return report, nil
+}
@@ -18,6 +18,7 @@ import (
 	"github.com/wavetermdev/waveterm/pkg/authkey"
 	"github.com/wavetermdev/waveterm/pkg/eventbus"
 	"github.com/wavetermdev/waveterm/pkg/panichandler"
+	"github.com/wavetermdev/waveterm/pkg/util/packetparser"
 	"github.com/wavetermdev/waveterm/pkg/web/webcmd"
 	"github.com/wavetermdev/waveterm/pkg/wshrpc"
 	"github.com/wavetermdev/waveterm/pkg/wshutil"
@@ -30,6 +31,13 @@ const wsInitialPingTime = 1 * time.Second
 
 const DefaultCommandTimeout = 2 * time.Second
 
+// an rpc message with binary side frames (see packetparser.ExtractBinFrames)
+// the frames are written as binary websocket messages right before the message (which references them)
+type wsBinFrameMsg struct {
+	Frames [][]byte
+	Msg    any
+}
+
 var GlobalLock = &sync.Mutex{}
 var RouteToConnMap = map[string]string{} // routeid => connid
 
@@ -207,6 +215,20 @@ func WriteLoop(conn *websocket.Conn, outputCh chan any, closeCh chan any, routeI
 		case msg := <-outputCh:
 			var barr []byte
 			var err error
+			if binMsg, ok := msg.(wsBinFrameMsg); ok {
+				for _, frame := range binMsg.Frames {
+					err = conn.WriteMessage(websocket.BinaryMessage, frame)
+					if err != nil {
+						break
+					}
+				}
+				if err != nil {
+					conn.Close()
+					log.Printf("[websocket] WritePump error (%s): %v\n", routeId, err)
+					return
+				}
+				msg = binMsg.Msg
+			}
 			if _, ok := msg.([]byte); ok {
 				barr = msg.([]byte)
 			} else {
@@ -271,6 +293,8 @@ func HandleWsInternal(w http.ResponseWriter, r *http.Request) error {
 	if tabId == "" {
 		return fmt.Errorf("tabid is required")
 	}
+	// set by clients that can read binary frames (otherwise data stays base64)
+	binFrames := r.URL.Query().Get("binframes") == "1"
 	err := authkey.ValidateIncomingRequest(r)
 	if err != nil {
 		w.WriteHeader(http.StatusUnauthorized)
@@ -306,10 +330,19 @@ func HandleWsInternal(w http.ResponseWriter, r *http.Request) error {
 		// no waitgroup add here
 		// move values from rpcOutputCh to outputCh
 		for msgBytes := range wproxy.ToRemoteCh {
+			var frames [][]byte
+			if binFrames {
+				msgBytes, frames = packetparser.ExtractBinFrames(msgBytes)
+			}
 			rpcWSMsg := map[string]any{
 				"eventtype": "rpc", // TODO don't hard code this (but def is in eventbus)
 				"data":      json.RawMessage(msgBytes),
 			}
+			if len(frames) > 0 {
+				// sent as one item so no other message can get in between the frames and the message
+				outputCh <- wsBinFrameMsg{Frames: frames, Msg: rpcWSMsg}
+				continue
+			}
 			outputCh <- rpcWSMsg
 		}
 	}()
@@ -5,8 +5,11 @@
 package wps
 
 import (
+	"log"
+	"slices"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/wavetermdev/waveterm/pkg/util/utilfn"
 	"github.com/wavetermdev/waveterm/pkg/waveobj"
@@ -22,10 +25,41 @@ type Client interface {
 	SendEvent(routeId string, event WaveEvent)
 }
 
+// durable storage for persisted events (so history survives restarts)
+// only event types the store marks as durable (and events published with Durable) are stored
+// StoreEvent must not block, ReadEvents returns the most recent events (oldest first) with seq < beforeSeq
+// and startTs <= ts < endTs (0 means unbounded)
+type EventStore interface {
+	IsDurable(eventType string) bool
+	StoreEvent(event *WaveEvent)
+	ReadEvents(eventType string, scope string, startTs int64, endTs int64, beforeSeq int64, maxItems int) ([]*WaveEvent, error)
+}
+
 type BrokerSubscription struct {
 	AllSubs   []string            // routeids subscribed to "all" events
 	ScopeSubs map[string][]string // routeids subscribed to specific scopes
 	StarSubs  map[string][]string // routeids subscribed to star scope (scopes with "*" or "**" in them)
+	Opts      map[string]*subOpts // routeid => filter and rate limit (only for subscriptions that set them)
+}
+
+type subOpts struct {
+	Filter      *EventFilter
+	MinInterval time.Duration
+	LastSent    time.Time
+}
+
+// returns true if the event should be sent (updates LastSent), filterData is only computed when needed
+func (so *subOpts) allow(getData func() any, now time.Time) bool {
+	if so.Filter != nil && !so.Filter.Match(getData()) {
+		return false
+	}
+	if so.MinInterval > 0 {
+		if now.Sub(so.LastSent) < so.MinInterval {
+			return false
+		}
+		so.LastSent = now
+	}
+	return true
 }
 
 type persistKey struct {
@@ -41,8 +75,10 @@ type persistEventWrap struct {
 type BrokerType struct {
 	Lock       *sync.Mutex
 	Client     Client
+	Store      EventStore
 	SubMap     map[string]*BrokerSubscription
 	PersistMap map[persistKey]*persistEventWrap
+	Seq        int64 // last seq assigned to a persisted event
 }
 
 var Broker = &BrokerType{
@@ -73,11 +109,39 @@ func (b *BrokerType) GetClient() Client {
 	return b.Client
 }
 
+// lastSeq is the highest seq in the store, events already in memory are renumbered after it (keeping their order)
+func (b *BrokerType) SetEventStore(store EventStore, lastSeq int64) {
+	b.Lock.Lock()
+	defer b.Lock.Unlock()
+	b.Store = store
+	renumbered := make(map[*WaveEvent]bool)
+	for _, pe := range b.PersistMap {
+		for _, event := range pe.Events {
+			if !renumbered[event] {
+				event.Seq += lastSeq
+				renumbered[event] = true
+			}
+		}
+	}
+	b.Seq += lastSeq
+}
+
 // if already subscribed, this will *resubscribe* with the new subscription (remove the old one, and replace with this one)
-func (b *BrokerType) Subscribe(subRouteId string, sub SubscriptionRequest) {
+func (b *BrokerType) Subscribe(subRouteId string, sub SubscriptionRequest) error {
 	// log.Printf("[wps] sub %s %s\n", subRouteId, sub.Event)
 	if sub.Event == "" {
-		return
+		return nil
+	}
+	var opts *subOpts
+	if sub.Filter != "" || sub.MinIntervalMs > 0 {
+		opts = &subOpts{MinInterval: time.Duration(sub.MinIntervalMs) * time.Millisecond}
+		if sub.Filter != "" {
+			filter, err := ParseEventFilter(sub.Filter)
+			if err != nil {
+				return err
+			}
+			opts.Filter = filter
+		}
 	}
 	b.Lock.Lock()
 	defer b.Lock.Unlock()
@@ -88,12 +152,16 @@ func (b *BrokerType) Subscribe(subRouteId string, sub SubscriptionRequest) {
 			AllSubs:   []string{},
 			ScopeSubs: make(map[string][]string),
 			StarSubs:  make(map[string][]string),
+			Opts:      make(map[string]*subOpts),
 		}
 		b.SubMap[sub.Event] = bs
 	}
+	if opts != nil {
+		bs.Opts[subRouteId] = opts
+	}
 	if sub.AllScopes {
 		bs.AllSubs = utilfn.AddElemToSliceUniq(bs.AllSubs, subRouteId)
-		return
+		return nil
 	}
 	for _, scope := range sub.Scopes {
 		starMatch := scopeHasStarMatch(scope)
@@ -103,6 +171,7 @@ func (b *BrokerType) Subscribe(subRouteId string, sub SubscriptionRequest) {
 			addStrToScopeMap(bs.ScopeSubs, scope, subRouteId)
 		}
 	}
+	return nil
 }
 
 func (bs *BrokerSubscription) IsEmpty() bool {
@@ -149,6 +218,7 @@ func (b *BrokerType) unsubscribe_nolock(subRouteId string, eventName string) {
 		return
 	}
 	bs.AllSubs = utilfn.RemoveElemFromSlice(bs.AllSubs, subRouteId)
+	delete(bs.Opts, subRouteId)
 	for scope := range bs.ScopeSubs {
 		removeStrFromScopeMap(bs.ScopeSubs, scope, subRouteId)
 	}
@@ -165,6 +235,7 @@ func (b *BrokerType) UnsubscribeAll(subRouteId string) {
 	defer b.Lock.Unlock()
 	for eventType, bs := range b.SubMap {
 		bs.AllSubs = utilfn.RemoveElemFromSlice(bs.AllSubs, subRouteId)
+		delete(bs.Opts, subRouteId)
 		removeStrFromScopeMapAll(bs.StarSubs, subRouteId)
 		removeStrFromScopeMapAll(bs.ScopeSubs, subRouteId)
 		if bs.IsEmpty() {
@@ -175,23 +246,44 @@ func (b *BrokerType) UnsubscribeAll(subRouteId string) {
 
 // does not take wildcards, use "" for all
 func (b *BrokerType) ReadEventHistory(eventType string, scope string, maxItems int) []*WaveEvent {
+	return b.ReadEventHistoryRange(eventType, scope, 0, 0, maxItems)
+}
+
+// returns the most recent maxItems events (oldest first) with startTs <= ts < endTs (0 means unbounded)
+// events are served from memory, older events are read from the event store (if set and the event type is durable)
+// memory and disk are split by seq (event timestamps can repeat or be set by the publisher, seqs are unique and ordered)
+func (b *BrokerType) ReadEventHistoryRange(eventType string, scope string, startTs int64, endTs int64, maxItems int) []*WaveEvent {
 	if maxItems <= 0 {
 		return nil
 	}
+	inRange := func(event *WaveEvent) bool {
+		return event.Ts >= startTs && (endTs <= 0 || event.Ts < endTs)
+	}
 	b.Lock.Lock()
-	defer b.Lock.Unlock()
-	key := persistKey{Event: eventType, Scope: scope}
-	pe := b.PersistMap[key]
-	if pe == nil || len(pe.Events) == 0 {
-		return nil
+	store := b.Store
+	var memEvents []*WaveEvent
+	var oldestMemSeq int64
+	pe := b.PersistMap[persistKey{Event: eventType, Scope: scope}]
+	if pe != nil && len(pe.Events) > 0 {
+		oldestMemSeq = pe.Events[0].Seq
+		for idx := len(pe.Events) - 1; idx >= 0 && len(memEvents) < maxItems; idx-- {
+			if inRange(pe.Events[idx]) {
+				memEvents = append(memEvents, pe.Events[idx])
+			}
+		}
 	}
-	if maxItems > len(pe.Events) {
-		maxItems = len(pe.Events)
+	b.Lock.Unlock()
+	slices.Reverse(memEvents)
+	if len(memEvents) >= maxItems || store == nil || !store.IsDurable(eventType) {
+		return memEvents
 	}
-	// return new arr
-	rtn := make([]*WaveEvent, maxItems)
-	copy(rtn, pe.Events[len(pe.Events)-maxItems:])
-	return rtn
+	// only read events that are older than the ones in memory (the store has copies of those)
+	diskEvents, err := store.ReadEvents(eventType, scope, startTs, endTs, oldestMemSeq, maxItems-len(memEvents))
+	if err != nil {
+		log.Printf("[wps] error reading event history for %s: %v\n", eventType, err)
+		return memEvents
+	}
+	return append(diskEvents, memEvents...)
 }
 
 func (b *BrokerType) persistEvent(event WaveEvent) {
@@ -209,6 +301,11 @@ func (b *BrokerType) persistEvent(event WaveEvent) {
 	scopeMap[""] = true
 	b.Lock.Lock()
 	defer b.Lock.Unlock()
+	b.Seq++
+	event.Seq = b.Seq
+	if b.Store != nil && (event.Durable || b.Store.IsDurable(event.Event)) {
+		b.Store.StoreEvent(&event)
+	}
 	for scope := range scopeMap {
 		key := persistKey{Event: event.Event, Scope: scope}
 		pe := b.PersistMap[key]
@@ -220,6 +317,9 @@ func (b *BrokerType) persistEvent(event WaveEvent) {
 			b.PersistMap[key] = pe
 		}
 		pe.Events = append(pe.Events, &event)
+		if len(pe.Events) > numPersist {
+			pe.Events = pe.Events[len(pe.Events)-numPersist:]
+		}
 		pe.ArrTotalAdds++
 		if pe.ArrTotalAdds > ReMakeArrThreshold {
 			pe.Events = append([]*WaveEvent{}, pe.Events...)
@@ -230,6 +330,9 @@ func (b *BrokerType) persistEvent(event WaveEvent) {
 
 func (b *BrokerType) Publish(event WaveEvent) {
 	// log.Printf("BrokerType.Publish: %v\n", event)
+	if event.Ts == 0 {
+		event.Ts = time.Now().UnixMilli()
+	}
 	if event.Persist > 0 {
 		b.persistEvent(event)
 	}
@@ -277,7 +380,20 @@ func (b *BrokerType) getMatchingRouteIds(event WaveEvent) []string {
 		}
 	}
 	var rtn []string
+	var data any
+	dataConverted := false
+	getData := func() any {
+		if !dataConverted {
+			data = filterData(event.Data)
+			dataConverted = true
+		}
+		return data
+	}
+	now := time.Now()
 	for routeId := range routeIds {
+		if opts := bs.Opts[routeId]; opts != nil && !opts.allow(getData, now) {
+			continue
+		}
 		rtn = append(rtn, routeId)
 	}
 	// log.Printf("getMatchingRouteIds %v %v\n", event, rtn)
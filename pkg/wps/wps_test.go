@@ -0,0 +1,147 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wps
+
+import (
+	"sync"
+	"testing"
+)
+
+// keeps every event, like the durable store would across a restart
+type testEventStore struct {
+	Events []*WaveEvent
+}
+
+func (s *testEventStore) IsDurable(eventType string) bool {
+	return eventType == "test"
+}
+
+func (s *testEventStore) StoreEvent(event *WaveEvent) {
+	s.Events = append(s.Events, event)
+}
+
+func (s *testEventStore) ReadEvents(eventType string, scope string, startTs int64, endTs int64, beforeSeq int64, maxItems int) ([]*WaveEvent, error) {
+	var rtn []*WaveEvent
+	for _, event := range s.Events {
+		if event.Event == eventType && (scope == "" || event.HasScope(scope)) && (beforeSeq <= 0 || event.Seq < beforeSeq) && event.Ts >= startTs && (endTs <= 0 || event.Ts < endTs) {
+			rtn = append(rtn, event)
+		}
+	}
+	if len(rtn) > maxItems {
+		rtn = rtn[len(rtn)-maxItems:]
+	}
+	return rtn, nil
+}
+
+func TestReadEventHistoryRange(t *testing.T) {
+	store := &testEventStore{}
+	// events from before a restart (seqs 1-3), the store is set after some events were published
+	for seq := int64(1); seq <= 3; seq++ {
+		store.Events = append(store.Events, &WaveEvent{Event: "test", Scopes: []string{"s1"}, Ts: seq, Seq: seq})
+	}
+	broker := &BrokerType{Lock: &sync.Mutex{}, SubMap: make(map[string]*BrokerSubscription), PersistMap: make(map[persistKey]*persistEventWrap)}
+	broker.Publish(WaveEvent{Event: "test", Scopes: []string{"s1"}, Ts: 4, Persist: 3})
+	broker.SetEventStore(store, 3)
+	// the timestamps repeat, only the seqs split memory and disk
+	for ts := int64(5); ts <= 10; ts++ {
+		broker.Publish(WaveEvent{Event: "test", Scopes: []string{"s1"}, Ts: min(ts, 8), Persist: 3})
+	}
+	broker.Publish(WaveEvent{Event: "other", Ts: 10, Persist: 3})
+	if len(store.Events) != 9 {
+		t.Fatalf("expected 9 stored events, got %d", len(store.Events))
+	}
+	// events can opt in to being stored
+	broker.Publish(WaveEvent{Event: "other", Ts: 10, Persist: 3, Durable: true})
+	if len(store.Events) != 10 || store.Events[9].Event != "other" {
+		t.Fatalf("expected the durable event to be stored")
+	}
+	checkSeqs := func(events []*WaveEvent, expected ...int64) {
+		t.Helper()
+		if len(events) != len(expected) {
+			t.Fatalf("expected %d events, got %d", len(expected), len(events))
+		}
+		for idx, event := range events {
+			if event.Seq != expected[idx] {
+				t.Errorf("event %d: expected seq %d, got %d", idx, expected[idx], event.Seq)
+			}
+		}
+	}
+	// memory only has the last 3 events
+	checkSeqs(broker.ReadEventHistory("test", "s1", 2), 9, 10)
+	checkSeqs(broker.ReadEventHistory("test", "s1", 5), 6, 7, 8, 9, 10)
+	checkSeqs(broker.ReadEventHistoryRange("test", "", 3, 6, 10), 3, 5)
+	checkSeqs(broker.ReadEventHistoryRange("test", "s1", 8, 0, 10), 8, 9, 10)
+	checkSeqs(broker.ReadEventHistory("test", "s1", 20), 1, 2, 3, 5, 6, 7, 8, 9, 10)
+}
+
+type testClient struct {
+	Sent map[string]int
+}
+
+func (c *testClient) SendEvent(routeId string, event WaveEvent) {
+	c.Sent[routeId]++
+}
+
+func TestEventFilter(t *testing.T) {
+	data := filterData(map[string]any{
+		"status":    "done",
+		"exitcode":  2,
+		"items":     []any{map[string]any{"name": "foo"}},
+		"conn:name": "local",
+	})
+	tests := []struct {
+		Expr  string
+		Match bool
+	}{
+		{`$.status == "done" && $.exitcode != 0`, true},
+		{`$.status == 'running' || $.exitcode > 5`, false},
+		{`$.exitcode >= 2 && $.exitcode < 3`, true},
+		{`$.items[0].name == "foo"`, true},
+		{`$.items[1].name == null`, true},
+		{`$["conn:name"] == "local"`, true},
+		{`!($.missing)`, true},
+		{`$.status`, true},
+		{`$.status > "a"`, true},
+		{`$.status > 1`, false},
+	}
+	for _, test := range tests {
+		filter, err := ParseEventFilter(test.Expr)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.Expr, err)
+			continue
+		}
+		if filter.Match(data) != test.Match {
+			t.Errorf("%s: expected match=%v", test.Expr, test.Match)
+		}
+	}
+	for _, badExpr := range []string{"", "$.a ==", "status == 1", `$.a == "x`, "($.a", "$.a $.b", "$[x]"} {
+		if _, err := ParseEventFilter(badExpr); err == nil {
+			t.Errorf("%q: expected parse error", badExpr)
+		}
+	}
+}
+
+func TestSubscriptionOpts(t *testing.T) {
+	client := &testClient{Sent: make(map[string]int)}
+	broker := &BrokerType{Lock: &sync.Mutex{}, SubMap: make(map[string]*BrokerSubscription), PersistMap: make(map[persistKey]*persistEventWrap)}
+	broker.SetClient(client)
+	broker.Subscribe("all", SubscriptionRequest{Event: "test", AllScopes: true})
+	broker.Subscribe("filtered", SubscriptionRequest{Event: "test", AllScopes: true, Filter: "$.exitcode != 0"})
+	broker.Subscribe("limited", SubscriptionRequest{Event: "test", Scopes: []string{"s1"}, MinIntervalMs: 60000})
+	if err := broker.Subscribe("bad", SubscriptionRequest{Event: "test", AllScopes: true, Filter: "$.a =="}); err == nil {
+		t.Errorf("expected error for invalid filter")
+	}
+	for idx := 0; idx < 10; idx++ {
+		broker.Publish(WaveEvent{Event: "test", Scopes: []string{"s1"}, Data: map[string]any{"exitcode": idx % 2}})
+	}
+	if client.Sent["all"] != 10 || client.Sent["filtered"] != 5 || client.Sent["limited"] != 1 || client.Sent["bad"] != 0 {
+		t.Errorf("unexpected delivery counts: %v", client.Sent)
+	}
+	// resubscribing without options removes them
+	broker.Subscribe("filtered", SubscriptionRequest{Event: "test", AllScopes: true})
+	broker.Publish(WaveEvent{Event: "test", Data: map[string]any{"exitcode": 0}})
+	if client.Sent["filtered"] != 6 {
+		t.Errorf("expected filter to be removed on resubscribe, got %d events", client.Sent["filtered"])
+	}
+}
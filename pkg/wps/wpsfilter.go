@@ -0,0 +1,473 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wps
+
+// subscription filters, evaluated against WaveEvent.Data (as json)
+//
+//	$.shellprocstatus == "done" && $.shellprocexitcode != 0
+//	$.items[0].name == 'foo' || !($.count > 10)
+//	$.error                      (a bare path is true if the value is set and not false/0/"")
+//
+// paths start with $ and use .field, [idx], or ["field"] selectors, a missing value compares equal to null
+// comparison operators are == != < <= > >= (ordering only applies to two numbers or two strings)
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type filterNode interface {
+	eval(data any) any
+}
+
+type EventFilter struct {
+	Expr string
+	root filterNode
+}
+
+type pathSelector struct {
+	Key   string
+	Idx   int
+	IsIdx bool
+}
+
+type pathNode struct {
+	Selectors []pathSelector
+}
+
+type literalNode struct {
+	Val any
+}
+
+type notNode struct {
+	Expr filterNode
+}
+
+type logicalNode struct {
+	Op    string // "&&" or "||"
+	Left  filterNode
+	Right filterNode
+}
+
+type compareNode struct {
+	Op    string
+	Left  filterNode
+	Right filterNode
+}
+
+func ParseEventFilter(expr string) (*EventFilter, error) {
+	tokens, err := tokenizeFilter(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid filter %q: %w", expr, err)
+	}
+	p := &filterParser{Tokens: tokens}
+	root, err := p.parseOr()
+	if err == nil && p.Pos < len(p.Tokens) {
+		err = fmt.Errorf("unexpected %q", p.Tokens[p.Pos].Val)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid filter %q: %w", expr, err)
+	}
+	return &EventFilter{Expr: expr, root: root}, nil
+}
+
+// data should be a generic json value (see filterData)
+func (f *EventFilter) Match(data any) bool {
+	return isTruthy(f.root.eval(data))
+}
+
+// converts event data (which is usually a go struct) to a generic json value
+func filterData(data any) any {
+	if data == nil {
+		return nil
+	}
+	barr, err := json.Marshal(data)
+	if err != nil {
+		return nil
+	}
+	var rtn any
+	if json.Unmarshal(barr, &rtn) != nil {
+		return nil
+	}
+	return rtn
+}
+
+func (n *pathNode) eval(data any) any {
+	cur := data
+	for _, sel := range n.Selectors {
+		if sel.IsIdx {
+			arr, ok := cur.([]any)
+			if !ok || sel.Idx < 0 || sel.Idx >= len(arr) {
+				return nil
+			}
+			cur = arr[sel.Idx]
+			continue
+		}
+		m, ok := cur.(map[string]any)
+		if !ok {
+			return nil
+		}
+		cur = m[sel.Key]
+	}
+	return cur
+}
+
+func (n *literalNode) eval(data any) any {
+	return n.Val
+}
+
+func (n *notNode) eval(data any) any {
+	return !isTruthy(n.Expr.eval(data))
+}
+
+func (n *logicalNode) eval(data any) any {
+	left := isTruthy(n.Left.eval(data))
+	if n.Op == "&&" {
+		return left && isTruthy(n.Right.eval(data))
+	}
+	return left || isTruthy(n.Right.eval(data))
+}
+
+func (n *compareNode) eval(data any) any {
+	left := n.Left.eval(data)
+	right := n.Right.eval(data)
+	switch n.Op {
+	case "==":
+		return jsonValEqual(left, right)
+	case "!=":
+		return !jsonValEqual(left, right)
+	}
+	var cmp int
+	lnum, lok := left.(float64)
+	rnum, rok := right.(float64)
+	if lok && rok {
+		cmp = compareOrdered(lnum, rnum)
+	} else {
+		lstr, lok := left.(string)
+		rstr, rok := right.(string)
+		if !lok || !rok {
+			return false
+		}
+		cmp = strings.Compare(lstr, rstr)
+	}
+	switch n.Op {
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	}
+	return false
+}
+
+func compareOrdered(a float64, b float64) int {
+	if a < b {
+		return -1
+	}
+	if a > b {
+		return 1
+	}
+	return 0
+}
+
+// objects and arrays are never equal (only scalars are compared)
+func jsonValEqual(a any, b any) bool {
+	switch av := a.(type) {
+	case nil:
+		return b == nil
+	case float64:
+		bv, ok := b.(float64)
+		return ok && av == bv
+	case string:
+		bv, ok := b.(string)
+		return ok && av == bv
+	case bool:
+		bv, ok := b.(bool)
+		return ok && av == bv
+	}
+	return false
+}
+
+func isTruthy(val any) bool {
+	switch v := val.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	case float64:
+		return v != 0
+	case string:
+		return v != ""
+	}
+	return true
+}
+
+const (
+	tokenPath   = "path"
+	tokenString = "string"
+	tokenNumber = "number"
+	tokenIdent  = "ident" // true, false, null
+	tokenOp     = "op"
+)
+
+type filterToken struct {
+	Type      string
+	Val       string
+	Selectors []pathSelector // for path tokens
+}
+
+var filterOps = []string{"==", "!=", "<=", ">=", "&&", "||", "<", ">", "!", "(", ")"}
+
+func isIdentChar(ch byte, first bool) bool {
+	if ch == '_' || (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z') {
+		return true
+	}
+	return !first && (ch == '-' || ch == ':' || (ch >= '0' && ch <= '9'))
+}
+
+// returns the string value and the position after the closing quote
+func scanQuoted(expr string, pos int) (string, int, error) {
+	quote := expr[pos]
+	var sb strings.Builder
+	for idx := pos + 1; idx < len(expr); idx++ {
+		ch := expr[idx]
+		if ch == '\\' && idx+1 < len(expr) {
+			idx++
+			sb.WriteByte(expr[idx])
+			continue
+		}
+		if ch == quote {
+			return sb.String(), idx + 1, nil
+		}
+		sb.WriteByte(ch)
+	}
+	return "", 0, fmt.Errorf("unterminated string")
+}
+
+func scanPath(expr string, pos int) ([]pathSelector, int, error) {
+	var selectors []pathSelector
+	pos++ // skip $
+	for pos < len(expr) {
+		switch expr[pos] {
+		case '.':
+			start := pos + 1
+			end := start
+			for end < len(expr) && isIdentChar(expr[end], end == start) {
+				end++
+			}
+			if end == start {
+				return nil, 0, fmt.Errorf("expected field name after '.' at %d", pos)
+			}
+			selectors = append(selectors, pathSelector{Key: expr[start:end]})
+			pos = end
+		case '[':
+			pos++
+			if pos < len(expr) && (expr[pos] == '"' || expr[pos] == '\'') {
+				key, next, err := scanQuoted(expr, pos)
+				if err != nil {
+					return nil, 0, err
+				}
+				selectors = append(selectors, pathSelector{Key: key})
+				pos = next
+			} else {
+				end := strings.IndexByte(expr[pos:], ']')
+				if end < 0 {
+					return nil, 0, fmt.Errorf("unterminated '['")
+				}
+				idx, err := strconv.Atoi(strings.TrimSpace(expr[pos : pos+end]))
+				if err != nil {
+					return nil, 0, fmt.Errorf("invalid array index %q", expr[pos:pos+end])
+				}
+				selectors = append(selectors, pathSelector{Idx: idx, IsIdx: true})
+				pos += end
+			}
+			if pos >= len(expr) || expr[pos] != ']' {
+				return nil, 0, fmt.Errorf("expected ']'")
+			}
+			pos++
+		default:
+			return selectors, pos, nil
+		}
+	}
+	return selectors, pos, nil
+}
+
+func tokenizeFilter(expr string) ([]filterToken, error) {
+	var tokens []filterToken
+	pos := 0
+outer:
+	for pos < len(expr) {
+		ch := expr[pos]
+		switch {
+		case ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r':
+			pos++
+			continue outer
+		case ch == '$':
+			selectors, next, err := scanPath(expr, pos)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, filterToken{Type: tokenPath, Val: expr[pos:next], Selectors: selectors})
+			pos = next
+			continue outer
+		case ch == '"' || ch == '\'':
+			str, next, err := scanQuoted(expr, pos)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, filterToken{Type: tokenString, Val: str})
+			pos = next
+			continue outer
+		case ch == '-' || (ch >= '0' && ch <= '9'):
+			end := pos + 1
+			for end < len(expr) && strings.IndexByte("0123456789.eE+-", expr[end]) >= 0 {
+				end++
+			}
+			tokens = append(tokens, filterToken{Type: tokenNumber, Val: expr[pos:end]})
+			pos = end
+			continue outer
+		case isIdentChar(ch, true):
+			end := pos + 1
+			for end < len(expr) && isIdentChar(expr[end], false) {
+				end++
+			}
+			tokens = append(tokens, filterToken{Type: tokenIdent, Val: expr[pos:end]})
+			pos = end
+			continue outer
+		}
+		for _, op := range filterOps {
+			if strings.HasPrefix(expr[pos:], op) {
+				tokens = append(tokens, filterToken{Type: tokenOp, Val: op})
+				pos += len(op)
+				continue outer
+			}
+		}
+		return nil, fmt.Errorf("unexpected character %q at %d", ch, pos)
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("empty expression")
+	}
+	return tokens, nil
+}
+
+type filterParser struct {
+	Tokens []filterToken
+	Pos    int
+}
+
+func (p *filterParser) peekOp(ops ...string) string {
+	if p.Pos >= len(p.Tokens) || p.Tokens[p.Pos].Type != tokenOp {
+		return ""
+	}
+	for _, op := range ops {
+		if p.Tokens[p.Pos].Val == op {
+			return op
+		}
+	}
+	return ""
+}
+
+func (p *filterParser) parseOr() (filterNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peekOp("||") != "" {
+		p.Pos++
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &logicalNode{Op: "||", Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseAnd() (filterNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peekOp("&&") != "" {
+		p.Pos++
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &logicalNode{Op: "&&", Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseUnary() (filterNode, error) {
+	if p.peekOp("!") != "" {
+		p.Pos++
+		expr, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &notNode{Expr: expr}, nil
+	}
+	if p.peekOp("(") != "" {
+		p.Pos++
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.peekOp(")") == "" {
+			return nil, fmt.Errorf("expected ')'")
+		}
+		p.Pos++
+		return expr, nil
+	}
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	if op := p.peekOp("==", "!=", "<", "<=", ">", ">="); op != "" {
+		p.Pos++
+		right, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		return &compareNode{Op: op, Left: left, Right: right}, nil
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseOperand() (filterNode, error) {
+	if p.Pos >= len(p.Tokens) {
+		return nil, fmt.Errorf("unexpected end of expression")
+	}
+	token := p.Tokens[p.Pos]
+	p.Pos++
+	switch token.Type {
+	case tokenPath:
+		return &pathNode{Selectors: token.Selectors}, nil
+	case tokenString:
+		return &literalNode{Val: token.Val}, nil
+	case tokenNumber:
+		num, err := strconv.ParseFloat(token.Val, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q", token.Val)
+		}
+		return &literalNode{Val: num}, nil
+	case tokenIdent:
+		switch token.Val {
+		case "true":
+			return &literalNode{Val: true}, nil
+		case "false":
+			return &literalNode{Val: false}, nil
+		case "null":
+			return &literalNode{Val: nil}, nil
+		}
+		return nil, fmt.Errorf("unknown identifier %q (paths must start with $)", token.Val)
+	}
+	return nil, fmt.Errorf("unexpected %q", token.Val)
+}
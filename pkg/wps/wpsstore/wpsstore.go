@@ -0,0 +1,241 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// durable storage for persisted wps events (events published with Persist > 0)
+// only event types registered with SetEventRetention and events published with Durable (user events) are stored
+// events are buffered and written to the event_history table in batches, old events are pruned per event type
+package wpsstore
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/wavetermdev/waveterm/pkg/panichandler"
+	"github.com/wavetermdev/waveterm/pkg/wps"
+	"github.com/wavetermdev/waveterm/pkg/wstore"
+)
+
+const FlushInterval = 5 * time.Second
+const PruneInterval = 10 * time.Minute
+const maxPendingRows = 10000 // events are dropped if the db writes fall this far behind
+
+// events older than MaxAge are removed, and at most MaxItems events are kept per event type and scope
+type Retention struct {
+	MaxAge   time.Duration
+	MaxItems int
+}
+
+// retention for event types that were stored because their events were published with Durable
+var DefaultRetention = Retention{MaxAge: 30 * 24 * time.Hour, MaxItems: 100}
+
+var retentionLock = &sync.Mutex{}
+var eventRetention = map[string]Retention{
+	wps.Event_ConnChange:       {MaxAge: 30 * 24 * time.Hour, MaxItems: 500},
+	wps.Event_ControllerStatus: {MaxAge: 7 * 24 * time.Hour, MaxItems: wps.ControllerStatusPersist},
+	wps.Event_SysInfo:          {MaxAge: time.Hour, MaxItems: 1024},
+}
+var optInTypes = make(map[string]bool) // event types with stored Durable events
+
+// makes eventType durable
+func SetEventRetention(eventType string, retention Retention) {
+	retentionLock.Lock()
+	defer retentionLock.Unlock()
+	eventRetention[eventType] = retention
+}
+
+// returns false if eventType is not durable (DefaultRetention is returned for opt-in types)
+func GetEventRetention(eventType string) (Retention, bool) {
+	retentionLock.Lock()
+	defer retentionLock.Unlock()
+	if retention, ok := eventRetention[eventType]; ok {
+		return retention, true
+	}
+	if optInTypes[eventType] {
+		return DefaultRetention, true
+	}
+	return Retention{}, false
+}
+
+func addOptInType(eventType string) {
+	retentionLock.Lock()
+	defer retentionLock.Unlock()
+	optInTypes[eventType] = true
+}
+
+type eventRow struct {
+	Event     string `db:"event"`
+	Scope     string `db:"scope"`
+	Seq       int64  `db:"seq"`
+	Ts        int64  `db:"ts"`
+	EventJson string `db:"eventjson"`
+}
+
+type eventStore struct {
+	Lock     *sync.Mutex
+	Pending  []*eventRow
+	Dropping bool
+}
+
+var globalStore = &eventStore{Lock: &sync.Mutex{}}
+
+// must be called after wstore is initialized
+func InitEventStore() error {
+	ctx, cancelFn := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelFn()
+	var eventTypes []string
+	lastSeq, err := wstore.WithTxRtn(ctx, func(tx *wstore.TxWrap) (int64, error) {
+		eventTypes = tx.SelectStrings(`SELECT DISTINCT event FROM event_history`)
+		return tx.GetInt64(`SELECT COALESCE(MAX(seq), 0) FROM event_history`), nil
+	})
+	if err != nil {
+		return fmt.Errorf("error reading last event seq: %w", err)
+	}
+	// every stored type is either registered or was opted in (types that are no longer registered fall back to DefaultRetention)
+	for _, eventType := range eventTypes {
+		addOptInType(eventType)
+	}
+	wps.Broker.SetEventStore(globalStore, lastSeq)
+	go globalStore.runFlusher()
+	return nil
+}
+
+func (s *eventStore) IsDurable(eventType string) bool {
+	_, ok := GetEventRetention(eventType)
+	return ok
+}
+
+// one row per scope (and one for the "" scope), matching the broker's in-memory history
+func (s *eventStore) StoreEvent(event *wps.WaveEvent) {
+	barr, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("[wpsstore] error marshaling %s event: %v\n", event.Event, err)
+		return
+	}
+	scopes := map[string]bool{"": true}
+	for _, scope := range event.Scopes {
+		scopes[scope] = true
+	}
+	if event.Durable {
+		addOptInType(event.Event)
+	}
+	s.Lock.Lock()
+	defer s.Lock.Unlock()
+	if len(s.Pending)+len(scopes) > maxPendingRows {
+		if !s.Dropping {
+			log.Printf("[wpsstore] too many pending events, dropping events\n")
+			s.Dropping = true
+		}
+		return
+	}
+	s.Dropping = false
+	for scope := range scopes {
+		s.Pending = append(s.Pending, &eventRow{Event: event.Event, Scope: scope, Seq: event.Seq, Ts: event.Ts, EventJson: string(barr)})
+	}
+}
+
+func (s *eventStore) ReadEvents(eventType string, scope string, startTs int64, endTs int64, beforeSeq int64, maxItems int) ([]*wps.WaveEvent, error) {
+	ctx, cancelFn := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelFn()
+	if endTs <= 0 {
+		endTs = math.MaxInt64
+	}
+	if beforeSeq <= 0 {
+		beforeSeq = math.MaxInt64
+	}
+	rows, err := wstore.WithTxRtn(ctx, func(tx *wstore.TxWrap) ([]*eventRow, error) {
+		var rows []*eventRow
+		query := `SELECT * FROM event_history WHERE event = ? AND scope = ? AND seq < ? AND ts >= ? AND ts < ? ORDER BY seq DESC LIMIT ?`
+		tx.Select(&rows, query, eventType, scope, beforeSeq, startTs, endTs, maxItems)
+		return rows, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error reading event history: %w", err)
+	}
+	rtn := make([]*wps.WaveEvent, 0, len(rows))
+	for idx := len(rows) - 1; idx >= 0; idx-- {
+		var event wps.WaveEvent
+		err = json.Unmarshal([]byte(rows[idx].EventJson), &event)
+		if err != nil {
+			log.Printf("[wpsstore] error unmarshaling %s event: %v\n", eventType, err)
+			continue
+		}
+		rtn = append(rtn, &event)
+	}
+	return rtn, nil
+}
+
+func (s *eventStore) takePending() []*eventRow {
+	s.Lock.Lock()
+	defer s.Lock.Unlock()
+	rtn := s.Pending
+	s.Pending = nil
+	return rtn
+}
+
+// writes pending events to the db
+func FlushEvents(ctx context.Context) error {
+	rows := globalStore.takePending()
+	if len(rows) == 0 {
+		return nil
+	}
+	return wstore.WithTx(ctx, func(tx *wstore.TxWrap) error {
+		query := `INSERT INTO event_history (event, scope, seq, ts, eventjson) VALUES (?, ?, ?, ?, ?)`
+		for _, row := range rows {
+			tx.Exec(query, row.Event, row.Scope, row.Seq, row.Ts, row.EventJson)
+		}
+		return nil
+	})
+}
+
+// removes events that are past their event type's retention
+func PruneEvents(ctx context.Context) error {
+	return wstore.WithTx(ctx, func(tx *wstore.TxWrap) error {
+		eventTypes := tx.SelectStrings(`SELECT DISTINCT event FROM event_history`)
+		for _, eventType := range eventTypes {
+			retention, ok := GetEventRetention(eventType)
+			if !ok {
+				tx.Exec(`DELETE FROM event_history WHERE event = ?`, eventType)
+				continue
+			}
+			if retention.MaxAge > 0 {
+				tx.Exec(`DELETE FROM event_history WHERE event = ? AND ts < ?`, eventType, time.Now().Add(-retention.MaxAge).UnixMilli())
+			}
+			if retention.MaxItems > 0 {
+				query := `DELETE FROM event_history WHERE rowid IN (
+				            SELECT rowid FROM (
+				              SELECT rowid, row_number() OVER (PARTITION BY scope ORDER BY seq DESC) AS rownum
+				              FROM event_history WHERE event = ?
+				            ) WHERE rownum > ?
+				          )`
+				tx.Exec(query, eventType, retention.MaxItems)
+			}
+		}
+		return nil
+	})
+}
+
+func (s *eventStore) runFlusher() {
+	defer panichandler.PanicHandler("wpsstore:runFlusher")
+	lastPrune := time.Time{}
+	for {
+		ctx, cancelFn := context.WithTimeout(context.Background(), 10*time.Second)
+		err := FlushEvents(ctx)
+		if err != nil {
+			log.Printf("[wpsstore] error writing events: %v\n", err)
+		}
+		if time.Since(lastPrune) >= PruneInterval {
+			err = PruneEvents(ctx)
+			if err != nil {
+				log.Printf("[wpsstore] error pruning events: %v\n", err)
+			}
+			lastPrune = time.Now()
+		}
+		cancelFn()
+		time.Sleep(FlushInterval)
+	}
+}
@@ -13,6 +13,13 @@ const (
 	Event_UserInput        = "userinput"
 	Event_RouteGone        = "route:gone"
 	Event_WorkspaceUpdate  = "workspace:update"
+	Event_FileStoreQuota   = "filestore:quota"
+)
+
+// number of events kept in memory (per scope) for event types that are always persisted
+const (
+	ConnChangePersist       = 100
+	ControllerStatusPersist = 20
 )
 
 type WaveEvent struct {
@@ -20,6 +27,9 @@ type WaveEvent struct {
 	Scopes  []string `json:"scopes,omitempty"`
 	Sender  string   `json:"sender,omitempty"`
 	Persist int      `json:"persist,omitempty"`
+	Durable bool     `json:"durable,omitempty"` // also save a persisted event to disk (for event types that are not durable by default, like user events)
+	Ts      int64    `json:"ts,omitempty"`      // set by the broker when the event is published (unixmilli)
+	Seq     int64    `json:"seq,omitempty"`     // set by the broker for persisted events (monotonic, also across restarts when the event type is durable)
 	Data    any      `json:"data,omitempty"`
 }
 
@@ -28,9 +38,11 @@ func (e WaveEvent) HasScope(scope string) bool {
 }
 
 type SubscriptionRequest struct {
-	Event     string   `json:"event"`
-	Scopes    []string `json:"scopes,omitempty"`
-	AllScopes bool     `json:"allscopes,omitempty"`
+	Event         string   `json:"event"`
+	Scopes        []string `json:"scopes,omitempty"`
+	AllScopes     bool     `json:"allscopes,omitempty"`
+	Filter        string   `json:"filter,omitempty"`        // only deliver events whose data matches this expression (see wpsfilter.go)
+	MinIntervalMs int64    `json:"minintervalms,omitempty"` // deliver at most one event per interval, events in between are dropped
 }
 
 const (
@@ -47,3 +59,12 @@ type WSFileEventData struct {
 	FileOp   string `json:"fileop"`
 	Data64   string `json:"data64"`
 }
+
+// sent when storage usage goes over the warning level of a quota (or a write is rejected)
+// ZoneId is empty for the total quota
+type WSQuotaEventData struct {
+	ZoneId   string `json:"zoneid,omitempty"`
+	Usage    int64  `json:"usage"`
+	Limit    int64  `json:"limit"`
+	Exceeded bool   `json:"exceeded,omitempty"`
+}
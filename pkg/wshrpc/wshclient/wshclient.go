@@ -55,6 +55,24 @@ func ConnEnsureCommand(w *wshutil.WshRpc, data string, opts *wshrpc.RpcOpts) err
 	return err
 }
 
+// command "connforwardadd", wshserver.ConnForwardAddCommand
+func ConnForwardAddCommand(w *wshutil.WshRpc, data wshrpc.CommandConnForwardAddData, opts *wshrpc.RpcOpts) (*wshrpc.ConnForward, error) {
+	resp, err := sendRpcRequestCallHelper[*wshrpc.ConnForward](w, "connforwardadd", data, opts)
+	return resp, err
+}
+
+// command "connforwardlist", wshserver.ConnForwardListCommand
+func ConnForwardListCommand(w *wshutil.WshRpc, data string, opts *wshrpc.RpcOpts) ([]wshrpc.ConnForward, error) {
+	resp, err := sendRpcRequestCallHelper[[]wshrpc.ConnForward](w, "connforwardlist", data, opts)
+	return resp, err
+}
+
+// command "connforwardremove", wshserver.ConnForwardRemoveCommand
+func ConnForwardRemoveCommand(w *wshutil.WshRpc, data wshrpc.CommandConnForwardRemoveData, opts *wshrpc.RpcOpts) error {
+	_, err := sendRpcRequestCallHelper[any](w, "connforwardremove", data, opts)
+	return err
+}
+
 // command "connlist", wshserver.ConnListCommand
 func ConnListCommand(w *wshutil.WshRpc, opts *wshrpc.RpcOpts) ([]string, error) {
 	resp, err := sendRpcRequestCallHelper[[]string](w, "connlist", nil, opts)
@@ -187,6 +205,24 @@ func FileDeleteCommand(w *wshutil.WshRpc, data wshrpc.CommandFileData, opts *wsh
 	return err
 }
 
+// command "fileijsonat", wshserver.FileIJsonAtCommand
+func FileIJsonAtCommand(w *wshutil.WshRpc, data wshrpc.CommandFileIJsonAtData, opts *wshrpc.RpcOpts) (*wshrpc.FileIJsonAtRtnData, error) {
+	resp, err := sendRpcRequestCallHelper[*wshrpc.FileIJsonAtRtnData](w, "fileijsonat", data, opts)
+	return resp, err
+}
+
+// command "fileijsonlog", wshserver.FileIJsonLogCommand
+func FileIJsonLogCommand(w *wshutil.WshRpc, data wshrpc.CommandFileData, opts *wshrpc.RpcOpts) ([]map[string]interface {}, error) {
+	resp, err := sendRpcRequestCallHelper[[]map[string]interface {}](w, "fileijsonlog", data, opts)
+	return resp, err
+}
+
+// command "fileijsonundo", wshserver.FileIJsonUndoCommand
+func FileIJsonUndoCommand(w *wshutil.WshRpc, data wshrpc.CommandFileIJsonUndoData, opts *wshrpc.RpcOpts) (int, error) {
+	resp, err := sendRpcRequestCallHelper[int](w, "fileijsonundo", data, opts)
+	return resp, err
+}
+
 // command "fileinfo", wshserver.FileInfoCommand
 func FileInfoCommand(w *wshutil.WshRpc, data wshrpc.CommandFileData, opts *wshrpc.RpcOpts) (*wshrpc.WaveFileInfo, error) {
 	resp, err := sendRpcRequestCallHelper[*wshrpc.WaveFileInfo](w, "fileinfo", data, opts)
@@ -205,12 +241,23 @@ func FileReadCommand(w *wshutil.WshRpc, data wshrpc.CommandFileData, opts *wshrp
 	return resp, err
 }
 
+// command "filestream", wshserver.FileStreamCommand
+func FileStreamCommand(w *wshutil.WshRpc, data wshrpc.CommandFileStreamData, opts *wshrpc.RpcOpts) chan wshrpc.RespOrErrorUnion[wshrpc.FileStreamRtnData] {
+	return sendRpcRequestResponseStreamHelper[wshrpc.FileStreamRtnData](w, "filestream", data, opts)
+}
+
 // command "filewrite", wshserver.FileWriteCommand
 func FileWriteCommand(w *wshutil.WshRpc, data wshrpc.CommandFileData, opts *wshrpc.RpcOpts) error {
 	_, err := sendRpcRequestCallHelper[any](w, "filewrite", data, opts)
 	return err
 }
 
+// command "focusblock", wshserver.FocusBlockCommand
+func FocusBlockCommand(w *wshutil.WshRpc, data string, opts *wshrpc.RpcOpts) error {
+	_, err := sendRpcRequestCallHelper[any](w, "focusblock", data, opts)
+	return err
+}
+
 // command "focuswindow", wshserver.FocusWindowCommand
 func FocusWindowCommand(w *wshutil.WshRpc, data string, opts *wshrpc.RpcOpts) error {
 	_, err := sendRpcRequestCallHelper[any](w, "focuswindow", data, opts)
@@ -235,6 +282,18 @@ func GetVarCommand(w *wshutil.WshRpc, data wshrpc.CommandVarData, opts *wshrpc.R
 	return resp, err
 }
 
+// command "historyclear", wshserver.HistoryClearCommand
+func HistoryClearCommand(w *wshutil.WshRpc, data wshrpc.CommandHistoryClearData, opts *wshrpc.RpcOpts) error {
+	_, err := sendRpcRequestCallHelper[any](w, "historyclear", data, opts)
+	return err
+}
+
+// command "historysearch", wshserver.HistorySearchCommand
+func HistorySearchCommand(w *wshutil.WshRpc, data wshrpc.CommandHistorySearchData, opts *wshrpc.RpcOpts) ([]*wshrpc.HistoryItem, error) {
+	resp, err := sendRpcRequestCallHelper[[]*wshrpc.HistoryItem](w, "historysearch", data, opts)
+	return resp, err
+}
+
 // command "message", wshserver.MessageCommand
 func MessageCommand(w *wshutil.WshRpc, data wshrpc.CommandMessageData, opts *wshrpc.RpcOpts) error {
 	_, err := sendRpcRequestCallHelper[any](w, "message", data, opts)
@@ -323,6 +382,17 @@ func RouteUnannounceCommand(w *wshutil.WshRpc, opts *wshrpc.RpcOpts) error {
 	return err
 }
 
+// command "rpctrace", wshserver.RpcTraceCommand
+func RpcTraceCommand(w *wshutil.WshRpc, data wshrpc.CommandRpcTraceData, opts *wshrpc.RpcOpts) chan wshrpc.RespOrErrorUnion[wshrpc.RpcTraceEntry] {
+	return sendRpcRequestResponseStreamHelper[wshrpc.RpcTraceEntry](w, "rpctrace", data, opts)
+}
+
+// command "searchblockfiles", wshserver.SearchBlockFilesCommand
+func SearchBlockFilesCommand(w *wshutil.WshRpc, data wshrpc.CommandSearchBlockFilesData, opts *wshrpc.RpcOpts) ([]*wshrpc.BlockFileSearchMatch, error) {
+	resp, err := sendRpcRequestCallHelper[[]*wshrpc.BlockFileSearchMatch](w, "searchblockfiles", data, opts)
+	return resp, err
+}
+
 // command "setconfig", wshserver.SetConfigCommand
 func SetConfigCommand(w *wshutil.WshRpc, data wshrpc.MetaSettingsType, opts *wshrpc.RpcOpts) error {
 	_, err := sendRpcRequestCallHelper[any](w, "setconfig", data, opts)
@@ -353,6 +423,12 @@ func SetViewCommand(w *wshutil.WshRpc, data wshrpc.CommandBlockSetViewData, opts
 	return err
 }
 
+// command "storagereport", wshserver.StorageReportCommand
+func StorageReportCommand(w *wshutil.WshRpc, data wshrpc.CommandStorageReportData, opts *wshrpc.RpcOpts) (*wshrpc.StorageReportData, error) {
+	resp, err := sendRpcRequestCallHelper[*wshrpc.StorageReportData](w, "storagereport", data, opts)
+	return resp, err
+}
+
 // command "streamcpudata", wshserver.StreamCpuDataCommand
 func StreamCpuDataCommand(w *wshutil.WshRpc, data wshrpc.CpuDataRequest, opts *wshrpc.RpcOpts) chan wshrpc.RespOrErrorUnion[wshrpc.TimeSeriesData] {
 	return sendRpcRequestResponseStreamHelper[wshrpc.TimeSeriesData](w, "streamcpudata", data, opts)
@@ -426,6 +502,12 @@ func WshActivityCommand(w *wshutil.WshRpc, data map[string]int, opts *wshrpc.Rpc
 	return err
 }
 
+// command "wshrpclistcommands", wshserver.WshRpcListCommandsCommand
+func WshRpcListCommandsCommand(w *wshutil.WshRpc, opts *wshrpc.RpcOpts) ([]wshrpc.WshRpcCommandInfo, error) {
+	resp, err := sendRpcRequestCallHelper[[]wshrpc.WshRpcCommandInfo](w, "wshrpclistcommands", nil, opts)
+	return resp, err
+}
+
 // command "wsldefaultdistro", wshserver.WslDefaultDistroCommand
 func WslDefaultDistroCommand(w *wshutil.WshRpc, opts *wshrpc.RpcOpts) (string, error) {
 	resp, err := sendRpcRequestCallHelper[string](w, "wsldefaultdistro", nil, opts)
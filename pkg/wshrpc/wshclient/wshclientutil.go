@@ -87,3 +87,12 @@ func sendRpcRequestResponseStreamHelper[T any](w *wshutil.WshRpc, command string
 	}()
 	return respChan
 }
+
+// for commands that are only known at runtime (wsh rpc call), responses are generic json values
+func SendRpcRequestCall(w *wshutil.WshRpc, command string, data interface{}, opts *wshrpc.RpcOpts) (any, error) {
+	return sendRpcRequestCallHelper[any](w, command, data, opts)
+}
+
+func SendRpcRequestResponseStream(w *wshutil.WshRpc, command string, data interface{}, opts *wshrpc.RpcOpts) chan wshrpc.RespOrErrorUnion[any] {
+	return sendRpcRequestResponseStreamHelper[any](w, command, data, opts)
+}
@@ -18,6 +18,7 @@ import (
 	"github.com/wavetermdev/waveterm/pkg/util/utilfn"
 	"github.com/wavetermdev/waveterm/pkg/wavebase"
 	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"github.com/wavetermdev/waveterm/pkg/wshutil"
 )
 
 const MaxFileSize = 50 * 1024 * 1024 // 10M
@@ -27,6 +28,7 @@ const DirChunkSize = 128
 
 type ServerImpl struct {
 	LogWriter io.Writer
+	Router    *wshutil.WshRouter // set when the connserver runs its own router (used for rpc tracing)
 }
 
 func (*ServerImpl) WshServerImpl() {}
@@ -384,3 +386,13 @@ func (*ServerImpl) RemoteFileDeleteCommand(ctx context.Context, path string) err
 	}
 	return nil
 }
+
+func (impl *ServerImpl) RpcTraceCommand(ctx context.Context, data wshrpc.CommandRpcTraceData) chan wshrpc.RespOrErrorUnion[wshrpc.RpcTraceEntry] {
+	if impl.Router == nil {
+		rtn := make(chan wshrpc.RespOrErrorUnion[wshrpc.RpcTraceEntry], 1)
+		rtn <- wshrpc.RespOrErrorUnion[wshrpc.RpcTraceEntry]{Error: errors.New("connserver is not running a router (local connections use the wavesrv router)")}
+		close(rtn)
+		return rtn
+	}
+	return impl.Router.StreamRpcTrace(ctx, data)
+}
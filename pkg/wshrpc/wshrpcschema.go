@@ -0,0 +1,184 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshrpc
+
+// json schemas for the command data and response types (used by WshRpcListCommandsCommand)
+// types are converted with the same rules as tsgen (json tags, "tstype" tags, ORef as a string, []byte as base64)
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"sync"
+
+	"github.com/wavetermdev/waveterm/pkg/util/utilfn"
+	"github.com/wavetermdev/waveterm/pkg/waveobj"
+)
+
+var orefRType = reflect.TypeOf((*waveobj.ORef)(nil)).Elem()
+var metaMapRType = reflect.TypeOf((*waveobj.MetaMapType)(nil)).Elem()
+var jsonMarshalerRType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+
+var commandInfoOnce = &sync.Once{}
+var commandInfo []WshRpcCommandInfo
+
+// returns the json schema for rtype, struct types are put in "$defs" (and referenced with "$ref")
+func GenerateJsonSchema(rtype reflect.Type) map[string]any {
+	defs := make(map[string]any)
+	schema := typeToJsonSchema(rtype, defs)
+	if len(defs) > 0 {
+		schema["$defs"] = defs
+	}
+	return schema
+}
+
+func typeToJsonSchema(rtype reflect.Type, defs map[string]any) map[string]any {
+	if rtype == orefRType {
+		return map[string]any{"type": "string", "description": "object reference (otype:oid)"}
+	}
+	if rtype == metaMapRType {
+		return map[string]any{"type": "object"}
+	}
+	if rtype.Kind() != reflect.Ptr && rtype.Kind() != reflect.Interface && (rtype.Implements(jsonMarshalerRType) || reflect.PointerTo(rtype).Implements(jsonMarshalerRType)) {
+		// custom encoding, could be anything
+		return map[string]any{}
+	}
+	switch rtype.Kind() {
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Slice, reflect.Array:
+		// byte slices marshal to base64 encoded strings
+		if rtype.Elem().Kind() == reflect.Uint8 {
+			return map[string]any{"type": "string", "contentEncoding": "base64"}
+		}
+		return map[string]any{"type": "array", "items": typeToJsonSchema(rtype.Elem(), defs)}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": typeToJsonSchema(rtype.Elem(), defs)}
+	case reflect.Ptr:
+		return typeToJsonSchema(rtype.Elem(), defs)
+	case reflect.Struct:
+		name := rtype.Name()
+		if name == "" {
+			return structToJsonSchema(rtype, defs)
+		}
+		if _, found := defs[name]; !found {
+			// set before recursing so recursive types (like vdom elems) terminate
+			defs[name] = true
+			defs[name] = structToJsonSchema(rtype, defs)
+		}
+		return map[string]any{"$ref": "#/$defs/" + name}
+	}
+	// interfaces (any)
+	return map[string]any{}
+}
+
+func structToJsonSchema(rtype reflect.Type, defs map[string]any) map[string]any {
+	fields := make(map[string]*schemaField)
+	collectSchemaFields(rtype, defs, 0, fields, make(map[reflect.Type]bool))
+	props := make(map[string]any)
+	for name, field := range fields {
+		if !field.Conflict {
+			props[name] = field.Schema
+		}
+	}
+	return map[string]any{"type": "object", "properties": props}
+}
+
+type schemaField struct {
+	Depth    int
+	Tagged   bool
+	Conflict bool
+	Schema   map[string]any
+}
+
+// follows encoding/json: untagged embedded structs are flattened into the parent, the shallowest field wins
+// (a tagged field wins over untagged fields at the same depth, otherwise fields with the same name are dropped)
+func collectSchemaFields(rtype reflect.Type, defs map[string]any, depth int, fields map[string]*schemaField, visiting map[reflect.Type]bool) {
+	if visiting[rtype] {
+		return
+	}
+	visiting[rtype] = true
+	defer delete(visiting, rtype)
+	for idx := 0; idx < rtype.NumField(); idx++ {
+		field := rtype.Field(idx)
+		if field.Tag.Get("tstype") == "-" {
+			continue
+		}
+		fieldName := utilfn.GetJsonTag(field)
+		if fieldName == "-" {
+			continue
+		}
+		if field.Anonymous {
+			ftype := field.Type
+			if ftype.Kind() == reflect.Ptr {
+				ftype = ftype.Elem()
+			}
+			if !field.IsExported() && ftype.Kind() != reflect.Struct {
+				continue
+			}
+			if fieldName == "" && ftype.Kind() == reflect.Struct {
+				collectSchemaFields(ftype, defs, depth+1, fields, visiting)
+				continue
+			}
+		} else if !field.IsExported() {
+			continue
+		}
+		tagged := fieldName != ""
+		if !tagged {
+			fieldName = field.Name
+		}
+		existing := fields[fieldName]
+		if existing != nil && existing.Depth == depth {
+			if existing.Tagged && !tagged {
+				continue
+			}
+			if existing.Tagged == tagged {
+				existing.Conflict = true
+				continue
+			}
+		} else if existing != nil && existing.Depth < depth {
+			continue
+		}
+		fields[fieldName] = &schemaField{Depth: depth, Tagged: tagged, Schema: typeToJsonSchema(field.Type, defs)}
+	}
+}
+
+func getTypeName(rtype reflect.Type) string {
+	if rtype == nil {
+		return ""
+	}
+	return rtype.String()
+}
+
+// sorted by command name
+func GetWshRpcCommandInfo() []WshRpcCommandInfo {
+	commandInfoOnce.Do(func() {
+		for _, decl := range GenerateWshCommandDeclMap() {
+			info := WshRpcCommandInfo{
+				Command:      decl.Command,
+				CommandType:  decl.CommandType,
+				DataType:     getTypeName(decl.CommandDataType),
+				ResponseType: getTypeName(decl.DefaultResponseDataType),
+			}
+			if decl.CommandDataType != nil {
+				info.DataSchema = GenerateJsonSchema(decl.CommandDataType)
+			}
+			if decl.DefaultResponseDataType != nil {
+				info.ResponseSchema = GenerateJsonSchema(decl.DefaultResponseDataType)
+			}
+			commandInfo = append(commandInfo, info)
+		}
+		sort.Slice(commandInfo, func(i, j int) bool {
+			return commandInfo[i].Command < commandInfo[j].Command
+		})
+	})
+	return commandInfo
+}
@@ -0,0 +1,89 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshrpc
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+type schemaTestBase struct {
+	Id   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type schemaTestOther struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+type SchemaTestExported struct {
+	Ts int64
+}
+
+type schemaTestEmbed struct {
+	schemaTestBase
+	*schemaTestOther
+	SchemaTestExported
+	Tagged schemaTestBase `json:"tagged"`
+	Id     string         `json:"id"`
+	hidden string
+}
+
+func schemaPropNames(schema map[string]any) []string {
+	props, _ := schema["properties"].(map[string]any)
+	var rtn []string
+	for name := range props {
+		rtn = append(rtn, name)
+	}
+	sort.Strings(rtn)
+	return rtn
+}
+
+func TestJsonSchemaEmbedded(t *testing.T) {
+	val := schemaTestEmbed{schemaTestOther: &schemaTestOther{}, hidden: "x"}
+	barr, err := json.Marshal(val)
+	if err != nil {
+		t.Fatalf("error marshaling: %v", err)
+	}
+	var jsonMap map[string]any
+	json.Unmarshal(barr, &jsonMap)
+	var jsonNames []string
+	for name := range jsonMap {
+		jsonNames = append(jsonNames, name)
+	}
+	sort.Strings(jsonNames)
+	// "name" is dropped (same depth in two embedded structs), "id" is taken from the outer struct
+	schema := GenerateJsonSchema(reflect.TypeOf(val))
+	defs, _ := schema["$defs"].(map[string]any)
+	propNames := schemaPropNames(defs["schemaTestEmbed"].(map[string]any))
+	if !reflect.DeepEqual(propNames, jsonNames) {
+		t.Errorf("expected properties %v (from encoding/json), got %v", jsonNames, propNames)
+	}
+}
+
+func TestJsonSchemaCommands(t *testing.T) {
+	declMap := GenerateWshCommandDeclMap()
+	fileSchema := GenerateJsonSchema(declMap[Command_FileAppend].CommandDataType)
+	defs, _ := fileSchema["$defs"].(map[string]any)
+	fileData, _ := defs["CommandFileData"].(map[string]any)
+	if names := schemaPropNames(fileData); !reflect.DeepEqual(names, []string{"at", "data64", "filename", "zoneid"}) {
+		t.Errorf("unexpected CommandFileData properties %v", names)
+	}
+	if at := fileData["properties"].(map[string]any)["at"]; !reflect.DeepEqual(at, map[string]any{"$ref": "#/$defs/CommandFileDataAt"}) {
+		t.Errorf("expected at to reference CommandFileDataAt, got %v", at)
+	}
+	historySchema := GenerateJsonSchema(declMap[Command_EventReadHistory].CommandDataType)
+	defs, _ = historySchema["$defs"].(map[string]any)
+	historyData, _ := defs["CommandEventReadHistoryData"].(map[string]any)
+	if names := schemaPropNames(historyData); !reflect.DeepEqual(names, []string{"endts", "event", "maxitems", "scope", "startts"}) {
+		t.Errorf("unexpected CommandEventReadHistoryData properties %v", names)
+	}
+	// custom json encoding
+	if schema := GenerateJsonSchema(declMap[Command_SetConfig].CommandDataType); len(schema) != 0 {
+		t.Errorf("expected an empty schema for MetaSettingsType, got %v", schema)
+	}
+}
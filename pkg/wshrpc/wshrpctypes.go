@@ -8,9 +8,11 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"log"
 	"os"
 	"reflect"
+	"strings"
 
 	"github.com/wavetermdev/waveterm/pkg/filestore"
 	"github.com/wavetermdev/waveterm/pkg/ijson"
@@ -49,6 +51,10 @@ const (
 	Command_DeleteBlock          = "deleteblock"
 	Command_FileWrite            = "filewrite"
 	Command_FileRead             = "fileread"
+	Command_FileStream           = "filestream"
+	Command_FileIJsonLog         = "fileijsonlog"
+	Command_FileIJsonAt          = "fileijsonat"
+	Command_FileIJsonUndo        = "fileijsonundo"
 	Command_EventPublish         = "eventpublish"
 	Command_EventRecv            = "eventrecv"
 	Command_EventSub             = "eventsub"
@@ -73,17 +79,27 @@ const (
 	Command_GetVar               = "getvar"
 	Command_SetVar               = "setvar"
 	Command_RemoteMkdir          = "remotemkdir"
-
-	Command_ConnStatus       = "connstatus"
-	Command_WslStatus        = "wslstatus"
-	Command_ConnEnsure       = "connensure"
-	Command_ConnReinstallWsh = "connreinstallwsh"
-	Command_ConnConnect      = "connconnect"
-	Command_ConnDisconnect   = "conndisconnect"
-	Command_ConnList         = "connlist"
-	Command_WslList          = "wsllist"
-	Command_WslDefaultDistro = "wsldefaultdistro"
-	Command_DismissWshFail   = "dismisswshfail"
+	Command_HistorySearch        = "historysearch"
+	Command_HistoryClear         = "historyclear"
+	Command_SearchBlockFiles     = "searchblockfiles"
+	Command_FocusBlock           = "focusblock"
+	Command_StorageReport        = "storagereport"
+	Command_RpcTrace             = "rpctrace"
+	Command_WshRpcListCommands   = "wshrpclistcommands"
+
+	Command_ConnStatus        = "connstatus"
+	Command_WslStatus         = "wslstatus"
+	Command_ConnEnsure        = "connensure"
+	Command_ConnReinstallWsh  = "connreinstallwsh"
+	Command_ConnConnect       = "connconnect"
+	Command_ConnDisconnect    = "conndisconnect"
+	Command_ConnList          = "connlist"
+	Command_WslList           = "wsllist"
+	Command_WslDefaultDistro  = "wsldefaultdistro"
+	Command_DismissWshFail    = "dismisswshfail"
+	Command_ConnForwardAdd    = "connforwardadd"
+	Command_ConnForwardList   = "connforwardlist"
+	Command_ConnForwardRemove = "connforwardremove"
 
 	Command_WorkspaceList = "workspacelist"
 
@@ -130,6 +146,10 @@ type WshRpcInterface interface {
 	FileAppendIJsonCommand(ctx context.Context, data CommandAppendIJsonData) error
 	FileWriteCommand(ctx context.Context, data CommandFileData) error
 	FileReadCommand(ctx context.Context, data CommandFileData) (string, error)
+	FileStreamCommand(ctx context.Context, data CommandFileStreamData) chan RespOrErrorUnion[FileStreamRtnData]
+	FileIJsonLogCommand(ctx context.Context, data CommandFileData) ([]ijson.Command, error)
+	FileIJsonAtCommand(ctx context.Context, data CommandFileIJsonAtData) (*FileIJsonAtRtnData, error)
+	FileIJsonUndoCommand(ctx context.Context, data CommandFileIJsonUndoData) (int, error)
 	FileInfoCommand(ctx context.Context, data CommandFileData) (*WaveFileInfo, error)
 	FileListCommand(ctx context.Context, data CommandFileListData) ([]*WaveFileInfo, error)
 	EventPublishCommand(ctx context.Context, data wps.WaveEvent) error
@@ -150,6 +170,13 @@ type WshRpcInterface interface {
 	GetVarCommand(ctx context.Context, data CommandVarData) (*CommandVarResponseData, error)
 	SetVarCommand(ctx context.Context, data CommandVarData) error
 	PathCommand(ctx context.Context, data PathCommandData) (string, error)
+	HistorySearchCommand(ctx context.Context, data CommandHistorySearchData) ([]*HistoryItem, error)
+	HistoryClearCommand(ctx context.Context, data CommandHistoryClearData) error
+	SearchBlockFilesCommand(ctx context.Context, data CommandSearchBlockFilesData) ([]*BlockFileSearchMatch, error)
+	FocusBlockCommand(ctx context.Context, blockId string) error
+	StorageReportCommand(ctx context.Context, data CommandStorageReportData) (*StorageReportData, error)
+	RpcTraceCommand(ctx context.Context, data CommandRpcTraceData) chan RespOrErrorUnion[RpcTraceEntry]
+	WshRpcListCommandsCommand(ctx context.Context) ([]WshRpcCommandInfo, error)
 
 	// connection functions
 	ConnStatusCommand(ctx context.Context) ([]ConnStatus, error)
@@ -162,6 +189,9 @@ type WshRpcInterface interface {
 	WslListCommand(ctx context.Context) ([]string, error)
 	WslDefaultDistroCommand(ctx context.Context) (string, error)
 	DismissWshFailCommand(ctx context.Context, connName string) error
+	ConnForwardAddCommand(ctx context.Context, data CommandConnForwardAddData) (*ConnForward, error)
+	ConnForwardListCommand(ctx context.Context, connName string) ([]ConnForward, error)
+	ConnForwardRemoveCommand(ctx context.Context, data CommandConnForwardRemoveData) error
 
 	// eventrecv is special, it's handled internally by WshRpc with EventListener
 	EventRecvCommand(ctx context.Context, data wps.WaveEvent) error
@@ -216,10 +246,38 @@ const (
 )
 
 type RpcContext struct {
-	ClientType string `json:"ctype,omitempty"`
-	BlockId    string `json:"blockid,omitempty"`
-	TabId      string `json:"tabid,omitempty"`
-	Conn       string `json:"conn,omitempty"`
+	ClientType string    `json:"ctype,omitempty"`
+	BlockId    string    `json:"blockid,omitempty"`
+	TabId      string    `json:"tabid,omitempty"`
+	Conn       string    `json:"conn,omitempty"`
+	Scope      *WshScope `json:"scope,omitempty"` // nil means unrestricted
+}
+
+// errors lose their type when they cross an rpc boundary, these sentinels are restored on the caller side (so errors.Is works)
+// their messages start with an "EC-" code, so they are not matched by accident
+var remoteSentinelErrors = []error{filestore.ErrQuotaExceeded}
+
+type RemoteError struct {
+	Msg      string
+	Sentinel error
+}
+
+func (e *RemoteError) Error() string {
+	return e.Msg
+}
+
+func (e *RemoteError) Unwrap() error {
+	return e.Sentinel
+}
+
+// converts an error message from an rpc response back into an error
+func MakeRemoteError(msg string) error {
+	for _, sentinel := range remoteSentinelErrors {
+		if strings.Contains(msg, sentinel.Error()) {
+			return &RemoteError{Msg: msg, Sentinel: sentinel}
+		}
+	}
+	return errors.New(msg)
 }
 
 func HackRpcContextIntoData(dataPtr any, rpcContext RpcContext) {
@@ -330,11 +388,28 @@ type CommandFileData struct {
 	At       *CommandFileDataAt `json:"at,omitempty"` // if set, this turns read/write ops to ReadAt/WriteAt ops (len is only used for ReadAt)
 }
 
+type CommandFileStreamData struct {
+	ZoneId   string `json:"zoneid" wshcontext:"BlockId"`
+	FileName string `json:"filename"`
+	Offset   int64  `json:"offset,omitempty"`
+	FromEnd  int64  `json:"fromend,omitempty"` // if set, starts this many bytes before the end of the file (Offset is ignored)
+	Follow   bool   `json:"follow,omitempty"`  // keep streaming appends until the request is canceled (or the file is deleted)
+}
+
+// exactly one of Data64, SkipSize, or Truncated is set
+type FileStreamRtnData struct {
+	Offset    int64  `json:"offset"`
+	Data64    string `json:"data64,omitempty"`
+	SkipSize  int64  `json:"skipsize,omitempty"`  // bytes at Offset that were overwritten (circular file wrapped) before they could be read
+	Truncated bool   `json:"truncated,omitempty"` // the file was truncated or rewritten, the stream restarts at offset 0
+}
+
 type WaveFileInfo struct {
 	ZoneId    string                 `json:"zoneid"`
 	Name      string                 `json:"name"`
 	Opts      filestore.FileOptsType `json:"opts,omitempty"`
 	Size      int64                  `json:"size,omitempty"`
+	DiskSize  int64                  `json:"disksize,omitempty"` // only set by FileInfoCommand
 	CreatedTs int64                  `json:"createdts,omitempty"`
 	ModTs     int64                  `json:"modts,omitempty"`
 	Meta      map[string]any         `json:"meta,omitempty"`
@@ -362,6 +437,26 @@ type CommandAppendIJsonData struct {
 	Data     ijson.Command `json:"data"`
 }
 
+// exactly one of Idx or Ts should be set
+type CommandFileIJsonAtData struct {
+	ZoneId   string `json:"zoneid" wshcontext:"BlockId"`
+	FileName string `json:"filename"`
+	Idx      int    `json:"idx,omitempty"` // state as of this command
+	Ts       int64  `json:"ts,omitempty"`  // state as of the last command written at or before this time (unixmilli)
+}
+
+type FileIJsonAtRtnData struct {
+	Idx  int   `json:"idx"` // the last command applied
+	Ts   int64 `json:"ts"`
+	Data any   `json:"data"`
+}
+
+type CommandFileIJsonUndoData struct {
+	ZoneId   string `json:"zoneid" wshcontext:"BlockId"`
+	FileName string `json:"filename"`
+	Count    int    `json:"count"`
+}
+
 type CommandWaitForRouteData struct {
 	RouteId string `json:"routeid"`
 	WaitMs  int    `json:"waitms"`
@@ -375,6 +470,8 @@ type CommandEventReadHistoryData struct {
 	Event    string `json:"event"`
 	Scope    string `json:"scope"`
 	MaxItems int    `json:"maxitems"`
+	StartTs  int64  `json:"startts,omitempty"` // only events with startts <= ts < endts (unixmilli, 0 is unbounded)
+	EndTs    int64  `json:"endts,omitempty"`
 }
 
 type OpenAiStreamRequest struct {
@@ -461,6 +558,7 @@ type CommandRemoteWriteFileData struct {
 type ConnKeywords struct {
 	ConnWshEnabled          *bool `json:"conn:wshenabled,omitempty"`
 	ConnAskBeforeWshInstall *bool `json:"conn:askbeforewshinstall,omitempty"`
+	ConnAutoReconnect       *bool `json:"conn:autoreconnect,omitempty"`
 
 	DisplayHidden *bool   `json:"display:hidden,omitempty"`
 	DisplayOrder  float32 `json:"display:order,omitempty"`
@@ -474,6 +572,7 @@ type ConnKeywords struct {
 	SshHostName                     string   `json:"ssh:hostname,omitempty"`
 	SshPort                         string   `json:"ssh:port,omitempty"`
 	SshIdentityFile                 []string `json:"ssh:identityfile,omitempty"`
+	SshCertificateFile              []string `json:"ssh:certificatefile,omitempty"`
 	SshBatchMode                    bool     `json:"ssh:batchmode,omitempty"`
 	SshPubkeyAuthentication         bool     `json:"ssh:pubkeyauthentication,omitempty"`
 	SshPasswordAuthentication       bool     `json:"ssh:passwordauthentication,omitempty"`
@@ -481,9 +580,16 @@ type ConnKeywords struct {
 	SshPreferredAuthentications     []string `json:"ssh:preferredauthentications,omitempty"`
 	SshAddKeysToAgent               bool     `json:"ssh:addkeystoagent,omitempty"`
 	SshIdentityAgent                string   `json:"ssh:identityagent,omitempty"`
+	SshForwardAgent                 *bool    `json:"ssh:forwardagent,omitempty"`
 	SshProxyJump                    []string `json:"ssh:proxyjump,omitempty"`
+	SshProxyCommand                 string   `json:"ssh:proxycommand,omitempty"`
 	SshUserKnownHostsFile           []string `json:"ssh:userknownhostsfile,omitempty"`
 	SshGlobalKnownHostsFile         []string `json:"ssh:globalknownhostsfile,omitempty"`
+	SshLocalForward                 []string `json:"ssh:localforward,omitempty"`
+	SshRemoteForward                []string `json:"ssh:remoteforward,omitempty"`
+	SshDynamicForward               []string `json:"ssh:dynamicforward,omitempty"`
+	SshServerAliveInterval          *int     `json:"ssh:serveraliveinterval,omitempty"`
+	SshServerAliveCountMax          *int     `json:"ssh:serveralivecountmax,omitempty"`
 }
 
 type ConnRequest struct {
@@ -525,14 +631,49 @@ type ConnConfigRequest struct {
 }
 
 type ConnStatus struct {
-	Status        string `json:"status"`
-	WshEnabled    bool   `json:"wshenabled"`
-	Connection    string `json:"connection"`
-	Connected     bool   `json:"connected"`
-	HasConnected  bool   `json:"hasconnected"` // true if it has *ever* connected successfully
-	ActiveConnNum int    `json:"activeconnnum"`
-	Error         string `json:"error,omitempty"`
-	WshError      string `json:"wsherror,omitempty"`
+	Status        string        `json:"status"`
+	WshEnabled    bool          `json:"wshenabled"`
+	Connection    string        `json:"connection"`
+	Connected     bool          `json:"connected"`
+	HasConnected  bool          `json:"hasconnected"` // true if it has *ever* connected successfully
+	ActiveConnNum int           `json:"activeconnnum"`
+	Error         string        `json:"error,omitempty"`
+	WshError      string        `json:"wsherror,omitempty"`
+	Forwards      []ConnForward `json:"forwards,omitempty"`
+}
+
+const (
+	ConnForwardType_Local   = "local"
+	ConnForwardType_Remote  = "remote"
+	ConnForwardType_Dynamic = "dynamic"
+)
+
+const (
+	ConnForwardStatus_Active = "active"
+	ConnForwardStatus_Error  = "error"
+)
+
+type ConnForward struct {
+	ForwardId  string `json:"forwardid"`
+	Type       string `json:"type"`
+	Spec       string `json:"spec"`
+	BindAddr   string `json:"bindaddr"`
+	TargetAddr string `json:"targetaddr,omitempty"` // not set for dynamic forwards
+	FromConfig bool   `json:"fromconfig,omitempty"`
+	Status     string `json:"status"`
+	Error      string `json:"error,omitempty"`
+	NumConns   int    `json:"numconns"`
+}
+
+type CommandConnForwardAddData struct {
+	ConnName string `json:"connname"`
+	Type     string `json:"type"`
+	Spec     string `json:"spec"` // same format as ssh -L/-R/-D (e.g. "8080:localhost:80")
+}
+
+type CommandConnForwardRemoveData struct {
+	ConnName  string `json:"connname"`
+	ForwardId string `json:"forwardid"`
 }
 
 type WebSelectorOpts struct {
@@ -613,6 +754,105 @@ type PathCommandData struct {
 	TabId        string `json:"tabid" wshcontext:"TabId"`
 }
 
+const (
+	HistoryExitStatus_Success = "success"
+	HistoryExitStatus_Failed  = "failed"
+)
+
+// a finished shell command (tracked with shell integration markers)
+// StartOffset and EndOffset are offsets into the block's "term" file
+type HistoryItem struct {
+	HistoryId   string `json:"historyid"`
+	Ts          int64  `json:"ts"`
+	BlockId     string `json:"blockid"`
+	TabId       string `json:"tabid"`
+	Connection  string `json:"connection"`
+	Cwd         string `json:"cwd"`
+	CmdStr      string `json:"cmdstr"`
+	ExitCode    *int   `json:"exitcode,omitempty"`
+	DurationMs  int64  `json:"durationms"`
+	StartOffset int64  `json:"startoffset"`
+	EndOffset   int64  `json:"endoffset"`
+}
+
+type CommandHistorySearchData struct {
+	Query      string `json:"query,omitempty"`
+	Connection string `json:"connection,omitempty"`
+	BlockId    string `json:"blockid,omitempty"`
+	ExitStatus string `json:"exitstatus,omitempty"` // "success", "failed", or "" (all)
+	Since      int64  `json:"since,omitempty"`
+	Limit      int    `json:"limit,omitempty"`
+}
+
+type CommandHistoryClearData struct {
+	BlockId string `json:"blockid,omitempty"` // if empty, clears all history
+}
+
+// BlockIds, TabId, and WorkspaceId are combined (a block matches if it is in any of them)
+type CommandSearchBlockFilesData struct {
+	Query        string   `json:"query"`
+	BlockIds     []string `json:"blockids,omitempty"`
+	TabId        string   `json:"tabid,omitempty"`
+	WorkspaceId  string   `json:"workspaceid,omitempty"`
+	Connection   string   `json:"connection,omitempty"`
+	Since        int64    `json:"since,omitempty"`
+	ContextLines int      `json:"contextlines,omitempty"`
+	Limit        int      `json:"limit,omitempty"`
+}
+
+// Offset is the offset of the indexed chunk (in the block file) that contains the match
+type BlockFileSearchMatch struct {
+	BlockId    string   `json:"blockid"`
+	FileName   string   `json:"filename"`
+	Offset     int64    `json:"offset"`
+	Ts         int64    `json:"ts"`
+	Connection string   `json:"connection,omitempty"`
+	Line       string   `json:"line"`
+	Before     []string `json:"before,omitempty"`
+	After      []string `json:"after,omitempty"`
+}
+
+type CommandStorageReportData struct {
+	GC bool `json:"gc,omitempty"` // delete orphan zones (and vacuum) before reporting
+}
+
+type StorageFileUsage struct {
+	Name     string `json:"name"`
+	Size     int64  `json:"size"`
+	DiskSize int64  `json:"disksize"`
+}
+
+// OType is the type of the object that owns the zone (empty for orphan zones)
+type StorageZoneUsage struct {
+	ZoneId   string             `json:"zoneid"`
+	OType    string             `json:"otype,omitempty"`
+	Orphan   bool               `json:"orphan,omitempty"`
+	Size     int64              `json:"size"`
+	DiskSize int64              `json:"disksize"`
+	Files    []StorageFileUsage `json:"files"`
+}
+
+type StorageGCResult struct {
+	Ts             int64 `json:"ts"`
+	NumZones       int   `json:"numzones"`
+	NumOrphans     int   `json:"numorphans"`
+	NumFiles       int   `json:"numfiles"`
+	ReclaimedBytes int64 `json:"reclaimedbytes"` // disk size of the deleted files
+	VacuumBytes    int64 `json:"vacuumbytes"`    // bytes the filestore db shrank by
+}
+
+type StorageReportData struct {
+	Backend        string             `json:"backend"`
+	DBFileSize     int64              `json:"dbfilesize"`
+	DBFreeBytes    int64              `json:"dbfreebytes"`
+	Size           int64              `json:"size"`
+	DiskSize       int64              `json:"disksize"`
+	NumOrphans     int                `json:"numorphans"`
+	OrphanDiskSize int64              `json:"orphandisksize"`
+	Zones          []StorageZoneUsage `json:"zones"`
+	LastGC         *StorageGCResult   `json:"lastgc,omitempty"`
+}
+
 type ActivityDisplayType struct {
 	Width    int     `json:"width"`
 	Height   int     `json:"height"`
@@ -645,3 +885,37 @@ type ActivityUpdate struct {
 	WshCmds       map[string]int        `json:"wshcmds,omitempty"`
 	Conn          map[string]int        `json:"conn,omitempty"`
 }
+
+// Command and Route filter the trace (Route matches the route, source, or the route the message came from)
+type CommandRpcTraceData struct {
+	Command string `json:"command,omitempty"`
+	Route   string `json:"route,omitempty"`
+	History bool   `json:"history,omitempty"` // send the buffered entries before following
+}
+
+// one message seen by a router, responses get their Command from the request they answer
+type RpcTraceEntry struct {
+	Ts        int64  `json:"ts"`
+	Router    string `json:"router"`
+	Command   string `json:"command,omitempty"`
+	ReqId     string `json:"reqid,omitempty"`
+	ResId     string `json:"resid,omitempty"`
+	Source    string `json:"source,omitempty"`
+	Route     string `json:"route,omitempty"`
+	FromRoute string `json:"fromroute,omitempty"`
+	Size      int    `json:"size"`
+	LatencyUs int64  `json:"latencyus,omitempty"` // for responses, time since the request passed through this router
+	Cont      bool   `json:"cont,omitempty"`
+	Error     string `json:"error,omitempty"`
+	Dropped   int    `json:"dropped,omitempty"` // entries dropped (before this one) because the reader fell behind
+}
+
+// schemas are json schemas (with their struct types in "$defs"), nil when the command has no data or response
+type WshRpcCommandInfo struct {
+	Command        string         `json:"command"`
+	CommandType    string         `json:"commandtype"`
+	DataType       string         `json:"datatype,omitempty"`
+	DataSchema     map[string]any `json:"dataschema,omitempty"`
+	ResponseType   string         `json:"responsetype,omitempty"`
+	ResponseSchema map[string]any `json:"responseschema,omitempty"`
+}
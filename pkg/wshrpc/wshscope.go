@@ -0,0 +1,195 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshrpc
+
+// capability scopes for wsh clients
+// a scope is embedded in the client's jwt (set from the "cmd:wshscope" block meta) and limits which
+// commands the client can run (by group) and which objects they can act on (the target)
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	CommandGroup_Base    = "base"    // always allowed (authentication, routing, messages)
+	CommandGroup_Read    = "read"    // read blocks, files, vars, events, and remote files
+	CommandGroup_Write   = "write"   // modify block meta, files, vars, and remote files
+	CommandGroup_Publish = "publish" // publish events
+	CommandGroup_Block   = "block"   // create, delete, focus, and send input to blocks, notifications, ai, and vdom
+	CommandGroup_Config  = "config"  // change settings and connections config, clear history
+	CommandGroup_Conn    = "conn"    // connect, disconnect, and manage connections
+	CommandGroup_Admin   = "admin"   // debugging commands (also the group for commands that are not listed)
+)
+
+const (
+	ScopeTarget_Block = "block" // only the client's own block
+	ScopeTarget_Tab   = "tab"   // the client's own tab and the blocks in it
+	ScopeTarget_Any   = "any"
+)
+
+var CommandGroups = map[string]string{
+	"authenticate":     CommandGroup_Base,
+	"dispose":          CommandGroup_Base,
+	"routeannounce":    CommandGroup_Base,
+	"routeunannounce":  CommandGroup_Base,
+	"message":          CommandGroup_Base,
+	"eventrecv":        CommandGroup_Base,
+	"wshactivity":      CommandGroup_Base,
+	"activity":         CommandGroup_Base,
+	"waveinfo":         CommandGroup_Base,
+	"resolveids":       CommandGroup_Base,
+	"waitforroute":     CommandGroup_Base,
+	"getupdatechannel": CommandGroup_Base,
+
+	"getmeta":             CommandGroup_Read,
+	"blockinfo":           CommandGroup_Read,
+	"fileread":            CommandGroup_Read,
+	"filestream":          CommandGroup_Read,
+	"fileinfo":            CommandGroup_Read,
+	"filelist":            CommandGroup_Read,
+	"fileijsonlog":        CommandGroup_Read,
+	"fileijsonat":         CommandGroup_Read,
+	"getvar":              CommandGroup_Read,
+	"path":                CommandGroup_Read,
+	"historysearch":       CommandGroup_Read,
+	"searchblockfiles":    CommandGroup_Read,
+	"eventsub":            CommandGroup_Read,
+	"eventunsub":          CommandGroup_Read,
+	"eventunsuball":       CommandGroup_Read,
+	"eventreadhistory":    CommandGroup_Read,
+	"streamcpudata":       CommandGroup_Read,
+	"connstatus":          CommandGroup_Read,
+	"wslstatus":           CommandGroup_Read,
+	"connlist":            CommandGroup_Read,
+	"wsllist":             CommandGroup_Read,
+	"wsldefaultdistro":    CommandGroup_Read,
+	"connforwardlist":     CommandGroup_Read,
+	"workspacelist":       CommandGroup_Read,
+	"remotestreamfile":    CommandGroup_Read,
+	"remotefileinfo":      CommandGroup_Read,
+	"remotefilejoin":      CommandGroup_Read,
+	"remotestreamcpudata": CommandGroup_Read,
+	"wshrpclistcommands":  CommandGroup_Read,
+
+	"setmeta":          CommandGroup_Write,
+	"filecreate":       CommandGroup_Write,
+	"filedelete":       CommandGroup_Write,
+	"fileappend":       CommandGroup_Write,
+	"fileappendijson":  CommandGroup_Write,
+	"filewrite":        CommandGroup_Write,
+	"fileijsonundo":    CommandGroup_Write,
+	"setvar":           CommandGroup_Write,
+	"remotefiletouch":  CommandGroup_Write,
+	"remotefilerename": CommandGroup_Write,
+	"remotefiledelete": CommandGroup_Write,
+	"remotewritefile":  CommandGroup_Write,
+	"remotemkdir":      CommandGroup_Write,
+
+	"eventpublish": CommandGroup_Publish,
+
+	"createblock":         CommandGroup_Block,
+	"createsubblock":      CommandGroup_Block,
+	"deleteblock":         CommandGroup_Block,
+	"deletesubblock":      CommandGroup_Block,
+	"setview":             CommandGroup_Block,
+	"focusblock":          CommandGroup_Block,
+	"controllerinput":     CommandGroup_Block,
+	"controllerstop":      CommandGroup_Block,
+	"controllerresync":    CommandGroup_Block,
+	"webselector":         CommandGroup_Block,
+	"notify":              CommandGroup_Block,
+	"focuswindow":         CommandGroup_Block,
+	"streamwaveai":        CommandGroup_Block,
+	"aisendmessage":       CommandGroup_Block,
+	"vdomcreatecontext":   CommandGroup_Block,
+	"vdomasyncinitiation": CommandGroup_Block,
+	"vdomrender":          CommandGroup_Block,
+	"vdomurlrequest":      CommandGroup_Block,
+
+	"setconfig":            CommandGroup_Config,
+	"setconnectionsconfig": CommandGroup_Config,
+	"historyclear":         CommandGroup_Config,
+
+	"connensure":        CommandGroup_Conn,
+	"connreinstallwsh":  CommandGroup_Conn,
+	"connconnect":       CommandGroup_Conn,
+	"conndisconnect":    CommandGroup_Conn,
+	"dismisswshfail":    CommandGroup_Conn,
+	"connforwardadd":    CommandGroup_Conn,
+	"connforwardremove": CommandGroup_Conn,
+}
+
+var allCommandGroups = []string{CommandGroup_Read, CommandGroup_Write, CommandGroup_Publish, CommandGroup_Block, CommandGroup_Config, CommandGroup_Conn, CommandGroup_Admin}
+
+// presets for "cmd:wshscope", the block and config groups are not included since they can be used
+// to create (or reconfigure) blocks that are not restricted
+var WshScopePresets = map[string]*WshScope{
+	"readonly": {Groups: []string{CommandGroup_Read}, Target: ScopeTarget_Tab},
+	"block":    {Groups: []string{CommandGroup_Read, CommandGroup_Write, CommandGroup_Publish}, Target: ScopeTarget_Block},
+	"tab":      {Groups: []string{CommandGroup_Read, CommandGroup_Write, CommandGroup_Publish}, Target: ScopeTarget_Tab},
+}
+
+// nil means unrestricted
+type WshScope struct {
+	Groups []string `json:"groups"`
+	Target string   `json:"target"`
+}
+
+func GetCommandGroup(command string) string {
+	if group, ok := CommandGroups[command]; ok {
+		return group
+	}
+	return CommandGroup_Admin
+}
+
+func (s *WshScope) AllowsGroup(group string) bool {
+	if s == nil || group == CommandGroup_Base {
+		return true
+	}
+	for _, g := range s.Groups {
+		if g == group {
+			return true
+		}
+	}
+	return false
+}
+
+// accepts a preset name ("readonly", "block", "tab"), "full" (or "") for unrestricted,
+// or a list of groups with an optional target like "read,publish@tab" (the target defaults to "block")
+func ParseWshScope(scopeStr string) (*WshScope, error) {
+	scopeStr = strings.TrimSpace(scopeStr)
+	if scopeStr == "" || scopeStr == "full" {
+		return nil, nil
+	}
+	if preset, ok := WshScopePresets[scopeStr]; ok {
+		return &WshScope{Groups: append([]string{}, preset.Groups...), Target: preset.Target}, nil
+	}
+	groupsStr, target, hasTarget := strings.Cut(scopeStr, "@")
+	if !hasTarget {
+		target = ScopeTarget_Block
+	}
+	if target != ScopeTarget_Block && target != ScopeTarget_Tab && target != ScopeTarget_Any {
+		return nil, fmt.Errorf("invalid wsh scope target %q (must be block, tab, or any)", target)
+	}
+	scope := &WshScope{Target: target}
+	for _, group := range strings.Split(groupsStr, ",") {
+		group = strings.TrimSpace(group)
+		if group == "" || group == CommandGroup_Base {
+			continue
+		}
+		found := false
+		for _, g := range allCommandGroups {
+			if g == group {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("invalid wsh scope group %q", group)
+		}
+		scope.Groups = append(scope.Groups, group)
+	}
+	return scope, nil
+}
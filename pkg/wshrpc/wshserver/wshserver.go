@@ -19,11 +19,14 @@ import (
 
 	"github.com/skratchdot/open-golang/open"
 	"github.com/wavetermdev/waveterm/pkg/blockcontroller"
+	"github.com/wavetermdev/waveterm/pkg/cmdhistory"
 	"github.com/wavetermdev/waveterm/pkg/filestore"
+	"github.com/wavetermdev/waveterm/pkg/ijson"
 	"github.com/wavetermdev/waveterm/pkg/panichandler"
 	"github.com/wavetermdev/waveterm/pkg/remote"
 	"github.com/wavetermdev/waveterm/pkg/remote/conncontroller"
 	"github.com/wavetermdev/waveterm/pkg/telemetry"
+	"github.com/wavetermdev/waveterm/pkg/termsearch"
 	"github.com/wavetermdev/waveterm/pkg/util/envutil"
 	"github.com/wavetermdev/waveterm/pkg/util/utilfn"
 	"github.com/wavetermdev/waveterm/pkg/waveai"
@@ -314,7 +317,12 @@ func (ws *WshServer) FileInfoCommand(ctx context.Context, data wshrpc.CommandFil
 		}
 		return nil, fmt.Errorf("error getting file info: %w", err)
 	}
-	return waveFileToWaveFileInfo(fileInfo), nil
+	rtn := waveFileToWaveFileInfo(fileInfo)
+	rtn.DiskSize, err = filestore.WFS.DiskSize(ctx, data.ZoneId, data.FileName)
+	if err != nil {
+		return nil, fmt.Errorf("error getting file disk size: %w", err)
+	}
+	return rtn, nil
 }
 
 func (ws *WshServer) FileListCommand(ctx context.Context, data wshrpc.CommandFileListData) ([]*wshrpc.WaveFileInfo, error) {
@@ -437,6 +445,38 @@ func (ws *WshServer) FileReadCommand(ctx context.Context, data wshrpc.CommandFil
 	}
 }
 
+func (ws *WshServer) FileStreamCommand(ctx context.Context, data wshrpc.CommandFileStreamData) chan wshrpc.RespOrErrorUnion[wshrpc.FileStreamRtnData] {
+	rtn := make(chan wshrpc.RespOrErrorUnion[wshrpc.FileStreamRtnData])
+	go func() {
+		defer panichandler.PanicHandler("FileStreamCommand")
+		defer close(rtn)
+		opts := filestore.StreamOpts{Offset: data.Offset, FromEnd: data.FromEnd, Follow: data.Follow}
+		err := filestore.WFS.StreamFile(ctx, data.ZoneId, data.FileName, opts, func(chunk filestore.StreamChunk) error {
+			resp := wshrpc.FileStreamRtnData{Offset: chunk.Offset, SkipSize: chunk.SkipSize, Truncated: chunk.Truncated}
+			if len(chunk.Data) > 0 {
+				resp.Data64 = base64.StdEncoding.EncodeToString(chunk.Data)
+			}
+			select {
+			case rtn <- wshrpc.RespOrErrorUnion[wshrpc.FileStreamRtnData]{Response: resp}:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+		if err == nil || ctx.Err() != nil {
+			// canceled (or timed out) streams just end
+			return
+		}
+		if err == fs.ErrNotExist {
+			err = fmt.Errorf("NOTFOUND: %w", err)
+		} else {
+			err = fmt.Errorf("error streaming blockfile: %w", err)
+		}
+		rtn <- wshrpc.RespOrErrorUnion[wshrpc.FileStreamRtnData]{Error: err}
+	}()
+	return rtn
+}
+
 func (ws *WshServer) FileAppendCommand(ctx context.Context, data wshrpc.CommandFileData) error {
 	dataBuf, err := base64.StdEncoding.DecodeString(data.Data64)
 	if err != nil {
@@ -465,7 +505,7 @@ func (ws *WshServer) FileAppendCommand(ctx context.Context, data wshrpc.CommandF
 func (ws *WshServer) FileAppendIJsonCommand(ctx context.Context, data wshrpc.CommandAppendIJsonData) error {
 	tryCreate := true
 	if data.FileName == blockcontroller.BlockFile_VDom && tryCreate {
-		err := filestore.WFS.MakeFile(ctx, data.ZoneId, data.FileName, nil, filestore.FileOptsType{MaxSize: blockcontroller.DefaultHtmlMaxFileSize, IJson: true})
+		err := filestore.WFS.MakeFile(ctx, data.ZoneId, data.FileName, nil, filestore.FileOptsType{MaxSize: blockcontroller.DefaultHtmlMaxFileSize, IJson: true, IJsonHistory: blockcontroller.DefaultIJsonHistory})
 		if err != nil && err != fs.ErrExist {
 			return fmt.Errorf("error creating blockfile[vdom]: %w", err)
 		}
@@ -487,6 +527,52 @@ func (ws *WshServer) FileAppendIJsonCommand(ctx context.Context, data wshrpc.Com
 	return nil
 }
 
+func (ws *WshServer) FileIJsonLogCommand(ctx context.Context, data wshrpc.CommandFileData) ([]ijson.Command, error) {
+	commands, err := filestore.WFS.ReadIJsonLog(ctx, data.ZoneId, data.FileName)
+	if err == fs.ErrNotExist {
+		return nil, fmt.Errorf("NOTFOUND: %w", err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading blockfile(ijson): %w", err)
+	}
+	return commands, nil
+}
+
+func (ws *WshServer) FileIJsonAtCommand(ctx context.Context, data wshrpc.CommandFileIJsonAtData) (*wshrpc.FileIJsonAtRtnData, error) {
+	state, lastCmd, err := filestore.WFS.ReadIJsonAt(ctx, data.ZoneId, data.FileName, data.Idx, data.Ts)
+	if err == fs.ErrNotExist {
+		return nil, fmt.Errorf("NOTFOUND: %w", err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading blockfile(ijson): %w", err)
+	}
+	return &wshrpc.FileIJsonAtRtnData{
+		Idx:  ijson.GetCommandIdx(lastCmd),
+		Ts:   ijson.GetCommandTs(lastCmd),
+		Data: state,
+	}, nil
+}
+
+func (ws *WshServer) FileIJsonUndoCommand(ctx context.Context, data wshrpc.CommandFileIJsonUndoData) (int, error) {
+	lastIdx, err := filestore.WFS.UndoIJson(ctx, data.ZoneId, data.FileName, data.Count)
+	if err == fs.ErrNotExist {
+		return 0, fmt.Errorf("NOTFOUND: %w", err)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("error undoing blockfile(ijson): %w", err)
+	}
+	wps.Broker.Publish(wps.WaveEvent{
+		Event:  wps.Event_BlockFile,
+		Scopes: []string{waveobj.MakeORef(waveobj.OType_Block, data.ZoneId).String()},
+		Data: &wps.WSFileEventData{
+			ZoneId:   data.ZoneId,
+			FileName: data.FileName,
+			FileOp:   wps.FileOp_Invalidate,
+		},
+	})
+	return lastIdx, nil
+}
+
 func (ws *WshServer) DeleteSubBlockCommand(ctx context.Context, data wshrpc.CommandDeleteBlockData) error {
 	err := wcore.DeleteBlock(ctx, data.BlockId, false)
 	if err != nil {
@@ -545,8 +631,7 @@ func (ws *WshServer) EventSubCommand(ctx context.Context, data wps.SubscriptionR
 	if rpcSource == "" {
 		return fmt.Errorf("no rpc source set")
 	}
-	wps.Broker.Subscribe(rpcSource, data)
-	return nil
+	return wps.Broker.Subscribe(rpcSource, data)
 }
 
 func (ws *WshServer) EventUnsubCommand(ctx context.Context, data string) error {
@@ -568,7 +653,7 @@ func (ws *WshServer) EventUnsubAllCommand(ctx context.Context) error {
 }
 
 func (ws *WshServer) EventReadHistoryCommand(ctx context.Context, data wshrpc.CommandEventReadHistoryData) ([]*wps.WaveEvent, error) {
-	events := wps.Broker.ReadEventHistory(data.Event, data.Scope, data.MaxItems)
+	events := wps.Broker.ReadEventHistoryRange(data.Event, data.Scope, data.StartTs, data.EndTs, data.MaxItems)
 	return events, nil
 }
 
@@ -597,6 +682,9 @@ func (ws *WshServer) ConnEnsureCommand(ctx context.Context, connName string) err
 		distroName := strings.TrimPrefix(connName, "wsl://")
 		return wsl.EnsureConnection(ctx, distroName)
 	}
+	if remote.IsExecConnName(connName) {
+		return conncontroller.EnsureExecConnection(ctx, connName)
+	}
 	return conncontroller.EnsureConnection(ctx, connName)
 }
 
@@ -609,6 +697,13 @@ func (ws *WshServer) ConnDisconnectCommand(ctx context.Context, connName string)
 		}
 		return conn.Close()
 	}
+	if remote.IsExecConnName(connName) {
+		conn, err := conncontroller.GetExecConn(ctx, connName, false)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
 	connOpts, err := remote.ParseOpts(connName)
 	if err != nil {
 		return fmt.Errorf("error parsing connection name: %w", err)
@@ -630,6 +725,13 @@ func (ws *WshServer) ConnConnectCommand(ctx context.Context, connRequest wshrpc.
 		}
 		return conn.Connect(ctx)
 	}
+	if remote.IsExecConnName(connName) {
+		conn, err := conncontroller.GetExecConn(ctx, connName, false)
+		if err != nil {
+			return err
+		}
+		return conn.Connect(ctx)
+	}
 	connOpts, err := remote.ParseOpts(connName)
 	if err != nil {
 		return fmt.Errorf("error parsing connection name: %w", err)
@@ -650,6 +752,13 @@ func (ws *WshServer) ConnReinstallWshCommand(ctx context.Context, connName strin
 		}
 		return conn.CheckAndInstallWsh(ctx, connName, &wsl.WshInstallOpts{Force: true, NoUserPrompt: true})
 	}
+	if remote.IsExecConnName(connName) {
+		conn, err := conncontroller.GetExecConn(ctx, connName, false)
+		if err != nil {
+			return err
+		}
+		return conn.CheckAndInstallWsh(ctx, connName, &conncontroller.WshInstallOpts{Force: true, NoUserPrompt: true})
+	}
 	connOpts, err := remote.ParseOpts(connName)
 	if err != nil {
 		return fmt.Errorf("error parsing connection name: %w", err)
@@ -696,6 +805,17 @@ func (ws *WshServer) WslDefaultDistroCommand(ctx context.Context) (string, error
  * Dismisses the WshFail Command in runtime memory on the backend
  */
 func (ws *WshServer) DismissWshFailCommand(ctx context.Context, connName string) error {
+	if remote.IsExecConnName(connName) {
+		conn, err := conncontroller.GetExecConn(ctx, connName, false)
+		if err != nil {
+			return err
+		}
+		conn.WithLock(func() {
+			conn.WshError = ""
+		})
+		conn.FireConnChangeEvent()
+		return nil
+	}
 	opts, err := remote.ParseOpts(connName)
 	if err != nil {
 		return err
@@ -711,6 +831,48 @@ func (ws *WshServer) DismissWshFailCommand(ctx context.Context, connName string)
 	return nil
 }
 
+func getSSHConnForForward(ctx context.Context, connName string) (*conncontroller.SSHConn, error) {
+	if strings.HasPrefix(connName, "wsl://") {
+		return nil, fmt.Errorf("port forwarding is not supported for wsl connections")
+	}
+	if remote.IsExecConnName(connName) {
+		return nil, fmt.Errorf("port forwarding is not supported for %q (only ssh connections)", connName)
+	}
+	connOpts, err := remote.ParseOpts(connName)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing connection name: %w", err)
+	}
+	conn := conncontroller.GetConn(ctx, connOpts, false, &wshrpc.ConnKeywords{})
+	if conn == nil {
+		return nil, fmt.Errorf("connection not found: %s", connName)
+	}
+	return conn, nil
+}
+
+func (ws *WshServer) ConnForwardAddCommand(ctx context.Context, data wshrpc.CommandConnForwardAddData) (*wshrpc.ConnForward, error) {
+	conn, err := getSSHConnForForward(ctx, data.ConnName)
+	if err != nil {
+		return nil, err
+	}
+	return conn.AddForward(data.Type, data.Spec)
+}
+
+func (ws *WshServer) ConnForwardListCommand(ctx context.Context, connName string) ([]wshrpc.ConnForward, error) {
+	conn, err := getSSHConnForForward(ctx, connName)
+	if err != nil {
+		return nil, err
+	}
+	return conn.ListForwards(), nil
+}
+
+func (ws *WshServer) ConnForwardRemoveCommand(ctx context.Context, data wshrpc.CommandConnForwardRemoveData) error {
+	conn, err := getSSHConnForForward(ctx, data.ConnName)
+	if err != nil {
+		return err
+	}
+	return conn.RemoveForward(data.ForwardId)
+}
+
 func (ws *WshServer) BlockInfoCommand(ctx context.Context, blockId string) (*wshrpc.BlockInfoData, error) {
 	blockData, err := wstore.DBMustGet[*waveobj.Block](ctx, blockId)
 	if err != nil {
@@ -833,6 +995,96 @@ func (ws *WshServer) SetVarCommand(ctx context.Context, data wshrpc.CommandVarDa
 	return filestore.WFS.WriteFile(ctx, data.ZoneId, data.FileName, []byte(envStr))
 }
 
+func (ws *WshServer) HistorySearchCommand(ctx context.Context, data wshrpc.CommandHistorySearchData) ([]*wshrpc.HistoryItem, error) {
+	items, err := cmdhistory.SearchHistory(ctx, data)
+	if err != nil {
+		return nil, fmt.Errorf("error searching history: %w", err)
+	}
+	return items, nil
+}
+
+func (ws *WshServer) HistoryClearCommand(ctx context.Context, data wshrpc.CommandHistoryClearData) error {
+	err := cmdhistory.ClearHistory(ctx, data.BlockId)
+	if err != nil {
+		return fmt.Errorf("error clearing history: %w", err)
+	}
+	return nil
+}
+
+func (ws *WshServer) SearchBlockFilesCommand(ctx context.Context, data wshrpc.CommandSearchBlockFilesData) ([]*wshrpc.BlockFileSearchMatch, error) {
+	blockIds, err := resolveSearchBlockIds(ctx, data)
+	if err != nil {
+		return nil, err
+	}
+	matches, err := termsearch.Search(ctx, data, blockIds)
+	if err != nil {
+		return nil, fmt.Errorf("error searching block files: %w", err)
+	}
+	return matches, nil
+}
+
+// returns nil if there are no block filters (search all blocks)
+func resolveSearchBlockIds(ctx context.Context, data wshrpc.CommandSearchBlockFilesData) ([]string, error) {
+	if len(data.BlockIds) == 0 && data.TabId == "" && data.WorkspaceId == "" {
+		return nil, nil
+	}
+	blockIds := []string{}
+	blockIds = append(blockIds, data.BlockIds...)
+	var tabIds []string
+	if data.TabId != "" {
+		tabIds = append(tabIds, data.TabId)
+	}
+	if data.WorkspaceId != "" {
+		workspace, err := wcore.GetWorkspace(ctx, data.WorkspaceId)
+		if err != nil {
+			return nil, fmt.Errorf("error getting workspace: %w", err)
+		}
+		tabIds = append(tabIds, workspace.PinnedTabIds...)
+		tabIds = append(tabIds, workspace.TabIds...)
+	}
+	for _, tabId := range tabIds {
+		tab, err := wstore.DBMustGet[*waveobj.Tab](ctx, tabId)
+		if err != nil {
+			return nil, fmt.Errorf("error getting tab: %w", err)
+		}
+		blockIds = append(blockIds, tab.BlockIds...)
+	}
+	return blockIds, nil
+}
+
+func (ws *WshServer) FocusBlockCommand(ctx context.Context, blockId string) error {
+	ctx = waveobj.ContextWithUpdates(ctx)
+	err := wcore.FocusBlock(ctx, blockId)
+	if err != nil {
+		return fmt.Errorf("error focusing block: %w", err)
+	}
+	updates := waveobj.ContextGetUpdatesRtn(ctx)
+	wps.Broker.SendUpdateEvents(updates)
+	return nil
+}
+
+func (ws *WshServer) StorageReportCommand(ctx context.Context, data wshrpc.CommandStorageReportData) (*wshrpc.StorageReportData, error) {
+	if data.GC {
+		_, err := wcore.CollectOrphanZones(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("error collecting orphan zones: %w", err)
+		}
+	}
+	report, err := wcore.GetStorageReport(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error getting storage report: %w", err)
+	}
+	return report, nil
+}
+
+func (ws *WshServer) RpcTraceCommand(ctx context.Context, data wshrpc.CommandRpcTraceData) chan wshrpc.RespOrErrorUnion[wshrpc.RpcTraceEntry] {
+	return wshutil.DefaultRouter.StreamRpcTrace(ctx, data)
+}
+
+func (ws *WshServer) WshRpcListCommandsCommand(ctx context.Context) ([]wshrpc.WshRpcCommandInfo, error) {
+	return wshrpc.GetWshRpcCommandInfo(), nil
+}
+
 func (ws *WshServer) PathCommand(ctx context.Context, data wshrpc.PathCommandData) (string, error) {
 	pathType := data.PathType
 	openInternal := data.Open
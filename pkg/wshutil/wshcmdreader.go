@@ -7,31 +7,70 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"log"
+	"strings"
 	"sync"
+	"time"
 )
 
 const (
-	Mode_Normal  = "normal"
-	Mode_Esc     = "esc"
-	Mode_WaveEsc = "waveesc"
+	Mode_Normal     = "normal"
+	Mode_Esc        = "esc"
+	Mode_WaveEsc    = "waveesc"
+	Mode_ShellEsc   = "shellesc"   // inside a shell integration OSC sequence (passed through to the output)
+	Mode_ShellEscST = "shellescst" // saw ESC inside a shell integration OSC sequence (waiting for '\')
 )
 
 const MaxBufferedDataSize = 256 * 1024
+const MaxShellEscSeqSize = 16 * 1024
+const DefaultShellChSize = 256
+
+// OSC numbers that are parsed for shell integration
+const (
+	ShellOSC_Cwd       = "7"   // current working directory (file://host/path)
+	ShellOSC_FinalTerm = "133" // FinalTerm prompt/command markers (A, B, C, D)
+)
+
+var ShellIntegrationOSCs = []string{ShellOSC_Cwd, ShellOSC_FinalTerm}
+
+// a shell integration escape sequence found in the pty output
+// Pos is the offset in the output stream where the sequence starts (the sequence itself is passed through)
+type ShellIntegrationMarker struct {
+	OSCNum string
+	Data   string
+	Pos    int64
+	Ts     int64
+}
 
 type PtyBuffer struct {
-	CVar        *sync.Cond
-	DataBuf     *bytes.Buffer
-	EscMode     string
-	EscSeqBuf   []byte
-	OSCPrefix   string
-	InputReader io.Reader
-	MessageCh   chan []byte
-	AtEOF       bool
-	Err         error
+	CVar           *sync.Cond
+	DataBuf        *bytes.Buffer
+	EscMode        string
+	EscSeqBuf      []byte
+	OSCPrefix      string
+	InputReader    io.Reader
+	MessageCh      chan []byte
+	ShellCh        chan ShellIntegrationMarker
+	ShellOSCNum    string
+	OutputPos      int64
+	DroppedMarkers int
+	AtEOF          bool
+	Err            error
 }
 
 // closes messageCh when input is closed (or error)
 func MakePtyBuffer(oscPrefix string, input io.Reader, messageCh chan []byte) *PtyBuffer {
+	return makePtyBufferInternal(oscPrefix, input, messageCh, nil)
+}
+
+// like MakePtyBuffer, but also parses shell integration sequences (OSC 133) and sends them to shellCh
+// shellCh should be buffered (DefaultShellChSize), markers are dropped when it is full so a slow consumer never blocks the pty output
+// closes both messageCh and shellCh when input is closed (or error)
+func MakeShellPtyBuffer(oscPrefix string, input io.Reader, messageCh chan []byte, shellCh chan ShellIntegrationMarker) *PtyBuffer {
+	return makePtyBufferInternal(oscPrefix, input, messageCh, shellCh)
+}
+
+func makePtyBufferInternal(oscPrefix string, input io.Reader, messageCh chan []byte, shellCh chan ShellIntegrationMarker) *PtyBuffer {
 	if len(oscPrefix) != WaveOSCPrefixLen {
 		panic(fmt.Sprintf("invalid OSC prefix length: %d", len(oscPrefix)))
 	}
@@ -42,6 +81,7 @@ func MakePtyBuffer(oscPrefix string, input io.Reader, messageCh chan []byte) *Pt
 		EscMode:     Mode_Normal,
 		InputReader: input,
 		MessageCh:   messageCh,
+		ShellCh:     shellCh,
 	}
 	go b.run()
 	return b
@@ -67,8 +107,58 @@ func (b *PtyBuffer) processWaveEscSeq(escSeq []byte) {
 	b.MessageCh <- escSeq
 }
 
+func (b *PtyBuffer) processShellEscSeq(outputPos int64) {
+	escData := b.EscSeqBuf[oscPrefixLen(b.ShellOSCNum):]
+	if b.EscMode == Mode_ShellEscST {
+		// remove the trailing ESC (from ESC \)
+		escData = escData[:len(escData)-1]
+	}
+	marker := ShellIntegrationMarker{
+		OSCNum: b.ShellOSCNum,
+		Data:   string(escData),
+		Pos:    outputPos,
+		Ts:     time.Now().UnixMilli(),
+	}
+	select {
+	case b.ShellCh <- marker:
+	default:
+		b.DroppedMarkers++
+		if b.DroppedMarkers == 1 {
+			log.Printf("shell integration channel full, dropping markers\n")
+		}
+	}
+}
+
+// returns the escape mode for the current EscSeqBuf (Mode_Normal if it cannot be a tracked OSC sequence)
+func (b *PtyBuffer) matchEscSeqPrefix() string {
+	escSeq := string(b.EscSeqBuf)
+	if strings.HasPrefix(b.OSCPrefix, escSeq) {
+		if len(escSeq) == len(b.OSCPrefix) {
+			return Mode_WaveEsc
+		}
+		return Mode_Esc
+	}
+	if b.ShellCh == nil {
+		return Mode_Normal
+	}
+	for _, oscNum := range ShellIntegrationOSCs {
+		shellPrefix := "\x1b]" + oscNum + ";"
+		if strings.HasPrefix(shellPrefix, escSeq) {
+			if len(escSeq) == len(shellPrefix) {
+				b.ShellOSCNum = oscNum
+				return Mode_ShellEsc
+			}
+			return Mode_Esc
+		}
+	}
+	return Mode_Normal
+}
+
 func (b *PtyBuffer) run() {
 	defer close(b.MessageCh)
+	if b.ShellCh != nil {
+		defer close(b.ShellCh)
+	}
 	buf := make([]byte, 4096)
 	for {
 		n, err := b.InputReader.Read(buf)
@@ -87,6 +177,33 @@ func (b *PtyBuffer) run() {
 func (b *PtyBuffer) processData(data []byte) {
 	outputBuf := make([]byte, 0, len(data))
 	for _, ch := range data {
+		if b.EscMode == Mode_ShellEsc || b.EscMode == Mode_ShellEscST {
+			// shell integration sequences are terminated by BEL or ESC \ (ST is not used since 0x9c can be part of a UTF-8 sequence)
+			// they are passed through to the output unchanged
+			if ch == BEL || (b.EscMode == Mode_ShellEscST && ch == '\\') {
+				b.processShellEscSeq(b.OutputPos + int64(len(outputBuf)))
+				b.EscMode = Mode_Normal
+				outputBuf = append(outputBuf, b.EscSeqBuf...)
+				outputBuf = append(outputBuf, ch)
+				b.EscSeqBuf = nil
+				continue
+			}
+			if b.EscMode == Mode_ShellEscST || len(b.EscSeqBuf) >= MaxShellEscSeqSize {
+				// invalid (or too long), pass it through without processing
+				b.EscMode = Mode_Normal
+				outputBuf = append(outputBuf, b.EscSeqBuf...)
+				outputBuf = append(outputBuf, ch)
+				b.EscSeqBuf = nil
+				continue
+			}
+			if ch == ESC {
+				b.EscMode = Mode_ShellEscST
+				b.EscSeqBuf = append(b.EscSeqBuf, ch)
+				continue
+			}
+			b.EscSeqBuf = append(b.EscSeqBuf, ch)
+			continue
+		}
 		if b.EscMode == Mode_WaveEsc {
 			if ch == ESC {
 				// terminates the escape sequence (and the rest was invalid)
@@ -114,19 +231,13 @@ func (b *PtyBuffer) processData(data []byte) {
 				b.EscSeqBuf = nil
 				continue
 			}
-			if ch != b.OSCPrefix[len(b.EscSeqBuf)] {
-				// this is not a Wave OSC sequence, just an escape sequence
-				b.EscMode = Mode_Normal
+			// we're still building what could be a Wave OSC (or shell integration) sequence
+			b.EscSeqBuf = append(b.EscSeqBuf, ch)
+			b.EscMode = b.matchEscSeqPrefix()
+			if b.EscMode == Mode_Normal {
+				// this is not a tracked OSC sequence, just an escape sequence
 				outputBuf = append(outputBuf, b.EscSeqBuf...)
-				outputBuf = append(outputBuf, ch)
 				b.EscSeqBuf = nil
-				continue
-			}
-			// we're still building what could be a Wave OSC sequence
-			b.EscSeqBuf = append(b.EscSeqBuf, ch)
-			// check to see if we have a full Wave OSC prefix
-			if len(b.EscSeqBuf) == len(b.OSCPrefix) {
-				b.EscMode = Mode_WaveEsc
 			}
 			continue
 		}
@@ -139,6 +250,7 @@ func (b *PtyBuffer) processData(data []byte) {
 		outputBuf = append(outputBuf, ch)
 	}
 	if len(outputBuf) > 0 {
+		b.OutputPos += int64(len(outputBuf))
 		b.writeData(outputBuf)
 	}
 }
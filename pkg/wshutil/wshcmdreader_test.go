@@ -0,0 +1,121 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshutil
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func makeTestPtyBuffer() *PtyBuffer {
+	return &PtyBuffer{
+		CVar:      sync.NewCond(&sync.Mutex{}),
+		DataBuf:   &bytes.Buffer{},
+		OSCPrefix: WaveOSCPrefix,
+		EscMode:   Mode_Normal,
+		MessageCh: make(chan []byte, 10),
+		ShellCh:   make(chan ShellIntegrationMarker, 10),
+	}
+}
+
+func drainMarkers(b *PtyBuffer) []ShellIntegrationMarker {
+	var rtn []ShellIntegrationMarker
+	for {
+		select {
+		case marker := <-b.ShellCh:
+			rtn = append(rtn, marker)
+		default:
+			return rtn
+		}
+	}
+}
+
+func TestPtyBufferShellEscSeq(t *testing.T) {
+	longSeq := "\x1b]133;" + strings.Repeat("x", MaxShellEscSeqSize+10) + "\x07"
+	tests := []struct {
+		Name    string
+		Chunks  []string
+		Output  string
+		Markers []ShellIntegrationMarker
+	}{
+		{
+			Name:    "bel",
+			Chunks:  []string{"a\x1b]133;A\x07b"},
+			Output:  "a\x1b]133;A\x07b",
+			Markers: []ShellIntegrationMarker{{OSCNum: "133", Data: "A", Pos: 1}},
+		},
+		{
+			Name:    "esc-backslash",
+			Chunks:  []string{"\x1b]7;file://host/tmp\x1b\\x"},
+			Output:  "\x1b]7;file://host/tmp\x1b\\x",
+			Markers: []ShellIntegrationMarker{{OSCNum: "7", Data: "file://host/tmp", Pos: 0}},
+		},
+		{
+			Name:   "esc-invalid",
+			Chunks: []string{"\x1b]133;A\x1bxy"},
+			Output: "\x1b]133;A\x1bxy",
+		},
+		{
+			Name:   "untracked",
+			Chunks: []string{"\x1b]0;title\x07\x1b[0m"},
+			Output: "\x1b]0;title\x07\x1b[0m",
+		},
+		{
+			Name:   "overflow",
+			Chunks: []string{longSeq},
+			Output: longSeq,
+		},
+		{
+			Name:    "split",
+			Chunks:  []string{"ab\x1b", "]1", "33;C;cmdline=ls", "\x1b", "\\", "cd"},
+			Output:  "ab\x1b]133;C;cmdline=ls\x1b\\cd",
+			Markers: []ShellIntegrationMarker{{OSCNum: "133", Data: "C;cmdline=ls", Pos: 2}},
+		},
+		{
+			Name:   "wave-interleaved",
+			Chunks: []string{"\x1b]133;A\x07$ ", WaveOSCPrefix + `{"command":"message"}` + "\x07", "\x1b]133;B\x07"},
+			Output: "\x1b]133;A\x07$ \x1b]133;B\x07",
+			Markers: []ShellIntegrationMarker{
+				{OSCNum: "133", Data: "A", Pos: 0},
+				{OSCNum: "133", Data: "B", Pos: 10},
+			},
+		},
+	}
+	for _, test := range tests {
+		b := makeTestPtyBuffer()
+		for _, chunk := range test.Chunks {
+			b.processData([]byte(chunk))
+		}
+		if output := b.DataBuf.String(); output != test.Output {
+			t.Errorf("%s: expected output %q, got %q", test.Name, test.Output, output)
+		}
+		markers := drainMarkers(b)
+		if len(markers) != len(test.Markers) {
+			t.Errorf("%s: expected %d markers, got %d", test.Name, len(test.Markers), len(markers))
+			continue
+		}
+		for idx, marker := range markers {
+			expected := test.Markers[idx]
+			if marker.OSCNum != expected.OSCNum || marker.Data != expected.Data || marker.Pos != expected.Pos {
+				t.Errorf("%s: marker %d expected %+v, got %+v", test.Name, idx, expected, marker)
+			}
+		}
+	}
+	b := makeTestPtyBuffer()
+	b.processData([]byte("x" + WaveOSCPrefix + `{"command":"message"}` + "\x07y"))
+	if b.DataBuf.String() != "xy" || len(b.MessageCh) != 1 || string(<-b.MessageCh) != `{"command":"message"}` {
+		t.Errorf("expected wave osc to be removed from the output and sent to the message channel")
+	}
+}
+
+func TestPtyBufferShellChFull(t *testing.T) {
+	b := makeTestPtyBuffer()
+	b.ShellCh = make(chan ShellIntegrationMarker, 1)
+	b.processData([]byte("\x1b]133;A\x07\x1b]133;B\x07\x1b]133;C\x07"))
+	if len(drainMarkers(b)) != 1 || b.DroppedMarkers != 2 {
+		t.Errorf("expected markers to be dropped (not block) when the channel is full, dropped=%d", b.DroppedMarkers)
+	}
+}
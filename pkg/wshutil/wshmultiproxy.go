@@ -65,7 +65,7 @@ func (p *WshRpcMultiProxy) removeRouteInfo(authToken string) {
 }
 
 func (p *WshRpcMultiProxy) sendResponseError(msg RpcMessage, sendErr error) {
-	if msg.ReqId == "" {
+	if msg.ReqId == "" || msg.Cancel {
 		// no response needed
 		return
 	}
@@ -141,6 +141,9 @@ func (p *WshRpcMultiProxy) handleUnauthMessage(msgBytes []byte) {
 		close(routeInfo.Proxy.FromRemoteCh)
 		return
 	}
+	if rebaseRemoteDeadline(&msg) {
+		msgBytes, _ = json.Marshal(msg)
+	}
 	routeInfo.Proxy.FromRemoteCh <- msgBytes
 }
 
@@ -18,6 +18,7 @@ type WshRpcProxy struct {
 	ToRemoteCh   chan []byte
 	FromRemoteCh chan []byte
 	AuthToken    string
+	ScopeCtx     *wshrpc.RpcContext // set for scoped clients, commands are checked against ScopeCtx.Scope
 }
 
 func MakeRpcProxy() *WshRpcProxy {
@@ -32,6 +33,9 @@ func (p *WshRpcProxy) SetRpcContext(rpcCtx *wshrpc.RpcContext) {
 	p.Lock.Lock()
 	defer p.Lock.Unlock()
 	p.RpcContext = rpcCtx
+	if rpcCtx != nil && rpcCtx.Scope != nil {
+		p.ScopeCtx = rpcCtx
+	}
 }
 
 func (p *WshRpcProxy) GetRpcContext() *wshrpc.RpcContext {
@@ -40,6 +44,18 @@ func (p *WshRpcProxy) GetRpcContext() *wshrpc.RpcContext {
 	return p.RpcContext
 }
 
+func (p *WshRpcProxy) SetScopeCtx(scopeCtx *wshrpc.RpcContext) {
+	p.Lock.Lock()
+	defer p.Lock.Unlock()
+	p.ScopeCtx = scopeCtx
+}
+
+func (p *WshRpcProxy) GetScopeCtx() *wshrpc.RpcContext {
+	p.Lock.Lock()
+	defer p.Lock.Unlock()
+	return p.ScopeCtx
+}
+
 func (p *WshRpcProxy) SetAuthToken(authToken string) {
 	p.Lock.Lock()
 	defer p.Lock.Unlock()
@@ -140,6 +156,12 @@ func (p *WshRpcProxy) HandleClientProxyAuth(router *WshRouter) (string, error) {
 			return "", respErr
 		}
 		p.SetAuthToken(authRtn.AuthToken)
+		// the token was just validated upstream, so its scope can be enforced here as well
+		if tokenStr, ok := origMsg.Data.(string); ok {
+			if rpcCtx, err := ExtractUnverifiedRpcContext(tokenStr); err == nil && rpcCtx.Scope != nil {
+				p.SetScopeCtx(rpcCtx)
+			}
+		}
 		announceMsg := RpcMessage{
 			Command:   wshrpc.Command_RouteAnnounce,
 			Source:    authRtn.RouteId,
@@ -190,31 +212,41 @@ func (p *WshRpcProxy) SendRpcMessage(msg []byte) {
 }
 
 func (p *WshRpcProxy) RecvRpcMessage() ([]byte, bool) {
-	msgBytes, more := <-p.FromRemoteCh
-	authToken := p.GetAuthToken()
-	if !more || (p.RpcContext == nil && authToken == "") {
-		return msgBytes, more
-	}
-	var msg RpcMessage
-	err := json.Unmarshal(msgBytes, &msg)
-	if err != nil {
-		// nothing to do here -- will error out at another level
-		return msgBytes, true
-	}
-	if p.RpcContext != nil {
-		msg.Data, err = recodeCommandData(msg.Command, msg.Data, p.RpcContext)
+	for {
+		msgBytes, more := <-p.FromRemoteCh
+		authToken := p.GetAuthToken()
+		scopeCtx := p.GetScopeCtx()
+		if !more || (p.RpcContext == nil && authToken == "" && scopeCtx == nil) {
+			return msgBytes, more
+		}
+		var msg RpcMessage
+		err := json.Unmarshal(msgBytes, &msg)
 		if err != nil {
 			// nothing to do here -- will error out at another level
 			return msgBytes, true
 		}
+		if scopeCtx != nil {
+			err = checkWshScope(scopeCtx, &msg)
+			if err != nil {
+				p.sendResponseError(msg, err)
+				continue
+			}
+		}
+		if p.RpcContext != nil {
+			msg.Data, err = recodeCommandData(msg.Command, msg.Data, p.RpcContext)
+			if err != nil {
+				// nothing to do here -- will error out at another level
+				return msgBytes, true
+			}
+		}
+		if msg.AuthToken == "" {
+			msg.AuthToken = authToken
+		}
+		newBytes, err := json.Marshal(msg)
+		if err != nil {
+			// nothing to do here
+			return msgBytes, true
+		}
+		return newBytes, true
 	}
-	if msg.AuthToken == "" {
-		msg.AuthToken = authToken
-	}
-	newBytes, err := json.Marshal(msg)
-	if err != nil {
-		// nothing to do here
-		return msgBytes, true
-	}
-	return newBytes, true
 }
@@ -24,6 +24,11 @@ const UpstreamRoute = "upstream"
 const SysRoute = "sys" // this route doesn't exist, just a placeholder for system messages
 const ElectronRoute = "electron"
 
+var errDeadlineExceeded = errors.New("EC-TIME: deadline exceeded")
+
+const RouteSweepInterval = time.Second
+const CancelGracePeriod = 5 * time.Second // how long to keep route info for a canceled rpc (waiting for its final response)
+
 // this works like a network switch
 
 // TODO maybe move the wps integration here instead of in wshserver
@@ -32,6 +37,10 @@ type routeInfo struct {
 	RpcId         string
 	SourceRouteId string
 	DestRouteId   string
+	Command       string
+	AuthToken     string
+	StartTs       time.Time
+	Deadline      time.Time
 }
 
 type msgAndRoute struct {
@@ -47,6 +56,7 @@ type WshRouter struct {
 	RpcMap           map[string]*routeInfo        // rpcid => routeinfo
 	SimpleRequestMap map[string]chan *RpcMessage  // simple reqid => response channel
 	InputCh          chan msgAndRoute
+	Tracer           *rpcTracer
 }
 
 func MakeConnectionRouteId(connId string) string {
@@ -79,8 +89,10 @@ func NewWshRouter() *WshRouter {
 		RpcMap:           make(map[string]*routeInfo),
 		SimpleRequestMap: make(map[string]chan *RpcMessage),
 		InputCh:          make(chan msgAndRoute, DefaultInputChSize),
+		Tracer:           makeRpcTracer(),
 	}
 	go rtn.runServer()
+	go rtn.runSweeper()
 	return rtn
 }
 
@@ -107,6 +119,7 @@ func (router *WshRouter) SendEvent(routeId string, event wps.WaveEvent) {
 		// nothing to do
 		return
 	}
+	router.traceMessage(&msg, msgAndRoute{msgBytes: msgBytes, fromRouteId: SysRoute}, nil, "")
 	rpc.SendRpcMessage(msgBytes)
 }
 
@@ -132,13 +145,52 @@ func (router *WshRouter) handleNoRoute(msg RpcMessage) {
 	router.sendRoutedMessage(respBytes, msg.Source)
 }
 
-func (router *WshRouter) registerRouteInfo(rpcId string, sourceRouteId string, destRouteId string) {
-	if rpcId == "" {
+func (router *WshRouter) handleDeadlineExceeded(msg RpcMessage) {
+	if msg.ReqId == "" {
+		return
+	}
+	response := RpcMessage{
+		ResId:     msg.ReqId,
+		Error:     errDeadlineExceeded.Error(),
+		AuthToken: msg.AuthToken,
+	}
+	respBytes, _ := json.Marshal(response)
+	router.sendRoutedMessage(respBytes, msg.Source)
+}
+
+func (router *WshRouter) registerRouteInfo(msg *RpcMessage, destRouteId string, now time.Time) {
+	if msg.ReqId == "" {
 		return
 	}
 	router.Lock.Lock()
 	defer router.Lock.Unlock()
-	router.RpcMap[rpcId] = &routeInfo{RpcId: rpcId, SourceRouteId: sourceRouteId, DestRouteId: destRouteId}
+	info := &routeInfo{
+		RpcId:         msg.ReqId,
+		SourceRouteId: msg.Source,
+		DestRouteId:   destRouteId,
+		Command:       msg.Command,
+		AuthToken:     msg.AuthToken,
+		StartTs:       now,
+	}
+	// requests without a deadline or timeout (some frontend calls) are never expired by the router
+	if msg.Deadline > 0 || msg.Timeout > 0 {
+		info.Deadline = msg.GetDeadline(now)
+	}
+	router.RpcMap[msg.ReqId] = info
+}
+
+// after a cancel we only wait a short time for the final response
+func (router *WshRouter) setRouteInfoCanceled(rpcId string) {
+	router.Lock.Lock()
+	defer router.Lock.Unlock()
+	info := router.RpcMap[rpcId]
+	if info == nil {
+		return
+	}
+	graceDeadline := time.Now().Add(CancelGracePeriod)
+	if info.Deadline.IsZero() || graceDeadline.Before(info.Deadline) {
+		info.Deadline = graceDeadline
+	}
 }
 
 func (router *WshRouter) unregisterRouteInfo(rpcId string) {
@@ -216,21 +268,31 @@ func (router *WshRouter) runServer() {
 		}
 		routeId := msg.Route
 		if msg.Command == wshrpc.Command_RouteAnnounce {
+			router.traceMessage(&msg, input, nil, "")
 			router.handleAnnounceMessage(msg, input)
 			continue
 		}
 		if msg.Command == wshrpc.Command_RouteUnannounce {
+			router.traceMessage(&msg, input, nil, "")
 			router.handleUnannounceMessage(msg)
 			continue
 		}
 		if msg.Command != "" {
 			// new comand, setup new rpc
+			now := time.Now()
+			if msg.Deadline > 0 && !msg.GetDeadline(now).After(now) {
+				router.traceMessage(&msg, input, nil, "deadline exceeded")
+				router.handleDeadlineExceeded(msg)
+				continue
+			}
 			ok := router.sendRoutedMessage(msgBytes, routeId)
 			if !ok {
+				router.traceMessage(&msg, input, nil, noRouteErr(routeId).Error())
 				router.handleNoRoute(msg)
 				continue
 			}
-			router.registerRouteInfo(msg.ReqId, msg.Source, routeId)
+			router.traceMessage(&msg, input, nil, "")
+			router.registerRouteInfo(&msg, routeId, now)
 			continue
 		}
 		// look at reqid or resid to route correctly
@@ -238,10 +300,15 @@ func (router *WshRouter) runServer() {
 			routeInfo := router.getRouteInfo(msg.ReqId)
 			if routeInfo == nil {
 				// no route info, nothing to do
+				router.traceMessage(&msg, input, nil, "no route info for request")
 				continue
 			}
+			router.traceMessage(&msg, input, routeInfo, "")
 			// no need to check the return value here (noop if failed)
 			router.sendRoutedMessage(msgBytes, routeInfo.DestRouteId)
+			if msg.Cancel {
+				router.setRouteInfoCanceled(msg.ReqId)
+			}
 			continue
 		} else if msg.ResId != "" {
 			ok := router.trySimpleResponse(&msg)
@@ -251,8 +318,10 @@ func (router *WshRouter) runServer() {
 			routeInfo := router.getRouteInfo(msg.ResId)
 			if routeInfo == nil {
 				// no route info, nothing to do
+				router.traceMessage(&msg, input, nil, "no route info for response")
 				continue
 			}
+			router.traceMessage(&msg, input, routeInfo, "")
 			router.sendRoutedMessage(msgBytes, routeInfo.SourceRouteId)
 			if !msg.Cont {
 				router.unregisterRouteInfo(msg.ResId)
@@ -265,6 +334,44 @@ func (router *WshRouter) runServer() {
 	}
 }
 
+// removes route info for rpcs that are past their deadline (the destination gets a cancel, the source gets an error)
+func (router *WshRouter) sweepExpiredRouteInfo(now time.Time) {
+	var expired []*routeInfo
+	router.Lock.Lock()
+	for rpcId, info := range router.RpcMap {
+		if !info.Deadline.IsZero() && info.Deadline.Before(now) {
+			expired = append(expired, info)
+			delete(router.RpcMap, rpcId)
+		}
+	}
+	router.Lock.Unlock()
+	for _, info := range expired {
+		router.sendCancel(info)
+		router.sendRouteInfoError(info, errDeadlineExceeded)
+	}
+}
+
+func (router *WshRouter) runSweeper() {
+	defer panichandler.PanicHandler("WshRouter:runSweeper")
+	ticker := time.NewTicker(RouteSweepInterval)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		router.sweepExpiredRouteInfo(now)
+	}
+}
+
+func (router *WshRouter) sendCancel(info *routeInfo) {
+	cancelMsg := RpcMessage{Cancel: true, ReqId: info.RpcId, AuthToken: info.AuthToken}
+	cancelBytes, _ := json.Marshal(cancelMsg)
+	router.sendRoutedMessage(cancelBytes, info.DestRouteId)
+}
+
+func (router *WshRouter) sendRouteInfoError(info *routeInfo, err error) {
+	response := RpcMessage{ResId: info.RpcId, Error: err.Error(), AuthToken: info.AuthToken}
+	respBytes, _ := json.Marshal(response)
+	router.sendRoutedMessage(respBytes, info.SourceRouteId)
+}
+
 func (router *WshRouter) WaitForRegister(ctx context.Context, routeId string) error {
 	for {
 		if router.GetRpc(routeId) != nil {
@@ -322,6 +429,10 @@ func (router *WshRouter) RegisterRoute(routeId string, rpc AbstractRpcClient, sh
 				if rpcMsg.Route == "" {
 					rpcMsg.Route = DefaultRoute
 				}
+				if rpcMsg.Deadline == 0 && rpcMsg.Timeout > 0 {
+					// older clients only send a timeout
+					rpcMsg.Deadline = time.Now().Add(time.Duration(rpcMsg.Timeout) * time.Millisecond).UnixMilli()
+				}
 				msgBytes, err = json.Marshal(rpcMsg)
 				if err != nil {
 					continue
@@ -332,17 +443,42 @@ func (router *WshRouter) RegisterRoute(routeId string, rpc AbstractRpcClient, sh
 	}()
 }
 
-func (router *WshRouter) UnregisterRoute(routeId string) {
-	log.Printf("[router] unregistering wsh route %q\n", routeId)
+// removes the route (and the routes announced through it), returns the route info for the in-flight rpcs that used them
+func (router *WshRouter) removeRoute(routeId string) ([]*routeInfo, []*routeInfo) {
 	router.Lock.Lock()
 	defer router.Lock.Unlock()
 	delete(router.RouteMap, routeId)
+	goneRoutes := map[string]bool{routeId: true}
 	// clear out announced routes
-	for routeId, localRouteId := range router.AnnouncedRoutes {
+	for announcedRouteId, localRouteId := range router.AnnouncedRoutes {
 		if localRouteId == routeId {
-			delete(router.AnnouncedRoutes, routeId)
+			goneRoutes[announcedRouteId] = true
+			delete(router.AnnouncedRoutes, announcedRouteId)
+		}
+	}
+	var fromGone, toGone []*routeInfo
+	for rpcId, info := range router.RpcMap {
+		if goneRoutes[info.SourceRouteId] {
+			fromGone = append(fromGone, info)
+			delete(router.RpcMap, rpcId)
+		} else if goneRoutes[info.DestRouteId] {
+			toGone = append(toGone, info)
+			delete(router.RpcMap, rpcId)
 		}
 	}
+	return fromGone, toGone
+}
+
+func (router *WshRouter) UnregisterRoute(routeId string) {
+	log.Printf("[router] unregistering wsh route %q\n", routeId)
+	fromGone, toGone := router.removeRoute(routeId)
+	// nobody is waiting for these anymore (stops long running streams when the requestor goes away)
+	for _, info := range fromGone {
+		router.sendCancel(info)
+	}
+	for _, info := range toGone {
+		router.sendRouteInfoError(info, fmt.Errorf("route %q is gone", info.DestRouteId))
+	}
 	go func() {
 		defer panichandler.PanicHandler("WshRouter:unregisterRoute:routegone")
 		wps.Broker.UnsubscribeAll(routeId)
@@ -421,7 +557,7 @@ func (router *WshRouter) RunSimpleRawCommand(ctx context.Context, msg RpcMessage
 		return nil, ctx.Err()
 	case resp := <-respCh:
 		if resp.Error != "" {
-			return nil, errors.New(resp.Error)
+			return nil, wshrpc.MakeRemoteError(resp.Error)
 		}
 		return resp, nil
 	}
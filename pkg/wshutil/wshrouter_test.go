@@ -0,0 +1,157 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshutil
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wavetermdev/waveterm/pkg/filestore"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+func recvTestMsg(t *testing.T, proxy *WshRpcProxy) RpcMessage {
+	t.Helper()
+	select {
+	case msgBytes := <-proxy.ToRemoteCh:
+		var msg RpcMessage
+		if err := json.Unmarshal(msgBytes, &msg); err != nil {
+			t.Fatalf("error unmarshaling: %v", err)
+		}
+		return msg
+	case <-time.After(2 * time.Second):
+		t.Fatalf("timeout waiting for message")
+		return RpcMessage{}
+	}
+}
+
+func sendTestMsg(proxy *WshRpcProxy, msg RpcMessage) {
+	msgBytes, _ := json.Marshal(msg)
+	proxy.FromRemoteCh <- msgBytes
+}
+
+func TestRouterDeadlineAndCancel(t *testing.T) {
+	router := NewWshRouter()
+	srcProxy := MakeRpcProxy()
+	destProxy := MakeRpcProxy()
+	router.RegisterRoute("src", srcProxy, false)
+	router.RegisterRoute("dest", destProxy, false)
+
+	// the source goes away, the destination gets a cancel
+	sendTestMsg(srcProxy, RpcMessage{Command: "test", ReqId: "req-1", Route: "dest", Timeout: 60000})
+	if msg := recvTestMsg(t, destProxy); msg.ReqId != "req-1" || msg.Source != "src" || msg.Deadline == 0 {
+		t.Fatalf("unexpected command: %#v", msg)
+	}
+	router.UnregisterRoute("src")
+	if msg := recvTestMsg(t, destProxy); !msg.Cancel || msg.ReqId != "req-1" {
+		t.Fatalf("expected cancel, got %#v", msg)
+	}
+
+	// expired route info, the destination gets a cancel and the source gets an error
+	router.RegisterRoute("src", srcProxy, false)
+	sendTestMsg(srcProxy, RpcMessage{Command: "test", ReqId: "req-2", Route: "dest", Timeout: 60000})
+	recvTestMsg(t, destProxy)
+	router.sweepExpiredRouteInfo(time.Now().Add(2 * time.Minute))
+	if msg := recvTestMsg(t, destProxy); !msg.Cancel || msg.ReqId != "req-2" {
+		t.Fatalf("expected cancel, got %#v", msg)
+	}
+	if msg := recvTestMsg(t, srcProxy); msg.ResId != "req-2" || !strings.HasPrefix(msg.Error, "EC-TIME") {
+		t.Fatalf("expected deadline error, got %#v", msg)
+	}
+
+	// commands past their deadline are not forwarded
+	sendTestMsg(srcProxy, RpcMessage{Command: "test", ReqId: "req-3", Route: "dest", Timeout: 60000, Deadline: time.Now().Add(-time.Second).UnixMilli()})
+	if msg := recvTestMsg(t, srcProxy); msg.ResId != "req-3" || !strings.HasPrefix(msg.Error, "EC-TIME") {
+		t.Fatalf("expected deadline error, got %#v", msg)
+	}
+	if router.getRouteInfo("req-3") != nil {
+		t.Errorf("expected no route info for expired command")
+	}
+}
+
+func recvTraceEntry(t *testing.T, ch chan wshrpc.RespOrErrorUnion[wshrpc.RpcTraceEntry]) wshrpc.RpcTraceEntry {
+	t.Helper()
+	select {
+	case resp := <-ch:
+		return resp.Response
+	case <-time.After(2 * time.Second):
+		t.Fatalf("timeout waiting for trace entry")
+		return wshrpc.RpcTraceEntry{}
+	}
+}
+
+func TestRpcTrace(t *testing.T) {
+	router := NewWshRouter()
+	srcProxy := MakeRpcProxy()
+	destProxy := MakeRpcProxy()
+	router.RegisterRoute("src", srcProxy, false)
+	router.RegisterRoute("dest", destProxy, false)
+	ctx, cancelFn := context.WithCancel(context.Background())
+	defer cancelFn()
+	allCh := router.StreamRpcTrace(ctx, wshrpc.CommandRpcTraceData{})
+	testCh := router.StreamRpcTrace(ctx, wshrpc.CommandRpcTraceData{Command: "test"})
+	otherCh := router.StreamRpcTrace(ctx, wshrpc.CommandRpcTraceData{Route: "other"})
+
+	// the trace stream's own messages are not traced
+	sendTestMsg(srcProxy, RpcMessage{Command: wshrpc.Command_RpcTrace, ReqId: "req-0", Route: "dest"})
+	recvTestMsg(t, destProxy)
+	sendTestMsg(srcProxy, RpcMessage{Command: "test", ReqId: "req-1", Route: "dest"})
+	recvTestMsg(t, destProxy)
+	time.Sleep(2 * time.Millisecond)
+	sendTestMsg(destProxy, RpcMessage{ResId: "req-1", Data: "ok"})
+	recvTestMsg(t, srcProxy)
+	for _, ch := range []chan wshrpc.RespOrErrorUnion[wshrpc.RpcTraceEntry]{allCh, testCh} {
+		if entry := recvTraceEntry(t, ch); entry.Command != "test" || entry.ReqId != "req-1" || entry.Route != "dest" || entry.FromRoute != "src" {
+			t.Errorf("unexpected request entry %#v", entry)
+		}
+		// responses get the command and latency from the route info
+		if entry := recvTraceEntry(t, ch); entry.Command != "test" || entry.ResId != "req-1" || entry.FromRoute != "dest" || entry.LatencyUs < 1000 {
+			t.Errorf("unexpected response entry %#v", entry)
+		}
+	}
+	select {
+	case resp := <-otherCh:
+		t.Errorf("expected no entries for the other route, got %#v", resp.Response)
+	default:
+	}
+
+	// ring buffer wraparound (oldest first) and dropped entries for watches that fall behind
+	tracer := makeRpcTracer()
+	_, watch, unwatch := tracer.watch(wshrpc.CommandRpcTraceData{})
+	defer unwatch()
+	numEntries := RpcTraceBufferSize + 5
+	for idx := 0; idx < numEntries; idx++ {
+		tracer.record(&wshrpc.RpcTraceEntry{Command: "test", ReqId: fmt.Sprintf("req-%d", idx)})
+	}
+	history := tracer.getHistory_nolock(wshrpc.CommandRpcTraceData{})
+	if len(history) != RpcTraceBufferSize || history[0].ReqId != "req-5" || history[len(history)-1].ReqId != fmt.Sprintf("req-%d", numEntries-1) {
+		t.Fatalf("unexpected history: %d entries, first %s", len(history), history[0].ReqId)
+	}
+	if watch.Dropped != numEntries-rpcTraceWatchChSize {
+		t.Errorf("expected %d dropped entries, got %d", numEntries-rpcTraceWatchChSize, watch.Dropped)
+	}
+	for len(watch.Ch) > 0 {
+		<-watch.Ch
+	}
+	tracer.record(&wshrpc.RpcTraceEntry{Command: "test", ReqId: "req-last"})
+	if entry := <-watch.Ch; entry.ReqId != "req-last" || entry.Dropped != numEntries-rpcTraceWatchChSize || watch.Dropped != 0 {
+		t.Errorf("expected the dropped count on the next entry, got %#v (dropped %d)", entry, watch.Dropped)
+	}
+}
+
+func TestRemoteError(t *testing.T) {
+	quotaErr := fmt.Errorf("error appending: %w", fmt.Errorf("%w: zone z1", filestore.ErrQuotaExceeded))
+	remoteErr := wshrpc.MakeRemoteError(quotaErr.Error())
+	if !errors.Is(remoteErr, filestore.ErrQuotaExceeded) || remoteErr.Error() != quotaErr.Error() {
+		t.Errorf("expected the quota sentinel to be restored, got %v", remoteErr)
+	}
+	if errors.Is(wshrpc.MakeRemoteError("storage quota exceeded"), filestore.ErrQuotaExceeded) {
+		t.Errorf("expected plain messages not to match the sentinel")
+	}
+}
@@ -4,6 +4,7 @@
 package wshutil
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
@@ -111,6 +112,7 @@ type RpcMessage struct {
 	ReqId     string `json:"reqid,omitempty"`
 	ResId     string `json:"resid,omitempty"`
 	Timeout   int    `json:"timeout,omitempty"`
+	Deadline  int64  `json:"deadline,omitempty"`  // absolute deadline for commands (unix ms), enforced by every router hop
 	Route     string `json:"route,omitempty"`     // to route/forward requests to alternate servers
 	AuthToken string `json:"authtoken,omitempty"` // needed for routing unauthenticated requests (WshRpcMultiProxy)
 	Source    string `json:"source,omitempty"`    // source route id
@@ -125,6 +127,22 @@ func (r *RpcMessage) IsRpcRequest() bool {
 	return r.Command != "" || r.ReqId != ""
 }
 
+// returns the effective deadline for a command (the earlier of the deadline and the timeout, uses the default timeout if neither is set)
+func (r *RpcMessage) GetDeadline(now time.Time) time.Time {
+	timeoutMs := r.Timeout
+	if timeoutMs <= 0 {
+		timeoutMs = DefaultTimeoutMs
+	}
+	deadline := now.Add(time.Duration(timeoutMs) * time.Millisecond)
+	if r.Deadline > 0 {
+		msgDeadline := time.UnixMilli(r.Deadline)
+		if msgDeadline.Before(deadline) {
+			deadline = msgDeadline
+		}
+	}
+	return deadline
+}
+
 func (r *RpcMessage) Validate() error {
 	if r.ReqId != "" && r.ResId != "" {
 		return fmt.Errorf("request packets may not have both reqid and resid set")
@@ -160,6 +178,9 @@ func (r *RpcMessage) Validate() error {
 		if r.Timeout != 0 {
 			return fmt.Errorf("non-command request packets may not have timeout set")
 		}
+		if r.Deadline != 0 {
+			return fmt.Errorf("non-command request packets may not have deadline set")
+		}
 		return nil
 	}
 	if r.ResId != "" {
@@ -172,11 +193,47 @@ func (r *RpcMessage) Validate() error {
 		if r.Timeout != 0 {
 			return fmt.Errorf("response packets may not have timeout set")
 		}
+		if r.Deadline != 0 {
+			return fmt.Errorf("response packets may not have deadline set")
+		}
 		return nil
 	}
 	return fmt.Errorf("invalid packet: must have command, reqid, or resid set")
 }
 
+// the clocks on the two sides of a remote connection can differ, so deadlines that come from the remote side
+// are rebased on the request timeout (this loses the time the request spent in transit)
+// returns true if msg was changed
+func rebaseRemoteDeadline(msg *RpcMessage) bool {
+	if msg.Command == "" || msg.Deadline == 0 {
+		return false
+	}
+	msg.Deadline = 0
+	if msg.Timeout > 0 {
+		msg.Deadline = time.Now().Add(time.Duration(msg.Timeout) * time.Millisecond).UnixMilli()
+	}
+	return true
+}
+
+// rebaseRemoteDeadline for raw messages (returns the original bytes if nothing changed)
+func RebaseRemoteDeadline(msgBytes []byte) []byte {
+	if !bytes.Contains(msgBytes, []byte(`"deadline":`)) {
+		return msgBytes
+	}
+	var msg RpcMessage
+	if err := json.Unmarshal(msgBytes, &msg); err != nil {
+		return msgBytes
+	}
+	if !rebaseRemoteDeadline(&msg) {
+		return msgBytes
+	}
+	newBytes, err := json.Marshal(msg)
+	if err != nil {
+		return msgBytes
+	}
+	return newBytes
+}
+
 type rpcData struct {
 	ResCh chan *RpcMessage
 	Ctx   context.Context
@@ -238,6 +295,18 @@ func (w *WshRpc) GetAuthToken() string {
 	return w.AuthToken
 }
 
+// waits (up to timeout) for the queued messages to be taken off OutputCh by the output writer, returns false on timeout
+func (w *WshRpc) WaitForOutputDrain(timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for len(w.OutputCh) > 0 {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return true
+}
+
 func (w *WshRpc) registerResponseHandler(reqId string, handler *RpcResponseHandler) {
 	w.Lock.Lock()
 	defer w.Lock.Unlock()
@@ -259,8 +328,12 @@ func (w *WshRpc) cancelRequest(reqId string) {
 	handler := w.ResponseHandlerMap[reqId]
 	if handler != nil {
 		handler.canceled.Store(true)
+		// cancel the context so streaming handlers stop (the final response is still sent by Finalize)
+		cancelFn := handler.contextCancelFn.Load()
+		if cancelFn != nil && *cancelFn != nil {
+			(*cancelFn)()
+		}
 	}
-
 }
 
 func (w *WshRpc) handleRequest(req *RpcMessage) {
@@ -281,11 +354,7 @@ func (w *WshRpc) handleRequest(req *RpcMessage) {
 	}
 
 	var respHandler *RpcResponseHandler
-	timeoutMs := req.Timeout
-	if timeoutMs <= 0 {
-		timeoutMs = DefaultTimeoutMs
-	}
-	ctx, cancelFn := context.WithTimeout(context.Background(), time.Duration(timeoutMs)*time.Millisecond)
+	ctx, cancelFn := context.WithDeadline(context.Background(), req.GetDeadline(time.Now()))
 	ctx = withWshRpcContext(ctx, w)
 	respHandler = &RpcResponseHandler{
 		w:               w,
@@ -497,7 +566,7 @@ func (handler *RpcRequestHandler) NextResponse() (any, error) {
 		return nil, errors.New("response channel closed")
 	}
 	if resp.Error != "" {
-		return nil, errors.New(resp.Error)
+		return nil, wshrpc.MakeRemoteError(resp.Error)
 	}
 	return resp.Data, nil
 }
@@ -656,6 +725,7 @@ func (w *WshRpc) SendComplexRequest(command string, data any, opts *wshrpc.RpcOp
 		ReqId:     handler.reqId,
 		Data:      data,
 		Timeout:   timeoutMs,
+		Deadline:  time.Now().Add(time.Duration(timeoutMs) * time.Millisecond).UnixMilli(),
 		Route:     opts.Route,
 		AuthToken: w.GetAuthToken(),
 	}
@@ -7,6 +7,9 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"sync/atomic"
+
+	"github.com/wavetermdev/waveterm/pkg/util/packetparser"
 )
 
 // special I/O wrappers for wshrpc
@@ -55,14 +58,54 @@ func StreamToLines(input io.Reader, lineFn func([]byte)) error {
 	}
 }
 
-func AdaptStreamToMsgCh(input io.Reader, output chan []byte) error {
-	return StreamToLines(input, func(line []byte) {
+// binary frame negotiation for a stream connection (see packetparser.BinFrameHello)
+// the client sends a hello when it connects, the server answers with its own hello (before its next message)
+// frames are only written once the peer's hello has been read
+type StreamBinFrames struct {
+	IsClient  bool
+	PeerHello *atomic.Bool
+	SentHello *atomic.Bool
+}
+
+func MakeStreamBinFrames(isClient bool) *StreamBinFrames {
+	return &StreamBinFrames{IsClient: isClient, PeerHello: &atomic.Bool{}, SentHello: &atomic.Bool{}}
+}
+
+// binFrames can be nil (plain json lines)
+func AdaptStreamToMsgCh(input io.Reader, output chan []byte, binFrames *StreamBinFrames) error {
+	if binFrames == nil {
+		return StreamToLines(input, func(line []byte) {
+			output <- line
+		})
+	}
+	return packetparser.ReadBinFrameStream(input, maxLineLength, func() {
+		binFrames.PeerHello.Store(true)
+	}, func(line []byte) {
 		output <- line
 	})
 }
 
-func AdaptOutputChToStream(outputCh chan []byte, output io.Writer) error {
+// binFrames can be nil (plain json lines)
+func AdaptOutputChToStream(outputCh chan []byte, output io.Writer, binFrames *StreamBinFrames) error {
+	if binFrames != nil && binFrames.IsClient {
+		if err := packetparser.WriteBinFrameHello(output); err != nil {
+			return fmt.Errorf("error writing hello to output (AdaptOutputChToStream): %w", err)
+		}
+		binFrames.SentHello.Store(true)
+	}
 	for msg := range outputCh {
+		if binFrames != nil && binFrames.PeerHello.Load() {
+			if !binFrames.SentHello.Load() {
+				if err := packetparser.WriteBinFrameHello(output); err != nil {
+					return fmt.Errorf("error writing hello to output (AdaptOutputChToStream): %w", err)
+				}
+				binFrames.SentHello.Store(true)
+			}
+			if err := packetparser.WriteBinFrameMsg(output, msg); err != nil {
+				return fmt.Errorf("error writing to output (AdaptOutputChToStream): %w", err)
+			}
+			continue
+		}
 		if _, err := output.Write(msg); err != nil {
 			return fmt.Errorf("error writing to output (AdaptOutputChToStream): %w", err)
 		}
@@ -0,0 +1,266 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshutil
+
+// enforces wsh scopes (see wshrpc.WshScope) for commands coming from scoped clients
+// the check runs on the raw command data before the rpc context is filled in, so empty ids (which become the
+// client's own block/tab) are always allowed
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/wavetermdev/waveterm/pkg/util/utilfn"
+	"github.com/wavetermdev/waveterm/pkg/waveobj"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+const scopeMaxDataDepth = 4
+
+// returns the tab that a block belongs to (set by wavesrv)
+// when nil (in the connserver) tab-scoped clients can only target their own block and tab
+var ScopeBlockTabResolver func(blockId string) (string, error)
+
+// commands that read across all blocks unless they are given a block or tab
+var scopeTargetRequiredCommands = map[string]bool{
+	wshrpc.Command_HistorySearch:    true,
+	wshrpc.Command_SearchBlockFiles: true,
+}
+
+// commands where the data is just a block id
+var scopeBlockIdCommands = map[string]bool{
+	wshrpc.Command_BlockInfo:      true,
+	wshrpc.Command_FocusBlock:     true,
+	wshrpc.Command_ControllerStop: true,
+}
+
+// commands whose event scopes are targets (scoped clients must name scopes in their target, not all scopes)
+var scopeEventCommands = map[string]bool{
+	wshrpc.Command_EventSub:         true,
+	wshrpc.Command_EventReadHistory: true,
+}
+
+type scopeTargetRef struct {
+	Key   string
+	OType string
+	OID   string
+}
+
+// msg.Data is replaced with its canonical encoding (see canonicalScopeData), so the data that is
+// forwarded is exactly the data that was checked
+func checkWshScope(rpcCtx *wshrpc.RpcContext, msg *RpcMessage) error {
+	scope := rpcCtx.Scope
+	if scope == nil || msg.Command == "" {
+		return nil
+	}
+	group := wshrpc.GetCommandGroup(msg.Command)
+	if !scope.AllowsGroup(group) {
+		return fmt.Errorf("wsh scope does not allow %q (%s command)", msg.Command, group)
+	}
+	data, err := canonicalScopeData(msg.Command, msg.Data)
+	if err != nil {
+		return fmt.Errorf("wsh scope does not allow %q: invalid command data: %w", msg.Command, err)
+	}
+	msg.Data = data
+	if msg.Command == wshrpc.Command_SetMeta {
+		if err := checkScopedSetMeta(msg.Data); err != nil {
+			return err
+		}
+	}
+	if scope.Target == wshrpc.ScopeTarget_Any {
+		return nil
+	}
+	if scopeEventCommands[msg.Command] {
+		if err := checkScopedEventScopes(rpcCtx, scope.Target, msg.Data); err != nil {
+			return fmt.Errorf("wsh scope does not allow %q: %w", msg.Command, err)
+		}
+		return nil
+	}
+	var refs []scopeTargetRef
+	if blockId, ok := msg.Data.(string); ok && scopeBlockIdCommands[msg.Command] {
+		refs = append(refs, scopeTargetRef{Key: "blockid", OType: waveobj.OType_Block, OID: blockId})
+	} else {
+		refs = collectScopeTargets(msg.Data, refs, 0)
+	}
+	if len(refs) == 0 && scopeTargetRequiredCommands[msg.Command] {
+		return fmt.Errorf("wsh scope requires %q to be limited to a block", msg.Command)
+	}
+	for _, ref := range refs {
+		if err := checkScopeTarget(rpcCtx, scope.Target, ref); err != nil {
+			return fmt.Errorf("wsh scope does not allow %q: %w", msg.Command, err)
+		}
+	}
+	return nil
+}
+
+// decodes the data into the command's data type (the same way the server will) and re-encodes it.
+// encoding/json matches field names case-insensitively, so without this {"ZoneId": ...} would
+// reach the server as the zoneid but never be seen by the (exact key) checks below.
+func canonicalScopeData(command string, data any) (any, error) {
+	methodDecl := WshCommandDeclMap[command]
+	if methodDecl == nil || methodDecl.CommandDataType == nil || data == nil {
+		return data, nil
+	}
+	typedData := reflect.New(methodDecl.CommandDataType)
+	err := utilfn.ReUnmarshal(typedData.Interface(), data)
+	if err != nil {
+		return nil, err
+	}
+	var rtn any
+	err = utilfn.ReUnmarshal(&rtn, typedData.Interface())
+	if err != nil {
+		return nil, err
+	}
+	return rtn, nil
+}
+
+// scoped clients cannot change their own (or any other) block's command, scope, or controller
+// (the whole cmd namespace is denied, since the cmd keys control what runs in the block and with which scope)
+func checkScopedSetMeta(data any) error {
+	dataMap, ok := data.(map[string]any)
+	if !ok {
+		return nil
+	}
+	meta, ok := dataMap["meta"].(map[string]any)
+	if !ok {
+		return nil
+	}
+	for key := range meta {
+		if key == waveobj.MetaKey_Cmd || strings.HasPrefix(key, waveobj.MetaKey_Cmd+":") || key == waveobj.MetaKey_Controller {
+			return fmt.Errorf("wsh scope does not allow setting %q", key)
+		}
+	}
+	return nil
+}
+
+// every scope must be given (no AllScopes or empty scopes), oref scopes must be in the target
+// star scopes over objects and unparseable orefs are denied, other scopes (like connection names) are allowed
+func checkScopedEventScopes(rpcCtx *wshrpc.RpcContext, target string, data any) error {
+	dataMap, _ := data.(map[string]any)
+	if allScopes, _ := dataMap["allscopes"].(bool); allScopes {
+		return fmt.Errorf("subscribing to all scopes is not allowed")
+	}
+	var scopes []string
+	if scopeStr, ok := dataMap["scope"].(string); ok {
+		scopes = append(scopes, scopeStr)
+	}
+	if scopeVals, ok := dataMap["scopes"].([]any); ok {
+		for _, scopeVal := range scopeVals {
+			scopeStr, _ := scopeVal.(string)
+			scopes = append(scopes, scopeStr)
+		}
+	}
+	if len(scopes) == 0 {
+		return fmt.Errorf("event scopes are required")
+	}
+	for _, scopeStr := range scopes {
+		if scopeStr == "" {
+			return fmt.Errorf("event scopes are required")
+		}
+		oref, err := waveobj.ParseORef(scopeStr)
+		if err == nil {
+			if err := checkScopeTarget(rpcCtx, target, scopeTargetRef{Key: "scope", OType: oref.OType, OID: oref.OID}); err != nil {
+				return err
+			}
+			continue
+		}
+		otype, _, _ := strings.Cut(scopeStr, ":")
+		if strings.Contains(scopeStr, "*") || waveobj.ValidOTypes[otype] {
+			return fmt.Errorf("scope %q is not in the scope's %s", scopeStr, target)
+		}
+	}
+	return nil
+}
+
+func collectScopeTargets(data any, refs []scopeTargetRef, depth int) []scopeTargetRef {
+	dataMap, ok := data.(map[string]any)
+	if !ok || depth > scopeMaxDataDepth {
+		return refs
+	}
+	for key, val := range dataMap {
+		switch key {
+		case "blockid", "parentblockid", "zoneid":
+			if id, ok := val.(string); ok && id != "" {
+				refs = append(refs, scopeTargetRef{Key: key, OType: waveobj.OType_Block, OID: id})
+			}
+		case "tabid":
+			if id, ok := val.(string); ok && id != "" {
+				refs = append(refs, scopeTargetRef{Key: key, OType: waveobj.OType_Tab, OID: id})
+			}
+		case "workspaceid":
+			if id, ok := val.(string); ok && id != "" {
+				refs = append(refs, scopeTargetRef{Key: key, OType: waveobj.OType_Workspace, OID: id})
+			}
+		case "blockids":
+			if ids, ok := val.([]any); ok {
+				for _, idVal := range ids {
+					if id, ok := idVal.(string); ok && id != "" {
+						refs = append(refs, scopeTargetRef{Key: key, OType: waveobj.OType_Block, OID: id})
+					}
+				}
+			}
+		case "oref":
+			if orefStr, ok := val.(string); ok && orefStr != "" {
+				refs = append(refs, makeORefTarget(key, orefStr))
+			}
+		case "scope":
+			// event scopes are only targets when they are orefs
+			if scopeStr, ok := val.(string); ok {
+				if oref, err := waveobj.ParseORef(scopeStr); err == nil {
+					refs = append(refs, scopeTargetRef{Key: key, OType: oref.OType, OID: oref.OID})
+				}
+			}
+		case "scopes":
+			if scopes, ok := val.([]any); ok {
+				for _, scopeVal := range scopes {
+					scopeStr, _ := scopeVal.(string)
+					if oref, err := waveobj.ParseORef(scopeStr); err == nil {
+						refs = append(refs, scopeTargetRef{Key: key, OType: oref.OType, OID: oref.OID})
+					}
+				}
+			}
+		default:
+			refs = collectScopeTargets(val, refs, depth+1)
+		}
+	}
+	return refs
+}
+
+func makeORefTarget(key string, orefStr string) scopeTargetRef {
+	oref, err := waveobj.ParseORef(orefStr)
+	if err != nil {
+		// unparseable orefs are denied (they will also fail in the command)
+		return scopeTargetRef{Key: key, OType: "invalid", OID: orefStr}
+	}
+	return scopeTargetRef{Key: key, OType: oref.OType, OID: oref.OID}
+}
+
+func checkScopeTarget(rpcCtx *wshrpc.RpcContext, target string, ref scopeTargetRef) error {
+	switch ref.OType {
+	case waveobj.OType_Block:
+		if ref.OID == rpcCtx.BlockId {
+			return nil
+		}
+		if target == wshrpc.ScopeTarget_Tab {
+			// zone ids can also be tab ids (tab files)
+			if ref.OID == rpcCtx.TabId && rpcCtx.TabId != "" {
+				return nil
+			}
+			if ScopeBlockTabResolver != nil {
+				tabId, err := ScopeBlockTabResolver(ref.OID)
+				if err == nil && tabId != "" && tabId == rpcCtx.TabId {
+					return nil
+				}
+			}
+		}
+		return fmt.Errorf("%s %s is not in the scope's %s", ref.Key, ref.OID, target)
+	case waveobj.OType_Tab:
+		if target == wshrpc.ScopeTarget_Tab && ref.OID == rpcCtx.TabId && rpcCtx.TabId != "" {
+			return nil
+		}
+		return fmt.Errorf("%s %s is not in the scope's %s", ref.Key, ref.OID, target)
+	}
+	return fmt.Errorf("%s %s is not in the scope's %s", ref.Key, ref.OType+":"+ref.OID, target)
+}
@@ -0,0 +1,103 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshutil
+
+import (
+	"testing"
+
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+func TestCommandGroups(t *testing.T) {
+	for command := range wshrpc.CommandGroups {
+		if WshCommandDeclMap[command] == nil {
+			t.Errorf("command group listed for unknown command %q", command)
+		}
+	}
+}
+
+const (
+	testBlockId1     = "a5e2c5a6-2a4e-4c0e-8a5e-7c6b1f2d0001"
+	testBlockId2     = "a5e2c5a6-2a4e-4c0e-8a5e-7c6b1f2d0002" // in the same tab
+	testBlockId3     = "a5e2c5a6-2a4e-4c0e-8a5e-7c6b1f2d0003" // in another tab
+	testWorkspaceId1 = "a5e2c5a6-2a4e-4c0e-8a5e-7c6b1f2d0004"
+)
+
+func TestCheckWshScope(t *testing.T) {
+	ScopeBlockTabResolver = func(blockId string) (string, error) {
+		if blockId == testBlockId2 {
+			return "tab-1", nil
+		}
+		return "tab-2", nil
+	}
+	defer func() { ScopeBlockTabResolver = nil }()
+	readonly, _ := wshrpc.ParseWshScope("readonly")
+	blockScope, _ := wshrpc.ParseWshScope("block")
+	tabScope, _ := wshrpc.ParseWshScope("tab")
+	tests := []struct {
+		Name    string
+		Scope   *wshrpc.WshScope
+		Command string
+		Data    any
+		Allowed bool
+	}{
+		{"unscoped", nil, wshrpc.Command_SetConfig, map[string]any{}, true},
+		{"base", readonly, wshrpc.Command_RouteAnnounce, nil, true},
+		{"read own block", readonly, wshrpc.Command_GetMeta, map[string]any{"oref": "block:" + testBlockId1}, true},
+		{"read context block", readonly, wshrpc.Command_GetMeta, map[string]any{}, true},
+		{"read block in tab", readonly, wshrpc.Command_GetMeta, map[string]any{"oref": "block:" + testBlockId2}, true},
+		{"read block in other tab", readonly, wshrpc.Command_GetMeta, map[string]any{"oref": "block:" + testBlockId3}, false},
+		{"read workspace", readonly, wshrpc.Command_GetMeta, map[string]any{"oref": "workspace:" + testWorkspaceId1}, false},
+		{"write readonly", readonly, wshrpc.Command_SetMeta, map[string]any{"oref": "block:" + testBlockId1}, false},
+		{"block info string", readonly, wshrpc.Command_BlockInfo, testBlockId3, false},
+		{"search all blocks", readonly, wshrpc.Command_HistorySearch, map[string]any{"query": "ls"}, false},
+		{"write own block", blockScope, wshrpc.Command_FileWrite, map[string]any{"zoneid": testBlockId1, "filename": "term"}, true},
+		{"write block in tab", blockScope, wshrpc.Command_FileWrite, map[string]any{"zoneid": testBlockId2, "filename": "term"}, false},
+		{"read mixed case key", readonly, wshrpc.Command_FileRead, map[string]any{"ZoneId": testBlockId3, "filename": "term"}, false},
+		{"write mixed case key", blockScope, wshrpc.Command_FileWrite, map[string]any{"ZONEID": testBlockId2, "filename": "term"}, false},
+		{"sub mixed case key", readonly, wshrpc.Command_EventSub, map[string]any{"event": "controllerstatus", "AllScopes": true}, false},
+		{"set scope", blockScope, wshrpc.Command_SetMeta, map[string]any{"meta": map[string]any{"cmd:wshscope": nil}}, false},
+		{"set cmd", blockScope, wshrpc.Command_SetMeta, map[string]any{"meta": map[string]any{"cmd": "rm -rf ~"}}, false},
+		{"set controller", blockScope, wshrpc.Command_SetMeta, map[string]any{"meta": map[string]any{"controller": "cmd"}}, false},
+		{"set sibling cmd", tabScope, wshrpc.Command_SetMeta, map[string]any{"oref": "block:" + testBlockId2, "meta": map[string]any{"cmd:args": []any{"x"}}}, false},
+		{"set sibling title", tabScope, wshrpc.Command_SetMeta, map[string]any{"oref": "block:" + testBlockId2, "meta": map[string]any{"frame:title": "x"}}, true},
+		{"sub own block", readonly, wshrpc.Command_EventSub, map[string]any{"event": "controllerstatus", "scopes": []any{"block:" + testBlockId1}}, true},
+		{"sub block in other tab", readonly, wshrpc.Command_EventSub, map[string]any{"event": "controllerstatus", "scopes": []any{"block:" + testBlockId3}}, false},
+		{"sub all scopes", readonly, wshrpc.Command_EventSub, map[string]any{"event": "controllerstatus", "allscopes": true}, false},
+		{"sub no scopes", readonly, wshrpc.Command_EventSub, map[string]any{"event": "controllerstatus"}, false},
+		{"sub star scope", readonly, wshrpc.Command_EventSub, map[string]any{"event": "controllerstatus", "scopes": []any{"block:*"}}, false},
+		{"sub connection", readonly, wshrpc.Command_EventSub, map[string]any{"event": "sysinfo", "scopes": []any{"local"}}, true},
+		{"history all scopes", readonly, wshrpc.Command_EventReadHistory, map[string]any{"event": "connchange", "scope": ""}, false},
+		{"history own block", readonly, wshrpc.Command_EventReadHistory, map[string]any{"event": "controllerstatus", "scope": "block:" + testBlockId1}, true},
+		{"create block", blockScope, wshrpc.Command_CreateBlock, map[string]any{}, false},
+		{"admin", blockScope, wshrpc.Command_RpcTrace, map[string]any{}, false},
+	}
+	for _, test := range tests {
+		rpcCtx := &wshrpc.RpcContext{BlockId: testBlockId1, TabId: "tab-1", Scope: test.Scope}
+		err := checkWshScope(rpcCtx, &RpcMessage{Command: test.Command, ReqId: "req", Data: test.Data})
+		if (err == nil) != test.Allowed {
+			t.Errorf("%s: expected allowed=%v, got err=%v", test.Name, test.Allowed, err)
+		}
+	}
+
+	// the checked (canonical) data is what gets forwarded
+	msg := &RpcMessage{Command: wshrpc.Command_FileRead, ReqId: "req", Data: map[string]any{"ZoneId": testBlockId1, "FileName": "term"}}
+	rpcCtx := &wshrpc.RpcContext{BlockId: testBlockId1, TabId: "tab-1", Scope: readonly}
+	if err := checkWshScope(rpcCtx, msg); err != nil {
+		t.Fatalf("expected own block to be allowed, got %v", err)
+	}
+	if dataMap, _ := msg.Data.(map[string]any); dataMap["zoneid"] != testBlockId1 || dataMap["filename"] != "term" || dataMap["ZoneId"] != nil {
+		t.Errorf("expected canonical data to be forwarded, got %v", msg.Data)
+	}
+
+	// without a resolver (connserver) only the client's own block and tab can be targeted
+	ScopeBlockTabResolver = nil
+	rpcCtx = &wshrpc.RpcContext{BlockId: testBlockId1, TabId: "tab-1", Scope: tabScope}
+	if err := checkWshScope(rpcCtx, &RpcMessage{Command: wshrpc.Command_GetMeta, ReqId: "req", Data: map[string]any{"oref": "block:" + testBlockId2}}); err == nil {
+		t.Errorf("expected sibling block to be denied without a resolver")
+	}
+	if err := checkWshScope(rpcCtx, &RpcMessage{Command: wshrpc.Command_GetMeta, ReqId: "req", Data: map[string]any{"oref": "block:" + testBlockId1}}); err != nil {
+		t.Errorf("expected own block to be allowed without a resolver, got %v", err)
+	}
+}
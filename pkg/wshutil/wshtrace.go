@@ -0,0 +1,210 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshutil
+
+// opt-in rpc tracing for WshRouter
+// messages are only recorded while a trace is being streamed (RpcTraceCommand) or when the tracer is set to always on
+// entries go into a fixed size ring buffer, and are sent to the active trace streams
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wavetermdev/waveterm/pkg/panichandler"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+const RpcTraceBufferSize = 2000
+const rpcTraceWatchChSize = 1000
+
+type rpcTraceWatch struct {
+	Data    wshrpc.CommandRpcTraceData
+	Ch      chan *wshrpc.RpcTraceEntry
+	Dropped int
+}
+
+type rpcTracer struct {
+	Lock     *sync.Mutex
+	Name     string
+	AlwaysOn bool
+	Enabled  *atomic.Bool
+	Buf      []*wshrpc.RpcTraceEntry // ring buffer, Pos is the next write
+	Pos      int
+	Watches  map[string]*rpcTraceWatch
+}
+
+func makeRpcTracer() *rpcTracer {
+	return &rpcTracer{
+		Lock:    &sync.Mutex{},
+		Enabled: &atomic.Bool{},
+		Buf:     make([]*wshrpc.RpcTraceEntry, 0, RpcTraceBufferSize),
+		Watches: make(map[string]*rpcTraceWatch),
+	}
+}
+
+func (t *rpcTracer) updateEnabled_nolock() {
+	t.Enabled.Store(t.AlwaysOn || len(t.Watches) > 0)
+}
+
+// the name identifies the router in trace entries (e.g. "wavesrv" or "connserver:user@host")
+func (router *WshRouter) SetTraceName(name string) {
+	router.Tracer.Lock.Lock()
+	defer router.Tracer.Lock.Unlock()
+	router.Tracer.Name = name
+}
+
+// when always on, messages are recorded even if no trace is being streamed (so the history can be read later)
+func (router *WshRouter) SetTraceAlwaysOn(alwaysOn bool) {
+	router.Tracer.Lock.Lock()
+	defer router.Tracer.Lock.Unlock()
+	router.Tracer.AlwaysOn = alwaysOn
+	router.Tracer.updateEnabled_nolock()
+}
+
+func traceEntryMatches(data wshrpc.CommandRpcTraceData, entry *wshrpc.RpcTraceEntry) bool {
+	if data.Command != "" && entry.Command != data.Command {
+		return false
+	}
+	if data.Route != "" && entry.Route != data.Route && entry.Source != data.Route && entry.FromRoute != data.Route {
+		return false
+	}
+	return true
+}
+
+func (t *rpcTracer) record(entry *wshrpc.RpcTraceEntry) {
+	t.Lock.Lock()
+	defer t.Lock.Unlock()
+	entry.Router = t.Name
+	if len(t.Buf) < RpcTraceBufferSize {
+		t.Buf = append(t.Buf, entry)
+	} else {
+		t.Buf[t.Pos] = entry
+	}
+	t.Pos = (t.Pos + 1) % RpcTraceBufferSize
+	for _, watch := range t.Watches {
+		if !traceEntryMatches(watch.Data, entry) {
+			continue
+		}
+		sendEntry := entry
+		if watch.Dropped > 0 {
+			entryCopy := *entry
+			entryCopy.Dropped = watch.Dropped
+			sendEntry = &entryCopy
+		}
+		select {
+		case watch.Ch <- sendEntry:
+			watch.Dropped = 0
+		default:
+			watch.Dropped++
+		}
+	}
+}
+
+// returns the buffered entries (oldest first)
+func (t *rpcTracer) getHistory_nolock(data wshrpc.CommandRpcTraceData) []*wshrpc.RpcTraceEntry {
+	var rtn []*wshrpc.RpcTraceEntry
+	start := 0
+	if len(t.Buf) == RpcTraceBufferSize {
+		start = t.Pos
+	}
+	for idx := 0; idx < len(t.Buf); idx++ {
+		entry := t.Buf[(start+idx)%len(t.Buf)]
+		if traceEntryMatches(data, entry) {
+			rtn = append(rtn, entry)
+		}
+	}
+	return rtn
+}
+
+func (t *rpcTracer) watch(data wshrpc.CommandRpcTraceData) ([]*wshrpc.RpcTraceEntry, *rpcTraceWatch, func()) {
+	t.Lock.Lock()
+	defer t.Lock.Unlock()
+	var history []*wshrpc.RpcTraceEntry
+	if data.History {
+		history = t.getHistory_nolock(data)
+	}
+	id := uuid.New().String()
+	watch := &rpcTraceWatch{Data: data, Ch: make(chan *wshrpc.RpcTraceEntry, rpcTraceWatchChSize)}
+	t.Watches[id] = watch
+	t.updateEnabled_nolock()
+	return history, watch, func() {
+		t.Lock.Lock()
+		defer t.Lock.Unlock()
+		delete(t.Watches, id)
+		t.updateEnabled_nolock()
+	}
+}
+
+// route info is used to fill in the command and latency for messages that are not requests
+func (router *WshRouter) traceMessage(msg *RpcMessage, input msgAndRoute, info *routeInfo, errStr string) {
+	if !router.Tracer.Enabled.Load() {
+		return
+	}
+	entry := &wshrpc.RpcTraceEntry{
+		Ts:        time.Now().UnixMilli(),
+		Command:   msg.Command,
+		ReqId:     msg.ReqId,
+		ResId:     msg.ResId,
+		Source:    msg.Source,
+		Route:     msg.Route,
+		FromRoute: input.fromRouteId,
+		Size:      len(input.msgBytes),
+		Cont:      msg.Cont,
+		Error:     msg.Error,
+	}
+	if errStr != "" {
+		entry.Error = errStr
+	}
+	if info != nil {
+		if entry.Command == "" {
+			entry.Command = info.Command
+		}
+		if msg.ResId != "" && !info.StartTs.IsZero() {
+			entry.LatencyUs = time.Since(info.StartTs).Microseconds()
+		}
+	}
+	if entry.Command == wshrpc.Command_RpcTrace {
+		// tracing the trace stream would feed back into itself
+		return
+	}
+	router.Tracer.record(entry)
+}
+
+// streams trace entries until ctx is done
+func (router *WshRouter) StreamRpcTrace(ctx context.Context, data wshrpc.CommandRpcTraceData) chan wshrpc.RespOrErrorUnion[wshrpc.RpcTraceEntry] {
+	rtn := make(chan wshrpc.RespOrErrorUnion[wshrpc.RpcTraceEntry], rpcTraceWatchChSize)
+	history, watch, unwatch := router.Tracer.watch(data)
+	go func() {
+		defer panichandler.PanicHandler("WshRouter:StreamRpcTrace")
+		defer close(rtn)
+		defer unwatch()
+		send := func(entry *wshrpc.RpcTraceEntry) bool {
+			select {
+			case rtn <- wshrpc.RespOrErrorUnion[wshrpc.RpcTraceEntry]{Response: *entry}:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+		for _, entry := range history {
+			if !send(entry) {
+				return
+			}
+		}
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case entry := <-watch.Ch:
+				if !send(entry) {
+					return
+				}
+			}
+		}
+	}()
+	return rtn
+}
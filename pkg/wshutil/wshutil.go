@@ -21,6 +21,7 @@ import (
 	"github.com/google/uuid"
 	"github.com/wavetermdev/waveterm/pkg/panichandler"
 	"github.com/wavetermdev/waveterm/pkg/util/packetparser"
+	"github.com/wavetermdev/waveterm/pkg/util/utilfn"
 	"github.com/wavetermdev/waveterm/pkg/wavebase"
 	"github.com/wavetermdev/waveterm/pkg/wshrpc"
 	"golang.org/x/term"
@@ -233,9 +234,10 @@ func SetupConnRpcClient(conn net.Conn, serverImpl ServerImpl) (*WshRpc, chan err
 	inputCh := make(chan []byte, DefaultInputChSize)
 	outputCh := make(chan []byte, DefaultOutputChSize)
 	writeErrCh := make(chan error, 1)
+	binFrames := MakeStreamBinFrames(true)
 	go func() {
 		defer panichandler.PanicHandler("SetupConnRpcClient:AdaptOutputChToStream")
-		writeErr := AdaptOutputChToStream(outputCh, conn)
+		writeErr := AdaptOutputChToStream(outputCh, conn, binFrames)
 		if writeErr != nil {
 			writeErrCh <- writeErr
 			close(writeErrCh)
@@ -245,7 +247,7 @@ func SetupConnRpcClient(conn net.Conn, serverImpl ServerImpl) (*WshRpc, chan err
 		defer panichandler.PanicHandler("SetupConnRpcClient:AdaptStreamToMsgCh")
 		// when input is closed, close the connection
 		defer conn.Close()
-		AdaptStreamToMsgCh(conn, inputCh)
+		AdaptStreamToMsgCh(conn, inputCh, binFrames)
 	}()
 	rtn := MakeWshRpc(inputCh, outputCh, wshrpc.RpcContext{}, serverImpl)
 	return rtn, writeErrCh, nil
@@ -298,6 +300,9 @@ func MakeClientJWTToken(rpcCtx wshrpc.RpcContext, sockName string) (string, erro
 	if rpcCtx.ClientType != "" {
 		claims["ctype"] = rpcCtx.ClientType
 	}
+	if rpcCtx.Scope != nil {
+		claims["wshscope"] = rpcCtx.Scope
+	}
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	tokenStr, err := token.SignedString([]byte(wavebase.JwtSecret))
 	if err != nil {
@@ -359,6 +364,14 @@ func mapClaimsToRpcContext(claims jwt.MapClaims) *wshrpc.RpcContext {
 			rpcCtx.ClientType = ctype
 		}
 	}
+	if claims["wshscope"] != nil {
+		var scope wshrpc.WshScope
+		if err := utilfn.ReUnmarshal(&scope, claims["wshscope"]); err != nil {
+			// an invalid scope allows nothing (it must not fall back to unrestricted)
+			scope = wshrpc.WshScope{Target: wshrpc.ScopeTarget_Block}
+		}
+		rpcCtx.Scope = &scope
+	}
 	return rpcCtx
 }
 
@@ -444,9 +457,10 @@ func HandleStdIOClient(logName string, input io.Reader, output io.Writer) {
 func handleDomainSocketClient(conn net.Conn) {
 	var routeIdContainer atomic.Pointer[string]
 	proxy := MakeRpcProxy()
+	binFrames := MakeStreamBinFrames(false)
 	go func() {
 		defer panichandler.PanicHandler("handleDomainSocketClient:AdaptOutputChToStream")
-		writeErr := AdaptOutputChToStream(proxy.ToRemoteCh, conn)
+		writeErr := AdaptOutputChToStream(proxy.ToRemoteCh, conn, binFrames)
 		if writeErr != nil {
 			log.Printf("error writing to domain socket: %v\n", writeErr)
 		}
@@ -461,7 +475,7 @@ func handleDomainSocketClient(conn net.Conn) {
 				DefaultRouter.UnregisterRoute(*routeIdPtr)
 			}
 		}()
-		AdaptStreamToMsgCh(conn, proxy.FromRemoteCh)
+		AdaptStreamToMsgCh(conn, proxy.FromRemoteCh, binFrames)
 	}()
 	rpcCtx, err := proxy.HandleAuthentication()
 	if err != nil {
@@ -17,6 +17,7 @@ import (
 	"time"
 
 	"github.com/wavetermdev/waveterm/pkg/panichandler"
+	"github.com/wavetermdev/waveterm/pkg/util/utilfn"
 )
 
 func DetectShell(ctx context.Context, client *Distro) (string, error) {
@@ -292,6 +293,12 @@ func GetHomeDir(ctx context.Context, client *Distro) string {
 	return "~"
 }
 
+func DirExists(ctx context.Context, client *Distro, dirPath string) bool {
+	cmd := client.WslCommand(ctx, "test -d "+utilfn.ShellQuote(dirPath, false, -1))
+	_, err := cmd.Output()
+	return err == nil
+}
+
 func IsPowershell(shellPath string) bool {
 	// get the base path, and then check contains
 	shellBase := filepath.Base(shellPath)
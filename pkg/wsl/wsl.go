@@ -104,7 +104,8 @@ func (conn *WslConn) FireConnChangeEvent() {
 		Scopes: []string{
 			fmt.Sprintf("connection:%s", conn.GetName()),
 		},
-		Data: status,
+		Data:    status,
+		Persist: wps.ConnChangePersist,
 	}
 	log.Printf("sending event: %+#v", event)
 	wps.Broker.Publish(event)